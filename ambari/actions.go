@@ -16,10 +16,14 @@ package ambari
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
+	"time"
 )
 
 // ListAgents get all the registered hosts
@@ -55,6 +59,20 @@ func (a AmbariRegistry) ListHostComponents(param string, useHost bool) []HostCom
 	return ambariItems.ConvertResponse().HostComponents
 }
 
+// ListAllHostComponents get all installed host components of the cluster
+func (a AmbariRegistry) ListAllHostComponents() []HostComponent {
+	request := a.CreateGetRequest("host_components?fields=HostRoles/component_name,HostRoles/state,HostRoles/host_name", true)
+	ambariItems := ProcessAmbariItems(request)
+	return ambariItems.ConvertResponse().HostComponents
+}
+
+// ListHostComponentsWithConfigState get all installed host components of the cluster with their services and stale config flags
+func (a AmbariRegistry) ListHostComponentsWithConfigState() []HostComponent {
+	request := a.CreateGetRequest("host_components?fields=HostRoles/component_name,HostRoles/service_name,HostRoles/state,HostRoles/host_name,HostRoles/stale_configs", true)
+	ambariItems := ProcessAmbariItems(request)
+	return ambariItems.ConvertResponse().HostComponents
+}
+
 //ListHostComponentsByService get all installed host components by service name
 func (a AmbariRegistry) ListHostComponentsByService(service string) []HostComponent {
 	request := a.CreateGetRequest("host_components?fields=HostRoles/component_name,HostRoles/state,HostRoles/host_name&component/ServiceComponentInfo/service_name="+service, true)
@@ -62,6 +80,13 @@ func (a AmbariRegistry) ListHostComponentsByService(service string) []HostCompon
 	return ambariItems.ConvertResponse().HostComponents
 }
 
+// ListHostComponentVersions get the installed versions of a component on all hosts
+func (a AmbariRegistry) ListHostComponentVersions(component string) []HostComponent {
+	request := a.CreateGetRequest("host_components?fields=HostRoles/component_name,HostRoles/state,HostRoles/host_name,HostRoles/version&HostRoles/component_name="+component, true)
+	ambariItems := ProcessAmbariItems(request)
+	return ambariItems.ConvertResponse().HostComponents
+}
+
 // ListServiceConfigVersions gather service configuration details
 func (a AmbariRegistry) ListServiceConfigVersions() []ServiceConfig {
 	request := a.CreateGetRequest("configurations/service_config_versions?fields=service_name&is_current=true", true)
@@ -69,6 +94,33 @@ func (a AmbariRegistry) ListServiceConfigVersions() []ServiceConfig {
 	return ambariItems.ConvertResponse().ServiceConfigs
 }
 
+// GetClusters list the names of the clusters that are managed by the ambari server
+func (a AmbariRegistry) GetClusters() ([]string, error) {
+	request := a.CreateGetRequest("clusters", false)
+	bodyBytes := ProcessRequest(request)
+	var clustersResponse ClustersResponse
+	if err := json.Unmarshal(bodyBytes, &clustersResponse); err != nil {
+		return nil, err
+	}
+	clusters := make([]string, 0)
+	for _, item := range clustersResponse.Items {
+		clusters = append(clusters, item.Cluster.ClusterName)
+	}
+	return clusters, nil
+}
+
+// SelectCluster set the target cluster of the ambari server entry, returns error if the entry pins a different cluster
+func (a AmbariRegistry) SelectCluster(cluster string) (AmbariRegistry, error) {
+	if len(cluster) == 0 || a.Cluster == cluster {
+		return a, nil
+	}
+	if len(a.Cluster) > 0 {
+		return a, fmt.Errorf("Ambari server entry '%s' is pinned to cluster '%s', cannot select cluster '%s'", a.Name, a.Cluster, cluster)
+	}
+	a.Cluster = cluster
+	return a, nil
+}
+
 // GetClusterInfo obtain cluster detauls for ambari managed cluster
 func (a AmbariRegistry) GetClusterInfo() Cluster {
 	request := a.CreateGetRequest("?fields=Clusters/cluster_name,Clusters/version,Clusters/total_hosts,Clusters/security_type", true)
@@ -96,16 +148,144 @@ func (a AmbariRegistry) GetStackDefaultConfigs(stack string, version string) map
 	return ambariItems.ConvertResponse().StackConfigs
 }
 
-// SetConfig sets a config value for a specific config key of a config type
-func (a AmbariRegistry) SetConfig(configType string, configKey string, configValue string) {
+// SetConfig sets a config value for a specific config key of a config type, the note (optional) is added to the version note of the new config version
+func (a AmbariRegistry) SetConfig(configType string, configKey string, configValue string, note string) {
+	versionNote := configVersionNote(note, fmt.Sprintf("Update config key: %s", configKey))
+	a.runConfigsScript(fmt.Sprintf("--action set -c %s -k %s -v %s", configType, configKey, configValue), versionNote)
+}
+
+// configVersionNote create the version note of a config change (the default note is used if there is no note)
+func configVersionNote(note string, defaultNote string) string {
+	if len(note) == 0 {
+		note = defaultNote
+	}
+	return fmt.Sprintf("AMBARICTL - %s", note)
+}
+
+// DeleteConfig removes a config key from a config type (a new config version is created without it),
+// deleting a key that does not exist does nothing
+func (a AmbariRegistry) DeleteConfig(configType string, configKey string, note string) error {
+	if _, err := a.GetConfig(configType, configKey); err != nil {
+		outPrintln(fmt.Sprintf("Nothing to delete: %v", err))
+		return nil
+	}
+	versionNote := configVersionNote(note, fmt.Sprintf("Delete config key: %s", configKey))
+	responses := a.runConfigsScript(fmt.Sprintf("--action delete -c %s -k %s", configType, configKey), versionNote)
+	if failedHosts := GetFailedHosts(responses); len(failedHosts) > 0 {
+		return fmt.Errorf("Deleting config key '%s' from '%s' failed", configKey, configType)
+	}
+	return nil
+}
+
+// runConfigsScript runs the configs.py script of the ambari server (that reads the current config version and creates a new one with the changes)
+func (a AmbariRegistry) runConfigsScript(actionArgs string, versionNote string) map[string]RemoteResponse {
 	filter := Filter{}
 	filter.Server = true
 	filteredHosts := a.GetFilteredHosts(filter)
-	versionNote := fmt.Sprintf("AMBARICTL - Update config key: %s", configKey)
-	command := fmt.Sprintf("/var/lib/ambari-server/resources/scripts/configs.py --action set -c %s -k %s -v %s "+
-		"-u %s -p %s --host=%s --cluster=%s --protocol=%s -b '%s'", configType, configKey, configValue, a.Username, a.Password,
-		a.Hostname, a.Cluster, a.Protocol, versionNote)
-	a.RunRemoteHostCommand(command, filteredHosts, filter.Server)
+	command := fmt.Sprintf("/var/lib/ambari-server/resources/scripts/configs.py %s "+
+		"-u %s -p %s --host=%s --cluster=%s --protocol=%s -b '%s'", actionArgs, a.Username, a.Password,
+		a.Hostname, a.Cluster, a.Protocol, strings.Replace(versionNote, "'", `'\''`, -1))
+	return a.RunRemoteHostCommand(command, filteredHosts, filter.Server)
+}
+
+// GetConfig gets the value of a config key from the current (desired) version of a config type
+func (a AmbariRegistry) GetConfig(configType string, configKey string) (string, error) {
+	config, err := a.getDesiredConfig(configType)
+	if err != nil {
+		return "", err
+	}
+	if value, ok := config.Properties[configKey]; ok {
+		return value, nil
+	}
+	return "", fmt.Errorf("Config key '%s' does not exist in config type '%s'", configKey, configType)
+}
+
+// SetConfigs sets multiple config values of a config type at once (only one new config version is created),
+// the note and the tag of the new config version are optional (a timestamp based tag is generated if there is no tag)
+func (a AmbariRegistry) SetConfigs(configType string, configs map[string]string, note string, tag string) error {
+	config, err := a.getDesiredConfig(configType)
+	if err != nil {
+		return err
+	}
+	if len(tag) == 0 {
+		tag = fmt.Sprintf("version%d", time.Now().UnixNano()/int64(time.Millisecond))
+	} else if a.configVersionExists(configType, tag) {
+		return fmt.Errorf("Config version with tag '%s' already exists for config type '%s'", tag, configType)
+	}
+	if config.Properties == nil {
+		config.Properties = make(map[string]string)
+	}
+	configKeys := make([]string, 0)
+	for configKey, configValue := range configs {
+		config.Properties[configKey] = configValue
+		configKeys = append(configKeys, configKey)
+	}
+	sort.Strings(configKeys)
+	desiredConfig := map[string]interface{}{
+		"type":                        configType,
+		"tag":                         tag,
+		"properties":                  config.Properties,
+		"service_config_version_note": configVersionNote(note, fmt.Sprintf("Update config keys: %s", strings.Join(configKeys, ", "))),
+	}
+	if len(config.PropertiesAttributes) > 0 {
+		desiredConfig["properties_attributes"] = config.PropertiesAttributes
+	}
+	body, err := json.Marshal(map[string]interface{}{"Clusters": map[string]interface{}{"desired_config": desiredConfig}})
+	if err != nil {
+		return err
+	}
+	var bodyBytes bytes.Buffer
+	bodyBytes.Write(body)
+	ProcessRequest(a.CreatePutRequest(bodyBytes, "", true))
+	return nil
+}
+
+// configVersionExists reports whether a config type has a version with the tag
+func (a AmbariRegistry) configVersionExists(configType string, tag string) bool {
+	var configResponse struct {
+		Items []desiredConfig `json:"items"`
+	}
+	request := a.CreateGetRequest(fmt.Sprintf("configurations?type=%s&tag=%s", configType, tag), true)
+	if err := json.Unmarshal(ProcessRequest(request), &configResponse); err != nil {
+		return false
+	}
+	return len(configResponse.Items) > 0
+}
+
+type desiredConfig struct {
+	Tag                  string                       `json:"tag"`
+	Properties           map[string]string            `json:"properties"`
+	PropertiesAttributes map[string]map[string]string `json:"properties_attributes"`
+}
+
+// getDesiredConfig gets the current (desired) version of a config type
+func (a AmbariRegistry) getDesiredConfig(configType string) (desiredConfig, error) {
+	var clusterResponse struct {
+		Clusters struct {
+			DesiredConfigs map[string]struct {
+				Tag string `json:"tag"`
+			} `json:"desired_configs"`
+		} `json:"Clusters"`
+	}
+	request := a.CreateGetRequest("?fields=Clusters/desired_configs/"+configType, true)
+	if err := json.Unmarshal(ProcessRequest(request), &clusterResponse); err != nil {
+		return desiredConfig{}, err
+	}
+	desired, ok := clusterResponse.Clusters.DesiredConfigs[configType]
+	if !ok {
+		return desiredConfig{}, fmt.Errorf("Config type '%s' does not exist", configType)
+	}
+	var configResponse struct {
+		Items []desiredConfig `json:"items"`
+	}
+	request = a.CreateGetRequest(fmt.Sprintf("configurations?type=%s&tag=%s", configType, desired.Tag), true)
+	if err := json.Unmarshal(ProcessRequest(request), &configResponse); err != nil {
+		return desiredConfig{}, err
+	}
+	if len(configResponse.Items) == 0 {
+		return desiredConfig{}, fmt.Errorf("Config type '%s' with tag '%s' does not exist", configType, desired.Tag)
+	}
+	return configResponse.Items[0], nil
 }
 
 // RunAmbariServiceCommand start / stop / restart Ambari services or components
@@ -120,7 +300,7 @@ func (a AmbariRegistry) RunAmbariServiceCommand(command string, filter Filter, u
 	} else if command == "SERVICE_CHECK" {
 		a.checkService(filter)
 	} else {
-		fmt.Println("Only START/STOP/RESTART/SERVICE_CHECK operations are supported.")
+		errPrintln("Only START/STOP/RESTART/SERVICE_CHECK operations are supported.")
 		os.Exit(1)
 	}
 }
@@ -157,19 +337,19 @@ func (a AmbariRegistry) RestartService(service string) {
 
 // StartComponent start an ambari component of a service
 func (a AmbariRegistry) StartComponent(component string) []byte {
-	request := a.componentOperation(component, "START", fmt.Sprintf("Start component (%s) by ambarictl", component))
+	request := a.componentOperation(component, "START", fmt.Sprintf("Start component (%s) by ambarictl", component), nil)
 	return ProcessRequest(request)
 }
 
 // StopComponent stop an ambari component of a service
 func (a AmbariRegistry) StopComponent(component string) []byte {
-	request := a.componentOperation(component, "STOP", fmt.Sprintf("Stop component (%s) by ambarictl", component))
+	request := a.componentOperation(component, "STOP", fmt.Sprintf("Stop component (%s) by ambarictl", component), nil)
 	return ProcessRequest(request)
 }
 
 // RestartComponent restarts an ambari component of a service
 func (a AmbariRegistry) RestartComponent(component string) []byte {
-	request := a.componentOperation(component, "RESTART", fmt.Sprintf("Restart component (%s) by ambarictl", component))
+	request := a.componentOperation(component, "RESTART", fmt.Sprintf("Restart component (%s) by ambarictl", component), nil)
 	return ProcessRequest(request)
 }
 
@@ -183,6 +363,19 @@ func getServiceNameForComponent(searchComponent string, components []Component)
 	return result
 }
 
+// SetHostMaintenanceMode turn on or turn off maintenance mode of a host (by ambari host name)
+func (a AmbariRegistry) SetHostMaintenanceMode(host string, on bool) []byte {
+	state := "OFF"
+	if on {
+		state = "ON"
+	}
+	uriSuffix := fmt.Sprintf("hosts/%s", host)
+	var bodyBytes bytes.Buffer
+	jsonStr := fmt.Sprintf(`{"RequestInfo": {"context" : "Turn %s maintenance mode (%s) by ambarictl"}, "Body": {"Hosts": {"maintenance_state": "%s"}}}`, state, host, state)
+	bodyBytes.WriteString(jsonStr)
+	return ProcessRequest(a.CreatePutRequest(bodyBytes, uriSuffix, true))
+}
+
 func (a AmbariRegistry) serviceOperation(service string, state string, context string) *http.Request {
 	uriSuffix := fmt.Sprintf("services/%s", service)
 	var bodyBytes bytes.Buffer
@@ -191,14 +384,58 @@ func (a AmbariRegistry) serviceOperation(service string, state string, context s
 	return a.CreatePutRequest(bodyBytes, uriSuffix, true)
 }
 
-func (a AmbariRegistry) componentOperation(component string, operation string, context string) *http.Request {
+// ErrNoHostComponents is returned when none of the selected hosts has the component of a host component command
+var ErrNoHostComponents = errors.New("none of the selected hosts has the component")
+
+// RunHostComponentCommand start / stop / restart a component only on the selected hosts (the ones that have the component),
+// the hosts can be selected by ip addresses (like the filtered hosts) or host names, returns ErrNoHostComponents if none of the hosts has the component
+func (a AmbariRegistry) RunHostComponentCommand(command string, component string, filteredHosts map[string]bool) ([]byte, error) {
+	command = strings.ToUpper(command)
+	if command != "START" && command != "STOP" && command != "RESTART" {
+		return nil, fmt.Errorf("Only START/STOP/RESTART operations are supported on specific hosts (%s)", command)
+	}
+	if len(filteredHosts) == 0 {
+		return nil, fmt.Errorf("No hosts selected for %s of component %s", command, component)
+	}
+	hostNames := a.getAmbariHostNames(filteredHosts)
+	if len(hostNames) == 0 {
+		return nil, ErrNoHostComponents
+	}
+	context := fmt.Sprintf("%s component (%s) on selected hosts by ambarictl", strings.Title(strings.ToLower(command)), component)
+	request := a.componentOperation(component, command, context, hostNames)
+	if request == nil {
+		return nil, ErrNoHostComponents
+	}
+	return ProcessRequest(request), nil
+}
+
+// getAmbariHostNames get the ambari host names of the filtered hosts (those can be ip addresses, host names or public host names)
+func (a AmbariRegistry) getAmbariHostNames(filteredHosts map[string]bool) map[string]bool {
+	hostNames := make(map[string]bool)
+	for _, agent := range a.ListAgents() {
+		if filteredHosts[agent.IP] || filteredHosts[agent.HostName] || filteredHosts[agent.PublicHostname] {
+			hostNames[agent.HostName] = true
+		}
+	}
+	return hostNames
+}
+
+// componentOperation create a request for a component operation on the hosts of the component (only on the filtered ones if there is a host filter),
+// returns nil if none of the filtered hosts has the component
+func (a AmbariRegistry) componentOperation(component string, operation string, context string, filteredHosts map[string]bool) *http.Request {
 	components := a.ListComponents()
 	service := getServiceNameForComponent(component, components)
 	hostComponents := a.ListHostComponents(component, false)
 	hosts := ""
 	for _, hostComponent := range hostComponents {
+		if len(filteredHosts) > 0 && !filteredHosts[hostComponent.HostComponntHost] {
+			continue
+		}
 		hosts += hostComponent.HostComponntHost + ","
 	}
+	if len(hosts) == 0 && len(filteredHosts) > 0 {
+		return nil
+	}
 	hosts = strings.TrimSuffix(hosts, ",")
 	uriSuffix := "requests"
 	var bodyBytes bytes.Buffer
@@ -0,0 +1,224 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestGetConfig(t *testing.T) {
+	ambariRegistry, _ := newFakeConfigs(t, map[string]map[string]string{"core-site": {"fs.defaultFS": "hdfs://nn:8020"}}, nil)
+
+	if value, err := ambariRegistry.GetConfig("core-site", "fs.defaultFS"); err != nil || value != "hdfs://nn:8020" {
+		t.Errorf("unexpected value: %q, err: %v", value, err)
+	}
+	if _, err := ambariRegistry.GetConfig("core-site", "missing"); err == nil {
+		t.Error("expected an error for a missing config key")
+	}
+	if _, err := ambariRegistry.GetConfig("hdfs-site", "dfs.replication"); err == nil {
+		t.Error("expected an error for a missing config type")
+	}
+}
+
+func TestExecutePlaybookRegistersConfigValue(t *testing.T) {
+	ambariRegistry, _ := newFakeConfigs(t, map[string]map[string]string{"core-site": {"fs.defaultFS": "hdfs://nn:8020"}}, nil)
+	playbook := loadTestPlaybook(t, `
+name: get config
+tasks:
+  - name: "get"
+    type: Config
+    register: fs
+    parameters:
+      operation: get
+      config_type: core-site
+      config_key: fs.defaultFS
+  - name: "use"
+    type: LocalCommand
+    command: "true"
+    when: fs.stdout == 'hdfs://nn:8020'
+`, "")
+
+	result, err := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Tasks) != 2 || result.Tasks[1].Status != TaskSuccess {
+		t.Errorf("expected the registered config value to be used: %+v", result.Tasks)
+	}
+}
+
+func TestDeleteConfig(t *testing.T) {
+	configs, _ := newFakeConfigs(t, map[string]map[string]string{"core-site": {"fs.defaultFS": "hdfs://nn:8020"}}, nil)
+	remote := &fakeRemote{}
+	ambariRegistry := useFakeRemote(t, remote, configs, false)
+
+	if err := ambariRegistry.DeleteConfig("core-site", "missing", ""); err != nil {
+		t.Errorf("deleting a missing key failed: %v", err)
+	}
+	if commands := remote.getCommands(ambariRegistry.Hostname); len(commands) != 0 {
+		t.Errorf("the configs script is run for a missing key: %v", commands)
+	}
+	if err := ambariRegistry.DeleteConfig("core-site", "fs.defaultFS", "it's obsolete"); err != nil {
+		t.Fatal(err)
+	}
+	commands := remote.getCommands(ambariRegistry.Hostname)
+	if len(commands) != 1 || !strings.Contains(commands[0], "--action delete -c core-site -k fs.defaultFS") ||
+		!strings.Contains(commands[0], `-b 'AMBARICTL - it'\''s obsolete'`) {
+		t.Errorf("unexpected commands on the ambari server: %v", commands)
+	}
+
+	remote.run = func(host string, command string) (string, string, error) {
+		return "", "", &ExitCodeError{Code: 1}
+	}
+	if err := ambariRegistry.DeleteConfig("core-site", "fs.defaultFS", ""); err == nil {
+		t.Error("expected the failed configs script to fail the delete")
+	}
+}
+
+func TestSetConfigsCreatesOneVersion(t *testing.T) {
+	ambariRegistry, configs := newFakeConfigs(t, map[string]map[string]string{"core-site": {"fs.defaultFS": "hdfs://nn:8020", "io.file.buffer.size": "4096"}}, nil)
+
+	err := ambariRegistry.SetConfigs("core-site", map[string]string{"io.file.buffer.size": "131072", "hadoop.proxyuser.ambari.hosts": "*"}, "", "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if puts := configs.getPuts(); len(puts) != 1 {
+		t.Errorf("expected 1 config update, got %d", len(puts))
+	}
+	expected := map[string]string{"fs.defaultFS": "hdfs://nn:8020", "io.file.buffer.size": "131072", "hadoop.proxyuser.ambari.hosts": "*"}
+	if properties := configs.getDesired("core-site"); !reflect.DeepEqual(properties, expected) {
+		t.Errorf("unexpected properties of the new version: %v", properties)
+	}
+	note := configs.getPuts()[0]["Clusters"].(map[string]interface{})["desired_config"].(map[string]interface{})["service_config_version_note"]
+	if note != "AMBARICTL - Update config keys: hadoop.proxyuser.ambari.hosts, io.file.buffer.size" {
+		t.Errorf("unexpected version note: %v", note)
+	}
+	if err := ambariRegistry.SetConfigs("hdfs-site", map[string]string{"dfs.replication": "2"}, "", ""); err == nil {
+		t.Error("expected an error for a missing config type")
+	}
+}
+
+func TestAmbariCommandTaskOnSelectedHosts(t *testing.T) {
+	ambariRegistry, requests := newFakeAmbari(t, map[string][]string{
+		"host1": {"HDFS_DATANODE", "HDFS_CLIENT"},
+		"host2": {"HDFS_DATANODE"},
+		"host3": {"HDFS_NAMENODE"},
+	}, nil)
+	task := Task{Name: "restart", Type: AmbariCommand, Command: "RESTART", ComponentFilter: "HDFS_DATANODE", HostFilter: "host1,host3"}
+
+	if _, _, err := ambariRegistry.executeTask(context.Background(), task, map[string]string{}, map[string]interface{}{}, PlaybookOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	operations := requests.getOperations()
+	if len(operations) != 1 || !strings.Contains(operations[0], `"component_name": "HDFS_DATANODE"`) || !strings.Contains(operations[0], `"hosts": "host1"`) {
+		t.Errorf("expected a restart of the datanode on host1 only: %v", operations)
+	}
+	task.HostFilter = "host3"
+	if _, _, err := ambariRegistry.executeTask(context.Background(), task, map[string]string{}, map[string]interface{}{}, PlaybookOptions{}); err == nil {
+		t.Error("expected an error if none of the selected hosts has the component")
+	}
+}
+
+func TestGetClustersAndSelectCluster(t *testing.T) {
+	var mutex sync.Mutex
+	paths := make([]string, 0)
+	ambariRegistry := newTestAmbari(t, func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		paths = append(paths, r.URL.Path)
+		mutex.Unlock()
+		if r.URL.Path == "/api/v1/clusters" {
+			w.Write([]byte(`{"items":[{"Clusters":{"cluster_name":"prod"}},{"Clusters":{"cluster_name":"test"}}]}`))
+			return
+		}
+		emptyItemsHandler(w, r)
+	})
+	ambariRegistry.Cluster = ""
+
+	clusters, err := ambariRegistry.GetClusters()
+	if err != nil || !reflect.DeepEqual(clusters, []string{"prod", "test"}) {
+		t.Fatalf("unexpected clusters: %v, err: %v", clusters, err)
+	}
+	selected, err := ambariRegistry.SelectCluster("test")
+	if err != nil || selected.Cluster != "test" {
+		t.Fatalf("cannot select cluster 'test': %+v, err: %v", selected, err)
+	}
+	selected.ListServices()
+	mutex.Lock()
+	if lastPath := paths[len(paths)-1]; lastPath != "/api/v1/clusters/test/services" {
+		t.Errorf("expected the request to use the selected cluster, got: %s", lastPath)
+	}
+	mutex.Unlock()
+
+	if unchanged, err := selected.SelectCluster(""); err != nil || unchanged.Cluster != "test" {
+		t.Errorf("expected no change without a cluster: %+v, err: %v", unchanged, err)
+	}
+	if _, err := selected.SelectCluster("prod"); err == nil {
+		t.Error("expected an error for selecting a different cluster than the pinned one")
+	}
+}
+
+func TestConfigTaskWithNoteAndTag(t *testing.T) {
+	captureOutput(t)
+	configs, fake := newFakeConfigs(t, map[string]map[string]string{"hdfs-site": {"dfs.replication": "3"}}, nil)
+	remote := &fakeRemote{}
+	ambariRegistry := useFakeRemote(t, remote, configs, false)
+	desiredConfig := func(index int) map[string]interface{} {
+		return fake.getPuts()[index]["Clusters"].(map[string]interface{})["desired_config"].(map[string]interface{})
+	}
+
+	task := Task{Name: "replication", Type: Config, Parameters: map[string]string{"operation": ConfigSet, "config_type": "hdfs-site",
+		"config_key": "dfs.replication", "config_value": "2", "note": "Small cluster", "tag": "small-cluster"}}
+	if err := ambariRegistry.ExecuteConfigCommand(task); err != nil {
+		t.Fatal(err)
+	}
+	if config := desiredConfig(0); config["tag"] != "small-cluster" || config["service_config_version_note"] != "AMBARICTL - Small cluster" {
+		t.Errorf("expected the note and the tag in the new config version: %v", config)
+	}
+	if err := ambariRegistry.ExecuteConfigCommand(task); err == nil || !strings.Contains(err.Error(), "tag 'small-cluster' already exists") {
+		t.Errorf("expected an error for an existing tag, got: %v", err)
+	}
+	if puts := fake.getPuts(); len(puts) != 1 {
+		t.Errorf("expected no new config version for an existing tag, got %d versions", len(puts))
+	}
+
+	task.Parameters = map[string]string{"operation": ConfigSet, "config_type": "hdfs-site", "note": "Faster block reports"}
+	task.Configs = map[string]string{"dfs.blockreport.intervalMsec": "10800000"}
+	if err := ambariRegistry.ExecuteConfigCommand(task); err != nil {
+		t.Fatal(err)
+	}
+	if config := desiredConfig(1); !strings.HasPrefix(config["tag"].(string), "version") || config["service_config_version_note"] != "AMBARICTL - Faster block reports" {
+		t.Errorf("expected a generated tag and the note in the new config version: %v", config)
+	}
+
+	task.Parameters = map[string]string{"operation": ConfigSet, "config_type": "hdfs-site", "config_key": "dfs.replication", "config_value": "1", "note": "Single node"}
+	task.Configs = nil
+	if err := ambariRegistry.ExecuteConfigCommand(task); err != nil {
+		t.Fatal(err)
+	}
+	if commands := remote.getCommands(ambariRegistry.Hostname); len(commands) != 1 || !strings.Contains(commands[0], "-b 'AMBARICTL - Single node'") {
+		t.Errorf("expected the note for the configs script: %v", commands)
+	}
+	task.Parameters = map[string]string{"operation": ConfigDelete, "config_type": "hdfs-site", "config_key": "dfs.replication", "tag": "v2"}
+	if err := ambariRegistry.ExecuteConfigCommand(task); err == nil {
+		t.Error("expected an error for a tag of a delete operation")
+	}
+}
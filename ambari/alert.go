@@ -0,0 +1,146 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// AlertOk alert state when the check passes
+	AlertOk = "OK"
+	// AlertUnknown alert state when the check cannot be evaluated
+	AlertUnknown = "UNKNOWN"
+	// AlertWarning alert state of warnings
+	AlertWarning = "WARNING"
+	// AlertCritical alert state of critical problems
+	AlertCritical = "CRITICAL"
+)
+
+// alertSeverities holds the alert states in increasing order of severity
+var alertSeverities = []string{AlertOk, AlertUnknown, AlertWarning, AlertCritical}
+
+// alertSeverity get the severity level of an alert state (-1 if the state is unknown)
+func alertSeverity(state string) int {
+	for level, severity := range alertSeverities {
+		if severity == strings.ToUpper(state) {
+			return level
+		}
+	}
+	return -1
+}
+
+// ListAlerts get the current alerts of the cluster
+func (a AmbariRegistry) ListAlerts() ([]Alert, error) {
+	bodyBytes, err := sendRequest(a.CreateGetRequest("alerts?fields=Alert/*", true))
+	if err != nil {
+		return nil, err
+	}
+	var alertsResponse AlertsResponse
+	if err := json.Unmarshal(bodyBytes, &alertsResponse); err != nil {
+		return nil, err
+	}
+	alerts := make([]Alert, 0)
+	for _, item := range alertsResponse.Items {
+		alerts = append(alerts, item.Alert)
+	}
+	return alerts, nil
+}
+
+// FilterAlerts get the alerts that match the filter (services, components, hosts) and are at or above the minimum severity,
+// alerts in maintenance mode are ignored
+func FilterAlerts(alerts []Alert, filter Filter, minSeverity string) []Alert {
+	filteredAlerts := make([]Alert, 0)
+	for _, alert := range alerts {
+		if alertSeverity(alert.State) < alertSeverity(minSeverity) || alert.MaintenanceState == "ON" {
+			continue
+		}
+		if (len(filter.Services) > 0 && !containsString(filter.Services, alert.ServiceName)) ||
+			(len(filter.Components) > 0 && !containsString(filter.Components, alert.ComponentName)) ||
+			(len(filter.Hosts) > 0 && !containsString(filter.Hosts, alert.HostName)) {
+			continue
+		}
+		filteredAlerts = append(filteredAlerts, alert)
+	}
+	sort.Slice(filteredAlerts, func(i, j int) bool {
+		if filteredAlerts[i].DefinitionName != filteredAlerts[j].DefinitionName {
+			return filteredAlerts[i].DefinitionName < filteredAlerts[j].DefinitionName
+		}
+		return filteredAlerts[i].HostName < filteredAlerts[j].HostName
+	})
+	return filteredAlerts
+}
+
+// ExecuteAlertCheckTask fails if there are alerts (of the filtered services, components and hosts) at or above 'min_severity',
+// if 'wait' is true, it polls the alerts until they clear (or 'timeout' is reached)
+func (a AmbariRegistry) ExecuteAlertCheckTask(ctx context.Context, task Task) error {
+	minSeverity := strings.ToUpper(task.Parameters["min_severity"])
+	if alertSeverity(minSeverity) < 0 {
+		return fmt.Errorf("'min_severity' parameter of '%s' task should be one of: %s", AlertCheck, strings.Join(alertSeverities, ", "))
+	}
+	wait, err := strconv.ParseBool(task.Parameters["wait"])
+	if err != nil {
+		return fmt.Errorf("'wait' parameter of '%s' task should be true or false: %v", AlertCheck, err)
+	}
+	timeoutSeconds, err := strconv.Atoi(task.Parameters["timeout"])
+	if err != nil {
+		return fmt.Errorf("'timeout' parameter of '%s' task should be a number: %v", AlertCheck, err)
+	}
+	pollSeconds, err := strconv.Atoi(task.Parameters["poll_interval"])
+	if err != nil || pollSeconds <= 0 {
+		return fmt.Errorf("'poll_interval' parameter of '%s' task should be a positive number: %s", AlertCheck, task.Parameters["poll_interval"])
+	}
+	filter := CreateFilter(task.ServiceFilter, task.ComponentFilter, task.HostFilter, false)
+	deadline := time.Now().Add(time.Duration(timeoutSeconds) * time.Second)
+	lastAlerts := ""
+	for {
+		alerts, err := a.ListAlerts()
+		if err != nil {
+			return err
+		}
+		descriptions := make([]string, 0)
+		for _, alert := range FilterAlerts(alerts, filter, minSeverity) {
+			description := fmt.Sprintf("%s: %s", alert.State, alert.Label)
+			if len(alert.HostName) > 0 {
+				description = fmt.Sprintf("%s (host: %s)", description, alert.HostName)
+			}
+			descriptions = append(descriptions, description)
+		}
+		if len(descriptions) == 0 {
+			outPrintln(fmt.Sprintf("No alerts with %s or higher severity", minSeverity))
+			return nil
+		}
+		current := strings.Join(descriptions, ", ")
+		if !wait {
+			return fmt.Errorf("%d alerts with %s or higher severity: %s", len(descriptions), minSeverity, current)
+		}
+		if current != lastAlerts {
+			outPrintln(fmt.Sprintf("Waiting for %d alerts to clear (%s)", len(descriptions), current))
+			lastAlerts = current
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out waiting for alerts to clear after %d seconds (%s)", timeoutSeconds, lastAlerts)
+		}
+		if err := sleepWithContext(ctx, time.Duration(pollSeconds)*time.Second); err != nil {
+			return err
+		}
+	}
+}
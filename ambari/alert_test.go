@@ -0,0 +1,97 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// alertsHandler answer the alerts requests with the alerts (json items) returned by the alerts function
+func alertsHandler(t *testing.T, alerts func() string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/api/v1/clusters/cl1/alerts") || r.URL.Query().Get("fields") != "Alert/*" {
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+		w.Write([]byte(`{"items":[` + alerts() + `]}`))
+	}
+}
+
+const (
+	criticalDatanodeAlert          = `{"Alert":{"definition_name":"datanode_process","label":"DataNode Process","service_name":"HDFS","component_name":"DATANODE","host_name":"host1","state":"CRITICAL"}}`
+	warningZookeeperAlert          = `{"Alert":{"definition_name":"zookeeper_server_process","label":"ZooKeeper Server Process","service_name":"ZOOKEEPER","component_name":"ZOOKEEPER_SERVER","host_name":"host2","state":"WARNING"}}`
+	criticalYarnAlertInMaintenance = `{"Alert":{"definition_name":"nodemanager_health","label":"NodeManager Health","service_name":"YARN","component_name":"NODEMANAGER","host_name":"host3","state":"CRITICAL","maintenance_state":"ON"}}`
+	okHdfsAlert                    = `{"Alert":{"definition_name":"namenode_webui","label":"NameNode Web UI","service_name":"HDFS","component_name":"NAMENODE","host_name":"host1","state":"OK"}}`
+)
+
+func TestExecuteAlertCheckTask(t *testing.T) {
+	captureOutput(t)
+	ambariRegistry := newTestAmbari(t, alertsHandler(t, func() string {
+		return strings.Join([]string{criticalDatanodeAlert, warningZookeeperAlert, criticalYarnAlertInMaintenance, okHdfsAlert}, ",")
+	}))
+	cases := []struct {
+		services, minSeverity, err string
+	}{
+		{"", "CRITICAL", "1 alerts with CRITICAL or higher severity: CRITICAL: DataNode Process (host: host1)"},
+		{"", "warning", "2 alerts with WARNING or higher severity: CRITICAL: DataNode Process (host: host1), WARNING: ZooKeeper Server Process (host: host2)"},
+		{"YARN", "CRITICAL", ""},
+		{"ZOOKEEPER", "CRITICAL", ""},
+		{"HDFS,ZOOKEEPER", "OK", "3 alerts with OK or higher severity"},
+		{"", "FATAL", "'min_severity' parameter of 'AlertCheck' task should be one of"},
+	}
+	for _, c := range cases {
+		task := Task{Type: AlertCheck, ServiceFilter: c.services, Parameters: map[string]string{"min_severity": c.minSeverity, "wait": "false", "timeout": "0", "poll_interval": "1"}}
+		err := ambariRegistry.ExecuteAlertCheckTask(context.Background(), task)
+		if len(c.err) == 0 && err != nil {
+			t.Errorf("%q/%s: expected no alerts, got: %v", c.services, c.minSeverity, err)
+		} else if len(c.err) > 0 && (err == nil || !strings.HasPrefix(err.Error(), c.err)) {
+			t.Errorf("%q/%s: expected error %q, got: %v", c.services, c.minSeverity, c.err, err)
+		}
+	}
+}
+
+func TestExecuteAlertCheckTaskWaitsForAlertsToClear(t *testing.T) {
+	output := captureOutput(t)
+	var mutex sync.Mutex
+	polls := 0
+	ambariRegistry := newTestAmbari(t, alertsHandler(t, func() string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		polls++
+		if polls > 2 {
+			return okHdfsAlert
+		}
+		return criticalDatanodeAlert
+	}))
+	task := Task{Type: AlertCheck, Parameters: map[string]string{"min_severity": "CRITICAL", "wait": "true", "timeout": "30", "poll_interval": "1"}}
+
+	if err := ambariRegistry.ExecuteAlertCheckTask(context.Background(), task); err != nil {
+		t.Fatalf("expected the alerts to clear: %v", err)
+	}
+	if strings.Count(output.String(), "Waiting for 1 alerts to clear (CRITICAL: DataNode Process (host: host1))") != 1 {
+		t.Errorf("expected the waiting message only once, output:\n%s", output.String())
+	}
+
+	task.Parameters["timeout"] = "0"
+	mutex.Lock()
+	polls = 0
+	mutex.Unlock()
+	if err := ambariRegistry.ExecuteAlertCheckTask(context.Background(), task); err == nil || !strings.HasPrefix(err.Error(), "Timed out waiting for alerts to clear") {
+		t.Errorf("expected a timeout, got: %v", err)
+	}
+}
@@ -16,50 +16,65 @@ package ambari
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 )
 
 // CreateGetRequest creates an Ambari GET request
 func (a AmbariRegistry) CreateGetRequest(urlSuffix string, useCluster bool) *http.Request {
 	uri := a.GetAmbariUri(urlSuffix, useCluster)
-	request, err := http.NewRequest("GET", uri, nil)
+	request, err := http.NewRequestWithContext(a.requestContext(), "GET", uri, nil)
 	if err != nil {
 		panic(err)
 	}
 	request.Header.Add("Content-Type", "application/json")
 	request.SetBasicAuth(a.Username, a.Password)
-	return request
+	return a.withClientSettings(request)
 }
 
 // CreatePostRequest creates an Ambari POST request with body
 func (a AmbariRegistry) CreatePostRequest(body bytes.Buffer, urlSuffix string, useCluster bool) *http.Request {
 	uri := a.GetAmbariUri(urlSuffix, useCluster)
-	request, err := http.NewRequest("POST", uri, &body)
+	request, err := http.NewRequestWithContext(a.requestContext(), "POST", uri, &body)
 	if err != nil {
 		panic(err)
 	}
 	//request.Header.Add("Content-Type", "application/json")
 	request.Header.Add("X-Requested-By", "ambari")
 	request.SetBasicAuth(a.Username, a.Password)
-	return request
+	return a.withClientSettings(request)
 }
 
 // CreatePutRequest creates an Ambari PUT request with body
 func (a AmbariRegistry) CreatePutRequest(body bytes.Buffer, urlSuffix string, useCluster bool) *http.Request {
 	uri := a.GetAmbariUri(urlSuffix, useCluster)
-	request, err := http.NewRequest("PUT", uri, &body)
+	request, err := http.NewRequestWithContext(a.requestContext(), "PUT", uri, &body)
 	if err != nil {
 		panic(err)
 	}
 	request.Header.Add("X-Requested-By", "ambari")
 	request.SetBasicAuth(a.Username, a.Password)
-	return request
+	return a.withClientSettings(request)
+}
+
+// CreateDeleteRequest creates an Ambari DELETE request
+func (a AmbariRegistry) CreateDeleteRequest(urlSuffix string, useCluster bool) *http.Request {
+	uri := a.GetAmbariUri(urlSuffix, useCluster)
+	request, err := http.NewRequestWithContext(a.requestContext(), "DELETE", uri, nil)
+	if err != nil {
+		panic(err)
+	}
+	request.Header.Add("X-Requested-By", "ambari")
+	request.SetBasicAuth(a.Username, a.Password)
+	return a.withClientSettings(request)
 }
 
 // GetAmbariUri creates the Ambari uri with /api/v1/ suffix (+ /api/v1/clusters/<cluster> suffix is useCluster is enabled)
@@ -70,28 +85,103 @@ func (a AmbariRegistry) GetAmbariUri(uriSuffix string, useCluster bool) string {
 	return fmt.Sprintf("%s://%s:%v/api/v1/%s", a.Protocol, a.Hostname, a.Port, uriSuffix)
 }
 
-// GetHttpClient create HTTP client instance for Ambari
-func GetHttpClient() *http.Client {
+// DefaultRequestTimeout is the timeout (in seconds) of the ambari REST calls if the registry entry does not override it
+const DefaultRequestTimeout = 60
+
+const (
+	requestRetries    = 2
+	requestRetryDelay = 2 * time.Second
+)
+
+type clientSettingsKey struct{}
+
+// clientSettings holds the certificate verification options and the request timeout of an ambari registry
+type clientSettings struct {
+	insecure   bool
+	caCertPath string
+	timeout    int
+}
+
+// requestContext get the context of the running playbook task (the REST calls are cancelled with it)
+func (a AmbariRegistry) requestContext() context.Context {
+	if a.ctx == nil {
+		return context.Background()
+	}
+	return a.ctx
+}
+
+// withClientSettings attach the client options of the ambari registry to a request, so the request is sent by a client with those options
+func (a AmbariRegistry) withClientSettings(request *http.Request) *http.Request {
+	settings := clientSettings{insecure: a.InsecureTLS, caCertPath: a.CACertPath, timeout: a.RequestTimeout}
+	return request.WithContext(context.WithValue(request.Context(), clientSettingsKey{}, settings))
+}
+
+// CreateTLSConfig create the TLS config of the ambari client: the server certificate is verified by the system CAs (and the CA certificate
+// of the caCertPath pem file, if it is set), insecure turns off the verification (e.g. for self-signed certificates)
+func CreateTLSConfig(insecure bool, caCertPath string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecure}
+	if len(caCertPath) == 0 {
+		return tlsConfig, nil
+	}
+	caCert, err := ioutil.ReadFile(caCertPath)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read CA certificate: %v", err)
+	}
+	certPool, err := x509.SystemCertPool()
+	if err != nil || certPool == nil {
+		certPool = x509.NewCertPool()
+	}
+	if !certPool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("No certificate found in CA certificate file %s", caCertPath)
+	}
+	tlsConfig.RootCAs = certPool
+	return tlsConfig, nil
+}
+
+// GetHttpClient create HTTP client instance for Ambari, a request fails if it does not finish in timeout (0 means no timeout)
+func GetHttpClient(tlsConfig *tls.Config, timeout time.Duration) *http.Client {
 	httpClient := &http.Client{
+		Timeout: timeout,
 		Transport: &http.Transport{
-			Proxy:                 http.ProxyFromEnvironment,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       30 * time.Second,
-			ResponseHeaderTimeout: 10 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
+			Proxy:               http.ProxyFromEnvironment,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     30 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+			TLSClientConfig:     tlsConfig,
 		},
 	}
 	return httpClient
 }
 
+var (
+	// httpClients the cached HTTP clients by client settings, so the connections are reused between the REST calls (e.g. while polling)
+	httpClients      = make(map[clientSettings]*http.Client)
+	httpClientsMutex sync.Mutex
+)
+
+// getCachedHttpClient get the HTTP client for the client settings (it is created at the first use)
+func getCachedHttpClient(settings clientSettings) (*http.Client, error) {
+	httpClientsMutex.Lock()
+	defer httpClientsMutex.Unlock()
+	if client, ok := httpClients[settings]; ok {
+		return client, nil
+	}
+	tlsConfig, err := CreateTLSConfig(settings.insecure, settings.caCertPath)
+	if err != nil {
+		return nil, err
+	}
+	client := GetHttpClient(tlsConfig, time.Duration(settings.timeout)*time.Second)
+	httpClients[settings] = client
+	return client, nil
+}
+
 // ProcessAmbariItems get "items" from Ambari response
 func ProcessAmbariItems(request *http.Request) AmbariItems {
 	bodyBytes := ProcessRequest(request)
 	var ambariItems AmbariItems
 	err := json.Unmarshal(bodyBytes, &ambariItems)
 	if err != nil {
-		fmt.Println(err)
+		errPrintln(err)
 		os.Exit(1)
 	}
 	return ambariItems
@@ -103,36 +193,73 @@ func ProcessAsMap(request *http.Request) map[string]interface{} {
 	var responseMap map[string]interface{}
 	err := json.Unmarshal(bodyBytes, &responseMap)
 	if err != nil {
-		fmt.Println(err)
+		errPrintln(err)
 		os.Exit(1)
 	}
 	return responseMap
 }
 
-// ProcessRequest get a simple response from a REST call
-func ProcessRequest(request *http.Request) []byte {
-	client := GetHttpClient()
+// doRequestWithRetries send a request, GET and PUT requests (those do not create new ambari requests if they are sent again)
+// are retried on connection errors and 5xx responses
+func doRequestWithRetries(client *http.Client, request *http.Request) (*http.Response, error) {
 	response, err := client.Do(request)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-	defer response.Body.Close()
-	if response.StatusCode >= 400 {
-		errorResponseMessage := fmt.Sprintf("Response status code: %v", response.StatusCode)
-		fmt.Println(errorResponseMessage)
-		bodyBytes, err := ioutil.ReadAll(response.Body)
+	retryable := request.Method == "GET" || request.Method == "PUT"
+	for attempt := 1; retryable && attempt <= requestRetries && (err != nil || response.StatusCode >= 500); attempt++ {
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			warnPrintln(fmt.Sprintf("Request to %s failed: %v, retrying (%d/%d)", request.URL, err, attempt, requestRetries))
+		} else {
+			warnPrintln(fmt.Sprintf("Request to %s failed with status code %d, retrying (%d/%d)", request.URL, response.StatusCode, attempt, requestRetries))
+			response.Body.Close()
 		}
-		fmt.Println(string(bodyBytes))
-		os.Exit(1)
+		select {
+		case <-time.After(requestRetryDelay):
+		case <-request.Context().Done():
+			return nil, request.Context().Err()
+		}
+		if request.GetBody != nil {
+			body, bodyErr := request.GetBody()
+			if bodyErr != nil {
+				return nil, bodyErr
+			}
+			request.Body = body
+		}
+		response, err = client.Do(request)
 	}
-	bodyBytes, err := ioutil.ReadAll(response.Body)
+	return response, err
+}
+
+// ProcessRequest get a simple response from a REST call (exits if the call fails)
+func ProcessRequest(request *http.Request) []byte {
+	bodyBytes, err := sendRequest(request)
 	if err != nil {
-		fmt.Println(err)
+		errPrintln(err)
 		os.Exit(1)
 	}
 	return bodyBytes
 }
+
+// sendRequest get a simple response from a REST call, returns an error (with the response body) for 4xx and 5xx responses
+func sendRequest(request *http.Request) ([]byte, error) {
+	settings, _ := request.Context().Value(clientSettingsKey{}).(clientSettings)
+	if settings.timeout <= 0 {
+		settings.timeout = DefaultRequestTimeout
+	}
+	client, err := getCachedHttpClient(settings)
+	if err != nil {
+		return nil, err
+	}
+	debugPrintln(fmt.Sprintf("REST request: %s %s", request.Method, request.URL))
+	response, err := doRequestWithRetries(client, request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	bodyBytes, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= 400 {
+		return nil, fmt.Errorf("Response status code: %v\n%s", response.StatusCode, string(bodyBytes))
+	}
+	return bodyBytes, nil
+}
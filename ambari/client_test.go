@@ -0,0 +1,159 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRequestRetriesStopWhenCancelled(t *testing.T) {
+	ambariRegistry := newTestAmbari(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	ambariRegistry.ctx = ctx
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := sendRequest(ambariRegistry.CreateGetRequest("services", true))
+
+	if err != context.Canceled {
+		t.Errorf("expected the request to be cancelled, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= requestRetryDelay {
+		t.Errorf("the retries did not stop after the cancel (%v)", elapsed)
+	}
+}
+
+func TestRequestsWithTLSOptions(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(emptyItemsHandler))
+	defer server.Close()
+	serverUrl, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(serverUrl.Port())
+	ambariRegistry := AmbariRegistry{Name: "tls", Hostname: serverUrl.Hostname(), Port: port, Protocol: "https", Cluster: "cl1", Username: "admin", Password: "admin"}
+	caCertPath := filepath.Join(t.TempDir(), "ca.pem")
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caCertPath, caCert, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// POST requests are not retried
+	if _, err := sendRequest(ambariRegistry.CreatePostRequest(bytes.Buffer{}, "services", true)); err == nil {
+		t.Error("expected the unknown certificate to be rejected")
+	}
+	insecure := ambariRegistry
+	insecure.InsecureTLS = true
+	if _, err := sendRequest(insecure.CreateGetRequest("services", true)); err != nil {
+		t.Errorf("request without certificate verification failed: %v", err)
+	}
+	withCA := ambariRegistry
+	withCA.CACertPath = caCertPath
+	if _, err := sendRequest(withCA.CreateGetRequest("services", true)); err != nil {
+		t.Errorf("request with the CA certificate failed: %v", err)
+	}
+	withCA.CACertPath = filepath.Join(t.TempDir(), "missing.pem")
+	if _, err := sendRequest(withCA.CreateGetRequest("services", true)); err == nil || !strings.Contains(err.Error(), "Cannot read CA certificate") {
+		t.Errorf("expected an error for a missing CA certificate, got: %v", err)
+	}
+}
+
+func TestRequestRetriesAndTimeout(t *testing.T) {
+	var mutex sync.Mutex
+	calls := make(map[string]int)
+	ambariRegistry := newTestAmbari(t, func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		calls[r.Method]++
+		count := calls[r.Method]
+		mutex.Unlock()
+		switch {
+		case r.URL.Path == "/api/v1/clusters/cl1/slow":
+			time.Sleep(2 * time.Second)
+		case count == 1:
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	})
+
+	var body bytes.Buffer
+	body.WriteString(`{"Clusters": {}}`)
+	if response, err := sendRequest(ambariRegistry.CreatePutRequest(body, "", true)); err != nil || string(response) != `{"Clusters": {}}` {
+		t.Errorf("expected the PUT request to be retried with its body: %q, err: %v", response, err)
+	}
+	if _, err := sendRequest(ambariRegistry.CreatePostRequest(bytes.Buffer{}, "requests", true)); err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("expected the POST request not to be retried, got: %v", err)
+	}
+	if calls["PUT"] != 2 || calls["POST"] != 1 {
+		t.Errorf("unexpected number of calls: %v", calls)
+	}
+	ambariRegistry.RequestTimeout = 1
+	start := time.Now()
+	if _, err := sendRequest(ambariRegistry.CreatePostRequest(bytes.Buffer{}, "slow", true)); err == nil || time.Since(start) >= 2*time.Second {
+		t.Errorf("expected the request to time out after 1 second, got: %v (%v)", err, time.Since(start))
+	}
+}
+
+func TestHttpClientsAreReusedBySettings(t *testing.T) {
+	var mutex sync.Mutex
+	connections := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(emptyItemsHandler))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mutex.Lock()
+			connections++
+			mutex.Unlock()
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	serverUrl, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(serverUrl.Port())
+	ambariRegistry := AmbariRegistry{Name: "test", Hostname: serverUrl.Hostname(), Port: port, Protocol: "http", Cluster: "cl1", RequestTimeout: 42}
+
+	for i := 0; i < 3; i++ {
+		if _, err := sendRequest(ambariRegistry.CreateGetRequest("hosts", true)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if connections != 1 {
+		t.Errorf("expected the connection to be reused, got %d connections", connections)
+	}
+	client, err := getCachedHttpClient(clientSettings{timeout: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Timeout != 42*time.Second || client.Transport.(*http.Transport).ResponseHeaderTimeout != 0 {
+		t.Errorf("expected only the request timeout to limit the response time: %v, %+v", client.Timeout, client.Transport)
+	}
+}
@@ -0,0 +1,353 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	conditionNumberToken = iota
+	conditionStringToken
+	conditionIdentifierToken
+	conditionOperatorToken
+)
+
+type conditionToken struct {
+	kind int
+	text string
+}
+
+type conditionParser struct {
+	tokens    []conditionToken
+	pos       int
+	vars      map[string]string
+	bareWords bool
+}
+
+// EvaluateCondition evaluates a boolean expression like "free_disk > 1024 and (os == 'centos7' or not upgraded)".
+// Supported operators: ==, !=, <, <=, >, >=, contains, and (&&), or (||), not (!), defined, parentheses.
+// Identifiers are resolved from the variables, values are compared as numbers if both sides are numbers.
+func EvaluateCondition(expression string, vars map[string]string) (bool, error) {
+	return evaluateCondition(expression, vars, false)
+}
+
+// EvaluateWhenCondition evaluates the 'when' expression of a task, like EvaluateCondition,
+// but undefined identifiers are used as plain words, so rendered templates like "{{.env}} == prod" can be compared
+func EvaluateWhenCondition(expression string, vars map[string]string) (bool, error) {
+	return evaluateCondition(expression, vars, true)
+}
+
+func evaluateCondition(expression string, vars map[string]string, bareWords bool) (bool, error) {
+	tokens, err := tokenizeCondition(expression)
+	if err != nil {
+		return false, err
+	}
+	if len(tokens) == 0 {
+		return false, fmt.Errorf("Empty condition")
+	}
+	parser := &conditionParser{tokens: tokens, vars: vars, bareWords: bareWords}
+	value, err := parser.parseOr()
+	if err != nil {
+		return false, fmt.Errorf("Cannot evaluate condition '%s': %v", expression, err)
+	}
+	if parser.pos < len(tokens) {
+		return false, fmt.Errorf("Cannot evaluate condition '%s': unexpected '%s'", expression, tokens[parser.pos].text)
+	}
+	result, err := conditionBool(value)
+	if err != nil {
+		return false, fmt.Errorf("Cannot evaluate condition '%s': %v", expression, err)
+	}
+	return result, nil
+}
+
+func tokenizeCondition(expression string) ([]conditionToken, error) {
+	tokens := make([]conditionToken, 0)
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'' || r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("Unterminated string in condition '%s'", expression)
+			}
+			tokens = append(tokens, conditionToken{kind: conditionStringToken, text: string(runes[i+1 : end])})
+			i = end + 1
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			end := i + 1
+			for end < len(runes) && (unicode.IsDigit(runes[end]) || runes[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, conditionToken{kind: conditionNumberToken, text: string(runes[i:end])})
+			i = end
+		case unicode.IsLetter(r) || r == '_':
+			end := i + 1
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_' || runes[end] == '.') {
+				end++
+			}
+			word := string(runes[i:end])
+			switch word {
+			case "and", "or", "not", "contains", "defined":
+				tokens = append(tokens, conditionToken{kind: conditionOperatorToken, text: word})
+			default:
+				tokens = append(tokens, conditionToken{kind: conditionIdentifierToken, text: word})
+			}
+			i = end
+		default:
+			operator := ""
+			for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")"} {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					operator = op
+					break
+				}
+			}
+			if len(operator) == 0 {
+				return nil, fmt.Errorf("Unexpected character '%c' in condition '%s'", r, expression)
+			}
+			i += len(operator)
+			switch operator {
+			case "&&":
+				operator = "and"
+			case "||":
+				operator = "or"
+			case "!":
+				operator = "not"
+			}
+			tokens = append(tokens, conditionToken{kind: conditionOperatorToken, text: operator})
+		}
+	}
+	return tokens, nil
+}
+
+func (p *conditionParser) peekOperator(operators ...string) (string, bool) {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != conditionOperatorToken {
+		return "", false
+	}
+	for _, operator := range operators {
+		if p.tokens[p.pos].text == operator {
+			return operator, true
+		}
+	}
+	return "", false
+}
+
+func (p *conditionParser) parseOr() (interface{}, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.peekOperator("or"); !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left, err = combineConditions(left, right, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *conditionParser) parseAnd() (interface{}, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.peekOperator("and"); !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left, err = combineConditions(left, right, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *conditionParser) parseNot() (interface{}, error) {
+	if _, ok := p.peekOperator("not"); ok {
+		p.pos++
+		value, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		result, err := conditionBool(value)
+		if err != nil {
+			return nil, err
+		}
+		return !result, nil
+	}
+	if _, ok := p.peekOperator("defined"); ok {
+		p.pos++
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != conditionIdentifierToken {
+			return nil, fmt.Errorf("'defined' requires a variable name")
+		}
+		value := p.vars[p.tokens[p.pos].text]
+		p.pos++
+		return len(value) > 0, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *conditionParser) parseComparison() (interface{}, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	operator, ok := p.peekOperator("==", "!=", "<", "<=", ">", ">=", "contains")
+	if !ok {
+		return left, nil
+	}
+	p.pos++
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return compareConditionValues(left, right, operator), nil
+}
+
+func (p *conditionParser) parseOperand() (interface{}, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of condition")
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	switch token.kind {
+	case conditionNumberToken:
+		number, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			// e.g. versions like 2.6.5 are compared as strings
+			return token.text, nil
+		}
+		return number, nil
+	case conditionStringToken:
+		return token.text, nil
+	case conditionIdentifierToken:
+		if value, ok := p.vars[token.text]; ok {
+			return value, nil
+		}
+		switch token.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		if p.bareWords {
+			return token.text, nil
+		}
+		return nil, fmt.Errorf("undefined variable '%s'", token.text)
+	}
+	if token.text == "(" {
+		value, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.peekOperator(")"); !ok {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		return value, nil
+	}
+	return nil, fmt.Errorf("unexpected '%s'", token.text)
+}
+
+func combineConditions(left interface{}, right interface{}, and bool) (interface{}, error) {
+	leftBool, err := conditionBool(left)
+	if err != nil {
+		return nil, err
+	}
+	rightBool, err := conditionBool(right)
+	if err != nil {
+		return nil, err
+	}
+	if and {
+		return leftBool && rightBool, nil
+	}
+	return leftBool || rightBool, nil
+}
+
+func compareConditionValues(left interface{}, right interface{}, operator string) bool {
+	leftStr := conditionString(left)
+	rightStr := conditionString(right)
+	if operator == "contains" {
+		return strings.Contains(leftStr, rightStr)
+	}
+	leftNum, leftErr := strconv.ParseFloat(leftStr, 64)
+	rightNum, rightErr := strconv.ParseFloat(rightStr, 64)
+	compared := strings.Compare(leftStr, rightStr)
+	if leftErr == nil && rightErr == nil {
+		compared = 0
+		if leftNum < rightNum {
+			compared = -1
+		} else if leftNum > rightNum {
+			compared = 1
+		}
+	}
+	switch operator {
+	case "==":
+		return compared == 0
+	case "!=":
+		return compared != 0
+	case "<":
+		return compared < 0
+	case "<=":
+		return compared <= 0
+	case ">":
+		return compared > 0
+	}
+	return compared >= 0
+}
+
+func conditionString(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return strings.TrimSpace(fmt.Sprintf("%v", value))
+}
+
+func conditionBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case float64:
+		return v != 0, nil
+	}
+	result, err := strconv.ParseBool(conditionString(value))
+	if err != nil {
+		return false, fmt.Errorf("'%v' is not a boolean value", value)
+	}
+	return result, nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"testing"
+)
+
+func TestEvaluateWhenCondition(t *testing.T) {
+	vars := map[string]string{"env": "prod", "free_disk": "2048", "upgraded": "false"}
+	cases := map[string]bool{
+		"env == 'prod'":                           true,
+		"prod == prod":                            true,
+		"staging == prod":                         false,
+		"free_disk > 1024 and not upgraded":       true,
+		"free_disk < 1024 || env != 'prod'":       false,
+		"(env == 'dev' or env == 'prod') && true": true,
+		"env contains 'ro'":                       true,
+		"defined env and not defined missing":     true,
+	}
+	for expression, expected := range cases {
+		result, err := EvaluateWhenCondition(expression, vars)
+		if err != nil {
+			t.Errorf("cannot evaluate %q: %v", expression, err)
+			continue
+		}
+		if result != expected {
+			t.Errorf("%q: expected %v", expression, expected)
+		}
+	}
+	for _, expression := range []string{"", "env == 'prod", "env ==", "(env == 'prod'", "env $ 1"} {
+		if _, err := EvaluateWhenCondition(expression, vars); err == nil {
+			t.Errorf("expected an error for %q", expression)
+		}
+	}
+	if _, err := EvaluateCondition("staging == prod", vars); err == nil {
+		t.Error("expected undefined identifiers to fail outside of 'when' expressions")
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ListConfigGroups get the config groups of the cluster
+func (a AmbariRegistry) ListConfigGroups() ([]ConfigGroup, error) {
+	request := a.CreateGetRequest("config_groups?fields=ConfigGroup/id,ConfigGroup/group_name,ConfigGroup/tag,ConfigGroup/description,ConfigGroup/hosts", true)
+	var configGroupsResponse ConfigGroupsResponse
+	if err := json.Unmarshal(ProcessRequest(request), &configGroupsResponse); err != nil {
+		return nil, err
+	}
+	configGroups := make([]ConfigGroup, 0)
+	for _, item := range configGroupsResponse.Items {
+		configGroups = append(configGroups, item.ConfigGroup)
+	}
+	return configGroups, nil
+}
+
+// getConfigGroup get a config group by name, returns false if it does not exist
+func (a AmbariRegistry) getConfigGroup(groupName string) (ConfigGroup, bool, error) {
+	configGroups, err := a.ListConfigGroups()
+	if err != nil {
+		return ConfigGroup{}, false, err
+	}
+	for _, configGroup := range configGroups {
+		if configGroup.GroupName == groupName {
+			return configGroup, true, nil
+		}
+	}
+	return ConfigGroup{}, false, nil
+}
+
+// SaveConfigGroup create a config group of a service with the hosts (ambari host names) and the config overrides (config type -> properties),
+// if the group already exists, its hosts and overrides are replaced
+func (a AmbariRegistry) SaveConfigGroup(groupName string, service string, description string, hosts []string, configs map[string]map[string]string) error {
+	configGroup, exists, err := a.getConfigGroup(groupName)
+	if err != nil {
+		return err
+	}
+	if exists && len(service) > 0 && configGroup.ServiceName != service {
+		return fmt.Errorf("Config group '%s' already exists for service %s (not %s)", groupName, configGroup.ServiceName, service)
+	}
+	if !exists && len(service) == 0 {
+		return fmt.Errorf("Service is required for creating config group '%s'", groupName)
+	}
+	if exists {
+		service = configGroup.ServiceName
+		if len(description) == 0 {
+			description = configGroup.Description
+		}
+	}
+	groupHosts := make([]map[string]string, 0)
+	for _, host := range hosts {
+		groupHosts = append(groupHosts, map[string]string{"host_name": host})
+	}
+	configTypes := make([]string, 0)
+	for configType := range configs {
+		configTypes = append(configTypes, configType)
+	}
+	sort.Strings(configTypes)
+	desiredConfigs := make([]map[string]interface{}, 0)
+	for _, configType := range configTypes {
+		desiredConfigs = append(desiredConfigs, map[string]interface{}{
+			"type":       configType,
+			"tag":        fmt.Sprintf("version%d", time.Now().UnixNano()/int64(time.Millisecond)),
+			"properties": configs[configType],
+		})
+	}
+	body := map[string]interface{}{"ConfigGroup": map[string]interface{}{
+		"group_name":      groupName,
+		"tag":             service,
+		"description":     description,
+		"hosts":           groupHosts,
+		"desired_configs": desiredConfigs,
+	}}
+	var bodyBytes bytes.Buffer
+	if exists {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		bodyBytes.Write(content)
+		ProcessRequest(a.CreatePutRequest(bodyBytes, fmt.Sprintf("config_groups/%d", int64(configGroup.ID)), true))
+		return nil
+	}
+	content, err := json.Marshal([]interface{}{body})
+	if err != nil {
+		return err
+	}
+	bodyBytes.Write(content)
+	ProcessRequest(a.CreatePostRequest(bodyBytes, "config_groups", true))
+	return nil
+}
+
+// DeleteConfigGroup delete a config group by name, deleting a group that does not exist does nothing
+func (a AmbariRegistry) DeleteConfigGroup(groupName string) error {
+	configGroup, exists, err := a.getConfigGroup(groupName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		outPrintln(fmt.Sprintf("Nothing to delete: config group '%s' does not exist", groupName))
+		return nil
+	}
+	ProcessRequest(a.CreateDeleteRequest(fmt.Sprintf("config_groups/%d", int64(configGroup.ID)), true))
+	return nil
+}
+
+// ExecuteConfigGroupTask creates (or updates) the config group ('group' parameter) of a service ('service' parameter) with the filtered hosts
+// and the configs of the task as overrides ('<config type>/<key>' keys), or deletes the group if 'operation' is delete
+func (a AmbariRegistry) ExecuteConfigGroupTask(task Task, filteredHosts map[string]bool) error {
+	groupName := task.Parameters["group"]
+	switch task.Parameters["operation"] {
+	case ConfigGroupDelete:
+		outPrintln(fmt.Sprintf("Delete config group '%s'", groupName))
+		return a.DeleteConfigGroup(groupName)
+	case ConfigGroupCreate:
+	default:
+		return fmt.Errorf("Unknown operation '%s' for '%s' task (use '%s' or '%s')", task.Parameters["operation"], ConfigGroupTask, ConfigGroupCreate, ConfigGroupDelete)
+	}
+	if len(task.ServiceFilter) == 0 && len(task.ComponentFilter) == 0 && len(task.HostFilter) == 0 {
+		return fmt.Errorf("'hosts', 'components' or 'services' field is required for selecting the hosts of config group '%s'", groupName)
+	}
+	configs, err := getConfigsByType(task)
+	if err != nil {
+		return err
+	}
+	hosts := make([]string, 0)
+	for host := range a.getAmbariHostNames(filteredHosts) {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	outPrintln(fmt.Sprintf("Save config group '%s' (hosts: %s, %d config types)", groupName, strings.Join(hosts, ", "), len(configs)))
+	return a.SaveConfigGroup(groupName, strings.ToUpper(task.Parameters["service"]), task.Parameters["description"], hosts, configs)
+}
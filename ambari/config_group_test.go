@@ -0,0 +1,122 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// decodeOperationBody decode the json body of a recorded operation ("<method> <path> <body>")
+func decodeOperationBody(t *testing.T, operation string, body interface{}) string {
+	parts := strings.SplitN(operation, " ", 3)
+	if len(parts) != 3 {
+		t.Fatalf("unexpected operation: %s", operation)
+	}
+	if err := json.Unmarshal([]byte(parts[2]), body); err != nil {
+		t.Fatalf("cannot decode the body of '%s': %v", operation, err)
+	}
+	return parts[0] + " " + parts[1]
+}
+
+func TestExecuteConfigGroupTask(t *testing.T) {
+	captureOutput(t)
+	var mutex sync.Mutex
+	configGroups := ""
+	setConfigGroups := func(items string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		configGroups = items
+	}
+	ambariRegistry, requests := newFakeAmbari(t, map[string][]string{"host1": {"HDFS_DATANODE"}, "host2": {"HDFS_DATANODE"}, "host3": {"YARN_NODEMANAGER"}},
+		func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasSuffix(r.URL.Path, "/config_groups") {
+				w.Write([]byte(`{"items":[]}`))
+				return
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			w.Write([]byte(`{"items":[` + configGroups + `]}`))
+		})
+	task := Task{Name: "large disks", Type: ConfigGroupTask, ComponentFilter: "HDFS_DATANODE",
+		Parameters: map[string]string{"operation": ConfigGroupCreate, "group": "large-disks", "service": "hdfs", "description": "Large disks"},
+		Configs:    map[string]string{"hdfs-site/dfs.datanode.du.reserved": "10737418240"}}
+
+	if err := ambariRegistry.ExecuteConfigGroupTask(task, ambariRegistry.GetFilteredHosts(CreateFilter("", "HDFS_DATANODE", "", false))); err != nil {
+		t.Fatal(err)
+	}
+	operations := requests.getOperations()
+	if len(operations) != 1 {
+		t.Fatalf("expected one request for creating the group: %v", operations)
+	}
+	var created []struct {
+		ConfigGroup struct {
+			GroupName      string              `json:"group_name"`
+			Tag            string              `json:"tag"`
+			Description    string              `json:"description"`
+			Hosts          []map[string]string `json:"hosts"`
+			DesiredConfigs []struct {
+				Type       string            `json:"type"`
+				Properties map[string]string `json:"properties"`
+			} `json:"desired_configs"`
+		}
+	}
+	if request := decodeOperationBody(t, operations[0], &created); request != "POST config_groups" || len(created) != 1 {
+		t.Fatalf("unexpected create request: %s", operations[0])
+	}
+	group := created[0].ConfigGroup
+	if group.GroupName != "large-disks" || group.Tag != "HDFS" || group.Description != "Large disks" ||
+		!reflect.DeepEqual(group.Hosts, []map[string]string{{"host_name": "host1"}, {"host_name": "host2"}}) {
+		t.Errorf("unexpected config group: %+v", group)
+	}
+	if len(group.DesiredConfigs) != 1 || group.DesiredConfigs[0].Type != "hdfs-site" || group.DesiredConfigs[0].Properties["dfs.datanode.du.reserved"] != "10737418240" {
+		t.Errorf("unexpected overrides: %+v", group.DesiredConfigs)
+	}
+
+	setConfigGroups(`{"ConfigGroup":{"id":5,"group_name":"large-disks","tag":"HDFS","description":"Large disks","hosts":[{"host_name":"host1"},{"host_name":"host2"}]}}`)
+	task.HostFilter = "host2"
+	if err := ambariRegistry.ExecuteConfigGroupTask(task, map[string]bool{"host2": true}); err != nil {
+		t.Fatal(err)
+	}
+	operations = requests.getOperations()
+	var updated struct {
+		ConfigGroup struct {
+			Hosts []map[string]string `json:"hosts"`
+		}
+	}
+	if request := decodeOperationBody(t, operations[1], &updated); request != "PUT config_groups/5" || !reflect.DeepEqual(updated.ConfigGroup.Hosts, []map[string]string{{"host_name": "host2"}}) {
+		t.Errorf("expected the hosts of the existing group to be replaced: %s", operations[1])
+	}
+	task.Parameters["service"] = "YARN"
+	if err := ambariRegistry.ExecuteConfigGroupTask(task, map[string]bool{"host2": true}); err == nil {
+		t.Error("expected an error for an existing group of another service")
+	}
+
+	deleteTask := Task{Name: "delete", Type: ConfigGroupTask, Parameters: map[string]string{"operation": ConfigGroupDelete, "group": "large-disks"}}
+	if err := ambariRegistry.ExecuteConfigGroupTask(deleteTask, nil); err != nil {
+		t.Fatal(err)
+	}
+	if operations = requests.getOperations(); len(operations) != 3 || !strings.HasPrefix(operations[2], "DELETE config_groups/5") {
+		t.Errorf("expected the group to be deleted: %v", operations)
+	}
+	setConfigGroups("")
+	if err := ambariRegistry.ExecuteConfigGroupTask(deleteTask, nil); err != nil || len(requests.getOperations()) != 3 {
+		t.Errorf("expected deleting a missing group to do nothing: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ListConfigVersions get the service config versions that include a config type (in increasing order of versions)
+func (a AmbariRegistry) ListConfigVersions(configType string) ([]ServiceConfigVersion, error) {
+	request := a.CreateGetRequest("configurations/service_config_versions?fields=service_name,service_config_version,is_current,"+
+		"service_config_version_note,user,createtime,configurations/type,configurations/tag,configurations/version", true)
+	var versionsResponse ServiceConfigVersionsResponse
+	if err := json.Unmarshal(ProcessRequest(request), &versionsResponse); err != nil {
+		return nil, err
+	}
+	versions := make([]ServiceConfigVersion, 0)
+	for _, version := range versionsResponse.Items {
+		for _, config := range version.Configurations {
+			if config.ServiceConfigType == configType {
+				versions = append(versions, version)
+				break
+			}
+		}
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("Config type '%s' does not exist", configType)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+	return versions, nil
+}
+
+// RollbackConfig make a previous service config version (of the service that owns the config type) current again,
+// note that every config type of the service is reverted to that version
+func (a AmbariRegistry) RollbackConfig(configType string, toVersion int) error {
+	versions, err := a.ListConfigVersions(configType)
+	if err != nil {
+		return err
+	}
+	available := make([]string, 0)
+	for _, version := range versions {
+		available = append(available, strconv.Itoa(version.Version))
+		if version.Version != toVersion {
+			continue
+		}
+		if version.IsCurrent {
+			outPrintln(fmt.Sprintf("Nothing to rollback: version %d of %s (config type: %s) is already the current one", toVersion, version.ServiceName, configType))
+			return nil
+		}
+		outPrintln(fmt.Sprintf("Rollback %s configs (config type: %s) to version %d", version.ServiceName, configType, toVersion))
+		body, err := json.Marshal(map[string]interface{}{"Clusters": map[string]interface{}{
+			"desired_service_config_versions": map[string]interface{}{
+				"service_name":                version.ServiceName,
+				"service_config_version":      toVersion,
+				"service_config_version_note": configVersionNote("", fmt.Sprintf("Rollback %s to version %d", configType, toVersion)),
+			},
+		}})
+		if err != nil {
+			return err
+		}
+		var bodyBytes bytes.Buffer
+		bodyBytes.Write(body)
+		ProcessRequest(a.CreatePutRequest(bodyBytes, "", true))
+		return nil
+	}
+	return fmt.Errorf("Version %d does not exist for config type '%s' (available versions: %s)", toVersion, configType, strings.Join(available, ", "))
+}
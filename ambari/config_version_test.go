@@ -0,0 +1,112 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newFakeConfigVersions start a fake ambari server with service config versions of HDFS (2 is the current one) and YARN,
+// the PUT request bodies of rollbacks are recorded
+func newFakeConfigVersions(t *testing.T) (AmbariRegistry, func() []map[string]interface{}) {
+	var mutex sync.Mutex
+	puts := make([]map[string]interface{}, 0)
+	ambariRegistry := newTestAmbari(t, func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if r.Method == "PUT" {
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			puts = append(puts, body)
+			return
+		}
+		if !strings.HasSuffix(r.URL.Path, "/configurations/service_config_versions") {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		hdfsConfigs := []ServiceConfig{{ServiceConfigType: "core-site"}, {ServiceConfigType: "hdfs-site"}}
+		json.NewEncoder(w).Encode(ServiceConfigVersionsResponse{Items: []ServiceConfigVersion{
+			{ServiceName: "HDFS", Version: 2, IsCurrent: true, Configurations: hdfsConfigs},
+			{ServiceName: "YARN", Version: 1, IsCurrent: true, Configurations: []ServiceConfig{{ServiceConfigType: "yarn-site"}}},
+			{ServiceName: "HDFS", Version: 1, Configurations: hdfsConfigs},
+		}})
+	})
+	return ambariRegistry, func() []map[string]interface{} {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return puts
+	}
+}
+
+func TestListConfigVersions(t *testing.T) {
+	ambariRegistry, _ := newFakeConfigVersions(t)
+	versions, err := ambariRegistry.ListConfigVersions("hdfs-site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Version != 1 || versions[1].Version != 2 || versions[0].ServiceName != "HDFS" {
+		t.Errorf("expected the HDFS versions in increasing order: %v", versions)
+	}
+	if _, err := ambariRegistry.ListConfigVersions("hive-site"); err == nil {
+		t.Error("expected an error for a config type without versions")
+	}
+}
+
+func TestRollbackConfig(t *testing.T) {
+	captureOutput(t)
+	ambariRegistry, puts := newFakeConfigVersions(t)
+	if err := ambariRegistry.RollbackConfig("core-site", 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(puts()) != 1 {
+		t.Fatalf("expected 1 rollback request, got: %v", puts())
+	}
+	desiredVersions := puts()[0]["Clusters"].(map[string]interface{})["desired_service_config_versions"].(map[string]interface{})
+	if desiredVersions["service_name"] != "HDFS" || desiredVersions["service_config_version"] != float64(1) ||
+		desiredVersions["service_config_version_note"] != "AMBARICTL - Rollback core-site to version 1" {
+		t.Errorf("unexpected rollback request: %v", desiredVersions)
+	}
+
+	if err := ambariRegistry.RollbackConfig("hdfs-site", 2); err != nil {
+		t.Fatal(err)
+	}
+	if len(puts()) != 1 {
+		t.Errorf("expected no rollback request for the current version, got: %v", puts())
+	}
+	if err := ambariRegistry.RollbackConfig("hdfs-site", 3); err == nil || !strings.Contains(err.Error(), "available versions: 1, 2") {
+		t.Errorf("expected an error with the available versions, got: %v", err)
+	}
+}
+
+func TestExecuteConfigTaskWithRollback(t *testing.T) {
+	captureOutput(t)
+	ambariRegistry, puts := newFakeConfigVersions(t)
+	task := Task{Name: "rollback", Type: Config, Parameters: map[string]string{"operation": ConfigRollback, "config_type": "hdfs-site", "version": "1"}}
+	if err := ambariRegistry.ExecuteConfigCommand(task); err != nil {
+		t.Fatal(err)
+	}
+	if len(puts()) != 1 {
+		t.Errorf("expected 1 rollback request, got: %v", puts())
+	}
+	for _, version := range []string{"", "latest"} {
+		task.Parameters["version"] = version
+		if err := ambariRegistry.ExecuteConfigCommand(task); err == nil {
+			t.Errorf("expected an error for version '%s'", version)
+		}
+	}
+}
@@ -148,6 +148,15 @@ func createHostComponentsType(item Item, hostComponents []HostComponent) []HostC
 		if state, ok := hostComponentI["state"]; ok {
 			hostComponent.HostComponentState = state.(string)
 		}
+		if version, ok := hostComponentI["version"]; ok && version != nil {
+			hostComponent.HostComponentVersion = version.(string)
+		}
+		if serviceName, ok := hostComponentI["service_name"]; ok && serviceName != nil {
+			hostComponent.HostComponentService = serviceName.(string)
+		}
+		if staleConfigs, ok := hostComponentI["stale_configs"].(bool); ok {
+			hostComponent.StaleConfigs = staleConfigs
+		}
 		hostComponents = append(hostComponents, hostComponent)
 	}
 	return hostComponents
@@ -0,0 +1,111 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+const environmentsJsonFileName = "environments.json"
+
+// ListEnvironmentEntries get all environments from ambarictl database
+func ListEnvironmentEntries() []Environment {
+	environments := make([]Environment, 0)
+	environmentsJsonFile := getJsonDbFile(environmentsJsonFileName)
+	if !exists(environmentsJsonFile) {
+		return environments
+	}
+	file, err := ioutil.ReadFile(environmentsJsonFile)
+	checkErr(err)
+	json.Unmarshal(file, &environments)
+	return environments
+}
+
+// GetEnvironmentById get the environment from ambarictl database by id
+func GetEnvironmentById(searchId string) Environment {
+	var result Environment
+	for _, environment := range ListEnvironmentEntries() {
+		if environment.Name == searchId {
+			result = environment
+		}
+	}
+	return result
+}
+
+// RegisterNewEnvironment create new environment entry (ambari server entry + connection profile) in ambarictl database
+func RegisterNewEnvironment(id string, ambariEntryId string, profileId string) {
+	if len(GetEnvironmentById(id).Name) > 0 {
+		errPrintln(fmt.Sprintf("Environment with id '%s' is already defined as an environment entry", id))
+		os.Exit(1)
+	}
+	if len(GetAmbariEntryId(ambariEntryId)) == 0 {
+		errPrintln(fmt.Sprintf("Ambari server entry does not exist with id '%s'", ambariEntryId))
+		os.Exit(1)
+	}
+	if len(profileId) > 0 && len(GetConnectionProfileEntryId(profileId)) == 0 {
+		errPrintln(fmt.Sprintf("Connection profile does not exist with id '%s'", profileId))
+		os.Exit(1)
+	}
+	environments := ListEnvironmentEntries()
+	environments = append(environments, Environment{Name: id, AmbariEntry: ambariEntryId, ConnectionProfile: profileId})
+	WriteEnvironmentEntries(environments)
+}
+
+// DeRegisterEnvironment remove an environment entry by id
+func DeRegisterEnvironment(id string) {
+	newEnvironments := make([]Environment, 0)
+	for _, environment := range ListEnvironmentEntries() {
+		if environment.Name != id {
+			newEnvironments = append(newEnvironments, environment)
+		}
+	}
+	WriteEnvironmentEntries(newEnvironments)
+}
+
+// UseEnvironment activate the ambari server entry of an environment and attach its connection profile in one step
+func UseEnvironment(id string) {
+	environment := GetEnvironmentById(id)
+	if len(environment.Name) == 0 {
+		errPrintln(fmt.Sprintf("Environment does not exist with id '%s'", id))
+		os.Exit(1)
+	}
+	if len(GetAmbariEntryId(environment.AmbariEntry)) == 0 {
+		errPrintln(fmt.Sprintf("Ambari server entry '%s' of environment '%s' does not exist", environment.AmbariEntry, id))
+		os.Exit(1)
+	}
+	if len(environment.ConnectionProfile) > 0 && len(GetConnectionProfileEntryId(environment.ConnectionProfile)) == 0 {
+		errPrintln(fmt.Sprintf("Connection profile '%s' of environment '%s' does not exist", environment.ConnectionProfile, id))
+		os.Exit(1)
+	}
+	ambariServers := ListAmbariRegistryEntries()
+	for index := range ambariServers {
+		ambariServers[index].Active = ambariServers[index].Name == environment.AmbariEntry
+		if ambariServers[index].Active && len(environment.ConnectionProfile) > 0 {
+			ambariServers[index].ConnectionProfile = environment.ConnectionProfile
+		}
+	}
+	WriteAmbariServerEntries(ambariServers)
+}
+
+// WriteEnvironmentEntries write environment entries to the environments json file
+func WriteEnvironmentEntries(environments []Environment) {
+	environmentsJson, _ := json.Marshal(environments)
+	environmentsJsonFile := getJsonDbFile(environmentsJsonFileName)
+	err := ioutil.WriteFile(environmentsJsonFile, FormatJson(environmentsJson).Bytes(), 0600)
+	checkErr(err)
+}
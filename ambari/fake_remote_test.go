@@ -0,0 +1,206 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const fakeProfileName = "fake"
+
+// fakeRemote replaces the ssh clients of the hosts during a test: the commands are answered by the run function (empty outputs by default),
+// the uploaded files are kept in memory, and the commands and the number of concurrently running commands are recorded
+type fakeRemote struct {
+	// run answers a command on a host (it can return an *ExitCodeError for a failed command)
+	run func(host string, command string) (string, string, error)
+	// lines are sent one by one (waiting lineDelay between them) by the streaming commands
+	lines     []string
+	lineDelay time.Duration
+	// delay is the duration of every command and copy
+	delay time.Duration
+
+	mutex      sync.Mutex
+	commands   map[string][]string
+	uploads    map[string]map[string][]byte
+	configs    map[string]*SshConfig
+	running    int
+	maxRunning int
+}
+
+type fakeRemoteClient struct {
+	remote *fakeRemote
+	host   string
+}
+
+// useFakeRemote register a connection profile (with become if it is set) and use the fake remote for the hosts until the end of the test,
+// returns the ambari registry entry with the profile attached
+func useFakeRemote(t *testing.T, remote *fakeRemote, ambariRegistry AmbariRegistry, become bool) AmbariRegistry {
+	resetDb(t)
+	err := RegisterNewConnectionProfile(fakeProfileName, "", 22, "root", "secret", "", false, "", nil, nil, nil, 0, become, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote.commands = make(map[string][]string)
+	remote.uploads = make(map[string]map[string][]byte)
+	remote.configs = make(map[string]*SshConfig)
+	previous := newRemoteClient
+	newRemoteClient = func(connectionProfile ConnectionProfile, password string, host string, skipJump bool) remoteClient {
+		remote.mutex.Lock()
+		remote.configs[host] = createSshConfig(connectionProfile, password, host, skipJump)
+		remote.mutex.Unlock()
+		return &fakeRemoteClient{remote: remote, host: host}
+	}
+	t.Cleanup(func() { newRemoteClient = previous })
+	ambariRegistry.ConnectionProfile = fakeProfileName
+	return ambariRegistry
+}
+
+// fakeHosts get the host filter for count hosts (host1, host2, ...)
+func fakeHosts(count int) map[string]bool {
+	hosts := make(map[string]bool)
+	for index := 1; index <= count; index++ {
+		hosts[fmt.Sprintf("host%d", index)] = true
+	}
+	return hosts
+}
+
+func (r *fakeRemote) start(host string, command string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.commands[host] = append(r.commands[host], command)
+	r.running++
+	if r.running > r.maxRunning {
+		r.maxRunning = r.running
+	}
+}
+
+func (r *fakeRemote) finish() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.running--
+}
+
+// getCommands get the commands that were run on a host
+func (r *fakeRemote) getCommands(host string) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string{}, r.commands[host]...)
+}
+
+// getUpload get the content of a file that was uploaded to a host
+func (r *fakeRemote) getUpload(host string, target string) ([]byte, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	content, ok := r.uploads[host][target]
+	return content, ok
+}
+
+func (r *fakeRemote) wait(ctx context.Context) error {
+	select {
+	case <-time.After(r.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *fakeRemoteClient) Run(ctx context.Context, command string, timeout int) (string, string, bool, error) {
+	c.remote.start(c.host, command)
+	defer c.remote.finish()
+	if err := c.remote.wait(ctx); err != nil {
+		return "", "", false, err
+	}
+	if c.remote.run == nil {
+		return "", "", true, nil
+	}
+	stdout, stderr, err := c.remote.run(c.host, command)
+	_, exitErr := err.(*ExitCodeError)
+	return stdout, stderr, err == nil || exitErr, err
+}
+
+func (c *fakeRemoteClient) RunStreaming(ctx context.Context, command string, timeout int, onLine func(line string, isStderr bool)) (string, string, bool, error) {
+	err := c.Stream(ctx, command, onLine)
+	if err != nil {
+		return "", "", false, err
+	}
+	return strings.Join(c.remote.lines, "\n") + "\n", "", true, nil
+}
+
+func (c *fakeRemoteClient) Stream(ctx context.Context, command string, onLine func(line string, isStderr bool)) error {
+	c.remote.start(c.host, command)
+	defer c.remote.finish()
+	for _, line := range c.remote.lines {
+		select {
+		case <-time.After(c.remote.lineDelay):
+		case <-ctx.Done():
+			return nil
+		}
+		onLine(line, false)
+	}
+	return nil
+}
+
+func (c *fakeRemoteClient) Scp(ctx context.Context, sourceFile string, targetFile string) error {
+	content, err := ioutil.ReadFile(sourceFile)
+	if err != nil {
+		return err
+	}
+	return c.ScpContent(ctx, content, targetFile)
+}
+
+func (c *fakeRemoteClient) ScpContent(ctx context.Context, content []byte, targetFile string) error {
+	c.remote.start(c.host, "scp -t "+targetFile)
+	defer c.remote.finish()
+	if err := c.remote.wait(ctx); err != nil {
+		return err
+	}
+	if c.remote.run != nil {
+		if _, _, err := c.remote.run(c.host, "scp -t "+targetFile); err != nil {
+			return err
+		}
+	}
+	c.remote.mutex.Lock()
+	defer c.remote.mutex.Unlock()
+	if c.remote.uploads[c.host] == nil {
+		c.remote.uploads[c.host] = make(map[string][]byte)
+	}
+	c.remote.uploads[c.host][targetFile] = append([]byte{}, content...)
+	return nil
+}
+
+// Download write the standard output of the "scp -f <source>" command (answered by the run function) to the target file
+func (c *fakeRemoteClient) Download(ctx context.Context, sourceFile string, targetFile string) error {
+	command := "scp -f " + sourceFile
+	c.remote.start(c.host, command)
+	defer c.remote.finish()
+	if err := c.remote.wait(ctx); err != nil {
+		return err
+	}
+	content := ""
+	if c.remote.run != nil {
+		stdout, _, err := c.remote.run(c.host, command)
+		if err != nil {
+			return err
+		}
+		content = stdout
+	}
+	return ioutil.WriteFile(targetFile, []byte(content), 0600)
+}
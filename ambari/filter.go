@@ -14,35 +14,170 @@
 
 package ambari
 
-import "strings"
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
 
-// Filter represents filter on agent hosts (by component / service / hosts)
+// Filter represents filter on agent hosts (by component / service / hosts), the excluded values (prefixed with '!' in filter strings)
+// are applied after the included ones: hosts that are excluded, or have an excluded service or component are always dropped
 type Filter struct {
-	Services   []string
-	Components []string
-	Hosts      []string
-	Server     bool
+	Services           []string `yaml:"services,omitempty"`
+	Components         []string `yaml:"components,omitempty"`
+	Hosts              []string `yaml:"hosts,omitempty"`
+	MissingComponents  []string `yaml:"missing_components,omitempty"`
+	ExcludedServices   []string `yaml:"exclude_services,omitempty"`
+	ExcludedComponents []string `yaml:"exclude_components,omitempty"`
+	ExcludedHosts      []string `yaml:"exclude_hosts,omitempty"`
+	Server             bool     `yaml:"ambari_server,omitempty"`
 }
 
-// CreateFilter will make a Filter object from filter strings (component / service / hosts)
-func CreateFilter(serviceFilter string, componentFilter string, hostFilter string, ambariServer bool) Filter {
-	filter := Filter{}
-	if len(serviceFilter) > 0 {
-		services := strings.Split(serviceFilter, ",")
-		filter.Services = services
+// excludePrefix marks the excluded values in filter strings (e.g.: DATANODE,!c7402.ambari.apache.org)
+const excludePrefix = "!"
+
+// HostComponentFilter selects host components by service, component and state, its string form is service/component/state
+// (e.g. HDFS/DATANODE/STARTED), every part can be '*' (or left out from the end), the state can be 'stale' for host components with stale configs
+type HostComponentFilter struct {
+	Service   string
+	Component string
+	State     string
+}
+
+// StaleConfigsState is the state of the host component filter that matches the host components with stale configs
+const StaleConfigsState = "stale"
+
+// ParseHostComponentFilter create a host component filter from its string form (service/component/state)
+func ParseHostComponentFilter(filterStr string) (HostComponentFilter, error) {
+	parts := strings.Split(strings.TrimSpace(filterStr), "/")
+	if len(filterStr) == 0 || len(parts) > 3 {
+		return HostComponentFilter{}, fmt.Errorf("Invalid host component filter '%s', use service/component/state format (e.g. HDFS/*/stale)", filterStr)
+	}
+	for len(parts) < 3 {
+		parts = append(parts, "*")
+	}
+	return HostComponentFilter{Service: parts[0], Component: parts[1], State: parts[2]}, nil
+}
+
+// Matches reports whether a host component is selected by the filter
+func (f HostComponentFilter) Matches(hostComponent HostComponent) bool {
+	if f.Service != "*" && !strings.EqualFold(f.Service, hostComponent.HostComponentService) {
+		return false
+	}
+	if f.Component != "*" && !strings.EqualFold(f.Component, hostComponent.HostComponentName) {
+		return false
+	}
+	if strings.EqualFold(f.State, StaleConfigsState) {
+		return hostComponent.StaleConfigs
+	}
+	return f.State == "*" || strings.EqualFold(f.State, hostComponent.HostComponentState)
+}
+
+// LimitHosts keep only those filtered hosts (with the same keys as GetFilteredHosts) that are in the host limit
+// (host names, public host names or IPs), empty limit means no limit
+func (a AmbariRegistry) LimitHosts(filteredHosts map[string]bool, hostLimit []string) map[string]bool {
+	if len(hostLimit) == 0 {
+		return filteredHosts
+	}
+	allowedHosts := make(map[string]bool)
+	for _, host := range hostLimit {
+		allowedHosts[host] = true
+	}
+	for _, agent := range a.ListAgents() {
+		if allowedHosts[agent.IP] || allowedHosts[agent.HostName] || allowedHosts[agent.PublicHostname] {
+			allowedHosts[agent.IP] = true
+			allowedHosts[agent.HostName] = true
+			allowedHosts[agent.PublicHostname] = true
+		}
+	}
+	limitedHosts := make(map[string]bool)
+	for host := range filteredHosts {
+		if allowedHosts[host] {
+			limitedHosts[host] = true
+		}
+	}
+	return limitedHosts
+}
+
+var (
+	filterNamePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+	filterHostPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]*$`)
+)
+
+// ParseFilter make a Filter object from comma separated filter strings (services / components / hosts / missing components),
+// the values are trimmed, empty and duplicated values are dropped, service and component names are upper-cased,
+// values with '!' prefix are excluded (except for missing components), returns error if a value is not a valid service / component / host name
+func ParseFilter(serviceFilter string, componentFilter string, hostFilter string, missingComponentFilter string, ambariServer bool) (Filter, error) {
+	filter := Filter{Server: ambariServer}
+	var err error
+	if filter.Services, filter.ExcludedServices, err = parseFilterValues("services", serviceFilter, true, filterNamePattern); err != nil {
+		return Filter{}, err
 	}
-	if len(componentFilter) > 0 {
-		components := strings.Split(componentFilter, ",")
-		filter.Components = components
+	if filter.Components, filter.ExcludedComponents, err = parseFilterValues("components", componentFilter, true, filterNamePattern); err != nil {
+		return Filter{}, err
 	}
-	if len(hostFilter) > 0 {
-		hosts := strings.Split(hostFilter, ",")
-		filter.Hosts = hosts
+	if filter.Hosts, filter.ExcludedHosts, err = parseFilterValues("hosts", hostFilter, false, filterHostPattern); err != nil {
+		return Filter{}, err
 	}
+	var excludedMissingComponents []string
+	if filter.MissingComponents, excludedMissingComponents, err = parseFilterValues("missing_components", missingComponentFilter, true, filterNamePattern); err != nil {
+		return Filter{}, err
+	}
+	if len(excludedMissingComponents) > 0 {
+		return Filter{}, fmt.Errorf("Exclusions are not supported in missing_components filter '%s'", missingComponentFilter)
+	}
+	return filter, nil
+}
+
+// parseFilterValues split a comma separated filter string to included and excluded values (nil if there are no such values)
+func parseFilterValues(filterName string, filterStr string, upperCase bool, pattern *regexp.Regexp) ([]string, []string, error) {
+	included, excluded := splitFilterValues(filterStr, upperCase)
+	for _, value := range append(append([]string{}, included...), excluded...) {
+		if !pattern.MatchString(value) {
+			return nil, nil, fmt.Errorf("Invalid value '%s' in %s filter '%s'", value, filterName, filterStr)
+		}
+	}
+	return included, excluded, nil
+}
+
+// splitFilterValues split a comma separated filter string to trimmed, unique and non-empty included and excluded values
+func splitFilterValues(filterStr string, upperCase bool) ([]string, []string) {
+	var included, excluded []string
+	for _, value := range strings.Split(filterStr, ",") {
+		value = strings.TrimSpace(value)
+		if upperCase {
+			value = strings.ToUpper(value)
+		}
+		if strings.HasPrefix(value, excludePrefix) {
+			value = strings.TrimSpace(strings.TrimPrefix(value, excludePrefix))
+			if len(value) > 0 && !containsString(excluded, value) {
+				excluded = append(excluded, value)
+			}
+		} else if len(value) > 0 && !containsString(included, value) {
+			included = append(included, value)
+		}
+	}
+	return included, excluded
+}
+
+// CreateFilter will make a Filter object from filter strings (component / service / hosts), the values are normalized
+// the same way as by ParseFilter, but without validation
+func CreateFilter(serviceFilter string, componentFilter string, hostFilter string, ambariServer bool) Filter {
+	filter := Filter{}
+	filter.Services, filter.ExcludedServices = splitFilterValues(serviceFilter, true)
+	filter.Components, filter.ExcludedComponents = splitFilterValues(componentFilter, true)
+	filter.Hosts, filter.ExcludedHosts = splitFilterValues(hostFilter, false)
 	filter.Server = ambariServer
 	return filter
 }
 
+// CreateMissingComponentsFilter add missing components to a filter from a filter string: only those hosts are kept that do not have any of the components
+func CreateMissingComponentsFilter(filter Filter, missingComponentFilter string) Filter {
+	filter.MissingComponents, _ = splitFilterValues(missingComponentFilter, true)
+	return filter
+}
+
 // GetFilteredHosts obtain specific hosts based on different filters
 func (a AmbariRegistry) GetFilteredHosts(filter Filter) map[string]bool {
 	finalHosts := make(map[string]bool)
@@ -64,17 +199,164 @@ func (a AmbariRegistry) GetFilteredHosts(filter Filter) map[string]bool {
 		}
 	}
 	if filter.Server {
-		hosts[a.Hostname] = true
-		finalHosts[a.Hostname] = true
+		for _, serverHost := range a.GetAmbariServerHosts() {
+			if len(filter.Hosts) > 0 && !containsString(filter.Hosts, serverHost) {
+				continue
+			}
+			if containsString(filter.ExcludedHosts, serverHost) {
+				continue
+			}
+			finalHosts[serverHost] = true
+		}
 	} else {
 		agents := a.ListAgents()
-		calculateAndFillFinalHosts(agents, filter, hosts, finalHosts)
+		excludedHosts := a.getHostsWithComponents(append(append([]string{}, filter.MissingComponents...), filter.ExcludedComponents...))
+		for _, service := range filter.ExcludedServices {
+			for _, hostComponent := range a.ListHostComponentsByService(service) {
+				excludedHosts[hostComponent.HostComponntHost] = true
+			}
+		}
+		for _, host := range filter.ExcludedHosts {
+			excludedHosts[host] = true
+		}
+		calculateAndFillFinalHosts(agents, filter, hosts, excludedHosts, finalHosts)
 	}
 	return finalHosts
 }
 
-func calculateAndFillFinalHosts(agents []Host, filter Filter, hosts map[string]bool, finalHosts map[string]bool) {
+// GetFilteredHostComponents obtain specific hosts based on different filters (with the same keys as GetFilteredHosts) with the components
+// that are matched on the hosts: the components of the filtered services / components that are installed on the host
+// (every component of the host if there is no service / component filter)
+func (a AmbariRegistry) GetFilteredHostComponents(filter Filter) map[string][]string {
+	return a.matchHostComponents(filter, a.GetFilteredHosts(filter))
+}
+
+// matchHostComponents get the matched components of the filter for the already filtered hosts
+func (a AmbariRegistry) matchHostComponents(filter Filter, filteredHosts map[string]bool) map[string][]string {
+	result := make(map[string][]string)
+	hostKeys := make(map[string]string)
+	for _, agent := range a.ListAgents() {
+		for _, key := range []string{agent.IP, agent.HostName, agent.PublicHostname} {
+			if filteredHosts[key] {
+				hostKeys[agent.HostName] = key
+				break
+			}
+		}
+	}
+	for host := range filteredHosts {
+		result[host] = make([]string, 0)
+	}
+	matchAll := len(filter.Services) == 0 && len(filter.Components) == 0
+	for _, hostComponent := range a.ListHostComponentsWithConfigState() {
+		key, ok := hostKeys[hostComponent.HostComponntHost]
+		if !ok {
+			continue
+		}
+		if containsString(filter.ExcludedComponents, hostComponent.HostComponentName) || containsString(filter.ExcludedServices, hostComponent.HostComponentService) {
+			continue
+		}
+		if matchAll || containsString(filter.Components, hostComponent.HostComponentName) || containsString(filter.Services, hostComponent.HostComponentService) {
+			if !containsString(result[key], hostComponent.HostComponentName) {
+				result[key] = append(result[key], hostComponent.HostComponentName)
+			}
+		}
+	}
+	for host := range result {
+		sort.Strings(result[host])
+	}
+	return result
+}
+
+// ResolveExclusions apply the service and component exclusions of a filter on its service and component lists (for ambari commands):
+// the excluded names (and the components of the excluded services) are removed, if only exclusions are given, the lists are filled
+// with every service (or component) of the cluster first
+func (a AmbariRegistry) ResolveExclusions(filter Filter) Filter {
+	if len(filter.ExcludedServices) == 0 && len(filter.ExcludedComponents) == 0 {
+		return filter
+	}
+	services := filter.Services
+	if len(services) == 0 && len(filter.Components) == 0 && len(filter.ExcludedServices) > 0 {
+		for _, service := range a.ListServices() {
+			services = append(services, service.ServiceName)
+		}
+	}
+	components := filter.Components
+	var allComponents []Component
+	if len(filter.ExcludedComponents) > 0 || (len(components) > 0 && len(filter.ExcludedServices) > 0) {
+		allComponents = a.ListComponents()
+	}
+	if len(components) == 0 && len(filter.ExcludedComponents) > 0 {
+		for _, component := range allComponents {
+			if len(filter.Services) == 0 || containsString(filter.Services, component.ServiceName) {
+				components = append(components, component.ComponentName)
+			}
+		}
+	}
+	resolved := filter
+	resolved.Services = make([]string, 0)
+	for _, service := range services {
+		if !containsString(filter.ExcludedServices, service) {
+			resolved.Services = append(resolved.Services, service)
+		}
+	}
+	resolved.Components = make([]string, 0)
+	for _, component := range components {
+		if containsString(filter.ExcludedComponents, component) {
+			continue
+		}
+		excludedService := false
+		for _, c := range allComponents {
+			if c.ComponentName == component && containsString(filter.ExcludedServices, c.ServiceName) {
+				excludedService = true
+			}
+		}
+		if !excludedService {
+			resolved.Components = append(resolved.Components, component)
+		}
+	}
+	resolved.ExcludedServices = nil
+	resolved.ExcludedComponents = nil
+	return resolved
+}
+
+// GetAmbariServerHosts get all ambari server hosts (multiple ones in HA setups), defaults to the hostname of the registry entry
+func (a AmbariRegistry) GetAmbariServerHosts() []string {
+	if len(a.ServerHosts) > 0 {
+		return a.ServerHosts
+	}
+	return []string{a.Hostname}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// getHostsWithComponents get the hosts that have any of the components (based on the host -> components mapping, so only one request is needed)
+func (a AmbariRegistry) getHostsWithComponents(components []string) map[string]bool {
+	hostsWithComponents := make(map[string]bool)
+	if len(components) == 0 {
+		return hostsWithComponents
+	}
+	for host, hostComponents := range a.GetHostComponentMapping() {
+		for _, component := range hostComponents {
+			if containsString(components, component) {
+				hostsWithComponents[host] = true
+			}
+		}
+	}
+	return hostsWithComponents
+}
+
+func calculateAndFillFinalHosts(agents []Host, filter Filter, hosts map[string]bool, excludedHosts map[string]bool, finalHosts map[string]bool) {
 	for _, agent := range agents {
+		if excludedHosts[agent.HostName] || excludedHosts[agent.PublicHostname] || excludedHosts[agent.IP] {
+			continue
+		}
 		if len(filter.Hosts) > 0 {
 			filteredHosts := filter.Hosts
 			containsHost := false
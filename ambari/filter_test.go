@@ -0,0 +1,175 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestHostComponentFilter(t *testing.T) {
+	datanode := HostComponent{HostComponentService: "HDFS", HostComponentName: "DATANODE", HostComponentState: "STARTED", StaleConfigs: true}
+	namenode := HostComponent{HostComponentService: "HDFS", HostComponentName: "NAMENODE", HostComponentState: "INSTALLED"}
+	cases := map[string][]bool{
+		"HDFS":               {true, true},
+		"hdfs/*/stale":       {true, false},
+		"HDFS/NAMENODE":      {false, true},
+		"*/*/STARTED":        {true, false},
+		"YARN/*/*":           {false, false},
+		"*/datanode/started": {true, false},
+	}
+	for filterStr, expected := range cases {
+		filter, err := ParseHostComponentFilter(filterStr)
+		if err != nil {
+			t.Errorf("cannot parse %q: %v", filterStr, err)
+			continue
+		}
+		if filter.Matches(datanode) != expected[0] || filter.Matches(namenode) != expected[1] {
+			t.Errorf("%q: expected matches %v", filterStr, expected)
+		}
+	}
+	for _, filterStr := range []string{"", "HDFS/DATANODE/stale/extra"} {
+		if _, err := ParseHostComponentFilter(filterStr); err == nil {
+			t.Errorf("expected an error for %q", filterStr)
+		}
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	filter, err := ParseFilter("HDFS,,YARN,", " datanode , NodeManager,DATANODE", "c7401.ambari.apache.org, ,c7402.ambari.apache.org", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Filter{Services: []string{"HDFS", "YARN"}, Components: []string{"DATANODE", "NODEMANAGER"},
+		Hosts: []string{"c7401.ambari.apache.org", "c7402.ambari.apache.org"}}
+	if !reflect.DeepEqual(filter, expected) {
+		t.Errorf("unexpected filter: %+v", filter)
+	}
+
+	filter, err = ParseFilter("", " , ", ",", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(filter, Filter{Server: true}) {
+		t.Errorf("expected an empty filter, got: %+v", filter)
+	}
+
+	filter, err = ParseFilter("hdfs", "", "", " zookeeper_server,ZOOKEEPER_SERVER ", false)
+	if err != nil || !reflect.DeepEqual(filter.MissingComponents, []string{"ZOOKEEPER_SERVER"}) {
+		t.Errorf("unexpected missing components: %+v, err: %v", filter, err)
+	}
+
+	invalidFilters := [][]string{
+		{"HDFS YARN", "", "", ""},
+		{"HDFS;YARN", "", "", ""},
+		{"", "1DATANODE", "", ""},
+		{"", "DATA-NODE", "", ""},
+		{"", "", "host1 host2", ""},
+		{"", "", "-host1", ""},
+		{"", "", "", "HDFS/DATANODE"},
+		{"", "", "", "!DATANODE"},
+	}
+	for _, values := range invalidFilters {
+		if filter, err := ParseFilter(values[0], values[1], values[2], values[3], false); err == nil {
+			t.Errorf("expected an error for %q, got: %+v", values, filter)
+		}
+	}
+
+	createdFilter := CreateFilter(" hdfs,,HDFS", "DATANODE,", " host1 ", false)
+	if !reflect.DeepEqual(createdFilter, Filter{Services: []string{"HDFS"}, Components: []string{"DATANODE"}, Hosts: []string{"host1"}}) {
+		t.Errorf("expected the same normalization by CreateFilter: %+v", createdFilter)
+	}
+}
+
+func TestFilterExclusions(t *testing.T) {
+	ambariRegistry, _ := newFakeAmbari(t, map[string][]string{
+		"host1": {"HDFS_DATANODE", "ZOOKEEPER_SERVER"},
+		"host2": {"HDFS_DATANODE"},
+		"host3": {"HDFS_DATANODE", "YARN_NODEMANAGER"},
+		"host4": {"YARN_NODEMANAGER"},
+	}, nil)
+	cases := []struct {
+		services, components, hosts string
+		expected                    []string
+	}{
+		{"", "HDFS_DATANODE", "!host2", []string{"host1", "host3"}},
+		{"", "HDFS_DATANODE,!YARN_NODEMANAGER", "", []string{"host1", "host2"}},
+		{"HDFS,!ZOOKEEPER", "", "", []string{"host2", "host3"}},
+		{"", "", "host1,host2,!host1", []string{"host2"}},
+		{"!YARN", "", "", []string{"host1", "host2"}},
+		{"", "HDFS_DATANODE", "!host1,!host2,!host3", []string{}},
+	}
+	for _, c := range cases {
+		filter, err := ParseFilter(c.services, c.components, c.hosts, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts := ambariRegistry.GetFilteredHosts(filter)
+		if !reflect.DeepEqual(sortedHosts(hosts), c.expected) {
+			t.Errorf("%q/%q/%q: expected %v, got: %v", c.services, c.components, c.hosts, c.expected, sortedHosts(hosts))
+		}
+	}
+
+	resolved := ambariRegistry.ResolveExclusions(CreateFilter("!YARN", "", "", false))
+	if !reflect.DeepEqual(resolved.Services, []string{"HDFS", "ZOOKEEPER"}) || len(resolved.ExcludedServices) > 0 {
+		t.Errorf("expected every other service to be targeted: %+v", resolved)
+	}
+	resolved = ambariRegistry.ResolveExclusions(CreateFilter("HDFS,YARN", "!HDFS_DATANODE", "", false))
+	if !reflect.DeepEqual(resolved.Services, []string{"HDFS", "YARN"}) || !reflect.DeepEqual(resolved.Components, []string{"YARN_NODEMANAGER"}) {
+		t.Errorf("expected the other components of the services to be targeted: %+v", resolved)
+	}
+	resolved = ambariRegistry.ResolveExclusions(CreateFilter("!HDFS", "HDFS_DATANODE,ZOOKEEPER_SERVER", "", false))
+	if !reflect.DeepEqual(resolved.Components, []string{"ZOOKEEPER_SERVER"}) {
+		t.Errorf("expected the components of the excluded service to be removed: %+v", resolved)
+	}
+}
+
+// sortedHosts get the filtered hosts in order
+func sortedHosts(hosts map[string]bool) []string {
+	result := make([]string, 0)
+	for host := range hosts {
+		result = append(result, host)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestGetFilteredHostComponents(t *testing.T) {
+	ambariRegistry := newFakeCluster(t, map[string][]string{
+		"host1": {"HDFS_DATANODE", "HDFS_CLIENT", "ZOOKEEPER_SERVER"},
+		"host2": {"HDFS_DATANODE", "YARN_NODEMANAGER"},
+		"host3": {"YARN_NODEMANAGER"},
+	}, nil)
+	cases := []struct {
+		filter   Filter
+		expected map[string][]string
+	}{
+		{CreateFilter("", "HDFS_DATANODE", "", false), map[string][]string{"host1": {"HDFS_DATANODE"}, "host2": {"HDFS_DATANODE"}}},
+		{CreateFilter("", "HDFS_DATANODE,YARN_NODEMANAGER", "host2,host3", false), map[string][]string{"host2": {"HDFS_DATANODE", "YARN_NODEMANAGER"}, "host3": {"YARN_NODEMANAGER"}}},
+		{CreateFilter("HDFS", "", "", false), map[string][]string{"host1": {"HDFS_CLIENT", "HDFS_DATANODE"}, "host2": {"HDFS_DATANODE"}}},
+		{CreateFilter("", "", "host1", false), map[string][]string{"host1": {"HDFS_CLIENT", "HDFS_DATANODE", "ZOOKEEPER_SERVER"}}},
+		{CreateFilter("HDFS", "!HDFS_CLIENT", "", false), map[string][]string{"host2": {"HDFS_DATANODE"}}},
+	}
+	for _, c := range cases {
+		hostComponents := ambariRegistry.GetFilteredHostComponents(c.filter)
+		if !reflect.DeepEqual(hostComponents, c.expected) {
+			t.Errorf("%+v: expected %v, got: %v", c.filter, c.expected, hostComponents)
+		}
+		if hosts := ambariRegistry.GetFilteredHosts(c.filter); len(hosts) != len(hostComponents) {
+			t.Errorf("%+v: expected the same hosts as GetFilteredHosts: %v", c.filter, hosts)
+		}
+	}
+}
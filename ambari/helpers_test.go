@@ -0,0 +1,292 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestMain runs the tests with an empty ambarictl database in a temporary folder and without outputs
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "ambarictl-test-")
+	if err != nil {
+		panic(err)
+	}
+	dbFolder = dir
+	os.Unsetenv(SecretEnvVariable)
+	SetExecutionContext(NewExecutionContext(ioutil.Discard, ioutil.Discard))
+	CreateAmbariRegistryDb()
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// resetDb remove every entry from the test database
+func resetDb(t *testing.T) {
+	files, err := ioutil.ReadDir(dbFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if err := os.RemoveAll(filepath.Join(dbFolder, file.Name())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	CreateAmbariRegistryDb()
+}
+
+// captureOutput collect the outputs of the ambari package (normal and error outputs together) until the end of the test
+func captureOutput(t *testing.T) *bytes.Buffer {
+	var output bytes.Buffer
+	previous := GetExecutionContext()
+	SetExecutionContext(NewExecutionContext(&output, &output))
+	t.Cleanup(func() { SetExecutionContext(previous) })
+	return &output
+}
+
+// newTestAmbari start a fake ambari server with the handler, returns a registry entry (cluster: cl1) that points to it
+func newTestAmbari(t *testing.T, handler http.HandlerFunc) AmbariRegistry {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	serverUrl, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(serverUrl.Port())
+	return AmbariRegistry{Name: "test", Hostname: serverUrl.Hostname(), Port: port, Protocol: "http", Cluster: "cl1", Username: "admin", Password: "admin"}
+}
+
+// emptyItemsHandler answers every ambari request with an empty list (e.g. no hosts for the filters)
+func emptyItemsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(`{"items":[]}`))
+}
+
+// newFakeCluster start a fake ambari server with hosts (the host name, the public host name and the ip are the same) and their components,
+// the hosts and host components requests are answered from these (filtered by hosts, components or services with the SERVICE_COMPONENT naming),
+// other requests are handled by the fallback handler (or get empty lists if it is nil)
+func newFakeCluster(t *testing.T, hostComponents map[string][]string, fallback http.HandlerFunc) AmbariRegistry {
+	return newTestAmbari(t, func(w http.ResponseWriter, r *http.Request) {
+		items := make([]map[string]interface{}, 0)
+		switch {
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/api/v1/hosts"):
+			for _, host := range sortedKeys(hostComponents) {
+				items = append(items, map[string]interface{}{"Hosts": map[string]interface{}{"host_name": host, "public_host_name": host, "ip": host}})
+			}
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/host_components"):
+			query := r.URL.Query()
+			for _, host := range sortedKeys(hostComponents) {
+				for _, component := range hostComponents[host] {
+					service := strings.SplitN(component, "_", 2)[0]
+					if (len(query.Get("HostRoles/host_name")) > 0 && query.Get("HostRoles/host_name") != host) ||
+						(len(query.Get("HostRoles/component_name")) > 0 && query.Get("HostRoles/component_name") != component) ||
+						(len(query.Get("component/ServiceComponentInfo/service_name")) > 0 && query.Get("component/ServiceComponentInfo/service_name") != service) {
+						continue
+					}
+					items = append(items, map[string]interface{}{"HostRoles": map[string]interface{}{"host_name": host, "component_name": component,
+						"service_name": service, "state": "STARTED"}})
+				}
+			}
+		case fallback != nil:
+			fallback(w, r)
+			return
+		}
+		response, _ := json.Marshal(map[string]interface{}{"items": items})
+		w.Write(response)
+	})
+}
+
+// sortedKeys get the keys of the map in order
+func sortedKeys(values map[string][]string) []string {
+	keys := make([]string, 0)
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// loadTestPlaybook write the playbook content to a temporary file and load it with the variables (name=value pairs)
+func loadTestPlaybook(t *testing.T, content string, vars string) Playbook {
+	location := filepath.Join(t.TempDir(), "playbook.yml")
+	if err := ioutil.WriteFile(location, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	varMap, err := createVarMap(vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	playbook, err := loadPlaybookFile(location, varMap, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	playbook.Variables = make(map[string]string)
+	for name, value := range varMap {
+		playbook.Variables[name] = value.(string)
+	}
+	return playbook
+}
+
+// fakeConfigs holds the config versions (properties by tags) of the config types for a fake ambari server,
+// the desired config changes (PUT requests of the cluster) are applied to them and recorded
+type fakeConfigs struct {
+	mutex    sync.Mutex
+	desired  map[string]string
+	versions map[string]map[string]map[string]string
+	puts     []map[string]interface{}
+}
+
+// newFakeConfigs start a fake ambari server that serves the desired configs and the config versions of the config types (with 'initial' tags),
+// other requests are handled by the fallback handler (or get empty lists if it is nil)
+func newFakeConfigs(t *testing.T, configs map[string]map[string]string, fallback http.HandlerFunc) (AmbariRegistry, *fakeConfigs) {
+	fake := &fakeConfigs{desired: make(map[string]string), versions: make(map[string]map[string]map[string]string)}
+	for configType, properties := range configs {
+		fake.desired[configType] = "initial"
+		fake.versions[configType] = map[string]map[string]string{"initial": properties}
+	}
+	ambariRegistry := newTestAmbari(t, func(w http.ResponseWriter, r *http.Request) {
+		fake.mutex.Lock()
+		defer fake.mutex.Unlock()
+		var response interface{}
+		switch {
+		case r.Method == "PUT" && r.URL.Path == "/api/v1/clusters/cl1/":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			fake.puts = append(fake.puts, body)
+			if desiredConfig, ok := body["Clusters"].(map[string]interface{})["desired_config"].(map[string]interface{}); ok {
+				configType, tag := desiredConfig["type"].(string), desiredConfig["tag"].(string)
+				properties := make(map[string]string)
+				for key, value := range desiredConfig["properties"].(map[string]interface{}) {
+					properties[key] = value.(string)
+				}
+				fake.desired[configType] = tag
+				fake.versions[configType][tag] = properties
+			}
+			return
+		case r.Method == "GET" && r.URL.Path == "/api/v1/clusters/cl1/":
+			desiredConfigs := make(map[string]interface{})
+			for configType, tag := range fake.desired {
+				desiredConfigs[configType] = map[string]string{"tag": tag}
+			}
+			response = map[string]interface{}{"Clusters": map[string]interface{}{"desired_configs": desiredConfigs}}
+		case r.Method == "GET" && r.URL.Path == "/api/v1/clusters/cl1/configurations":
+			configType, tag := r.URL.Query().Get("type"), r.URL.Query().Get("tag")
+			items := make([]interface{}, 0)
+			if properties, ok := fake.versions[configType][tag]; ok {
+				items = append(items, map[string]interface{}{"tag": tag, "properties": properties})
+			}
+			response = map[string]interface{}{"items": items}
+		case fallback != nil:
+			fallback(w, r)
+			return
+		default:
+			response = map[string]interface{}{"items": []interface{}{}}
+		}
+		content, _ := json.Marshal(response)
+		w.Write(content)
+	})
+	return ambariRegistry, fake
+}
+
+// getDesired get the properties of the desired version of a config type
+func (f *fakeConfigs) getDesired(configType string) map[string]string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.versions[configType][f.desired[configType]]
+}
+
+// getPuts get the bodies of the PUT requests of the cluster
+func (f *fakeConfigs) getPuts() []map[string]interface{} {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]map[string]interface{}{}, f.puts...)
+}
+
+// fakeRequests records the operations (POST, PUT and DELETE requests) that are sent to a fake ambari server,
+// every operation creates an ambari request that finishes with the status immediately (COMPLETED by default)
+type fakeRequests struct {
+	mutex      sync.Mutex
+	status     string
+	operations []string
+}
+
+// newFakeAmbari start a fake ambari server like newFakeCluster, that also serves the components and the services of the hosts
+// and records the operations, other requests are handled by the fallback handler (or get empty lists if it is nil)
+func newFakeAmbari(t *testing.T, hostComponents map[string][]string, fallback http.HandlerFunc) (AmbariRegistry, *fakeRequests) {
+	fake := &fakeRequests{status: "COMPLETED"}
+	ambariRegistry := newFakeCluster(t, hostComponents, func(w http.ResponseWriter, r *http.Request) {
+		fake.mutex.Lock()
+		defer fake.mutex.Unlock()
+		var response interface{}
+		switch {
+		case r.Method != "GET":
+			body, _ := ioutil.ReadAll(r.Body)
+			fake.operations = append(fake.operations, fmt.Sprintf("%s %s %s", r.Method, strings.TrimPrefix(r.URL.Path, "/api/v1/clusters/cl1/"), body))
+			response = map[string]interface{}{"Requests": map[string]interface{}{"id": len(fake.operations), "status": "Accepted"}}
+		case strings.HasPrefix(r.URL.Path, "/api/v1/clusters/cl1/requests/"):
+			id, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/v1/clusters/cl1/requests/"))
+			response = map[string]interface{}{"Requests": map[string]interface{}{"id": id, "request_status": fake.status, "request_context": "test"}}
+		case strings.HasSuffix(r.URL.Path, "/components") || strings.HasSuffix(r.URL.Path, "/services"):
+			items := make([]interface{}, 0)
+			seen := make(map[string]bool)
+			for _, host := range sortedKeys(hostComponents) {
+				for _, component := range hostComponents[host] {
+					service := strings.SplitN(component, "_", 2)[0]
+					if strings.HasSuffix(r.URL.Path, "/components") && !seen[component] {
+						items = append(items, map[string]interface{}{"ServiceComponentInfo": map[string]interface{}{"component_name": component, "service_name": service, "state": "STARTED"}})
+					} else if strings.HasSuffix(r.URL.Path, "/services") && !seen[service] {
+						items = append(items, map[string]interface{}{"ServiceInfo": map[string]interface{}{"service_name": service, "state": "STARTED"}})
+					}
+					seen[component], seen[service] = true, true
+				}
+			}
+			response = map[string]interface{}{"items": items}
+		case fallback != nil:
+			fallback(w, r)
+			return
+		default:
+			response = map[string]interface{}{"items": []interface{}{}}
+		}
+		content, _ := json.Marshal(response)
+		w.Write(content)
+	})
+	return ambariRegistry, fake
+}
+
+// getOperations get the recorded operations ("<method> <path in the cluster> <body>")
+func (f *fakeRequests) getOperations() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]string{}, f.operations...)
+}
+
+// setStatus set the final status of the ambari requests
+func (f *fakeRequests) setStatus(status string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.status = status
+}
@@ -0,0 +1,77 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+)
+
+const (
+	playbookRunsJsonFileName = "playbook_runs.json"
+	// PlaybookRunSuccess status of a playbook run that finished without errors
+	PlaybookRunSuccess = "SUCCESS"
+	// PlaybookRunFailed status of a playbook run that finished with errors
+	PlaybookRunFailed = "FAILED"
+	// MaxPlaybookRuns the number of the latest playbook runs that are kept in the ambarictl database
+	MaxPlaybookRuns = 500
+)
+
+// PlaybookRun represents an executed playbook entry in the ambarictl database
+type PlaybookRun struct {
+	Name      string    `json:"name"`
+	Cluster   string    `json:"cluster"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Status    string    `json:"status"`
+}
+
+// RecordPlaybookRun save a playbook run entry to the ambarictl database (only the latest MaxPlaybookRuns entries are kept)
+func RecordPlaybookRun(playbookRun PlaybookRun) {
+	playbookRuns := ListPlaybookRuns(MaxPlaybookRuns - 1)
+	playbookRuns = append(playbookRuns, playbookRun)
+	WritePlaybookRunEntries(playbookRuns)
+}
+
+// ListPlaybookRuns get the latest playbook runs from ambarictl database (all of them if limit is not positive)
+func ListPlaybookRuns(limit int) []PlaybookRun {
+	playbookRuns := make([]PlaybookRun, 0)
+	playbookRunsJsonFile := getJsonDbFile(playbookRunsJsonFileName)
+	if !exists(playbookRunsJsonFile) {
+		return playbookRuns
+	}
+	file, err := ioutil.ReadFile(playbookRunsJsonFile)
+	checkErr(err)
+	json.Unmarshal(file, &playbookRuns)
+	if limit > 0 && len(playbookRuns) > limit {
+		return playbookRuns[len(playbookRuns)-limit:]
+	}
+	return playbookRuns
+}
+
+// DropPlaybookRunRecords drop all playbook run entries from ambarictl database
+func DropPlaybookRunRecords() {
+	playbookRuns := make([]PlaybookRun, 0)
+	WritePlaybookRunEntries(playbookRuns)
+}
+
+// WritePlaybookRunEntries write playbook run entries to the playbook runs json file
+func WritePlaybookRunEntries(playbookRuns []PlaybookRun) {
+	playbookRunsJson, _ := json.Marshal(playbookRuns)
+	playbookRunsJsonFile := getJsonDbFile(playbookRunsJsonFileName)
+	err := ioutil.WriteFile(playbookRunsJsonFile, FormatJson(playbookRunsJson).Bytes(), 0644)
+	checkErr(err)
+}
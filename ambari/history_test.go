@@ -0,0 +1,43 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestRecordPlaybookRunKeepsLatestRuns(t *testing.T) {
+	resetDb(t)
+	os.Remove(getJsonDbFile(playbookRunsJsonFileName))
+	for index := 0; index < MaxPlaybookRuns+5; index++ {
+		RecordPlaybookRun(PlaybookRun{Name: fmt.Sprintf("run%d", index), Status: PlaybookRunSuccess})
+	}
+	playbookRuns := ListPlaybookRuns(0)
+	if len(playbookRuns) != MaxPlaybookRuns {
+		t.Fatalf("expected %d runs, got %d", MaxPlaybookRuns, len(playbookRuns))
+	}
+	if playbookRuns[0].Name != "run5" || playbookRuns[len(playbookRuns)-1].Name != fmt.Sprintf("run%d", MaxPlaybookRuns+4) {
+		t.Errorf("unexpected first and last runs: %s, %s", playbookRuns[0].Name, playbookRuns[len(playbookRuns)-1].Name)
+	}
+	info, err := os.Stat(getJsonDbFile(playbookRunsJsonFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("expected file mode 0644, got %v", info.Mode().Perm())
+	}
+}
@@ -19,23 +19,27 @@ import (
 	"fmt"
 	"golang.org/x/crypto/ssh/terminal"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
+// stdinReader is shared by the prompts, so the buffered (e.g. piped) answers are not lost between them
+var stdinReader = bufio.NewReader(os.Stdin)
+
 // GetStringFlag trying to read a flag value, if it does not exists ask an input from the user
 func GetStringFlag(flagValue string, defaultValue string, text string) string {
 	if len(flagValue) == 0 {
-		reader := bufio.NewReader(os.Stdin)
-		fmt.Print(text)
+		outPrint(text)
 		if len(defaultValue) > 0 {
-			fmt.Print(" (" + defaultValue + "): ")
+			outPrint(" (" + defaultValue + "): ")
 		} else {
-			fmt.Print(": ")
+			outPrint(": ")
 		}
-		answer, _ := reader.ReadString('\n')
+		answer, _ := stdinReader.ReadString('\n')
 		if len(answer) == 0 || answer == "\n" {
 			if len(defaultValue) == 0 {
-				fmt.Println("Input cannot be empty!")
+				errPrintln("Input cannot be empty!")
 				os.Exit(1)
 			}
 			answer = defaultValue
@@ -48,21 +52,21 @@ func GetStringFlag(flagValue string, defaultValue string, text string) string {
 // GetPassword trying to read a password flag value, if it does not exists ask an input from the user
 func GetPassword(flagValue string, text string) string {
 	if len(flagValue) == 0 {
-		fmt.Print(text + ": ")
+		outPrint(text + ": ")
 		if terminal.IsTerminal(0) {
 			var fd = 0
 			bytePassword, err := terminal.ReadPassword(fd)
 			if err != nil {
-				fmt.Println(err)
+				errPrintln(err)
 				os.Exit(1)
 			}
 			password := string(bytePassword)
-			fmt.Println()
+			outPrintln()
 			return strings.TrimSpace(password)
 		}
-		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer, _ := stdinReader.ReadString('\n')
 		if len(answer) == 0 || answer == "\n" {
-			fmt.Println("Password cannot by empty")
+			errPrintln("Password cannot by empty")
 			os.Exit(1)
 		}
 		return strings.TrimSpace(answer)
@@ -82,3 +86,33 @@ func EvaluateBoolValueFromString(answer string) bool {
 	}
 	return result
 }
+
+// validateInputValue check a playbook input value against the type (string, int or bool), the required flag and the pattern of the input
+func validateInputValue(input Input, value string) error {
+	if input.Required && len(strings.TrimSpace(value)) == 0 {
+		return fmt.Errorf("Input '%s' is required, it cannot be empty", input.Name)
+	}
+	switch strings.ToLower(input.Type) {
+	case "", "string":
+	case "int":
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("Input '%s' should be a number, not '%s'", input.Name, value)
+		}
+	case "bool":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("Input '%s' should be true or false, not '%s'", input.Name, value)
+		}
+	default:
+		return fmt.Errorf("Unknown type '%s' of input '%s' (supported types: string, int, bool)", input.Type, input.Name)
+	}
+	if len(input.Pattern) > 0 {
+		pattern, err := regexp.Compile("^(?:" + input.Pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("Invalid pattern of input '%s': %v", input.Name, err)
+		}
+		if !pattern.MatchString(value) {
+			return fmt.Errorf("Input '%s' does not match pattern '%s': '%s'", input.Name, input.Pattern, value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"net"
+	"os/user"
+	"path"
+	"strings"
+)
+
+const (
+	// HostKeyCheckingStrict verify the host keys against a known_hosts file, unknown or changed keys are rejected
+	HostKeyCheckingStrict = "strict"
+	// HostKeyCheckingInsecure accept any host key (default)
+	HostKeyCheckingInsecure = "insecure"
+)
+
+// ValidateHostKeyChecking check that a host key checking mode is supported (empty value means the default insecure mode)
+func ValidateHostKeyChecking(mode string) error {
+	if len(mode) > 0 && mode != HostKeyCheckingStrict && mode != HostKeyCheckingInsecure {
+		return fmt.Errorf("Unknown host key checking mode '%s' (supported modes: %s, %s)", mode, HostKeyCheckingStrict, HostKeyCheckingInsecure)
+	}
+	return nil
+}
+
+// getKnownHostsFile get the known_hosts file of a connection profile (defaults to ~/.ssh/known_hosts)
+func getKnownHostsFile(knownHostsFile string) string {
+	if len(knownHostsFile) > 0 {
+		return knownHostsFile
+	}
+	usr, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return path.Join(usr.HomeDir, ".ssh", "known_hosts")
+}
+
+// knownHostsCallback create a host key callback that accepts only the host keys that are listed in a known_hosts file
+// (hashed host names and [host]:port entries are supported, revoked keys are rejected)
+func knownHostsCallback(knownHostsFile string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		content, err := ioutil.ReadFile(knownHostsFile)
+		if err != nil {
+			return fmt.Errorf("Cannot read known hosts file: %v", err)
+		}
+		return checkKnownHostKey(content, knownHostsAddresses(hostname, remote), key)
+	}
+}
+
+// knownHostsAddresses get the addresses of a host in known_hosts format (host for port 22, [host]:port otherwise)
+func knownHostsAddresses(hostname string, remote net.Addr) []string {
+	addresses := make([]string, 0)
+	for _, address := range []string{hostname, remote.String()} {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			host, port = address, "22"
+		}
+		if port != "22" {
+			host = fmt.Sprintf("[%s]:%s", host, port)
+		}
+		if !containsString(addresses, host) {
+			addresses = append(addresses, host)
+		}
+	}
+	return addresses
+}
+
+func checkKnownHostKey(content []byte, addresses []string, key ssh.PublicKey) error {
+	knownHost := false
+	for len(content) > 0 {
+		marker, hosts, hostKey, _, rest, err := ssh.ParseKnownHosts(content)
+		if err != nil {
+			break
+		}
+		content = rest
+		if marker == "cert-authority" || !matchKnownHosts(hosts, addresses) {
+			continue
+		}
+		sameKey := bytes.Equal(hostKey.Marshal(), key.Marshal())
+		if marker == "revoked" && sameKey {
+			return fmt.Errorf("Host key of %s is revoked", addresses[0])
+		}
+		if marker == "revoked" || hostKey.Type() != key.Type() {
+			continue
+		}
+		if sameKey {
+			return nil
+		}
+		knownHost = true
+	}
+	if knownHost {
+		return fmt.Errorf("Host key of %s does not match the key in the known hosts file (possible man-in-the-middle attack)", addresses[0])
+	}
+	return fmt.Errorf("Host %s is not in the known hosts file", addresses[0])
+}
+
+func matchKnownHosts(patterns []string, addresses []string) bool {
+	for _, pattern := range patterns {
+		for _, address := range addresses {
+			if matchKnownHost(pattern, address) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchKnownHost match a host name of a known_hosts entry (plain or hashed: |1|salt|hash) with an address
+func matchKnownHost(pattern string, address string) bool {
+	if !strings.HasPrefix(pattern, "|1|") {
+		return pattern == address
+	}
+	parts := strings.Split(pattern[len("|1|"):], "|")
+	if len(parts) != 2 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+	hash, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(address))
+	return hmac.Equal(mac.Sum(nil), hash)
+}
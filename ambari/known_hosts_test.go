@@ -0,0 +1,142 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestHostKey generate a public host key
+func newTestHostKey(t *testing.T) ssh.PublicKey {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// knownHostsLine create a known_hosts entry for the hosts (comma separated) with the key
+func knownHostsLine(marker string, hosts string, key ssh.PublicKey) string {
+	line := hosts + " " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	if len(marker) > 0 {
+		line = "@" + marker + " " + line
+	}
+	return line + "\n"
+}
+
+// hashKnownHost hash a host name the same way as ssh-keygen -H
+func hashKnownHost(host string) string {
+	salt := []byte("0123456789abcdefghij")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+	return fmt.Sprintf("|1|%s|%s", base64.StdEncoding.EncodeToString(salt), base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+func TestKnownHostsCallback(t *testing.T) {
+	key := newTestHostKey(t)
+	otherKey := newTestHostKey(t)
+	knownHostsFile := filepath.Join(t.TempDir(), "known_hosts")
+	content := "# comment\n" +
+		knownHostsLine("", "c7401.ambari.apache.org,192.168.64.101", key) +
+		knownHostsLine("", "[c7402.ambari.apache.org]:2222", key) +
+		knownHostsLine("", hashKnownHost("c7403.ambari.apache.org"), key) +
+		knownHostsLine("", "c7404.ambari.apache.org", otherKey) +
+		knownHostsLine("", "c7405.ambari.apache.org", otherKey)
+	if err := ioutil.WriteFile(knownHostsFile, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	callback := knownHostsCallback(knownHostsFile)
+	cases := []struct {
+		hostname string
+		port     int
+		key      ssh.PublicKey
+		err      string
+	}{
+		{"c7401.ambari.apache.org:22", 22, key, ""},
+		{"192.168.64.101:22", 22, key, ""},
+		{"c7402.ambari.apache.org:2222", 2222, key, ""},
+		{"c7402.ambari.apache.org:22", 22, key, "is not in the known hosts file"},
+		{"c7403.ambari.apache.org:22", 22, key, ""},
+		{"c7404.ambari.apache.org:22", 22, key, "does not match the key in the known hosts file"},
+		{"c7406.ambari.apache.org:22", 22, key, "is not in the known hosts file"},
+		{"c7405.ambari.apache.org:22", 22, otherKey, ""},
+	}
+	for _, c := range cases {
+		err := callback(c.hostname, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: c.port}, c.key)
+		if len(c.err) == 0 && err != nil {
+			t.Errorf("%s: expected the key to be accepted: %v", c.hostname, err)
+		} else if len(c.err) > 0 && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s: expected error %q, got: %v", c.hostname, c.err, err)
+		}
+	}
+
+	revokedFile := filepath.Join(t.TempDir(), "known_hosts")
+	if err := ioutil.WriteFile(revokedFile, []byte(knownHostsLine("revoked", "c7401.ambari.apache.org", key)+knownHostsLine("", "c7401.ambari.apache.org", key)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := knownHostsCallback(revokedFile)("c7401.ambari.apache.org:22", &net.TCPAddr{Port: 22}, key); err == nil || !strings.Contains(err.Error(), "is revoked") {
+		t.Errorf("expected the revoked key to be rejected: %v", err)
+	}
+	if err := knownHostsCallback(filepath.Join(t.TempDir(), "missing"))("c7401.ambari.apache.org:22", &net.TCPAddr{Port: 22}, key); err == nil {
+		t.Error("expected an error for a missing known hosts file")
+	}
+	if ValidateHostKeyChecking("strict") != nil || ValidateHostKeyChecking("") != nil || ValidateHostKeyChecking("yes") == nil {
+		t.Error("unexpected host key checking mode validation")
+	}
+}
+
+func TestSshConfigWithStrictHostKeyChecking(t *testing.T) {
+	server := newTestSshServer(t)
+	knownHostsFile := filepath.Join(t.TempDir(), "known_hosts")
+	address := fmt.Sprintf("[127.0.0.1]:%d", server.port)
+
+	config := server.sshConfig()
+	config.StrictHostKeyChecking = true
+	config.KnownHostsFile = knownHostsFile
+	if err := ioutil.WriteFile(knownHostsFile, []byte(knownHostsLine("", address, newTestHostKey(t))), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := config.Run(context.Background(), "echo hello", 5); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("expected the changed host key to be rejected: %v", err)
+	}
+	if err := ioutil.WriteFile(knownHostsFile, []byte(knownHostsLine("", address, server.hostKey)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if stdout, _, _, err := config.Run(context.Background(), "echo hello", 5); err != nil || stdout != "hello\n" {
+		t.Errorf("expected the known host key to be accepted: %q, err: %v", stdout, err)
+	}
+	config.StrictHostKeyChecking = false
+	config.KnownHostsFile = filepath.Join(t.TempDir(), "missing")
+	if _, _, _, err := config.Run(context.Background(), "echo hello", 5); err != nil {
+		t.Errorf("expected any host key to be accepted in insecure mode: %v", err)
+	}
+}
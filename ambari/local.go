@@ -16,50 +16,244 @@ package ambari
 
 import (
 	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
 	"os"
 	"os/exec"
+	"strings"
+	"syscall"
+	"time"
 )
 
+// DefaultCommandTimeout is the timeout (in seconds) of remote and local commands of playbook tasks if there is no timeout set
+const DefaultCommandTimeout = 60
+
+// ErrCommandTimeout is returned when a (remote or local) command does not finish in time
+var ErrCommandTimeout = errors.New("command timed out")
+
 // RunLocalCommand run local system command
 func RunLocalCommand(command string, arg ...string) (string, string, error) {
+	return RunLocalCommandWithTimeout(0, command, arg...)
+}
+
+// LocalCommandOptions holds the optional settings of a local command
+type LocalCommandOptions struct {
+	// Timeout in seconds, 0 means no timeout
+	Timeout int
+	// Dir is the working directory of the command, the current directory is used if it is empty
+	Dir string
+	// Env holds extra environment variables (the environment of ambarictl is inherited)
+	Env map[string]string
+}
+
+// RunLocalCommandWithTimeout run local system command, the process is killed if it does not finish in timeout seconds
+// (ErrCommandTimeout is returned then), 0 means no timeout
+func RunLocalCommandWithTimeout(timeout int, command string, arg ...string) (string, string, error) {
+	return RunLocalCommandWithOptions(context.Background(), LocalCommandOptions{Timeout: timeout}, command, arg...)
+}
+
+// RunLocalCommandWithOptions run local system command with a timeout, working directory and extra environment variables,
+// the process is killed if the context is cancelled (the error of the context is returned then)
+func RunLocalCommandWithOptions(parent context.Context, options LocalCommandOptions, command string, arg ...string) (string, string, error) {
 	outStr, errStr := "", ""
+	ctx := parent
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(options.Timeout)*time.Second)
+		defer cancel()
+	}
+	ctxDebugPrintln(ctx, fmt.Sprintf("Local command: %s %s", command, strings.Join(arg, " ")))
 	cmd := exec.Command(command, arg...)
+	setProcessGroup(cmd)
+	cmd.Dir = options.Dir
+	if len(options.Env) > 0 {
+		cmd.Env = os.Environ()
+		for name, value := range options.Env {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
-	err := cmd.Run()
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	err := cmd.Start()
+	if err == nil {
+		err = waitForCommand(ctx, cmd)
+	}
+	if parent.Err() != nil {
+		err = parent.Err()
+	} else if ctx.Err() == context.DeadlineExceeded {
+		err = ErrCommandTimeout
 	}
 	outStr, errStr = string(stdout.Bytes()), string(stderr.Bytes())
 	if len(outStr) > 0 {
-		fmt.Println(outStr)
+		ctxOutPrintln(ctx, outStr)
 	}
 	if len(errStr) > 0 {
-		fmt.Println(errStr)
+		ctxErrPrintln(ctx, errStr)
+	}
+	if err != nil {
+		ctxErrPrintln(ctx, err)
+		return outStr, errStr, err
 	}
 	return outStr, errStr, nil
 }
 
+// waitForCommand wait until a started command finishes, the command is killed (with its child processes) if the context is done first
+func waitForCommand(ctx context.Context, cmd *exec.Cmd) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- cmd.Wait()
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+		return <-result
+	}
+}
+
+// RunLocalCommandWithExitCode run local system command like RunLocalCommandWithOptions, but a non-zero exit status is not an error,
+// it is returned as the exit code (so the caller can decide whether it is fatal). The error is set only if the command could not be run
+// or it timed out or cancelled (the exit code is -1 then)
+func RunLocalCommandWithExitCode(ctx context.Context, options LocalCommandOptions, command string, arg ...string) (string, string, int, error) {
+	stdout, stderr, err := RunLocalCommandWithOptions(ctx, options, command, arg...)
+	if err == nil {
+		return stdout, stderr, 0, nil
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return stdout, stderr, status.ExitStatus(), nil
+		}
+	}
+	return stdout, stderr, -1, err
+}
+
+// ExitCodeError is the error of a command that finished with a non-zero exit code
+type ExitCodeError struct {
+	Code int
+}
+
+func (e *ExitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// RunPasswordCommand run a password helper command (e.g. a secret manager client) and use its standard output as the password
+func RunPasswordCommand(command string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Stdin = os.Stdin
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("Password command failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	password := strings.TrimRight(stdout.String(), "\r\n")
+	if len(password) == 0 {
+		return "", fmt.Errorf("Password command '%s' returned an empty password", command)
+	}
+	return password, nil
+}
+
+// DownloadOptions holds the optional settings of a file download
+type DownloadOptions struct {
+	// SHA256 and MD5 are the expected (hex encoded) checksums of the downloaded file, empty values are not verified
+	SHA256 string
+	MD5    string
+	// Timeout of the whole download (including the redirects), 0 means no timeout
+	Timeout time.Duration
+	// Username and Password are used for basic authentication (if the username is set)
+	Username string
+	Password string
+	// Headers are added to the download request (e.g. Authorization: Bearer <token>)
+	Headers map[string]string
+}
+
+// maxDownloadRedirects is the number of redirects that are followed during a download
+const maxDownloadRedirects = 10
+
 // DownloadFile download a file from an url to the local filesystem
-func DownloadFile(filepath string, url string) error {
-	out, err := os.Create(filepath)
+// (the file is downloaded into the temporary directory of the run first, so a failed download does not leave a partial file behind),
+// if checksums are provided, the file is moved to its location only if the checksums of the downloaded content match.
+// Redirects are followed (at most 10), responses with non-2xx status codes are returned as errors. The download is stopped if the context is cancelled
+func DownloadFile(ctx context.Context, filepath string, url string, options DownloadOptions) error {
+	out, err := CreateTempFile("download-")
 	if err != nil {
 		return err
 	}
+	defer os.Remove(out.Name())
 	defer out.Close()
-	resp, err := http.Get(url)
+	client := &http.Client{
+		Timeout: options.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxDownloadRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxDownloadRedirects)
+			}
+			return nil
+		},
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if len(options.Username) > 0 {
+		req.SetBasicAuth(options.Username, options.Password)
+	}
+	for name, value := range options.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.Do(req)
 	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		return err
 	}
 	defer resp.Body.Close()
-	_, err = io.Copy(out, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Download of %s failed with status: %s", url, resp.Status)
+	}
+	sha256Hash := sha256.New()
+	md5Hash := md5.New()
+	_, err = io.Copy(io.MultiWriter(out, sha256Hash, md5Hash), resp.Body)
 	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	if err = verifyChecksum("sha256", options.SHA256, sha256Hash); err != nil {
+		return err
+	}
+	if err = verifyChecksum("md5", options.MD5, md5Hash); err != nil {
 		return err
 	}
+	// temporary files are created with 0600
+	if err = os.Chmod(out.Name(), 0644); err != nil {
+		return err
+	}
+	return moveFile(out.Name(), filepath)
+}
+
+func verifyChecksum(name string, expected string, actual hash.Hash) error {
+	expected = strings.ToLower(strings.TrimSpace(expected))
+	if len(expected) == 0 {
+		return nil
+	}
+	actualChecksum := hex.EncodeToString(actual.Sum(nil))
+	if actualChecksum != expected {
+		return fmt.Errorf("%s checksum mismatch of the downloaded file (expected: %s, actual: %s)", name, expected, actualChecksum)
+	}
 	return nil
 }
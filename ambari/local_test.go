@@ -0,0 +1,237 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunLocalCommandWithTimeout(t *testing.T) {
+	start := time.Now()
+	_, _, err := RunLocalCommandWithTimeout(1, "sh", "-c", "sleep 10 & sleep 10")
+	if err != ErrCommandTimeout {
+		t.Errorf("expected ErrCommandTimeout, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the command is not killed after the timeout (%v)", elapsed)
+	}
+	if stdout, _, err := RunLocalCommandWithTimeout(5, "echo", "done"); err != nil || stdout != "done\n" {
+		t.Errorf("unexpected result: %q, err: %v", stdout, err)
+	}
+}
+
+func TestDefaultTaskTimeouts(t *testing.T) {
+	tasks := []Task{{Name: "own", Timeout: 5}, {Name: "default"}}
+	if tasks := defaultTaskTimeouts(tasks, 30); tasks[0].Timeout != 5 || tasks[1].Timeout != 30 {
+		t.Errorf("expected the playbook timeout for tasks without timeout: %+v", tasks)
+	}
+	if tasks := defaultTaskTimeouts(tasks, 0); tasks[1].Timeout != DefaultCommandTimeout {
+		t.Errorf("expected the default timeout without playbook timeout: %+v", tasks)
+	}
+}
+
+func TestExecutePlaybookWithPlaybookTimeout(t *testing.T) {
+	ambariRegistry := newTestAmbari(t, emptyItemsHandler)
+	playbook := loadTestPlaybook(t, `
+name: timeout
+timeout: 1
+tasks:
+  - name: "slow"
+    type: LocalCommand
+    command: "sleep 10"
+`, "")
+
+	start := time.Now()
+	result, err := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{})
+
+	if err == nil || len(result.Tasks) != 1 || result.Tasks[0].Status == TaskSuccess {
+		t.Errorf("expected the slow task to time out: %+v, err: %v", result.Tasks, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the playbook timeout is not applied (%v)", elapsed)
+	}
+}
+
+func TestDownloadFileVerifiesChecksums(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+	defer CleanupRunTempDir(false)
+	sha256Sum := fmt.Sprintf("%x", sha256.Sum256([]byte("content")))
+	md5Sum := fmt.Sprintf("%x", md5.Sum([]byte("content")))
+	dest := filepath.Join(t.TempDir(), "downloaded")
+
+	if err := DownloadFile(context.Background(), dest, server.URL, DownloadOptions{SHA256: strings.ToUpper(sha256Sum), MD5: md5Sum}); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := ioutil.ReadFile(dest); err != nil || string(content) != "content" {
+		t.Errorf("unexpected content: %q, err: %v", content, err)
+	}
+	mismatched := filepath.Join(filepath.Dir(dest), "mismatched")
+	for _, options := range []DownloadOptions{{SHA256: md5Sum}, {MD5: sha256Sum}} {
+		if err := DownloadFile(context.Background(), mismatched, server.URL, options); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+			t.Errorf("expected a checksum mismatch for %+v, got: %v", options, err)
+		}
+	}
+	if _, err := os.Stat(mismatched); !os.IsNotExist(err) {
+		t.Error("the file with a checksum mismatch is kept")
+	}
+}
+
+func TestDownloadFileFollowsRedirectsAndReportsStatus(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content"))
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/file", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	defer CleanupRunTempDir(false)
+	dir := t.TempDir()
+
+	if err := DownloadFile(context.Background(), filepath.Join(dir, "moved"), server.URL+"/moved", DownloadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(dir, "moved")); err != nil || string(content) != "content" {
+		t.Errorf("unexpected content: %q, err: %v", content, err)
+	}
+	if err := DownloadFile(context.Background(), filepath.Join(dir, "missing"), server.URL+"/missing", DownloadOptions{}); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected the 404 status in the error, got: %v", err)
+	}
+	if err := DownloadFile(context.Background(), filepath.Join(dir, "loop"), server.URL+"/loop", DownloadOptions{}); err == nil || !strings.Contains(err.Error(), "redirects") {
+		t.Errorf("expected a redirect loop error, got: %v", err)
+	}
+	for _, name := range []string{"missing", "loop"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("the failed download of %s left a file behind", name)
+		}
+	}
+}
+
+func TestDownloadTaskWithAuthenticationAndHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if r.URL.Path == "/basic" && (!ok || username != "user" || password != "pass") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/token" && (r.Header.Get("Authorization") != "Bearer abc" || r.Header.Get("X-Trace") != "1") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+	defer CleanupRunTempDir(false)
+	dir := t.TempDir()
+	tasks := []Task{
+		{Name: "basic", Parameters: map[string]string{"url": server.URL + "/basic", "file": filepath.Join(dir, "basic"), "username": "user", "password": "pass"}},
+		{Name: "token", Parameters: map[string]string{"url": server.URL + "/token", "file": filepath.Join(dir, "token"),
+			downloadHeaderPrefix + "Authorization": "Bearer abc", downloadHeaderPrefix + "X-Trace": "1"}},
+	}
+
+	for _, task := range tasks {
+		if err := ExecuteDownloadFileTask(context.Background(), task); err != nil {
+			t.Errorf("download of task '%s' failed: %v", task.Name, err)
+		}
+		task.Parameters["password"], task.Parameters[downloadHeaderPrefix+"Authorization"] = "wrong", "wrong"
+		if err := ExecuteDownloadFileTask(context.Background(), task); err == nil {
+			t.Errorf("expected the download of task '%s' with wrong credentials to fail", task.Name)
+		}
+	}
+	if err := ExecuteDownloadFileTask(context.Background(), Task{Name: "timeout", Parameters: map[string]string{"url": server.URL, "timeout": "-1"}}); err == nil {
+		t.Error("expected an error for an invalid timeout")
+	}
+}
+
+func TestRunLocalCommandWithExitCode(t *testing.T) {
+	stdout, _, exitCode, err := RunLocalCommandWithExitCode(context.Background(), LocalCommandOptions{}, "sh", "-c", "echo out; exit 3")
+	if err != nil || exitCode != 3 || stdout != "out\n" {
+		t.Errorf("expected exit code 3 without error, got: %d, %q, err: %v", exitCode, stdout, err)
+	}
+	if _, _, exitCode, err := RunLocalCommandWithExitCode(context.Background(), LocalCommandOptions{}, "true"); err != nil || exitCode != 0 {
+		t.Errorf("unexpected result: %d, err: %v", exitCode, err)
+	}
+	if _, _, exitCode, err := RunLocalCommandWithExitCode(context.Background(), LocalCommandOptions{}, "/nonexistent/command"); err == nil || exitCode != -1 {
+		t.Errorf("expected an error for a missing command, got: %d, err: %v", exitCode, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, exitCode, err := RunLocalCommandWithExitCode(ctx, LocalCommandOptions{}, "sleep", "5"); err != context.Canceled || exitCode != -1 {
+		t.Errorf("expected a cancelled command, got: %d, err: %v", exitCode, err)
+	}
+}
+
+func TestLocalCommandTaskWithShell(t *testing.T) {
+	dir := t.TempDir()
+	task := Task{Name: "pipe", Type: LocalCommand, Shell: true, Timeout: 5,
+		Command: "printf 'b\\na\\n' | sort > " + filepath.Join(dir, "sorted") + " && cat " + filepath.Join(dir, "sorted") + " | head -1"}
+
+	responses, err := runLocalCommandTask(context.Background(), task)
+
+	if err != nil || responses["localhost"].StdOut != "a\n" {
+		t.Errorf("unexpected response: %+v, err: %v", responses["localhost"], err)
+	}
+	task.Shell = false
+	task.Command = "echo a | sort"
+	if responses, err := runLocalCommandTask(context.Background(), task); err != nil || responses["localhost"].StdOut != "a | sort\n" {
+		t.Errorf("expected the command to run without a shell: %+v, err: %v", responses["localhost"], err)
+	}
+	task.Shell = true
+	task.Command = "exit 4"
+	if responses, err := runLocalCommandTask(context.Background(), task); err == nil || responses["localhost"].ExitStatus != 4 {
+		t.Errorf("expected exit status 4: %+v, err: %v", responses["localhost"], err)
+	}
+}
+
+func TestLocalCommandTaskWithWorkdirAndEnv(t *testing.T) {
+	dir := t.TempDir()
+	os.Setenv("AMBARICTL_TEST_INHERITED", "inherited")
+	defer os.Unsetenv("AMBARICTL_TEST_INHERITED")
+	task := Task{Name: "env", Type: LocalCommand, Shell: true, Timeout: 5, Workdir: dir,
+		Env:     map[string]string{"GREETING": "hello world"},
+		Command: `echo "$(pwd) $GREETING $AMBARICTL_TEST_INHERITED"`}
+
+	responses, err := runLocalCommandTask(context.Background(), task)
+
+	resolvedDir, _ := filepath.EvalSymlinks(dir)
+	if expected := resolvedDir + " hello world inherited\n"; err != nil || responses["localhost"].StdOut != expected {
+		t.Errorf("expected %q, got %q, err: %v", expected, responses["localhost"].StdOut, err)
+	}
+	if os.Getenv("GREETING") == "hello world" {
+		t.Error("the environment of the task leaked into the process")
+	}
+	task.Workdir = filepath.Join(dir, "missing")
+	if _, err := runLocalCommandTask(context.Background(), task); err == nil {
+		t.Error("expected an error for a missing workdir")
+	}
+}
@@ -236,14 +236,18 @@ func (a AmbariRegistry) DownloadLogs(dest string, filter Filter) {
 		getLogDirCommand := "cat /etc/ambari-server/conf/log4j.properties | grep ambari.root.dir"
 		responses := a.RunRemoteHostCommand(getLogDirCommand, serverHosts, filter.Server)
 		ambariLogDir := "/var/log/ambari-server"
-		for _, response := range responses {
+		for host, response := range responses {
+			if response.Err != nil {
+				warnPrintln(fmt.Sprintf("Cannot get ambari server log directory from %s, using %s: %v", host, ambariLogDir, response.Err))
+				continue
+			}
 			splittedResponses := strings.Split(response.StdOut, "\n")
 			propertyMap := ConvertStingsToMap(splittedResponses)
 			ambariRootDir := propertyMap["ambari.root.dir"]
 			ambariLogDirUnformatted := strings.Replace(propertyMap["ambari.log.dir"], "${ambari.root.dir}", ambariRootDir, 1)
 			ambariLogDir = strings.Replace(ambariLogDirUnformatted, "//", "/", -1)
 		}
-		fmt.Println(ambariLogDir)
+		outPrintln(ambariLogDir)
 		componentName := "ambari-server"
 		componentDownloadFolder := createDownloadFolder(downloadFolder, componentName)
 		a.CopyFolderFromRemote(componentName, ambariLogDir, componentDownloadFolder, serverHosts, filter.Server)
@@ -281,6 +285,10 @@ func (a AmbariRegistry) DownloadLogs(dest string, filter Filter) {
 				smallMap := make(map[string]bool)
 				smallMap[host] = true
 				responses := a.RunRemoteHostCommand(getLogDirCommand, smallMap, filter.Server)
+				if response := responses[host]; response.Err != nil {
+					warnPrintln(fmt.Sprintf("Cannot get ambari agent log directory from %s: %v", host, response.Err))
+					continue
+				}
 				for _, response := range responses {
 					splittedResponses := strings.Split(response.StdOut, "\n")
 					propertyMap := ConvertStingsToMap(splittedResponses)
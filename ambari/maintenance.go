@@ -0,0 +1,168 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maintenanceJsonFileName = "maintenance.json"
+	// MaintenanceStart command of a Maintenance task, it freezes the cluster
+	MaintenanceStart = "START"
+	// MaintenanceStop command of a Maintenance task, it unfreezes the cluster
+	MaintenanceStop = "STOP"
+)
+
+var (
+	forceMaintenance bool
+	// ownedMaintenances the maintenances that are started by this invocation (async playbook tasks can use it concurrently)
+	ownedMaintenances      = make(map[string]bool)
+	ownedMaintenancesMutex sync.Mutex
+)
+
+func isMaintenanceOwned(ambariEntry string) bool {
+	ownedMaintenancesMutex.Lock()
+	defer ownedMaintenancesMutex.Unlock()
+	return ownedMaintenances[ambariEntry]
+}
+
+func setMaintenanceOwned(ambariEntry string, owned bool) {
+	ownedMaintenancesMutex.Lock()
+	defer ownedMaintenancesMutex.Unlock()
+	if owned {
+		ownedMaintenances[ambariEntry] = true
+	} else {
+		delete(ownedMaintenances, ambariEntry)
+	}
+}
+
+// MaintenanceMarker represents a "maintenance in progress" marker for an ambari registry entry:
+// config changes and ambari commands are refused by other ambarictl invocations while it exists
+type MaintenanceMarker struct {
+	AmbariEntry string    `json:"ambari"`
+	Owner       string    `json:"owner"`
+	Reason      string    `json:"reason,omitempty"`
+	StartTime   time.Time `json:"start_time"`
+}
+
+// SetForceMaintenance allow config changes and ambari commands even if the cluster is frozen by someone else
+func SetForceMaintenance(force bool) {
+	forceMaintenance = force
+}
+
+// StartMaintenance freeze an ambari registry entry (config changes and ambari commands are refused by other invocations)
+func StartMaintenance(ambariEntry string, reason string) error {
+	if marker, ok := GetMaintenanceMarker(ambariEntry); ok && !isMaintenanceOwned(ambariEntry) && !forceMaintenance {
+		return maintenanceError(marker)
+	}
+	markers := removeMaintenanceMarker(ListMaintenanceMarkers(), ambariEntry)
+	markers = append(markers, MaintenanceMarker{AmbariEntry: ambariEntry, Owner: getMaintenanceOwner(), Reason: reason, StartTime: time.Now()})
+	WriteMaintenanceMarkers(markers)
+	setMaintenanceOwned(ambariEntry, true)
+	return nil
+}
+
+// StopMaintenance unfreeze an ambari registry entry
+func StopMaintenance(ambariEntry string) {
+	WriteMaintenanceMarkers(removeMaintenanceMarker(ListMaintenanceMarkers(), ambariEntry))
+	setMaintenanceOwned(ambariEntry, false)
+}
+
+// CheckMaintenance returns an error if the ambari registry entry is frozen by another invocation (and it is not forced)
+func CheckMaintenance(ambariEntry string) error {
+	marker, ok := GetMaintenanceMarker(ambariEntry)
+	if !ok || isMaintenanceOwned(ambariEntry) || forceMaintenance {
+		return nil
+	}
+	return maintenanceError(marker)
+}
+
+// GetMaintenanceMarker get the maintenance marker of an ambari registry entry (if there is any)
+func GetMaintenanceMarker(ambariEntry string) (MaintenanceMarker, bool) {
+	for _, marker := range ListMaintenanceMarkers() {
+		if marker.AmbariEntry == ambariEntry {
+			return marker, true
+		}
+	}
+	return MaintenanceMarker{}, false
+}
+
+// ListMaintenanceMarkers get all maintenance markers from ambarictl database
+func ListMaintenanceMarkers() []MaintenanceMarker {
+	markers := make([]MaintenanceMarker, 0)
+	maintenanceJsonFile := getJsonDbFile(maintenanceJsonFileName)
+	if !exists(maintenanceJsonFile) {
+		return markers
+	}
+	file, err := ioutil.ReadFile(maintenanceJsonFile)
+	checkErr(err)
+	json.Unmarshal(file, &markers)
+	return markers
+}
+
+// WriteMaintenanceMarkers write maintenance markers to the maintenance json file
+func WriteMaintenanceMarkers(markers []MaintenanceMarker) {
+	markersJson, _ := json.Marshal(markers)
+	maintenanceJsonFile := getJsonDbFile(maintenanceJsonFileName)
+	err := ioutil.WriteFile(maintenanceJsonFile, FormatJson(markersJson).Bytes(), 0600)
+	checkErr(err)
+}
+
+// ExecuteMaintenanceTask start or stop a maintenance window for the ambari registry entry
+func (a AmbariRegistry) ExecuteMaintenanceTask(task Task) error {
+	switch strings.ToUpper(task.Command) {
+	case MaintenanceStart:
+		outPrintln(fmt.Sprintf("Start maintenance for '%s'", a.Name))
+		return StartMaintenance(a.Name, task.Parameters["reason"])
+	case MaintenanceStop:
+		if err := CheckMaintenance(a.Name); err != nil {
+			return err
+		}
+		outPrintln(fmt.Sprintf("Stop maintenance for '%s'", a.Name))
+		StopMaintenance(a.Name)
+		return nil
+	}
+	return fmt.Errorf("Command of '%s' task should be %s or %s", Maintenance, MaintenanceStart, MaintenanceStop)
+}
+
+func removeMaintenanceMarker(markers []MaintenanceMarker, ambariEntry string) []MaintenanceMarker {
+	result := make([]MaintenanceMarker, 0)
+	for _, marker := range markers {
+		if marker.AmbariEntry != ambariEntry {
+			result = append(result, marker)
+		}
+	}
+	return result
+}
+
+func getMaintenanceOwner() string {
+	currentUser, err := user.Current()
+	if err != nil {
+		return "unknown"
+	}
+	return currentUser.Username
+}
+
+func maintenanceError(marker MaintenanceMarker) error {
+	return fmt.Errorf("Maintenance is in progress for '%s' (owner: %s, since: %s, reason: %s), use --force to override",
+		marker.AmbariEntry, marker.Owner, marker.StartTime.Format(time.RFC3339), marker.Reason)
+}
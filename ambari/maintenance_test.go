@@ -0,0 +1,52 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"testing"
+)
+
+func TestStartAndStopMaintenance(t *testing.T) {
+	resetDb(t)
+	if err := StartMaintenance("test", "upgrade"); err != nil {
+		t.Fatal(err)
+	}
+	if marker, ok := GetMaintenanceMarker("test"); !ok || marker.Reason != "upgrade" {
+		t.Errorf("expected a maintenance marker with the reason, got: %v", marker)
+	}
+	if err := CheckMaintenance("test"); err != nil {
+		t.Errorf("expected no error for the owner of the maintenance, got: %v", err)
+	}
+	// an other invocation does not own the maintenance
+	setMaintenanceOwned("test", false)
+	if err := CheckMaintenance("test"); err == nil {
+		t.Error("expected an error for a maintenance started by someone else")
+	}
+	if err := StartMaintenance("test", "other"); err == nil {
+		t.Error("expected an error for starting a maintenance started by someone else")
+	}
+
+	setMaintenanceOwned("test", true)
+	StopMaintenance("test")
+	if _, ok := GetMaintenanceMarker("test"); ok {
+		t.Error("expected no maintenance marker after stop")
+	}
+	if isMaintenanceOwned("test") {
+		t.Error("expected the maintenance not to be owned after stop")
+	}
+	if err := CheckMaintenance("test"); err != nil {
+		t.Errorf("expected no error after stop, got: %v", err)
+	}
+}
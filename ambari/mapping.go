@@ -0,0 +1,111 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+const (
+	// MappingByComponent mapping from components to the hosts they are installed on
+	MappingByComponent = "component"
+	// MappingByHost mapping from hosts to the components that are installed on them
+	MappingByHost = "host"
+)
+
+// GetComponentHostMapping get the hosts of every installed component (component -> sorted hosts)
+func (a AmbariRegistry) GetComponentHostMapping() map[string][]string {
+	mapping := make(map[string][]string)
+	for _, hostComponent := range a.ListAllHostComponents() {
+		mapping[hostComponent.HostComponentName] = append(mapping[hostComponent.HostComponentName], hostComponent.HostComponntHost)
+	}
+	return sortMappingValues(mapping)
+}
+
+// GetHostComponentMapping get the installed components of every host (host -> sorted components), it can be used as a host inventory
+func (a AmbariRegistry) GetHostComponentMapping() map[string][]string {
+	mapping := make(map[string][]string)
+	for _, hostComponent := range a.ListAllHostComponents() {
+		mapping[hostComponent.HostComponntHost] = append(mapping[hostComponent.HostComponntHost], hostComponent.HostComponentName)
+	}
+	return sortMappingValues(mapping)
+}
+
+// GetMapping get the component -> hosts or the host -> components mapping
+func (a AmbariRegistry) GetMapping(by string) (map[string][]string, error) {
+	switch strings.ToLower(by) {
+	case "", MappingByComponent:
+		return a.GetComponentHostMapping(), nil
+	case MappingByHost:
+		return a.GetHostComponentMapping(), nil
+	}
+	return nil, fmt.Errorf("Mapping can be created by '%s' or '%s', not by '%s'", MappingByComponent, MappingByHost, by)
+}
+
+// FormatMapping format a mapping as json or csv (one key,value pair per line)
+func FormatMapping(mapping map[string][]string, format string) ([]byte, error) {
+	switch strings.ToLower(format) {
+	case "", "json":
+		mappingJson, err := json.Marshal(mapping)
+		if err != nil {
+			return nil, err
+		}
+		return append(FormatJson(mappingJson).Bytes(), '\n'), nil
+	case "csv":
+		var buffer bytes.Buffer
+		writer := csv.NewWriter(&buffer)
+		keys := make([]string, 0)
+		for key := range mapping {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			for _, value := range mapping[key] {
+				writer.Write([]string{key, value})
+			}
+		}
+		writer.Flush()
+		return buffer.Bytes(), writer.Error()
+	}
+	return nil, fmt.Errorf("Unsupported mapping format: %s (use json or csv)", format)
+}
+
+// ExecuteMappingTask export the component -> hosts (or host -> components) mapping to a file
+func (a AmbariRegistry) ExecuteMappingTask(task Task) error {
+	file := task.Parameters["file"]
+	mapping, err := a.GetMapping(task.Parameters["by"])
+	if err != nil {
+		return err
+	}
+	content, err := FormatMapping(mapping, task.Parameters["format"])
+	if err != nil {
+		return err
+	}
+	outPrintln(fmt.Sprintf("Export mapping to %s", file))
+	return ioutil.WriteFile(file, content, 0644)
+}
+
+func sortMappingValues(mapping map[string][]string) map[string][]string {
+	for _, values := range mapping {
+		sort.Strings(values)
+	}
+	return mapping
+}
@@ -0,0 +1,57 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHostComponentMapping(t *testing.T) {
+	ambariRegistry := newFakeCluster(t, map[string][]string{
+		"host1": {"HDFS_NAMENODE", "HDFS_CLIENT", "ZOOKEEPER_SERVER"},
+		"host2": {"HDFS_DATANODE", "HDFS_CLIENT"},
+		"host3": {"ZOOKEEPER_SERVER"},
+	}, nil)
+	expected := map[string][]string{
+		"host1": {"HDFS_CLIENT", "HDFS_NAMENODE", "ZOOKEEPER_SERVER"},
+		"host2": {"HDFS_CLIENT", "HDFS_DATANODE"},
+		"host3": {"ZOOKEEPER_SERVER"},
+	}
+	if mapping := ambariRegistry.GetHostComponentMapping(); !reflect.DeepEqual(mapping, expected) {
+		t.Errorf("unexpected host -> components mapping: %v", mapping)
+	}
+	if mapping, err := ambariRegistry.GetMapping(MappingByComponent); err != nil || !reflect.DeepEqual(mapping["ZOOKEEPER_SERVER"], []string{"host1", "host3"}) {
+		t.Errorf("unexpected component -> hosts mapping: %v, err: %v", mapping, err)
+	}
+	cases := map[string][]string{
+		"HDFS_NAMENODE":                  {"host2", "host3"},
+		"HDFS_CLIENT, ZOOKEEPER_SERVER":  {},
+		"hdfs_datanode,ZOOKEEPER_SERVER": {},
+		"YARN_CLIENT":                    {"host1", "host2", "host3"},
+	}
+	for missingComponents, expectedHosts := range cases {
+		filter := CreateMissingComponentsFilter(CreateFilter("", "", "", false), missingComponents)
+		hosts := ambariRegistry.GetFilteredHosts(filter)
+		if len(hosts) != len(expectedHosts) {
+			t.Errorf("%q: expected hosts %v, got: %v", missingComponents, expectedHosts, hosts)
+		}
+		for _, host := range expectedHosts {
+			if !hosts[host] {
+				t.Errorf("%q: expected hosts %v, got: %v", missingComponents, expectedHosts, hosts)
+			}
+		}
+	}
+}
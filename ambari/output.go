@@ -0,0 +1,198 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ExecutionContext holds the writers that are used for printing normal and error outputs during executions
+type ExecutionContext struct {
+	Out io.Writer
+	Err io.Writer
+}
+
+var executionContext = NewExecutionContext(os.Stdout, os.Stderr)
+
+// NewExecutionContext creates an execution context with the provided output writers, the writers are safe to use from multiple goroutines
+func NewExecutionContext(out io.Writer, err io.Writer) ExecutionContext {
+	return ExecutionContext{Out: &syncWriter{writer: out}, Err: &syncWriter{writer: err}}
+}
+
+// SetExecutionContext replace the execution context that is used by the ambari package (e.g.: for capturing outputs to buffers or files)
+func SetExecutionContext(context ExecutionContext) {
+	executionContext = context
+}
+
+// GetExecutionContext get the execution context that is used by the ambari package
+func GetExecutionContext() ExecutionContext {
+	return executionContext
+}
+
+type syncWriter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.writer.Write(p)
+}
+
+var (
+	secretsMutex sync.RWMutex
+	secrets      []string
+)
+
+// AddSecret register a sensitive value (e.g. a password input of a playbook), it is replaced with a mask in every output of the ambari package
+func AddSecret(value string) {
+	if len(value) == 0 {
+		return
+	}
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+	secrets = append(secrets, value)
+}
+
+// RedactSecrets replace the registered secrets in a text with a mask
+func RedactSecrets(text string) string {
+	secretsMutex.RLock()
+	defer secretsMutex.RUnlock()
+	for _, secret := range secrets {
+		text = strings.Replace(text, secret, passwordMask, -1)
+	}
+	return text
+}
+
+// writeOutput write an output with masked secrets
+func writeOutput(writer io.Writer, output string) {
+	io.WriteString(writer, RedactSecrets(output))
+}
+
+type outputHiddenKey struct{}
+
+// withOutputHidden get a context for running an operation (e.g. a no_log task) without printing its commands and outputs
+func withOutputHidden(ctx context.Context) context.Context {
+	return context.WithValue(ctx, outputHiddenKey{}, true)
+}
+
+// isOutputHidden reports whether the outputs of the operations that run with the context are hidden
+func isOutputHidden(ctx context.Context) bool {
+	hidden, _ := ctx.Value(outputHiddenKey{}).(bool)
+	return hidden
+}
+
+// LogLevel represents the verbosity of the outputs of the ambari package
+type LogLevel int
+
+const (
+	// LevelDebug prints everything, including the details of REST requests and commands
+	LevelDebug LogLevel = iota
+	// LevelInfo prints the normal outputs, warnings and errors (default)
+	LevelInfo
+	// LevelWarn prints only warnings (e.g. retries) and errors
+	LevelWarn
+	// LevelError prints only errors
+	LevelError
+)
+
+var logLevels = map[string]LogLevel{"debug": LevelDebug, "info": LevelInfo, "warn": LevelWarn, "error": LevelError}
+
+var (
+	logLevel      = LevelInfo
+	logLevelMutex sync.RWMutex
+)
+
+// ParseLogLevel convert a level name (debug, info, warn or error) to a log level
+func ParseLogLevel(name string) (LogLevel, error) {
+	level, ok := logLevels[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return LevelInfo, fmt.Errorf("Unknown log level: '%s' (supported levels: debug, info, warn, error)", name)
+	}
+	return level, nil
+}
+
+// SetLogLevel set the minimum level of the outputs that are printed by the ambari package
+func SetLogLevel(level LogLevel) {
+	logLevelMutex.Lock()
+	defer logLevelMutex.Unlock()
+	logLevel = level
+}
+
+// GetLogLevel get the minimum level of the outputs that are printed by the ambari package
+func GetLogLevel() LogLevel {
+	logLevelMutex.RLock()
+	defer logLevelMutex.RUnlock()
+	return logLevel
+}
+
+// logOutput write an output if its level is enabled
+func logOutput(level LogLevel, writer io.Writer, output string) {
+	if level < GetLogLevel() {
+		return
+	}
+	writeOutput(writer, output)
+}
+
+func outPrint(a ...interface{}) {
+	logOutput(LevelInfo, executionContext.Out, fmt.Sprint(a...))
+}
+
+func outPrintln(a ...interface{}) {
+	logOutput(LevelInfo, executionContext.Out, fmt.Sprintln(a...))
+}
+
+func debugPrintln(a ...interface{}) {
+	logOutput(LevelDebug, executionContext.Err, fmt.Sprintln(a...))
+}
+
+func warnPrintln(a ...interface{}) {
+	logOutput(LevelWarn, executionContext.Err, fmt.Sprintln(a...))
+}
+
+func errPrintln(a ...interface{}) {
+	logOutput(LevelError, executionContext.Err, fmt.Sprintln(a...))
+}
+
+// ctxOutPrintln print an output of an operation unless its outputs are hidden
+func ctxOutPrintln(ctx context.Context, a ...interface{}) {
+	if !isOutputHidden(ctx) {
+		outPrintln(a...)
+	}
+}
+
+func ctxDebugPrintln(ctx context.Context, a ...interface{}) {
+	if !isOutputHidden(ctx) {
+		debugPrintln(a...)
+	}
+}
+
+func ctxWarnPrintln(ctx context.Context, a ...interface{}) {
+	if !isOutputHidden(ctx) {
+		warnPrintln(a...)
+	}
+}
+
+func ctxErrPrintln(ctx context.Context, a ...interface{}) {
+	if !isOutputHidden(ctx) {
+		errPrintln(a...)
+	}
+}
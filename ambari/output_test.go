@@ -0,0 +1,61 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLogLevels(t *testing.T) {
+	output := captureOutput(t)
+	previous := GetLogLevel()
+	t.Cleanup(func() { SetLogLevel(previous) })
+	cases := map[string][]string{
+		"debug":   {"debug line", "info line", "warn line", "error line"},
+		"INFO":    {"info line", "warn line", "error line"},
+		"warn":    {"warn line", "error line"},
+		" error ": {"error line"},
+	}
+	for name, expectedLines := range cases {
+		level, err := ParseLogLevel(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		SetLogLevel(level)
+		output.Reset()
+		debugPrintln("debug line")
+		outPrintln("info line")
+		warnPrintln("warn line")
+		errPrintln("error line")
+		if lines := strings.Split(strings.TrimSpace(output.String()), "\n"); strings.Join(lines, ",") != strings.Join(expectedLines, ",") {
+			t.Errorf("%q: expected %v, got: %v", name, expectedLines, lines)
+		}
+	}
+	if _, err := ParseLogLevel("trace"); err == nil {
+		t.Error("expected an error for an unknown log level")
+	}
+
+	SetLogLevel(LevelDebug)
+	output.Reset()
+	ctx := withOutputHidden(context.Background())
+	ctxOutPrintln(ctx, "hidden")
+	ctxDebugPrintln(ctx, "hidden")
+	ctxOutPrintln(context.Background(), "visible")
+	if output.String() != "visible\n" {
+		t.Errorf("expected only the output without hidden context, got: %q", output.String())
+	}
+}
@@ -16,12 +16,19 @@ package ambari
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
+	"unicode"
 )
 
 const (
@@ -37,65 +44,240 @@ const (
 	Config = "Config"
 	// AmbariCommand runs an ambari command (like START or STOP) against components or services
 	AmbariCommand = "AmbariCommand"
+	// ServiceCheck runs ambari service checks against services and waits for the results
+	ServiceCheck = "ServiceCheck"
+	// VersionCheck checks that components have the same version installed on every host
+	VersionCheck = "VersionCheck"
+	// Assert evaluates boolean expressions (the 'that' field) and fails if any of them is false
+	Assert = "Assert"
+	// Mapping exports the component -> hosts (or host -> components) mapping to a json or csv file
+	Mapping = "Mapping"
+	// ConfigSet operation of Config tasks updates a config value (default)
+	ConfigSet = "set"
+	// ConfigGet operation of Config tasks reads a config value (that can be registered)
+	ConfigGet = "get"
+	// ConfigDelete operation of Config tasks removes a config key (so the stack default takes over)
+	ConfigDelete = "delete"
+	// ConfigRollback operation of Config tasks makes a previous config version ('version' parameter) current again
+	ConfigRollback = "rollback"
+	// HostMaintenance turns on or turns off maintenance mode of the filtered hosts ('state' parameter: on or off)
+	HostMaintenance = "HostMaintenance"
+	// WaitForState waits until services or components reach a state (e.g. STARTED)
+	WaitForState = "WaitForState"
+	// Maintenance starts (START command) or stops (STOP command) a maintenance window, other invocations cannot change configs or run ambari commands meanwhile
+	Maintenance = "Maintenance"
+	// AddService creates a service with its components and host components, then installs (and optionally starts) it
+	AddService = "AddService"
+	// AlertCheck fails if there are ambari alerts at or above a severity (optionally waits for them to clear)
+	AlertCheck = "AlertCheck"
+	// ConfigGroupTask creates (or updates) a config group of a service with the filtered hosts and config overrides, or deletes it
+	ConfigGroupTask = "ConfigGroup"
+	// ConfigGroupCreate operation of ConfigGroup tasks creates the group, or updates its hosts and overrides if it exists (default)
+	ConfigGroupCreate = "create"
+	// ConfigGroupDelete operation of ConfigGroup tasks deletes the group
+	ConfigGroupDelete = "delete"
 )
 
 // Playbook contains an array of tasks that will be executed on ambari hosts
 type Playbook struct {
-	Name        string  `yaml:"name"`
-	Description string  `yaml:"description"`
-	Tasks       []Task  `yaml:"tasks"`
-	Inputs      []Input `yaml:"inputs"`
+	Name              string            `yaml:"name"`
+	Description       string            `yaml:"description,omitempty"`
+	Tasks             []Task            `yaml:"tasks,omitempty"`
+	Verify            []Task            `yaml:"verify,omitempty"`
+	Inputs            []Input           `yaml:"inputs,omitempty"`
+	IgnoreUnreachable bool              `yaml:"ignore_unreachable,omitempty"`
+	Timeout           int               `yaml:"timeout,omitempty"`
+	Variables         map[string]string `yaml:"-"`
+}
+
+// PlaybookOptions holds the options of a playbook execution, they apply only to that execution
+type PlaybookOptions struct {
+	// DryRun only prints the tasks with their target hosts instead of running them
+	DryRun bool
+	// Tags run only the tasks that have any of these tags (every task if there are no tags)
+	Tags []string
+	// SkipTags skip the tasks that have any of these tags (even if they have any of the Tags)
+	SkipTags []string
+	// StartAtTask skips the tasks before the task with this name (e.g. for resuming a failed run)
+	StartAtTask string
+	// Step asks before running each task whether it should run (until the user chooses to continue without asking)
+	Step bool
+	// Limit restricts the hosts of the tasks to these hosts (host names, public host names or IPs), on top of the filters of the tasks
+	Limit []string
 }
 
 // Task represents a task that can be executed on an ambari hosts
 type Task struct {
 	Name                string            `yaml:"name"`
-	Type                string            `yaml:"type"`
-	Command             string            `yaml:"command"`
-	HostComponentFilter string            `yaml:"host_component_filter"`
-	AmbariServerFilter  bool              `yaml:"ambari_server"`
-	AmbariAgentFilter   bool              `yaml:"ambari_agent"`
-	HostFilter          string            `yaml:"hosts"`
-	ServiceFilter       string            `yaml:"services"`
-	ComponentFilter     string            `yaml:"components"`
+	When                string            `yaml:"when,omitempty"`
+	Register            string            `yaml:"register,omitempty"`
+	Type                string            `yaml:"type,omitempty"`
+	Command             string            `yaml:"command,omitempty"`
+	HostComponentFilter string            `yaml:"host_component_filter,omitempty"`
+	AmbariServerFilter  bool              `yaml:"ambari_server,omitempty"`
+	AmbariAgentFilter   bool              `yaml:"ambari_agent,omitempty"`
+	HostFilter          string            `yaml:"hosts,omitempty"`
+	ServiceFilter       string            `yaml:"services,omitempty"`
+	ComponentFilter     string            `yaml:"components,omitempty"`
+	MissingComponents   string            `yaml:"missing_components,omitempty"`
+	Filter              *Filter           `yaml:"filter,omitempty"`
+	Assertions          []string          `yaml:"that,omitempty"`
+	Timeout             int               `yaml:"timeout,omitempty"`
+	Parallelism         int               `yaml:"parallelism,omitempty"`
+	Retries             int               `yaml:"retries,omitempty"`
+	RetryDelay          time.Duration     `yaml:"retry_delay,omitempty"`
+	IgnoreUnreachable   bool              `yaml:"ignore_unreachable,omitempty"`
+	ConnectionProfile   string            `yaml:"profile,omitempty"`
+	Cluster             string            `yaml:"cluster,omitempty"`
+	Become              bool              `yaml:"become,omitempty"`
+	Shell               bool              `yaml:"shell,omitempty"`
+	NoLog               bool              `yaml:"no_log,omitempty"`
+	Workdir             string            `yaml:"workdir,omitempty"`
+	Env                 map[string]string `yaml:"env,omitempty"`
+	Credentials         string            `yaml:"credentials,omitempty"`
 	Parameters          map[string]string `yaml:"parameters,omitempty"`
+	Configs             map[string]string `yaml:"configs,omitempty"`
+	ContinueOnError     bool              `yaml:"continue_on_error,omitempty"`
+	Loop                []string          `yaml:"loop,omitempty"`
+	Include             string            `yaml:"include,omitempty"`
+	Tags                []string          `yaml:"tags,omitempty"`
+	Async               bool              `yaml:"async,omitempty"`
+	inLoop              bool
+	loopItem            string
+}
+
+// UnmarshalYAML read a task, ignore_errors is accepted as an alias of continue_on_error (only one of them can be set)
+func (t *Task) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plainTask Task
+	if err := unmarshal((*plainTask)(t)); err != nil {
+		return err
+	}
+	var aliases struct {
+		ContinueOnError *bool `yaml:"continue_on_error"`
+		IgnoreErrors    *bool `yaml:"ignore_errors"`
+	}
+	if err := unmarshal(&aliases); err != nil {
+		return err
+	}
+	if aliases.IgnoreErrors != nil {
+		if aliases.ContinueOnError != nil {
+			return fmt.Errorf("Task '%s' has both continue_on_error and ignore_errors, use only one of them", t.Name)
+		}
+		t.ContinueOnError = *aliases.IgnoreErrors
+	}
+	return nil
 }
 
 // Input represents a variable that needs to be provided by users (if default value is empty)
 type Input struct {
 	Name    string `yaml:"name"`
 	Default string `yaml:"default,omitempty"`
+	// Sensitive inputs (e.g. passwords) are masked in the outputs and asked without echo
+	Sensitive bool `yaml:"sensitive,omitempty"`
+	// Env is an environment variable that provides the value if it is not set explicitly (it takes precedence over the default value)
+	Env string `yaml:"env,omitempty"`
+	// Type of the value: string (default), int or bool
+	Type string `yaml:"type,omitempty"`
+	// Required inputs cannot be empty (even if they are provided explicitly)
+	Required bool `yaml:"required,omitempty"`
+	// Pattern is a regular expression that the whole value needs to match
+	Pattern string `yaml:"pattern,omitempty"`
+}
+
+// playbookTemplateFuncs are the functions that can be used in playbook templates, e.g.: {{env "HOME"}} (empty if the variable is not set)
+var playbookTemplateFuncs = template.FuncMap{
+	"env": os.Getenv,
+}
+
+// hostLimitedTaskTypes the types of the tasks that run on hosts, so the host limit (PlaybookOptions.Limit) is applied on them
+var hostLimitedTaskTypes = []string{RemoteCommand, Upload, AmbariCommand, HostMaintenance}
+
+var ignoreUnreachable bool
+
+const loopItemVariable = "item"
+
+// downloadHeaderPrefix is the prefix of the Download task parameters that are sent as request headers
+const downloadHeaderPrefix = "header."
+
+// SetIgnoreUnreachable skip unreachable hosts in every task of the executed playbooks (instead of failing)
+func SetIgnoreUnreachable(ignore bool) {
+	ignoreUnreachable = ignore
+}
+
+// isTaskSelectedByTags reports whether a task needs to run based on the tags and skip tags of the options (skip tags win)
+func isTaskSelectedByTags(task Task, options PlaybookOptions) bool {
+	hasAnyTag := func(tags []string) bool {
+		for _, tag := range task.Tags {
+			if containsString(tags, tag) {
+				return true
+			}
+		}
+		return false
+	}
+	if hasAnyTag(options.SkipTags) {
+		return false
+	}
+	return len(options.Tags) == 0 || hasAnyTag(options.Tags)
+}
+
+var nonInteractive bool
+
+// SetNonInteractive fail loading the playbooks if inputs are missing instead of asking them (e.g. for CI pipelines)
+func SetNonInteractive(enabled bool) {
+	nonInteractive = enabled
 }
 
 // LoadPlaybookFile read a playbook yaml file and transform it to a Playbook object
 func LoadPlaybookFile(location string, varsInput string) Playbook {
-	varInputMap := createVarMap(varsInput)
-	data, err := ioutil.ReadFile(location)
+	varInputMap, err := createVarMap(varsInput)
 	if err != nil {
-		fmt.Print(err)
+		errPrintln(err)
 		os.Exit(1)
 	}
+	playbook, err := loadPlaybookFile(location, varInputMap, nil, nil)
+	if err != nil {
+		errPrintln(err)
+		os.Exit(1)
+	}
+	playbook.Variables = make(map[string]string)
+	for name, value := range varInputMap {
+		playbook.Variables[name] = fmt.Sprintf("%v", value)
+	}
+	outPrintln(fmt.Sprintf("[Executing playbook: %v, file: %v]", playbook.Name, location))
+	return playbook
+}
+
+// loadPlaybookFile read and render a playbook yaml file (asking for the missing inputs), the included playbooks are loaded as well,
+// includeChain holds the locations of the playbooks that include this one, parentTasks holds their tasks
+func loadPlaybookFile(location string, varInputMap map[string]interface{}, includeChain []string, parentTasks []Task) (Playbook, error) {
+	absLocation, err := filepath.Abs(location)
+	if err != nil {
+		return Playbook{}, err
+	}
+	if containsString(includeChain, absLocation) {
+		return Playbook{}, fmt.Errorf("Circular include of playbook '%s': %s", location, strings.Join(append(includeChain, absLocation), " -> "))
+	}
+	data, err := ioutil.ReadFile(location)
+	if err != nil {
+		return Playbook{}, err
+	}
 	playbookTempl := Playbook{}
 	err = yaml.Unmarshal([]byte(data), &playbookTempl)
 	if err != nil {
-		fmt.Print(err)
-		os.Exit(1)
+		return Playbook{}, err
 	}
-	if len(playbookTempl.Inputs) > 0 {
-		for _, input := range playbookTempl.Inputs {
-			if varVal, ok := varInputMap[input.Name]; ok {
-				fmt.Println(fmt.Sprintf("Found input: %v - %v", input.Name, varVal))
-				continue
-			}
-			if len(input.Default) == 0 {
-				varSetByUser := GetStringFlag("", "", fmt.Sprintf("Enter %v", input.Name))
-				varInputMap[input.Name] = varSetByUser
-				continue
-			}
-			varInputMap[input.Name] = input.Default
+	if missing := getMissingInputs(playbookTempl.Inputs, varInputMap); nonInteractive && len(missing) > 0 {
+		return Playbook{}, fmt.Errorf("Missing inputs of playbook '%s' (non-interactive mode): %s", location, strings.Join(missing, ", "))
+	}
+	for _, input := range playbookTempl.Inputs {
+		if err := resolveInput(input, varInputMap); err != nil {
+			return Playbook{}, err
 		}
 	}
-	templ := template.New("playbook template")
+	runtimeTasks := make([]Task, 0)
+	runtimeTasks = append(append(append(runtimeTasks, parentTasks...), playbookTempl.Tasks...), playbookTempl.Verify...)
+	data = escapeRuntimeReferences(data, runtimeTasks)
+	templ := template.New("playbook template").Funcs(playbookTemplateFuncs)
 	textTemplate, _ := templ.Parse(fmt.Sprintf("%s", data))
 	var tpl bytes.Buffer
 	textTemplate.Execute(&tpl, varInputMap)
@@ -103,186 +285,1223 @@ func LoadPlaybookFile(location string, varsInput string) Playbook {
 	playbook := Playbook{}
 	err = yaml.Unmarshal(tpl.Bytes(), &playbook)
 	if err != nil {
-		fmt.Print(err)
-		os.Exit(1)
+		return Playbook{}, err
 	}
-	fmt.Println(fmt.Sprintf("[Executing playbook: %v, file: %v]", playbook.Name, location))
-	return playbook
+	includeChain = append(append(make([]string, 0), includeChain...), absLocation)
+	playbook.Tasks, err = includeTasks(playbook.Tasks, filepath.Dir(location), varInputMap, includeChain, runtimeTasks)
+	if err != nil {
+		return Playbook{}, err
+	}
+	playbook.Verify, err = includeTasks(playbook.Verify, filepath.Dir(location), varInputMap, includeChain, runtimeTasks)
+	if err != nil {
+		return Playbook{}, err
+	}
+	return playbook, nil
+}
+
+// getMissingInputs get the names of the inputs that would be asked from the user (not provided explicitly, by environment variable or by default value)
+func getMissingInputs(inputs []Input, varInputMap map[string]interface{}) []string {
+	missing := make([]string, 0)
+	for _, input := range inputs {
+		if _, ok := varInputMap[input.Name]; ok {
+			continue
+		}
+		if _, ok := os.LookupEnv(input.Env); len(input.Env) > 0 && ok {
+			continue
+		}
+		if len(input.Default) == 0 {
+			missing = append(missing, input.Name)
+		}
+	}
+	return missing
+}
+
+// resolveInput set the value of an input: the explicitly provided value, the environment variable of the input, the default value
+// or the value that is asked from the user (in this order), the value is validated (values that are asked are asked again if they are invalid)
+func resolveInput(input Input, varInputMap map[string]interface{}) error {
+	value, provided := varInputMap[input.Name]
+	source := ""
+	if provided {
+		source = "Found input"
+	} else if envVal, ok := os.LookupEnv(input.Env); len(input.Env) > 0 && ok {
+		value, provided = envVal, true
+		source = fmt.Sprintf("Found input in environment variable %v", input.Env)
+	} else if len(input.Default) > 0 {
+		value, provided = input.Default, true
+	}
+	if provided {
+		strValue := fmt.Sprint(value)
+		if input.Sensitive {
+			AddSecret(strValue)
+		}
+		if err := validateInputValue(input, strValue); err != nil {
+			return err
+		}
+		if len(source) > 0 {
+			outPrintln(fmt.Sprintf("%s: %v - %v", source, input.Name, strValue))
+		}
+		varInputMap[input.Name] = value
+		return nil
+	}
+	for {
+		var varSetByUser string
+		if input.Sensitive {
+			varSetByUser = GetPassword("", fmt.Sprintf("Enter %v", input.Name))
+			AddSecret(varSetByUser)
+		} else {
+			varSetByUser = GetStringFlag("", "", fmt.Sprintf("Enter %v", input.Name))
+		}
+		if err := validateInputValue(input, varSetByUser); err != nil {
+			errPrintln(err)
+			continue
+		}
+		varInputMap[input.Name] = varSetByUser
+		return nil
+	}
+}
+
+// includeTasks replace the include tasks with the tasks of the included playbooks (their locations are relative to the including playbook)
+func includeTasks(tasks []Task, directory string, varInputMap map[string]interface{}, includeChain []string, parentTasks []Task) ([]Task, error) {
+	result := make([]Task, 0)
+	for _, task := range tasks {
+		if len(task.Include) == 0 {
+			result = append(result, task)
+			continue
+		}
+		location := task.Include
+		if !filepath.IsAbs(location) {
+			location = filepath.Join(directory, location)
+		}
+		includedPlaybook, err := loadPlaybookFile(location, varInputMap, includeChain, parentTasks)
+		if err != nil {
+			return nil, err
+		}
+		for _, includedTask := range includedPlaybook.Tasks {
+			// the included tasks inherit the tags of the include task
+			for _, tag := range task.Tags {
+				if !containsString(includedTask.Tags, tag) {
+					includedTask.Tags = append(includedTask.Tags, tag)
+				}
+			}
+			result = append(result, includedTask)
+		}
+	}
+	return result, nil
+}
+
+// SavePlaybookFile write a Playbook object to a yaml file (that can be loaded with LoadPlaybookFile)
+func SavePlaybookFile(playbook Playbook, location string) error {
+	data, err := yaml.Marshal(&playbook)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(location, data, 0644)
+}
+
+// ExecutePlaybook runs tasks on ambari hosts based on a playbook object (nothing runs if ValidatePlaybook finds any problem).
+// The verify tasks (if there are any) always run at the end, even if one of the tasks has failed,
+// and their result determines the result of the playbook execution. The returned report contains the results of the tasks (by hosts).
+// If the context is cancelled, the running commands, copies and downloads are stopped, and no more tasks (including verify tasks) are started
+func (a AmbariRegistry) ExecutePlaybook(ctx context.Context, playbook Playbook, options PlaybookOptions) (PlaybookResult, error) {
+	result := PlaybookResult{Name: playbook.Name, Cluster: a.Name, StartTime: time.Now()}
+	if validationErrors := ValidatePlaybook(playbook); len(validationErrors) > 0 {
+		for _, validationError := range validationErrors {
+			errPrintln(validationError)
+		}
+		result.EndTime = time.Now()
+		return result, fmt.Errorf("Playbook '%s' is invalid (%d errors), none of its tasks have been executed", playbook.Name, len(validationErrors))
+	}
+	if len(options.StartAtTask) > 0 && getTaskIndex(playbook.Tasks, options.StartAtTask) < 0 {
+		result.EndTime = time.Now()
+		return result, fmt.Errorf("Task '%s' (to start at) does not exist in playbook '%s'", options.StartAtTask, playbook.Name)
+	}
+	err := a.executePlaybookTasks(ctx, playbook, &options, &result)
+	result.EndTime = time.Now()
+	result.Success = err == nil
+	if options.DryRun {
+		return result, err
+	}
+	playbookRun := PlaybookRun{Name: playbook.Name, Cluster: a.Name, StartTime: result.StartTime, EndTime: result.EndTime}
+	playbookRun.Status = PlaybookRunSuccess
+	if err != nil {
+		playbookRun.Status = PlaybookRunFailed
+	}
+	RecordPlaybookRun(playbookRun)
+	CleanupRunTempDir(err != nil)
+	return result, err
+}
+
+func (a AmbariRegistry) executePlaybookTasks(ctx context.Context, playbook Playbook, options *PlaybookOptions, result *PlaybookResult) error {
+	vars := playbook.Variables
+	if vars == nil {
+		vars = make(map[string]string)
+	}
+	if playbook.IgnoreUnreachable || ignoreUnreachable {
+		playbook.Tasks = ignoreUnreachableHosts(playbook.Tasks)
+		playbook.Verify = ignoreUnreachableHosts(playbook.Verify)
+	}
+	playbook.Tasks = defaultTaskTimeouts(playbook.Tasks, playbook.Timeout)
+	playbook.Verify = defaultTaskTimeouts(playbook.Verify, playbook.Timeout)
+	registered := make(map[string]interface{})
+	var err error
+	skippedTasks := make([]TaskResult, 0)
+	if startIndex := getTaskIndex(playbook.Tasks, options.StartAtTask); len(options.StartAtTask) > 0 && startIndex > 0 {
+		for _, task := range playbook.Tasks[:startIndex] {
+			outPrintln(fmt.Sprintf("[skipped] task: %s (before '%s')", task.Name, options.StartAtTask))
+			taskResult := createTaskResult(task, time.Now(), nil, nil)
+			taskResult.Status = TaskSkipped
+			skippedTasks = append(skippedTasks, taskResult)
+		}
+		playbook.Tasks = playbook.Tasks[startIndex:]
+	}
+	result.Tasks, err = a.executeTasks(ctx, playbook.Tasks, vars, registered, options)
+	result.Tasks = append(skippedTasks, result.Tasks...)
+	if len(playbook.Verify) > 0 && ctx.Err() == nil {
+		if err != nil {
+			outPrintln(fmt.Sprintf("Task execution failed: %v", err))
+		}
+		outPrintln("[Executing verify tasks]")
+		result.Verify, err = a.executeTasks(ctx, playbook.Verify, vars, registered, options)
+	}
+	if failedTasks := result.FailedTasks(); len(failedTasks) > 0 && err == nil {
+		outPrintln("[Failed tasks (continued on error)]")
+		for _, failedTask := range failedTasks {
+			outPrintln(fmt.Sprintf("  %s: %s", failedTask.Name, failedTask.Error))
+		}
+	}
+	return err
 }
 
-// ExecutePlaybook runs tasks on ambari hosts based on a playbook object
-func (a AmbariRegistry) ExecutePlaybook(playbook Playbook) {
-	tasks := playbook.Tasks
+func ignoreUnreachableHosts(tasks []Task) []Task {
+	result := make([]Task, 0)
 	for _, task := range tasks {
-		if len(task.Type) > 0 {
-			filteredHosts := make(map[string]bool)
-			if !task.AmbariAgentFilter {
-				filter := CreateFilter(task.ServiceFilter, task.ComponentFilter, task.HostFilter, task.AmbariServerFilter)
-				filteredHosts = a.GetFilteredHosts(filter)
+		task.IgnoreUnreachable = true
+		result = append(result, task)
+	}
+	return result
+}
+
+// defaultTaskTimeouts set the command timeout (in seconds) of the tasks that have no timeout,
+// the playbook level timeout is used if it is set, otherwise DefaultCommandTimeout
+func defaultTaskTimeouts(tasks []Task, playbookTimeout int) []Task {
+	timeout := playbookTimeout
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+	result := make([]Task, 0)
+	for _, task := range tasks {
+		if task.Timeout <= 0 {
+			task.Timeout = timeout
+		}
+		result = append(result, task)
+	}
+	return result
+}
+
+// asyncTask is a task that runs in the background, until the next non-async task (or the end of the tasks) waits for it,
+// it registers its output to its own variables, those are merged to the playbook variables when the task is waited
+type asyncTask struct {
+	task       Task
+	index      int
+	vars       map[string]string
+	registered map[string]interface{}
+	result     TaskResult
+	err        error
+	done       chan struct{}
+}
+
+// executeTasks runs the tasks until one of them fails (except the ones with continue_on_error), returns the results of the tasks.
+// Consecutive async tasks run concurrently, the next non-async task starts only after all of them have finished.
+// No more tasks are started after the context is cancelled. The options belong to the current run (step mode is turned off in them if the user chooses to continue)
+func (a AmbariRegistry) executeTasks(ctx context.Context, tasks []Task, vars map[string]string, registered map[string]interface{}, options *PlaybookOptions) ([]TaskResult, error) {
+	taskResults := make([]TaskResult, 0)
+	running := make([]*asyncTask, 0)
+	finish := func(err error) ([]TaskResult, error) {
+		if asyncErr := waitForAsyncTasks(running, taskResults, vars, registered); err == nil {
+			err = asyncErr
+		}
+		return taskResults, err
+	}
+	for _, task := range expandLoops(tasks) {
+		if !task.Async || options.DryRun {
+			if err := waitForAsyncTasks(running, taskResults, vars, registered); err != nil {
+				return taskResults, err
 			}
-			if task.Type == RemoteCommand {
-				a.ExecuteRemoteCommandTask(task, filteredHosts)
+			running = make([]*asyncTask, 0)
+		}
+		if ctx.Err() != nil {
+			return finish(fmt.Errorf("Playbook execution has been cancelled, task '%s' and the remaining tasks have not been started", task.Name))
+		}
+		startTime := time.Now()
+		if task.inLoop {
+			vars[loopItemVariable] = task.loopItem
+		} else {
+			delete(vars, loopItemVariable)
+		}
+		if !isTaskSelectedByTags(task, *options) {
+			tagsInfo := "no tags"
+			if len(task.Tags) > 0 {
+				tagsInfo = "tags: " + strings.Join(task.Tags, ", ")
 			}
-			if task.Type == LocalCommand {
-				ExecuteLocalCommandTask(task)
+			outPrintln(fmt.Sprintf("[skipped] task: %s (%s)", task.Name, tagsInfo))
+			taskResult := createTaskResult(task, startTime, nil, nil)
+			taskResult.Status = TaskSkipped
+			taskResults = append(taskResults, taskResult)
+			continue
+		}
+		task, err := renderTaskTemplates(task, vars, registered)
+		if err != nil {
+			taskResults = append(taskResults, createTaskResult(task, startTime, nil, err))
+			return finish(err)
+		}
+		if len(task.When) > 0 {
+			run, err := EvaluateWhenCondition(task.When, vars)
+			if err != nil && options.DryRun {
+				outPrintln(fmt.Sprintf("[dry-run] condition of task '%s' cannot be evaluated without running the previous tasks: %s", task.Name, task.When))
+				run = true
+			} else if err != nil {
+				err = fmt.Errorf("Invalid 'when' condition of task '%s': %v", task.Name, err)
+				taskResults = append(taskResults, createTaskResult(task, startTime, nil, err))
+				return finish(err)
+			}
+			if !run {
+				outPrintln(fmt.Sprintf("[skipped] task: %s (condition: %s)", task.Name, task.When))
+				taskResult := createTaskResult(task, startTime, nil, nil)
+				taskResult.Status = TaskSkipped
+				taskResults = append(taskResults, taskResult)
+				continue
 			}
-			if task.Type == Download {
-				ExecuteDownloadFileTask(task)
+		}
+		if options.Step && !options.DryRun {
+			answer := strings.ToLower(GetStringFlag("", "y", fmt.Sprintf("Run task '%s'? (y)es / (n)o / (c)ontinue without asking", task.Name)))
+			if strings.HasPrefix(answer, "n") {
+				outPrintln(fmt.Sprintf("[skipped] task: %s (step mode)", task.Name))
+				taskResult := createTaskResult(task, startTime, nil, nil)
+				taskResult.Status = TaskSkipped
+				taskResults = append(taskResults, taskResult)
+				continue
 			}
-			if task.Type == Upload {
-				a.ExecuteUploadFileTask(task, filteredHosts)
+			if strings.HasPrefix(answer, "c") {
+				options.Step = false
 			}
-			if task.Type == Config {
-				a.ExecuteConfigCommand(task)
+		}
+		if task.Async && !options.DryRun {
+			outPrintln(fmt.Sprintf("[async] task: %s (runs in the background)", task.Name))
+			taskResults = append(taskResults, TaskResult{})
+			background := &asyncTask{task: task, index: len(taskResults) - 1, vars: make(map[string]string),
+				registered: make(map[string]interface{}), done: make(chan struct{})}
+			for key, value := range vars {
+				background.vars[key] = value
 			}
-			if task.Type == AmbariCommand {
-				a.ExecuteAmbariCommand(task)
+			running = append(running, background)
+			taskOptions := *options
+			go func() {
+				background.result, background.err = a.runTask(ctx, background.task, startTime, background.vars, background.registered, taskOptions)
+				close(background.done)
+			}()
+			continue
+		}
+		taskResult, err := a.runTask(ctx, task, startTime, vars, registered, *options)
+		taskResults = append(taskResults, taskResult)
+		if err != nil && ctx.Err() != nil {
+			return finish(fmt.Errorf("Playbook execution has been cancelled during task '%s': %v", task.Name, err))
+		}
+		if err != nil {
+			if !task.ContinueOnError {
+				return taskResults, err
 			}
-		} else {
-			if len(task.Name) > 0 {
-				fmt.Println(fmt.Sprintf("Type field for task '%s' is required!", task.Name))
-			} else {
-				fmt.Println("Type field for task is required!")
+			outPrintln(fmt.Sprintf("[failed, continuing] task: %s: %v", task.Name, err))
+		}
+	}
+	return finish(nil)
+}
+
+// runTask runs a task with the overridden credentials of the task (the commands and outputs are hidden if no_log is set), returns the result of the task
+func (a AmbariRegistry) runTask(ctx context.Context, task Task, startTime time.Time, vars map[string]string, registered map[string]interface{}, options PlaybookOptions) (TaskResult, error) {
+	var responses map[string]RemoteResponse
+	var requests []Request
+	ambariRegistry, err := a.overrideCredentials(task)
+	if err == nil {
+		if task.NoLog {
+			outPrintln(fmt.Sprintf("[no_log] task: %s (the output is hidden)", task.Name))
+			ctx = withOutputHidden(ctx)
+		}
+		responses, requests, err = ambariRegistry.executeTask(ctx, task, vars, registered, options)
+		if task.NoLog && err != nil {
+			err = fmt.Errorf("Task '%s' failed (the error is hidden by no_log)", task.Name)
+		}
+	}
+	taskResult := createTaskResult(task, startTime, responses, err)
+	taskResult.Requests = createRequestResults(requests)
+	return taskResult, err
+}
+
+// waitForAsyncTasks wait until the running async tasks finish, store their results (at the positions of the tasks)
+// and merge their registered outputs to the variables, returns the first error of the tasks that are not allowed to fail
+func waitForAsyncTasks(running []*asyncTask, taskResults []TaskResult, vars map[string]string, registered map[string]interface{}) error {
+	var firstErr error
+	for _, background := range running {
+		<-background.done
+		taskResults[background.index] = background.result
+		mergeRegisteredOutputs(background.vars, background.registered, vars, registered)
+		if background.err == nil {
+			continue
+		}
+		if background.task.ContinueOnError {
+			outPrintln(fmt.Sprintf("[failed, continuing] task: %s: %v", background.task.Name, background.err))
+		} else if firstErr == nil {
+			firstErr = background.err
+		}
+	}
+	return firstErr
+}
+
+// getTaskIndex get the index of the task with the name (-1 if there is no such task)
+func getTaskIndex(tasks []Task, name string) int {
+	for index, task := range tasks {
+		if task.Name == name {
+			return index
+		}
+	}
+	return -1
+}
+
+// expandLoops replace the tasks that have loop items with a task for every item (comma separated items are split, so inputs can be used as lists)
+func expandLoops(tasks []Task) []Task {
+	result := make([]Task, 0)
+	for _, task := range tasks {
+		if len(task.Loop) == 0 {
+			result = append(result, task)
+			continue
+		}
+		for _, loopValue := range task.Loop {
+			for _, item := range strings.Split(loopValue, ",") {
+				itemTask := task
+				itemTask.Name = fmt.Sprintf("%s (%s)", task.Name, strings.TrimSpace(item))
+				itemTask.Loop = nil
+				itemTask.inLoop = true
+				itemTask.loopItem = strings.TrimSpace(item)
+				result = append(result, itemTask)
 			}
-			os.Exit(1)
 		}
 	}
+	return result
 }
 
-// ExecuteAmbariCommand executes an ambari command against services or components
-func (a AmbariRegistry) ExecuteAmbariCommand(task Task) {
+// overrideCredentials use the connection profile and/or the ambari credentials (of another registry entry) of a task instead of the active ones
+func (a AmbariRegistry) overrideCredentials(task Task) (AmbariRegistry, error) {
+	if len(task.ConnectionProfile) > 0 {
+		if len(GetConnectionProfileEntryId(task.ConnectionProfile)) == 0 {
+			return a, fmt.Errorf("Connection profile '%s' of task '%s' does not exist", task.ConnectionProfile, task.Name)
+		}
+		a.ConnectionProfile = task.ConnectionProfile
+	}
+	if len(task.Credentials) > 0 {
+		credentialsRegistry := GetAmbariById(task.Credentials)
+		if len(credentialsRegistry.Name) == 0 {
+			return a, fmt.Errorf("Ambari registry entry '%s' (credentials of task '%s') does not exist", task.Credentials, task.Name)
+		}
+		credentialsRegistry, err := resolvePassword(credentialsRegistry)
+		if err != nil {
+			return a, err
+		}
+		a.Username = credentialsRegistry.Username
+		a.Password = credentialsRegistry.Password
+	}
+	if task.Become {
+		a.become = true
+	}
+	return a, nil
+}
+
+// executeTask runs a task, returns the outputs by hosts for command tasks and the finished ambari requests for ambari command tasks
+func (a AmbariRegistry) executeTask(ctx context.Context, task Task, vars map[string]string, registered map[string]interface{}, options PlaybookOptions) (map[string]RemoteResponse, []Request, error) {
+	task = mergeStructuredFilter(task)
+	if err := validateTask(task); err != nil {
+		return nil, nil, err
+	}
+	task, err := ApplyTaskParameterSpec(task)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err = a.SelectCluster(task.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	a.ctx = ctx
+	filteredHosts := make(map[string]bool)
+	if !task.AmbariAgentFilter {
+		filter, err := ParseFilter(task.ServiceFilter, task.ComponentFilter, task.HostFilter, task.MissingComponents, task.AmbariServerFilter)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid filter in task '%s': %v", task.Name, err)
+		}
+		filteredHosts = a.GetFilteredHosts(filter)
+		debugPrintln(fmt.Sprintf("Task '%s' filtered hosts: %v", task.Name, filteredHosts))
+	}
+	if len(options.Limit) > 0 && containsString(hostLimitedTaskTypes, task.Type) {
+		if len(filteredHosts) == 0 {
+			filteredHosts = a.GetFilteredHosts(Filter{Server: task.AmbariServerFilter})
+		}
+		filteredHosts = a.LimitHosts(filteredHosts, options.Limit)
+		if len(filteredHosts) == 0 {
+			outPrintln(fmt.Sprintf("[skipped] task: %s (no hosts within the limit: %s)", task.Name, strings.Join(options.Limit, ", ")))
+			return nil, nil, nil
+		}
+		a.hostLimited = true
+	}
+	if options.DryRun {
+		printDryRunTask(task, filteredHosts)
+		return nil, nil, nil
+	}
+	if task.Parallelism > 0 {
+		a.parallelism = task.Parallelism
+	}
+	switch task.Type {
+	case RemoteCommand:
+		responses, err := a.runRemoteCommandTask(ctx, task, filteredHosts)
+		if len(task.Register) > 0 {
+			RegisterTaskOutput(task.Register, responses, vars, registered)
+		}
+		return responses, nil, err
+	case LocalCommand:
+		responses, err := runLocalCommandTask(ctx, task)
+		if len(task.Register) > 0 {
+			RegisterTaskOutput(task.Register, responses, vars, registered)
+		}
+		return responses, nil, err
+	case Download:
+		return nil, nil, ExecuteDownloadFileTask(ctx, task)
+	case Upload:
+		if EvaluateBoolValueFromString(task.Parameters["template"]) {
+			if task, err = renderUploadSource(task, vars, registered); err != nil {
+				return nil, nil, err
+			}
+		}
+		return nil, nil, a.ExecuteUploadFileTask(ctx, task, filteredHosts)
+	case Config:
+		if task.Parameters["operation"] == ConfigGet {
+			value, err := a.ExecuteGetConfigTask(task)
+			responses := map[string]RemoteResponse{a.Hostname: {StdOut: value, Done: err == nil, Err: err}}
+			if len(task.Register) > 0 {
+				RegisterTaskOutput(task.Register, responses, vars, registered)
+			}
+			return responses, nil, err
+		}
+		if err := CheckMaintenance(a.Name); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, a.ExecuteConfigCommand(task)
+	case AmbariCommand:
+		if err := CheckMaintenance(a.Name); err != nil {
+			return nil, nil, err
+		}
+		requests, err := a.ExecuteAmbariCommand(ctx, task, filteredHosts)
+		return nil, requests, err
+	case AddService:
+		if err := CheckMaintenance(a.Name); err != nil {
+			return nil, nil, err
+		}
+		requests, err := a.ExecuteAddServiceTask(ctx, task)
+		return nil, requests, err
+	case ServiceCheck:
+		return nil, nil, a.ExecuteServiceCheckTask(ctx, task)
+	case WaitForState:
+		return nil, nil, a.ExecuteWaitForState(ctx, task)
+	case HostMaintenance:
+		if err := CheckMaintenance(a.Name); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, a.ExecuteHostMaintenanceTask(task, filteredHosts)
+	case VersionCheck:
+		return nil, nil, a.ExecuteVersionCheckTask(task)
+	case AlertCheck:
+		return nil, nil, a.ExecuteAlertCheckTask(ctx, task)
+	case ConfigGroupTask:
+		if err := CheckMaintenance(a.Name); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, a.ExecuteConfigGroupTask(task, filteredHosts)
+	case Maintenance:
+		return nil, nil, a.ExecuteMaintenanceTask(task)
+	case Assert:
+		return nil, nil, ExecuteAssertTask(task, vars)
+	case Mapping:
+		return nil, nil, a.ExecuteMappingTask(task)
+	}
+	return nil, nil, nil
+}
+
+// printDryRunTask print what a task would do and on which hosts
+func printDryRunTask(task Task, filteredHosts map[string]bool) {
+	outPrintln(fmt.Sprintf("[dry-run] task: %s (type: %s)", task.Name, task.Type))
 	if len(task.Command) > 0 {
-		useComponentFilter := false
-		useServiceFilter := false
-		if len(task.ComponentFilter) > 0 {
-			useComponentFilter = true
-		} else if len(task.ServiceFilter) > 0 {
-			useServiceFilter = true
+		outPrintln("  command: " + task.Command)
+	}
+	if len(task.Cluster) > 0 {
+		outPrintln("  cluster: " + task.Cluster)
+	}
+	for _, assertion := range task.Assertions {
+		outPrintln("  that: " + assertion)
+	}
+	parameterNames := make([]string, 0)
+	for name := range task.Parameters {
+		parameterNames = append(parameterNames, name)
+	}
+	sort.Strings(parameterNames)
+	for _, name := range parameterNames {
+		value := task.Parameters[name]
+		if name == "password" || strings.EqualFold(name, downloadHeaderPrefix+"Authorization") {
+			value = passwordMask
 		}
+		outPrintln(fmt.Sprintf("  %s: %s", name, value))
+	}
+	configKeys := make([]string, 0)
+	for configKey := range task.Configs {
+		configKeys = append(configKeys, configKey)
+	}
+	sort.Strings(configKeys)
+	for _, configKey := range configKeys {
+		outPrintln(fmt.Sprintf("  config %s: %s", configKey, task.Configs[configKey]))
+	}
+	if task.AmbariAgentFilter && len(filteredHosts) == 0 {
+		return
+	}
+	hosts := make([]string, 0)
+	for host := range filteredHosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	outPrintln(fmt.Sprintf("  hosts: %s", strings.Join(hosts, ", ")))
+}
 
-		if useComponentFilter {
-			filter := CreateFilter("", task.ComponentFilter, "", false)
-			a.RunAmbariServiceCommand(task.Command, filter, useServiceFilter, useComponentFilter)
+// mergeStructuredFilter add the values of the structured filter block of a task to its flat filter fields
+func mergeStructuredFilter(task Task) Task {
+	if task.Filter == nil {
+		return task
+	}
+	task.ServiceFilter = appendFilterValues(task.ServiceFilter, task.Filter.Services)
+	task.ServiceFilter = appendFilterValues(task.ServiceFilter, excludedFilterValues(task.Filter.ExcludedServices))
+	task.ComponentFilter = appendFilterValues(task.ComponentFilter, task.Filter.Components)
+	task.ComponentFilter = appendFilterValues(task.ComponentFilter, excludedFilterValues(task.Filter.ExcludedComponents))
+	task.HostFilter = appendFilterValues(task.HostFilter, task.Filter.Hosts)
+	task.HostFilter = appendFilterValues(task.HostFilter, excludedFilterValues(task.Filter.ExcludedHosts))
+	task.MissingComponents = appendFilterValues(task.MissingComponents, task.Filter.MissingComponents)
+	task.AmbariServerFilter = task.AmbariServerFilter || task.Filter.Server
+	return task
+}
+
+func excludedFilterValues(values []string) []string {
+	excluded := make([]string, 0)
+	for _, value := range values {
+		excluded = append(excluded, excludePrefix+value)
+	}
+	return excluded
+}
+
+func appendFilterValues(filterValue string, values []string) string {
+	if len(values) == 0 {
+		return filterValue
+	}
+	if len(filterValue) == 0 {
+		return strings.Join(values, ",")
+	}
+	return filterValue + "," + strings.Join(values, ",")
+}
+
+// ExecuteAmbariCommand executes an ambari command against services or components and waits until the created ambari requests finish
+// (every request can take at most 'timeout' seconds), returns the finished requests
+func (a AmbariRegistry) ExecuteAmbariCommand(ctx context.Context, task Task, filteredHosts map[string]bool) ([]Request, error) {
+	requests := make([]Request, 0)
+	if len(task.Command) == 0 {
+		return requests, nil
+	}
+	command := strings.ToUpper(task.Command)
+	if !containsString([]string{"START", "STOP", "RESTART", "SERVICE_CHECK"}, command) {
+		return requests, fmt.Errorf("Only START/STOP/RESTART/SERVICE_CHECK operations are supported (task '%s': %s)", task.Name, task.Command)
+	}
+	timeoutSeconds, err := strconv.Atoi(task.Parameters["timeout"])
+	if err != nil {
+		return requests, fmt.Errorf("'timeout' parameter of 'AmbariCommand' task should be a number: %v", err)
+	}
+	timeout := time.Duration(timeoutSeconds) * time.Second
+	filter, err := ParseFilter(task.ServiceFilter, task.ComponentFilter, "", "", false)
+	if err != nil {
+		return requests, fmt.Errorf("Invalid filter in task '%s': %v", task.Name, err)
+	}
+	filter = a.ResolveExclusions(filter)
+	wait := func(responseBody []byte) error {
+		request, err := a.WaitForOperation(ctx, responseBody, timeout)
+		if request.ID > 0 {
+			requests = append(requests, request)
+		}
+		return err
+	}
+	if len(task.HostComponentFilter) > 0 {
+		return requests, a.executeHostComponentFilterCommand(task, filteredHosts, wait)
+	}
+	if len(task.HostFilter) > 0 || task.AmbariServerFilter || a.hostLimited {
+		return requests, a.executeHostComponentCommand(task, filter, filteredHosts, wait)
+	}
+	if len(filter.Components) > 0 {
+		for _, component := range filter.Components {
+			var responseBody []byte
+			switch command {
+			case "START":
+				responseBody = a.StartComponent(component)
+			case "STOP":
+				responseBody = a.StopComponent(component)
+			case "RESTART":
+				responseBody = a.RestartComponent(component)
+			default:
+				return requests, fmt.Errorf("%s is supported only for services (task '%s')", command, task.Name)
+			}
+			if err := wait(responseBody); err != nil {
+				return requests, err
+			}
+		}
+		return requests, nil
+	}
+	for _, service := range filter.Services {
+		switch command {
+		case "START":
+			err = wait(a.StartService(service))
+		case "STOP":
+			err = wait(a.StopService(service))
+		case "RESTART":
+			err = wait(a.StopService(service))
+			if err == nil {
+				err = wait(a.StartService(service))
+			}
+		case "SERVICE_CHECK":
+			err = wait(a.CheckService(service))
 		}
-		if useServiceFilter {
-			filter := CreateFilter(task.ServiceFilter, "", "", false)
-			a.RunAmbariServiceCommand(task.Command, filter, useServiceFilter, useComponentFilter)
+		if err != nil {
+			return requests, err
 		}
 	}
+	return requests, nil
 }
 
-// ExecuteConfigCommand executes a configuration upgrade
-func (a AmbariRegistry) ExecuteConfigCommand(task Task) {
-	if task.Parameters != nil {
-		haveConfigType := false
-		haveConfigKey := false
-		haveConfigValue := false
-		if configType, ok := task.Parameters["config_type"]; ok {
-			haveConfigType = true
-			if configKey, ok := task.Parameters["config_key"]; ok {
-				haveConfigKey = true
-				if configValue, ok := task.Parameters["config_value"]; ok {
-					haveConfigValue = true
-					a.SetConfig(configType, configKey, configValue)
-				}
+// executeHostComponentCommand runs an ambari command only on the filtered hosts, for the filtered components
+// (or for all components of the filtered services) that are installed on those hosts, the created requests are waited by the wait function
+func (a AmbariRegistry) executeHostComponentCommand(task Task, filter Filter, filteredHosts map[string]bool, wait func(responseBody []byte) error) error {
+	if len(filter.Components) == 0 && len(filter.Services) == 0 {
+		return fmt.Errorf("'components' or 'services' field is required for running '%s' on specific hosts (task '%s')", task.Command, task.Name)
+	}
+	componentHosts := make(map[string]map[string]bool)
+	components := make([]string, 0)
+	for host, hostComponents := range a.matchHostComponents(filter, filteredHosts) {
+		for _, component := range hostComponents {
+			if _, ok := componentHosts[component]; !ok {
+				componentHosts[component] = make(map[string]bool)
+				components = append(components, component)
 			}
+			componentHosts[component][host] = true
+		}
+	}
+	if len(components) == 0 {
+		return fmt.Errorf("None of the selected hosts has the components of task '%s'", task.Name)
+	}
+	sort.Strings(components)
+	for _, component := range components {
+		responseBody, err := a.RunHostComponentCommand(task.Command, component, componentHosts[component])
+		if err == ErrNoHostComponents {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := wait(responseBody); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// executeHostComponentFilterCommand runs an ambari command on the host components that are selected by the host component filter of the task
+// (only on the filtered hosts if the task has a host filter), e.g. restart the components with stale configs. Nothing is done if no host component matches
+func (a AmbariRegistry) executeHostComponentFilterCommand(task Task, filteredHosts map[string]bool, wait func(responseBody []byte) error) error {
+	hostComponentFilter, err := ParseHostComponentFilter(task.HostComponentFilter)
+	if err != nil {
+		return err
+	}
+	var hostNames map[string]bool
+	if len(task.HostFilter) > 0 || task.AmbariServerFilter || a.hostLimited {
+		hostNames = a.getAmbariHostNames(filteredHosts)
+	}
+	hostsByComponents := make(map[string]map[string]bool)
+	components := make([]string, 0)
+	for _, hostComponent := range a.ListHostComponentsWithConfigState() {
+		if !hostComponentFilter.Matches(hostComponent) || (hostNames != nil && !hostNames[hostComponent.HostComponntHost]) {
+			continue
 		}
-		if !haveConfigType {
-			fmt.Println("'config_type' parameter is required for 'Upload' task")
-			os.Exit(1)
+		if _, ok := hostsByComponents[hostComponent.HostComponentName]; !ok {
+			hostsByComponents[hostComponent.HostComponentName] = make(map[string]bool)
+			components = append(components, hostComponent.HostComponentName)
 		}
-		if !haveConfigKey {
-			fmt.Println("'config_key' parameter is required for 'Upload' task")
-			os.Exit(1)
+		hostsByComponents[hostComponent.HostComponentName][hostComponent.HostComponntHost] = true
+	}
+	if len(components) == 0 {
+		outPrintln(fmt.Sprintf("No host components found for filter '%s' (task '%s')", task.HostComponentFilter, task.Name))
+		return nil
+	}
+	sort.Strings(components)
+	for _, component := range components {
+		responseBody, err := a.RunHostComponentCommand(task.Command, component, hostsByComponents[component])
+		if err != nil {
+			return err
 		}
-		if !haveConfigValue {
-			fmt.Println("'config_value' parameter is required for 'Upload' task")
-			os.Exit(1)
+		if err := wait(responseBody); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
-// ExecuteRemoteCommandTask executes a remote command on filtered hosts
-func (a AmbariRegistry) ExecuteRemoteCommandTask(task Task, filteredHosts map[string]bool) {
+// ExecuteServiceCheckTask runs service checks for the filtered services and waits until they pass (or fail)
+func (a AmbariRegistry) ExecuteServiceCheckTask(ctx context.Context, task Task) error {
+	if len(task.ServiceFilter) == 0 {
+		return errors.New("'services' field is required for 'ServiceCheck' task")
+	}
+	timeoutSeconds, err := strconv.Atoi(task.Parameters["timeout"])
+	if err != nil {
+		return fmt.Errorf("'timeout' parameter of 'ServiceCheck' task should be a number: %v", err)
+	}
+	timeout := time.Duration(timeoutSeconds) * time.Second
+	filter := CreateFilter(task.ServiceFilter, "", "", false)
+	for _, service := range filter.Services {
+		if err := a.ServiceCheck(ctx, service, timeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExecuteHostMaintenanceTask turns on or turns off (based on the 'state' parameter) maintenance mode of the filtered hosts
+func (a AmbariRegistry) ExecuteHostMaintenanceTask(task Task, filteredHosts map[string]bool) error {
+	state := strings.ToLower(task.Parameters["state"])
+	// unquoted on/off values are booleans in yaml
+	if state == "true" {
+		state = "on"
+	} else if state == "false" {
+		state = "off"
+	}
+	if state != "on" && state != "off" {
+		return fmt.Errorf("'state' parameter of '%s' task should be 'on' or 'off', not '%s'", HostMaintenance, task.Parameters["state"])
+	}
+	hostNames := make([]string, 0)
+	for hostName := range a.getAmbariHostNames(filteredHosts) {
+		hostNames = append(hostNames, hostName)
+	}
+	if len(hostNames) == 0 {
+		outPrintln(fmt.Sprintf("No hosts selected for turning %s maintenance mode (task '%s')", state, task.Name))
+		return nil
+	}
+	sort.Strings(hostNames)
+	for _, hostName := range hostNames {
+		a.SetHostMaintenanceMode(hostName, state == "on")
+		outPrintln(fmt.Sprintf("Maintenance mode of host %s: %s", hostName, strings.ToUpper(state)))
+	}
+	return nil
+}
+
+// ExecuteWaitForState polls the states of the filtered components (or services) until all of them are in 'desired_state',
+// fails if that does not happen in 'timeout' seconds
+func (a AmbariRegistry) ExecuteWaitForState(ctx context.Context, task Task) error {
+	if len(task.ServiceFilter) == 0 && len(task.ComponentFilter) == 0 {
+		return fmt.Errorf("'services' or 'components' field is required for '%s' task", WaitForState)
+	}
+	desiredState := strings.ToUpper(task.Parameters["desired_state"])
+	timeoutSeconds, err := strconv.Atoi(task.Parameters["timeout"])
+	if err != nil {
+		return fmt.Errorf("'timeout' parameter of '%s' task should be a number: %v", WaitForState, err)
+	}
+	pollSeconds, err := strconv.Atoi(task.Parameters["poll_interval"])
+	if err != nil || pollSeconds <= 0 {
+		return fmt.Errorf("'poll_interval' parameter of '%s' task should be a positive number: %s", WaitForState, task.Parameters["poll_interval"])
+	}
+	deadline := time.Now().Add(time.Duration(timeoutSeconds) * time.Second)
+	lastStates := ""
+	for {
+		states := a.getStates(task)
+		names := make([]string, 0)
+		for name := range states {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		pending := make([]string, 0)
+		for _, name := range names {
+			if states[name] != desiredState {
+				pending = append(pending, fmt.Sprintf("%s: %s", name, states[name]))
+			}
+		}
+		if len(pending) == 0 {
+			outPrintln(fmt.Sprintf("All of the selected services/components are %s", desiredState))
+			return nil
+		}
+		if current := strings.Join(pending, ", "); current != lastStates {
+			outPrintln(fmt.Sprintf("Waiting for %s state (%s)", desiredState, current))
+			lastStates = current
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out waiting for %s state after %d seconds (%s)", desiredState, timeoutSeconds, lastStates)
+		}
+		if err := sleepWithContext(ctx, time.Duration(pollSeconds)*time.Second); err != nil {
+			return err
+		}
+	}
+}
+
+// getStates get the states of the filtered components (or services if there is no component filter) by names,
+// the ones that are not installed have empty state
+func (a AmbariRegistry) getStates(task Task) map[string]string {
+	states := make(map[string]string)
+	if len(task.ComponentFilter) > 0 {
+		for _, component := range CreateFilter("", task.ComponentFilter, "", false).Components {
+			states[component] = ""
+		}
+		for _, component := range a.ListComponents() {
+			if _, ok := states[component.ComponentName]; ok {
+				states[component.ComponentName] = component.ComponentState
+			}
+		}
+		return states
+	}
+	for _, service := range CreateFilter(task.ServiceFilter, "", "", false).Services {
+		states[service] = ""
+	}
+	for _, service := range a.ListServices() {
+		if _, ok := states[service.ServiceName]; ok {
+			states[service.ServiceName] = service.ServiceState
+		}
+	}
+	return states
+}
+
+// ExecuteConfigCommand executes a configuration upgrade
+func (a AmbariRegistry) ExecuteConfigCommand(task Task) error {
+	operation := task.Parameters["operation"]
+	if operation != ConfigSet && operation != ConfigDelete && operation != ConfigRollback {
+		return fmt.Errorf("Unknown operation '%s' for 'Config' task (use '%s', '%s', '%s' or '%s')", operation, ConfigSet, ConfigGet, ConfigDelete, ConfigRollback)
+	}
+	if operation == ConfigRollback {
+		version, err := strconv.Atoi(task.Parameters["version"])
+		if err != nil {
+			return fmt.Errorf("'version' parameter is required for '%s' operation of 'Config' task (as a number)", ConfigRollback)
+		}
+		return a.RollbackConfig(task.Parameters["config_type"], version)
+	}
+	note := task.Parameters["note"]
+	tag := task.Parameters["tag"]
+	if operation == ConfigSet && len(task.Configs) > 0 {
+		outPrintln(fmt.Sprintf("Update %d config keys of '%s'", len(task.Configs), task.Parameters["config_type"]))
+		return a.SetConfigs(task.Parameters["config_type"], task.Configs, note, tag)
+	}
+	if _, ok := task.Parameters["config_key"]; !ok {
+		return fmt.Errorf("'config_key' parameter (or 'configs' field) is required for 'Config' task")
+	}
+	if operation == ConfigDelete {
+		if len(tag) > 0 {
+			return fmt.Errorf("'tag' parameter is not supported for '%s' operation of 'Config' task", ConfigDelete)
+		}
+		return a.DeleteConfig(task.Parameters["config_type"], task.Parameters["config_key"], note)
+	}
+	if _, ok := task.Parameters["config_value"]; !ok {
+		return fmt.Errorf("'config_value' parameter is required for '%s' operation of 'Config' task", ConfigSet)
+	}
+	if len(tag) > 0 {
+		configs := map[string]string{task.Parameters["config_key"]: task.Parameters["config_value"]}
+		return a.SetConfigs(task.Parameters["config_type"], configs, note, tag)
+	}
+	a.SetConfig(task.Parameters["config_type"], task.Parameters["config_key"], task.Parameters["config_value"], note)
+	return nil
+}
+
+// ExecuteGetConfigTask reads the value of a config key (the value is not printed for no_log tasks)
+func (a AmbariRegistry) ExecuteGetConfigTask(task Task) (string, error) {
+	configType := task.Parameters["config_type"]
+	configKey, ok := task.Parameters["config_key"]
+	if !ok {
+		return "", fmt.Errorf("'config_key' parameter is required for '%s' operation of 'Config' task", ConfigGet)
+	}
+	value, err := a.GetConfig(configType, configKey)
+	if err != nil {
+		return "", err
+	}
+	if !task.NoLog {
+		outPrintln(fmt.Sprintf("Config %s/%s: %s", configType, configKey, value))
+	}
+	return value, nil
+}
+
+// ExecuteRemoteCommandTask executes a remote command on filtered hosts,
+// unreachable hosts fail the task unless ignore_unreachable is set (then they are skipped)
+func (a AmbariRegistry) ExecuteRemoteCommandTask(ctx context.Context, task Task, filteredHosts map[string]bool) error {
+	_, err := a.runRemoteCommandTask(ctx, task, filteredHosts)
+	return err
+}
+
+func (a AmbariRegistry) runRemoteCommandTask(ctx context.Context, task Task, filteredHosts map[string]bool) (map[string]RemoteResponse, error) {
+	responses := make(map[string]RemoteResponse)
 	if len(task.Command) > 0 {
-		fmt.Println("Execute remote command: " + task.Command)
-		a.RunRemoteHostCommand(task.Command, filteredHosts, task.AmbariServerFilter)
-	}
-}
-
-// ExecuteUploadFileTask upload a file to specific (filtered) hosts
-func (a AmbariRegistry) ExecuteUploadFileTask(task Task, filteredHosts map[string]bool) {
-	if task.Parameters != nil {
-		haveSourceFile := false
-		haveTargetFile := false
-		if sourceVal, ok := task.Parameters["source"]; ok {
-			haveSourceFile = true
-			if targetVal, ok := task.Parameters["target"]; ok {
-				haveTargetFile = true
-				fmt.Println(fmt.Sprintf("Execute upload file command - source: %s, target: %s",
-					task.Parameters["source"], task.Parameters["target"]))
-				a.CopyToRemote(sourceVal, targetVal, filteredHosts, task.AmbariServerFilter)
+		ctxOutPrintln(ctx, "Execute remote command: "+task.Command)
+		responses = a.RunRemoteHostCommandWithRetries(ctx, task.Command, filteredHosts, task.AmbariServerFilter, task.Retries, task.RetryDelay, task.Timeout)
+		failedHosts := GetFailedHosts(responses)
+		if len(failedHosts) > 0 {
+			if timedOutHosts := GetTimedOutHosts(responses); len(timedOutHosts) > 0 {
+				return responses, fmt.Errorf("Remote command failed on hosts: %s (timed out after %d seconds on hosts: %s)",
+					strings.Join(failedHosts, ", "), task.Timeout, strings.Join(timedOutHosts, ", "))
 			}
+			return responses, fmt.Errorf("Remote command failed on hosts: %s", strings.Join(failedHosts, ", "))
 		}
-		if !haveSourceFile {
-			fmt.Println("'source' parameter is required for 'Upload' task")
-			os.Exit(1)
+		unreachableHosts := GetUnreachableHosts(responses)
+		if len(unreachableHosts) > 0 {
+			if !task.IgnoreUnreachable {
+				return responses, fmt.Errorf("Remote command failed on unreachable hosts: %s", strings.Join(unreachableHosts, ", "))
+			}
+			outPrintln(fmt.Sprintf("[skipped] unreachable hosts: %s", strings.Join(unreachableHosts, ", ")))
 		}
-		if !haveTargetFile {
-			fmt.Println("'target' parameter is required for 'Upload' task")
-			os.Exit(1)
+	}
+	return responses, nil
+}
+
+// ExecuteUploadFileTask upload a file ('source' parameter) or inline content ('content' parameter) to specific (filtered) hosts
+func (a AmbariRegistry) ExecuteUploadFileTask(ctx context.Context, task Task, filteredHosts map[string]bool) error {
+	target := task.Parameters["target"]
+	var copyErrors map[string]error
+	var size int64
+	var sizeErr error
+	if content, ok := task.Parameters["content"]; ok {
+		ctxOutPrintln(ctx, fmt.Sprintf("Execute upload file command - inline content (%d bytes), target: %s", len(content), target))
+		copyErrors = a.CopyContentToRemote(ctx, content, target, filteredHosts, task.AmbariServerFilter)
+		size = int64(len(content))
+	} else {
+		source := task.Parameters["source"]
+		ctxOutPrintln(ctx, fmt.Sprintf("Execute upload file command - source: %s, target: %s", source, target))
+		copyErrors = a.CopyToRemote(ctx, source, target, filteredHosts, task.AmbariServerFilter)
+		var sourceInfo os.FileInfo
+		if sourceInfo, sizeErr = os.Stat(source); sizeErr == nil {
+			size = sourceInfo.Size()
 		}
+	}
+	if EvaluateBoolValueFromString(task.Parameters["verify_size"]) && ctx.Err() == nil {
+		copyErrors = a.verifyUploadedFileSize(ctx, size, sizeErr, target, copyErrors, task.AmbariServerFilter)
+	}
+	return checkCopyErrors(copyErrors, task.IgnoreUnreachable)
+}
 
+// renderUploadSource render the source file of an Upload task as a template (with the playbook variables and the registered outputs)
+// to a file in the temporary directory of the run, returns the task with the rendered file as source
+func renderUploadSource(task Task, vars map[string]string, registered map[string]interface{}) (Task, error) {
+	source := task.Parameters["source"]
+	content, err := ioutil.ReadFile(source)
+	if err != nil {
+		return task, err
+	}
+	textTemplate, err := template.New(filepath.Base(source)).Funcs(playbookTemplateFuncs).Parse(string(content))
+	if err != nil {
+		return task, fmt.Errorf("Cannot render '%s' (task '%s'): %v", source, task.Name, err)
 	}
+	out, err := CreateTempFile("upload-")
+	if err != nil {
+		return task, err
+	}
+	defer out.Close()
+	if err := textTemplate.Execute(out, templateContext(vars, registered)); err != nil {
+		return task, fmt.Errorf("Cannot render '%s' (task '%s'): %v", source, task.Name, err)
+	}
+	if err := out.Close(); err != nil {
+		return task, err
+	}
+	parameters := make(map[string]string)
+	for name, value := range task.Parameters {
+		parameters[name] = value
+	}
+	parameters["source"] = out.Name()
+	task.Parameters = parameters
+	return task, nil
+}
+
+func (a AmbariRegistry) verifyUploadedFileSize(ctx context.Context, size int64, sizeErr error, target string, copyErrors map[string]error, skipJump bool) map[string]error {
+	if sizeErr != nil {
+		for host := range copyErrors {
+			copyErrors[host] = sizeErr
+		}
+		return copyErrors
+	}
+	uploadedHosts := make(map[string]bool)
+	for host, copyErr := range copyErrors {
+		if copyErr == nil {
+			uploadedHosts[host] = true
+		}
+	}
+	if len(uploadedHosts) == 0 {
+		return copyErrors
+	}
+	for host, sizeErr := range a.VerifyRemoteFileSize(ctx, target, size, uploadedHosts, skipJump) {
+		copyErrors[host] = sizeErr
+	}
+	return copyErrors
+}
+
+func checkCopyErrors(copyErrors map[string]error, ignoreUnreachable bool) error {
+	failedHosts := make([]string, 0)
+	unreachableHosts := make([]string, 0)
+	for host, err := range copyErrors {
+		if err != nil && ignoreUnreachable && IsConnectionError(err) {
+			unreachableHosts = append(unreachableHosts, host)
+		} else if err != nil {
+			failedHosts = append(failedHosts, host)
+		}
+	}
+	if len(failedHosts) > 0 {
+		sort.Strings(failedHosts)
+		return fmt.Errorf("Upload failed on %d of %d hosts: %s", len(failedHosts), len(copyErrors), strings.Join(failedHosts, ", "))
+	}
+	if len(unreachableHosts) > 0 {
+		sort.Strings(unreachableHosts)
+		outPrintln(fmt.Sprintf("[skipped] unreachable hosts: %s", strings.Join(unreachableHosts, ", ")))
+	}
+	return nil
+}
+
+// ExecuteAssertTask evaluates the assertions of a task (with the playbook variables), fails with the first false one
+func ExecuteAssertTask(task Task, vars map[string]string) error {
+	if len(task.Assertions) == 0 {
+		return errors.New("'that' field is required for 'Assert' task")
+	}
+	for _, assertion := range task.Assertions {
+		result, err := EvaluateCondition(assertion, vars)
+		if err != nil {
+			return err
+		}
+		if !result {
+			if message := task.Parameters["message"]; len(message) > 0 {
+				return fmt.Errorf("Assertion failed: %s (%s)", message, assertion)
+			}
+			return fmt.Errorf("Assertion failed: %s", assertion)
+		}
+		outPrintln(fmt.Sprintf("Assertion passed: %s", assertion))
+	}
+	return nil
 }
 
 // ExecuteLocalCommandTask executes a local shell command
-func ExecuteLocalCommandTask(task Task) {
+func ExecuteLocalCommandTask(ctx context.Context, task Task) error {
+	_, err := runLocalCommandTask(ctx, task)
+	return err
+}
+
+// runLocalCommandTask executes a local command, the output is returned as the response of 'localhost'.
+// The command is split by spaces and run directly, with shell option it is run by 'sh -c' (so pipes and redirects can be used),
+// it is run in the workdir of the task (if it is set) with the env variables of the task
+func runLocalCommandTask(ctx context.Context, task Task) (map[string]RemoteResponse, error) {
+	responses := make(map[string]RemoteResponse)
 	if len(task.Command) > 0 {
-		fmt.Println("Execute local command: " + task.Command)
+		ctxOutPrintln(ctx, "Execute local command: "+task.Command)
 		splitted := strings.Split(task.Command, " ")
-		if len(splitted) == 1 {
-			RunLocalCommand(splitted[0])
+		var stdout, stderr string
+		var exitCode int
+		var err error
+		options := LocalCommandOptions{Timeout: task.Timeout, Dir: task.Workdir, Env: task.Env}
+		if task.Shell {
+			stdout, stderr, exitCode, err = RunLocalCommandWithExitCode(ctx, options, "sh", "-c", task.Command)
+		} else if len(splitted) == 1 {
+			stdout, stderr, exitCode, err = RunLocalCommandWithExitCode(ctx, options, splitted[0])
 		} else {
-			RunLocalCommand(splitted[0], splitted[1:]...)
+			stdout, stderr, exitCode, err = RunLocalCommandWithExitCode(ctx, options, splitted[0], splitted[1:]...)
+		}
+		done := err == nil
+		if done && exitCode != 0 {
+			err = &ExitCodeError{Code: exitCode}
+		}
+		responses["localhost"] = withExitStatus(RemoteResponse{StdOut: stdout, StdErr: stderr, Done: done, Err: err, TimedOut: err == ErrCommandTimeout})
+		if err == ErrCommandTimeout {
+			return responses, fmt.Errorf("Local command timed out after %d seconds", task.Timeout)
 		}
+		return responses, err
 	}
+	return responses, nil
 }
 
-// ExecuteDownloadFileTask download a file from an url to the local filesystem
-func ExecuteDownloadFileTask(task Task) {
-	if task.Parameters != nil {
-		haveUrl := false
-		haveFile := false
-		if urlVal, ok := task.Parameters["url"]; ok {
-			haveUrl = true
-			if fileVal, ok := task.Parameters["file"]; ok {
-				haveFile = true
-				fmt.Println(fmt.Sprintf("Execute download file command - url: %s, location: %s",
-					task.Parameters["url"], task.Parameters["file"]))
-				DownloadFile(fileVal, urlVal)
-			}
-		}
-		if !haveFile {
-			fmt.Println("'file' parameter is required for 'Download' task")
-			os.Exit(1)
+// ExecuteDownloadFileTask download a file from an url to the local filesystem, the file is verified if 'sha256' or 'md5' parameter is set,
+// the download fails if it takes more than 'timeout' seconds (if it is set).
+// Private urls can be downloaded with basic authentication ('username' and 'password' parameters) or with extra headers ('header.<name>' parameters)
+func ExecuteDownloadFileTask(ctx context.Context, task Task) error {
+	ctxOutPrintln(ctx, fmt.Sprintf("Execute download file command - url: %s, location: %s", task.Parameters["url"], task.Parameters["file"]))
+	options := DownloadOptions{SHA256: task.Parameters["sha256"], MD5: task.Parameters["md5"],
+		Username: task.Parameters["username"], Password: task.Parameters["password"], Headers: make(map[string]string)}
+	for name, value := range task.Parameters {
+		if strings.HasPrefix(name, downloadHeaderPrefix) {
+			options.Headers[strings.TrimPrefix(name, downloadHeaderPrefix)] = value
 		}
-		if !haveUrl {
-			fmt.Println("'url' parameter is required for 'Download' task")
-			os.Exit(1)
+	}
+	if timeoutStr := task.Parameters["timeout"]; len(timeoutStr) > 0 {
+		timeout, err := strconv.Atoi(timeoutStr)
+		if err != nil || timeout < 0 {
+			return fmt.Errorf("Invalid 'timeout' parameter of task '%s': %s", task.Name, timeoutStr)
 		}
+		options.Timeout = time.Duration(timeout) * time.Second
 	}
+	return DownloadFile(ctx, task.Parameters["file"], task.Parameters["url"], options)
 }
 
-func createVarMap(varMapStr string) map[string]interface{} {
+// createVarMap parse space separated name=value pairs (values may contain '=' characters, empty values are allowed),
+// values with spaces can be quoted, e.g.: message="hello world" path='/tmp/my dir' quote="say \"hi\""
+func createVarMap(varMapStr string) (map[string]interface{}, error) {
 	resultMap := make(map[string]interface{})
-	if len(varMapStr) > 0 {
-		var ss []string
-		ss = strings.Split(varMapStr, " ")
-		for _, pair := range ss {
-			z := strings.Split(pair, "=")
-			resultMap[z[0]] = z[1]
+	pairs, err := splitVarPairs(varMapStr)
+	if err != nil {
+		return nil, err
+	}
+	for _, pair := range pairs {
+		nameAndValue := strings.SplitN(pair, "=", 2)
+		if len(nameAndValue) != 2 || len(nameAndValue[0]) == 0 {
+			return nil, fmt.Errorf("Invalid variable '%s' (expected format: name=value)", pair)
+		}
+		resultMap[nameAndValue[0]] = nameAndValue[1]
+	}
+	return resultMap, nil
+}
+
+// splitVarPairs split the input by whitespaces that are not quoted (the quotes are removed, backslash escapes the next character)
+func splitVarPairs(input string) ([]string, error) {
+	pairs := make([]string, 0)
+	var current bytes.Buffer
+	inPair := false
+	var quote rune
+	escaped := false
+	for _, r := range input {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+			inPair = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inPair = true
+		case unicode.IsSpace(r):
+			if inPair {
+				pairs = append(pairs, current.String())
+				current.Reset()
+				inPair = false
+			}
+		default:
+			current.WriteRune(r)
+			inPair = true
 		}
 	}
-	return resultMap
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("Unterminated quote or escape in variables: %s", input)
+	}
+	if inPair {
+		pairs = append(pairs, current.String())
+	}
+	return pairs, nil
 }
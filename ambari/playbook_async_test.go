@@ -0,0 +1,130 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+const asyncPlaybook = `
+name: async
+tasks:
+  - name: "first"
+    type: LocalCommand
+    async: true
+    shell: true
+    register: first
+    command: "sleep 0.5 && touch {{.dir}}/first && echo one"
+  - name: "second"
+    type: LocalCommand
+    async: true
+    shell: true
+    no_log: true
+    parallelism: 2
+    command: "sleep 0.5 && touch {{.dir}}/second && echo secret-output"
+  - name: "third"
+    type: LocalCommand
+    async: true
+    shell: true
+    command: "sleep 0.5 && touch {{.dir}}/third"
+  - name: "barrier"
+    type: LocalCommand
+    shell: true
+    command: "ls {{.dir}}/first {{.dir}}/second {{.dir}}/third"
+  - name: "registered by async task"
+    type: LocalCommand
+    when: first.stdout == "one"
+    command: "echo {{.first.stdout}}"
+    register: copy
+`
+
+func TestExecutePlaybookAsyncTasksOverlapAndBarrierWaits(t *testing.T) {
+	output := captureOutput(t)
+	ambariRegistry := newTestAmbari(t, emptyItemsHandler)
+	playbook := loadTestPlaybook(t, asyncPlaybook, "dir="+t.TempDir())
+
+	start := time.Now()
+	result, err := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{})
+	if err != nil {
+		t.Fatalf("playbook failed: %v", err)
+	}
+	if len(result.Tasks) != 5 {
+		t.Fatalf("expected 5 task results, got %d", len(result.Tasks))
+	}
+	asyncTasks, barrier, registeredTask := result.Tasks[:3], result.Tasks[3], result.Tasks[4]
+	for index, taskResult := range result.Tasks {
+		if taskResult.Status != TaskSuccess {
+			t.Errorf("task %d (%s) status: %s, error: %s", index, taskResult.Name, taskResult.Status, taskResult.Error)
+		}
+	}
+	for _, taskResult := range asyncTasks {
+		for _, other := range asyncTasks {
+			if taskResult.Name != other.Name && !taskResult.StartTime.Before(other.EndTime) {
+				t.Errorf("async task '%s' started after '%s' finished", taskResult.Name, other.Name)
+			}
+		}
+		if barrier.StartTime.Before(taskResult.EndTime) {
+			t.Errorf("barrier started before async task '%s' finished", taskResult.Name)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 1400*time.Millisecond {
+		t.Errorf("async tasks did not run concurrently (playbook took %v)", elapsed)
+	}
+	if registeredTask.Name != "registered by async task" || registeredTask.Status != TaskSuccess {
+		t.Errorf("the task using the registered output of an async task did not run: %+v", registeredTask)
+	}
+	if len(registeredTask.Hosts) != 1 || registeredTask.Hosts[0].ExitCode != 0 {
+		t.Errorf("unexpected hosts of the last task: %+v", registeredTask.Hosts)
+	}
+	if strings.Contains(output.String(), "secret-output") {
+		t.Errorf("output of the no_log async task is printed:\n%s", output.String())
+	}
+	if !strings.Contains(output.String(), "one") {
+		t.Errorf("output of the async task without no_log is hidden:\n%s", output.String())
+	}
+}
+
+func TestExecutePlaybookAsyncTaskFailureStopsAtBarrier(t *testing.T) {
+	captureOutput(t)
+	ambariRegistry := newTestAmbari(t, emptyItemsHandler)
+	playbook := loadTestPlaybook(t, `
+name: async failure
+tasks:
+  - name: "failing"
+    type: LocalCommand
+    async: true
+    command: "false"
+  - name: "running"
+    type: LocalCommand
+    async: true
+    command: "true"
+  - name: "after barrier"
+    type: LocalCommand
+    command: "true"
+`, "")
+	result, err := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{})
+	if err == nil {
+		t.Fatal("expected the failed async task to fail the playbook")
+	}
+	if len(result.Tasks) != 2 {
+		t.Fatalf("expected only the async tasks to run, got %d task results", len(result.Tasks))
+	}
+	if result.Tasks[0].Status != TaskFailed || result.Tasks[1].Status != TaskSuccess {
+		t.Errorf("unexpected async task statuses: %s, %s", result.Tasks[0].Status, result.Tasks[1].Status)
+	}
+}
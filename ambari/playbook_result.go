@@ -0,0 +1,112 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// TaskSuccess status of a task that finished without errors
+	TaskSuccess = "SUCCESS"
+	// TaskFailed status of a task that finished with errors
+	TaskFailed = "FAILED"
+	// TaskSkipped status of a task that did not run because of its 'when' condition
+	TaskSkipped = "SKIPPED"
+)
+
+// PlaybookResult represents the report of a playbook execution
+type PlaybookResult struct {
+	Name      string       `json:"name"`
+	Cluster   string       `json:"cluster"`
+	StartTime time.Time    `json:"start_time"`
+	EndTime   time.Time    `json:"end_time"`
+	Success   bool         `json:"success"`
+	Tasks     []TaskResult `json:"tasks"`
+	Verify    []TaskResult `json:"verify,omitempty"`
+}
+
+// TaskResult represents the result of an executed (or skipped) task, with the results by hosts for command tasks
+type TaskResult struct {
+	Name      string          `json:"name"`
+	Type      string          `json:"type"`
+	Status    string          `json:"status"`
+	StartTime time.Time       `json:"start_time"`
+	EndTime   time.Time       `json:"end_time"`
+	Error     string          `json:"error,omitempty"`
+	Hosts     []HostResult    `json:"hosts,omitempty"`
+	Requests  []RequestResult `json:"requests,omitempty"`
+}
+
+// RequestResult represents the final status of an ambari request that was created by a task
+type RequestResult struct {
+	ID      int    `json:"id"`
+	Context string `json:"context"`
+	Status  string `json:"status"`
+}
+
+// HostResult represents the result of a command on a host
+type HostResult struct {
+	Host        string `json:"host"`
+	ExitCode    int    `json:"exit_code"`
+	Done        bool   `json:"done"`
+	Unreachable bool   `json:"unreachable,omitempty"`
+	TimedOut    bool   `json:"timed_out,omitempty"`
+	Attempts    int    `json:"attempts,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// FailedTasks get the failed tasks (and verify tasks) of a playbook execution
+func (r PlaybookResult) FailedTasks() []TaskResult {
+	failedTasks := make([]TaskResult, 0)
+	for _, taskResult := range append(r.Tasks, r.Verify...) {
+		if taskResult.Status == TaskFailed {
+			failedTasks = append(failedTasks, taskResult)
+		}
+	}
+	return failedTasks
+}
+
+func createTaskResult(task Task, startTime time.Time, responses map[string]RemoteResponse, err error) TaskResult {
+	taskResult := TaskResult{Name: task.Name, Type: task.Type, Status: TaskSuccess, StartTime: startTime, EndTime: time.Now()}
+	if err != nil {
+		taskResult.Status = TaskFailed
+		taskResult.Error = RedactSecrets(err.Error())
+	}
+	hosts := make([]string, 0)
+	for host := range responses {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		response := responses[host]
+		hostResult := HostResult{Host: host, ExitCode: GetExitCode(response), Done: response.Done, Unreachable: response.Unreachable,
+			TimedOut: response.TimedOut, Attempts: response.Attempts}
+		if response.Err != nil {
+			hostResult.Error = RedactSecrets(response.Err.Error())
+		}
+		taskResult.Hosts = append(taskResult.Hosts, hostResult)
+	}
+	return taskResult
+}
+
+func createRequestResults(requests []Request) []RequestResult {
+	var requestResults []RequestResult
+	for _, request := range requests {
+		requestResults = append(requestResults, RequestResult{ID: int(request.ID), Context: request.Context, Status: request.Status})
+	}
+	return requestResults
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCreateTaskResult(t *testing.T) {
+	responses := map[string]RemoteResponse{
+		"host2": {Unreachable: true, Err: errors.New("dial tcp: connection refused"), ExitStatus: -1, Attempts: 2},
+		"host1": {StdOut: "ok", Done: true, Attempts: 1},
+	}
+
+	taskResult := createTaskResult(Task{Name: "check", Type: RemoteCommand}, time.Now(), responses, errors.New("Remote command failed on host2"))
+
+	if taskResult.Status != TaskFailed || taskResult.Error != "Remote command failed on host2" {
+		t.Errorf("unexpected task result: %+v", taskResult)
+	}
+	expected := []HostResult{
+		{Host: "host1", ExitCode: 0, Done: true, Attempts: 1},
+		{Host: "host2", ExitCode: -1, Unreachable: true, Attempts: 2, Error: "dial tcp: connection refused"},
+	}
+	if len(taskResult.Hosts) != len(expected) {
+		t.Fatalf("unexpected host results: %+v", taskResult.Hosts)
+	}
+	for index := range expected {
+		if taskResult.Hosts[index] != expected[index] {
+			t.Errorf("expected %+v, got %+v", expected[index], taskResult.Hosts[index])
+		}
+	}
+}
+
+func TestExecutePlaybookReport(t *testing.T) {
+	ambariRegistry := newTestAmbari(t, emptyItemsHandler)
+	playbook := loadTestPlaybook(t, `
+name: report
+tasks:
+  - name: "failed"
+    type: LocalCommand
+    command: "false"
+    continue_on_error: true
+  - name: "succeeded"
+    type: LocalCommand
+    command: "true"
+verify:
+  - name: "verified"
+    type: LocalCommand
+    command: "true"
+`, "")
+
+	result, err := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Name != "report" || !result.Success || result.EndTime.Before(result.StartTime) || len(result.Tasks) != 2 || len(result.Verify) != 1 {
+		t.Errorf("unexpected report: %+v", result)
+	}
+	if failedTasks := result.FailedTasks(); len(failedTasks) != 1 || failedTasks[0].Name != "failed" || failedTasks[0].Hosts[0].ExitCode != 1 {
+		t.Errorf("unexpected failed tasks: %+v", failedTasks)
+	}
+	content, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed PlaybookResult
+	if err := json.Unmarshal(content, &parsed); err != nil || len(parsed.Tasks) != 2 || parsed.Tasks[0].Hosts[0].Host != "localhost" {
+		t.Errorf("the report cannot be read back from json: %s, err: %v", content, err)
+	}
+}
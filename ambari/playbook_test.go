@@ -0,0 +1,835 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"bufio"
+	"context"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTaskContinueOnErrorKeys(t *testing.T) {
+	cases := map[string]bool{
+		"name: t\ncontinue_on_error: true": true,
+		"name: t\nignore_errors: true":     true,
+		"name: t\nignore_errors: false":    false,
+		"name: t":                          false,
+	}
+	for content, expected := range cases {
+		var task Task
+		if err := yaml.Unmarshal([]byte(content), &task); err != nil {
+			t.Errorf("cannot parse %q: %v", content, err)
+			continue
+		}
+		if task.ContinueOnError != expected {
+			t.Errorf("%q: expected continue on error: %v", content, expected)
+		}
+	}
+	var task Task
+	if err := yaml.Unmarshal([]byte("name: t\ncontinue_on_error: true\nignore_errors: false"), &task); err == nil {
+		t.Error("expected an error if both keys are set")
+	}
+}
+
+func TestExecutePlaybookContinuesAfterIgnoredErrors(t *testing.T) {
+	ambariRegistry := newTestAmbari(t, emptyItemsHandler)
+	playbook := loadTestPlaybook(t, `
+name: errors
+tasks:
+  - name: "ignored"
+    type: LocalCommand
+    command: "false"
+    ignore_errors: true
+  - name: "continued"
+    type: LocalCommand
+    command: "false"
+    continue_on_error: true
+  - name: "last"
+    type: LocalCommand
+    command: "true"
+`, "")
+
+	result, err := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{})
+
+	if err != nil {
+		t.Fatalf("the ignored errors failed the playbook: %v", err)
+	}
+	if len(result.Tasks) != 3 || result.Tasks[2].Status != TaskSuccess {
+		t.Errorf("expected the last task to run: %+v", result.Tasks)
+	}
+	for _, taskResult := range result.Tasks[:2] {
+		if taskResult.Status == TaskSuccess {
+			t.Errorf("expected '%s' to fail", taskResult.Name)
+		}
+	}
+}
+
+func TestExecutePlaybookCancelledDuringWaitForState(t *testing.T) {
+	ambariRegistry := newFakeCluster(t, map[string][]string{"host1": {"HDFS_NAMENODE"}}, nil)
+	dir := t.TempDir()
+	playbook := loadTestPlaybook(t, `
+name: cancel
+tasks:
+  - name: "wait"
+    type: WaitForState
+    services: HDFS
+    parameters:
+      desired_state: STARTED
+      timeout: "600"
+      poll_interval: "60"
+  - name: "next"
+    type: LocalCommand
+    shell: true
+    command: "touch {{.dir}}/next"
+`, "dir="+dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	start := time.Now()
+	result, err := ambariRegistry.ExecutePlaybook(ctx, playbook, PlaybookOptions{})
+
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("the cancelled wait returned after %v", elapsed)
+	}
+	if err == nil {
+		t.Error("expected the cancelled playbook to fail")
+	}
+	if len(result.Tasks) != 1 || result.Tasks[0].Status == TaskSuccess {
+		t.Errorf("expected only the cancelled wait task in the results: %+v", result.Tasks)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "next")); !os.IsNotExist(err) {
+		t.Error("the task after the cancelled wait has been started")
+	}
+}
+
+func TestExecutePlaybookSkipsTasksByWhen(t *testing.T) {
+	ambariRegistry := newTestAmbari(t, emptyItemsHandler)
+	dir := t.TempDir()
+	playbook := loadTestPlaybook(t, `
+name: when
+tasks:
+  - name: "skipped"
+    type: LocalCommand
+    shell: true
+    when: "{{.env}} == prod"
+    command: "touch {{.dir}}/skipped"
+  - name: "executed"
+    type: LocalCommand
+    shell: true
+    when: "{{.env}} == dev"
+    command: "touch {{.dir}}/executed"
+`, "env=dev dir="+dir)
+
+	result, err := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Tasks) != 2 || result.Tasks[0].Status != TaskSkipped || result.Tasks[1].Status != TaskSuccess {
+		t.Errorf("unexpected task results: %+v", result.Tasks)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "skipped")); !os.IsNotExist(err) {
+		t.Error("the skipped task has been executed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "executed")); err != nil {
+		t.Errorf("the selected task has not been executed: %v", err)
+	}
+}
+
+func TestExecutePlaybookDryRun(t *testing.T) {
+	resetDb(t)
+	output := captureOutput(t)
+	ambariRegistry := newTestAmbari(t, emptyItemsHandler)
+	dir := t.TempDir()
+	playbook := loadTestPlaybook(t, `
+name: dry-run
+tasks:
+  - name: "touch"
+    type: LocalCommand
+    shell: true
+    command: "touch {{.dir}}/touched"
+    register: touched
+  - name: "download"
+    type: Download
+    parameters:
+      url: "https://example.com/file"
+      file: "{{.dir}}/file"
+      password: "secret"
+`, "dir="+dir)
+	result, err := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{DryRun: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Tasks) != 2 {
+		t.Errorf("expected 2 task results: %+v", result.Tasks)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("the dry run executed tasks: %v", files)
+	}
+	for _, line := range []string{"[dry-run] task: touch (type: LocalCommand)", "command: touch " + dir + "/touched", "[dry-run] task: download (type: Download)"} {
+		if !strings.Contains(output.String(), line) {
+			t.Errorf("missing '%s' in output: %s", line, output.String())
+		}
+	}
+	if strings.Contains(output.String(), "secret") {
+		t.Errorf("the password is printed: %s", output.String())
+	}
+	if runs := ListPlaybookRuns(0); len(runs) != 0 {
+		t.Errorf("the dry run is saved to the history: %+v", runs)
+	}
+}
+
+func TestExpandLoops(t *testing.T) {
+	tasks := expandLoops([]Task{{Name: "plain"}, {Name: "install", Loop: []string{"a, b", "c"}}})
+
+	names := make([]string, 0)
+	for _, task := range tasks {
+		names = append(names, task.Name+"="+task.loopItem)
+	}
+	if strings.Join(names, ";") != "plain=;install (a)=a;install (b)=b;install (c)=c" {
+		t.Errorf("unexpected tasks: %v", names)
+	}
+}
+
+func TestExecutePlaybookLoop(t *testing.T) {
+	ambariRegistry := newTestAmbari(t, emptyItemsHandler)
+	dir := t.TempDir()
+	playbook := loadTestPlaybook(t, `
+name: loop
+tasks:
+  - name: "touch"
+    type: LocalCommand
+    shell: true
+    command: "touch {{.dir}}/{{.item}}"
+    loop:
+      - "{{.files}}"
+      - third
+`, "dir="+dir+" files=first,second")
+
+	result, err := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Tasks) != 3 || result.Tasks[1].Name != "touch (second)" {
+		t.Errorf("unexpected task results: %+v", result.Tasks)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 3 {
+		t.Errorf("expected a file for every loop item: %v", files)
+	}
+}
+
+func TestLoadPlaybookWithIncludes(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.yml": `
+name: main
+tasks:
+  - name: "first"
+    type: LocalCommand
+    command: "echo {{.greeting}}"
+  - include: "common/fragment.yml"
+    tags: [common]
+`,
+		"common/fragment.yml": `
+name: fragment
+tasks:
+  - name: "included"
+    type: LocalCommand
+    command: "echo {{.greeting}} from fragment"
+    tags: [fragment]
+`,
+		"loop-a.yml": "name: a\ntasks:\n  - include: loop-b.yml\n",
+		"loop-b.yml": "name: b\ntasks:\n  - include: loop-a.yml\n",
+	}
+	for name, content := range files {
+		location := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(location), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(location, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	playbook, err := loadPlaybookFile(filepath.Join(dir, "main.yml"), map[string]interface{}{"greeting": "hello"}, nil, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(playbook.Tasks) != 2 || playbook.Tasks[1].Name != "included" || playbook.Tasks[1].Command != "echo hello from fragment" {
+		t.Fatalf("unexpected tasks: %+v", playbook.Tasks)
+	}
+	if tags := strings.Join(playbook.Tasks[1].Tags, ","); tags != "fragment,common" {
+		t.Errorf("expected the included task to inherit the tags of the include: %s", tags)
+	}
+	if _, err := loadPlaybookFile(filepath.Join(dir, "loop-a.yml"), map[string]interface{}{}, nil, nil); err == nil || !strings.Contains(err.Error(), "Circular include") {
+		t.Errorf("expected a circular include error, got: %v", err)
+	}
+}
+
+func TestCreateVarMapRejectsMalformedPairs(t *testing.T) {
+	for _, input := range []string{"a", "=b", "a=1 b", "a=1 =2", "a=1,b=2 c", `a="unterminated`, `a='x`, `a=trailing\`} {
+		if varMap, err := createVarMap(input); err == nil {
+			t.Errorf("expected an error for %q, got: %v", input, varMap)
+		}
+	}
+	cases := map[string]map[string]interface{}{
+		"":                {},
+		"   ":             {},
+		"a=":              {"a": ""},
+		"a=b=c":           {"a": "b=c"},
+		" a=1 \t b=2 ":    {"a": "1", "b": "2"},
+		"a=1 a=2":         {"a": "2"},
+		"url=http://x?y=": {"url": "http://x?y="},
+	}
+	for input, expected := range cases {
+		varMap, err := createVarMap(input)
+		if err != nil {
+			t.Errorf("cannot parse %q: %v", input, err)
+			continue
+		}
+		if !reflect.DeepEqual(varMap, expected) {
+			t.Errorf("%q: expected %v, got %v", input, expected, varMap)
+		}
+	}
+}
+
+func TestCreateVarMapWithSpacesInValues(t *testing.T) {
+	cases := map[string]map[string]interface{}{
+		`msg="hello world" n=1`:   {"msg": "hello world", "n": "1"},
+		`'msg=it is here'`:        {"msg": "it is here"},
+		`path=/my\ dir/file`:      {"path": "/my dir/file"},
+		`q="it's" r='say "hi"'`:   {"q": "it's", "r": `say "hi"`},
+		`a=x"y z"w`:               {"a": "xy zw"},
+		`empty="" next=1`:         {"empty": "", "next": "1"},
+		`escaped=\"quoted\" b=\\`: {"escaped": `"quoted"`, "b": `\`},
+	}
+	for input, expected := range cases {
+		varMap, err := createVarMap(input)
+		if err != nil {
+			t.Errorf("cannot parse %q: %v", input, err)
+			continue
+		}
+		if !reflect.DeepEqual(varMap, expected) {
+			t.Errorf("%q: expected %v, got %v", input, expected, varMap)
+		}
+	}
+}
+
+func TestExecuteWaitForState(t *testing.T) {
+	var mutex sync.Mutex
+	polls := 0
+	ambariRegistry := newTestAmbari(t, func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		polls++
+		state := "INSTALLED"
+		if polls > 2 {
+			state = "STARTED"
+		}
+		mutex.Unlock()
+		w.Write([]byte(`{"items":[{"ServiceComponentInfo":{"component_name":"NAMENODE","service_name":"HDFS","state":"` + state + `"}},` +
+			`{"ServiceComponentInfo":{"component_name":"DATANODE","service_name":"HDFS","state":"INSTALLED"}}]}`))
+	})
+	output := captureOutput(t)
+	task := Task{Type: WaitForState, ComponentFilter: "NAMENODE", Parameters: map[string]string{"desired_state": "started", "timeout": "30", "poll_interval": "1"}}
+
+	if err := ambariRegistry.ExecuteWaitForState(context.Background(), task); err != nil {
+		t.Fatalf("expected the NAMENODE to reach STARTED state: %v", err)
+	}
+	mutex.Lock()
+	if polls != 3 {
+		t.Errorf("expected 3 polls, got: %d", polls)
+	}
+	mutex.Unlock()
+	if strings.Count(output.String(), "Waiting for STARTED state (NAMENODE: INSTALLED)") != 1 {
+		t.Errorf("expected the waiting message only once, output: %s", output.String())
+	}
+
+	task.ComponentFilter = "DATANODE,SECONDARY_NAMENODE"
+	task.Parameters["timeout"] = "0"
+	err := ambariRegistry.ExecuteWaitForState(context.Background(), task)
+	if err == nil || !strings.Contains(err.Error(), "DATANODE: INSTALLED, SECONDARY_NAMENODE: ") {
+		t.Errorf("expected a timeout with the pending components, got: %v", err)
+	}
+
+	for _, parameters := range []map[string]string{
+		{"desired_state": "STARTED", "timeout": "x", "poll_interval": "1"},
+		{"desired_state": "STARTED", "timeout": "10", "poll_interval": "0"},
+	} {
+		task.Parameters = parameters
+		if err := ambariRegistry.ExecuteWaitForState(context.Background(), task); err == nil {
+			t.Errorf("expected an error for parameters %v", parameters)
+		}
+	}
+	if err := ambariRegistry.ExecuteWaitForState(context.Background(), Task{Type: WaitForState}); err == nil {
+		t.Error("expected an error without services and components")
+	}
+}
+
+func TestExecuteHostMaintenanceTask(t *testing.T) {
+	ambariRegistry, requests := newFakeAmbari(t, map[string][]string{"host1": {"HDFS_DATANODE"}, "host2": {"HDFS_DATANODE"}, "host3": {"ZOOKEEPER_SERVER"}}, nil)
+	output := captureOutput(t)
+	cases := map[string]string{"on": "ON", "false": "OFF"}
+	for state, expectedState := range cases {
+		task := Task{Name: "maintenance", Type: HostMaintenance, Parameters: map[string]string{"state": state}}
+		filteredHosts := ambariRegistry.GetFilteredHosts(CreateFilter("", "HDFS_DATANODE", "", false))
+		before := len(requests.getOperations())
+		if err := ambariRegistry.ExecuteHostMaintenanceTask(task, filteredHosts); err != nil {
+			t.Fatalf("%s: %v", state, err)
+		}
+		operations := requests.getOperations()[before:]
+		if len(operations) != 2 {
+			t.Fatalf("%s: expected one request per host, got: %v", state, operations)
+		}
+		for i, host := range []string{"host1", "host2"} {
+			if !strings.HasPrefix(operations[i], "PUT hosts/"+host+" ") || !strings.Contains(operations[i], `"maintenance_state": "`+expectedState+`"`) {
+				t.Errorf("%s: unexpected request for %s: %s", state, host, operations[i])
+			}
+		}
+	}
+
+	before := len(requests.getOperations())
+	task := Task{Name: "nothing", Type: HostMaintenance, Parameters: map[string]string{"state": "on"}}
+	if err := ambariRegistry.ExecuteHostMaintenanceTask(task, map[string]bool{}); err != nil {
+		t.Errorf("expected an empty host set to be a no-op: %v", err)
+	}
+	if len(requests.getOperations()) != before || !strings.Contains(output.String(), "No hosts selected for turning on maintenance mode (task 'nothing')") {
+		t.Errorf("expected no requests for an empty host set, output: %s", output.String())
+	}
+	task.Parameters["state"] = "maybe"
+	if err := ambariRegistry.ExecuteHostMaintenanceTask(task, map[string]bool{"host1": true}); err == nil {
+		t.Error("expected an error for an invalid state")
+	}
+}
+
+func TestExecutePlaybookMasksSensitiveInputs(t *testing.T) {
+	output := captureOutput(t)
+	ambariRegistry := newTestAmbari(t, emptyItemsHandler)
+	dir := t.TempDir()
+	playbook := loadTestPlaybook(t, `
+name: secrets
+inputs:
+  - name: keystore_password
+    sensitive: true
+tasks:
+  - name: "write"
+    type: LocalCommand
+    shell: true
+    command: "echo {{.keystore_password}} > {{.dir}}/password && echo written {{.keystore_password}}"
+  - name: "hidden"
+    type: LocalCommand
+    shell: true
+    no_log: true
+    ignore_errors: true
+    command: "echo hidden-output; exit 3"
+  - name: "failed"
+    type: LocalCommand
+    shell: true
+    ignore_errors: true
+    command: "cat {{.dir}}/missing-{{.keystore_password}}"
+`, "keystore_password=Kst0rePassw0rd dir="+dir)
+
+	result, _ := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{})
+
+	if content, err := ioutil.ReadFile(filepath.Join(dir, "password")); err != nil || strings.TrimSpace(string(content)) != "Kst0rePassw0rd" {
+		t.Errorf("expected the real value to be used by the task: %q, err: %v", content, err)
+	}
+	if strings.Contains(output.String(), "Kst0rePassw0rd") || !strings.Contains(output.String(), "written "+passwordMask) {
+		t.Errorf("expected the sensitive input to be masked in the output:\n%s", output.String())
+	}
+	if strings.Contains(output.String(), "hidden-output") {
+		t.Errorf("output of the no_log task is printed:\n%s", output.String())
+	}
+	if len(result.Tasks) != 3 {
+		t.Fatalf("unexpected task results: %+v", result.Tasks)
+	}
+	if result.Tasks[1].Error != "Task 'hidden' failed (the error is hidden by no_log)" {
+		t.Errorf("expected the error of the no_log task to be hidden: %s", result.Tasks[1].Error)
+	}
+	if result.Tasks[2].Status != TaskFailed || strings.Contains(result.Tasks[2].Error, "Kst0rePassw0rd") {
+		t.Errorf("expected the sensitive input to be masked in the task error: %+v", result.Tasks[2])
+	}
+}
+
+func TestExecutePlaybookFailsOnInvalidFilter(t *testing.T) {
+	ambariRegistry := newTestAmbari(t, emptyItemsHandler)
+	dir := t.TempDir()
+	playbook := loadTestPlaybook(t, `
+name: invalid-filter
+tasks:
+  - name: "typo"
+    type: LocalCommand
+    shell: true
+    services: "HDFS YARN"
+    command: "touch {{.dir}}/executed"
+`, "dir="+dir)
+
+	result, err := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{})
+
+	if err == nil || len(result.Tasks) != 1 || !strings.Contains(result.Tasks[0].Error, "Invalid filter in task 'typo'") {
+		t.Errorf("expected the task to fail on the invalid filter: %+v, err: %v", result.Tasks, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "executed")); !os.IsNotExist(err) {
+		t.Error("the task with the invalid filter has been executed")
+	}
+}
+
+func TestLoadPlaybookWithEnvironmentVariables(t *testing.T) {
+	captureOutput(t)
+	t.Setenv("AMBARICTL_TEST_CLUSTER", "prod")
+	t.Setenv("AMBARICTL_TEST_FROM_ENV", "env-value")
+	t.Setenv("AMBARICTL_TEST_EXPLICIT", "env-value")
+	os.Unsetenv("AMBARICTL_TEST_UNSET")
+	playbook := loadTestPlaybook(t, `
+name: env
+inputs:
+  - name: from_env
+    env: AMBARICTL_TEST_FROM_ENV
+    default: default-value
+  - name: explicit
+    env: AMBARICTL_TEST_EXPLICIT
+  - name: with_default
+    env: AMBARICTL_TEST_UNSET
+    default: default-value
+tasks:
+  - name: "env"
+    type: LocalCommand
+    command: 'echo {{env "AMBARICTL_TEST_CLUSTER"}}|{{env "AMBARICTL_TEST_UNSET"}}|{{.from_env}}|{{.explicit}}|{{.with_default}}'
+`, "explicit=given")
+
+	if command := playbook.Tasks[0].Command; command != "echo prod||env-value|given|default-value" {
+		t.Errorf("unexpected rendered command: %s", command)
+	}
+}
+
+func TestRenderTaskTemplatesWithEnvironmentVariables(t *testing.T) {
+	t.Setenv("AMBARICTL_TEST_WORKDIR", "/tmp/work")
+	task, err := renderTaskTemplates(Task{Name: "env", Command: `ls {{env "AMBARICTL_TEST_WORKDIR"}}`, Workdir: `{{env "AMBARICTL_TEST_UNSET"}}`}, map[string]string{}, map[string]interface{}{"previous": "output"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Command != "ls /tmp/work" || task.Workdir != "" {
+		t.Errorf("unexpected rendered task: %+v", task)
+	}
+}
+
+func TestLoadPlaybookValidatesInputs(t *testing.T) {
+	output := captureOutput(t)
+	location := filepath.Join(t.TempDir(), "playbook.yml")
+	content := `
+name: inputs
+inputs:
+  - name: port
+    type: int
+  - name: cluster
+    required: true
+    pattern: "[a-z][a-z0-9]*"
+  - name: secure
+    type: bool
+    default: "false"
+tasks:
+  - name: "echo"
+    type: LocalCommand
+    command: "echo {{.cluster}}:{{.port}} {{.secure}}"
+`
+	if err := ioutil.WriteFile(location, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	invalidVars := map[string]string{
+		"port=http cluster=prod":              "Input 'port' should be a number, not 'http'",
+		"port=8080 cluster=Prod-1":            "Input 'cluster' does not match pattern",
+		"port=8080 cluster=prod secure=maybe": "Input 'secure' should be true or false, not 'maybe'",
+	}
+	for vars, expectedError := range invalidVars {
+		varMap, err := createVarMap(vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadPlaybookFile(location, varMap, nil, nil); err == nil || !strings.Contains(err.Error(), expectedError) {
+			t.Errorf("%q: expected error %q, got: %v", vars, expectedError, err)
+		}
+	}
+
+	previousReader := stdinReader
+	t.Cleanup(func() { stdinReader = previousReader })
+	stdinReader = bufio.NewReader(strings.NewReader("http\n8080\n \nProd\nprod1\n"))
+	playbook, err := loadPlaybookFile(location, map[string]interface{}{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command := playbook.Tasks[0].Command; command != "echo prod1:8080 false" {
+		t.Errorf("unexpected rendered command: %s", command)
+	}
+	for _, message := range []string{"Input 'port' should be a number, not 'http'", "Input 'cluster' is required", "Input 'cluster' does not match pattern"} {
+		if !strings.Contains(output.String(), message) {
+			t.Errorf("expected %q for the invalid answers, output:\n%s", message, output.String())
+		}
+	}
+}
+
+func TestLoadPlaybookInNonInteractiveMode(t *testing.T) {
+	captureOutput(t)
+	SetNonInteractive(true)
+	t.Cleanup(func() { SetNonInteractive(false) })
+	t.Setenv("AMBARICTL_TEST_PASSWORD", "from-env")
+	location := filepath.Join(t.TempDir(), "playbook.yml")
+	content := `
+name: batch
+inputs:
+  - name: cluster
+  - name: host
+  - name: password
+    env: AMBARICTL_TEST_PASSWORD
+  - name: port
+    default: "8080"
+tasks:
+  - name: "echo"
+    type: LocalCommand
+    command: "echo {{.cluster}} {{.host}}:{{.port}} {{.password}}"
+`
+	if err := ioutil.WriteFile(location, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := loadPlaybookFile(location, map[string]interface{}{}, nil, nil)
+	if err == nil || !strings.HasSuffix(err.Error(), "(non-interactive mode): cluster, host") {
+		t.Errorf("expected an error with the missing inputs, got: %v", err)
+	}
+	playbook, err := loadPlaybookFile(location, map[string]interface{}{"cluster": "prod", "host": "ambari"}, nil, nil)
+	if err != nil {
+		t.Fatalf("expected the playbook with every input to be loaded: %v", err)
+	}
+	if command := playbook.Tasks[0].Command; command != "echo prod ambari:8080 from-env" {
+		t.Errorf("unexpected rendered command: %s", command)
+	}
+}
+
+func TestExecutePlaybookWithTags(t *testing.T) {
+	captureOutput(t)
+	ambariRegistry := newTestAmbari(t, emptyItemsHandler)
+	playbook := loadTestPlaybook(t, `
+name: tags
+tasks:
+  - name: "untagged"
+    type: LocalCommand
+    command: "true"
+  - name: "config"
+    type: LocalCommand
+    command: "true"
+    tags: [config]
+  - name: "slow config"
+    type: LocalCommand
+    command: "true"
+    tags: [config, slow]
+  - name: "verify"
+    type: LocalCommand
+    command: "true"
+    tags: [verify, slow]
+`, "")
+	cases := []struct {
+		tags, skipTags []string
+		expected       []string
+	}{
+		{nil, nil, []string{"untagged", "config", "slow config", "verify"}},
+		{[]string{"config"}, nil, []string{"config", "slow config"}},
+		{[]string{"config", "verify"}, []string{"slow"}, []string{"config"}},
+		{nil, []string{"slow"}, []string{"untagged", "config"}},
+		{[]string{"missing"}, nil, []string{}},
+	}
+	for _, c := range cases {
+		result, err := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{Tags: c.tags, SkipTags: c.skipTags})
+		if err != nil {
+			t.Fatal(err)
+		}
+		executed := make([]string, 0)
+		for _, taskResult := range result.Tasks {
+			if taskResult.Status == TaskSuccess {
+				executed = append(executed, taskResult.Name)
+			} else if taskResult.Status != TaskSkipped {
+				t.Errorf("unexpected status of '%s': %s", taskResult.Name, taskResult.Status)
+			}
+		}
+		if len(result.Tasks) != 4 || !reflect.DeepEqual(executed, c.expected) {
+			t.Errorf("tags %v, skip tags %v: expected %v to run, got: %v", c.tags, c.skipTags, c.expected, executed)
+		}
+	}
+}
+
+func TestExecutePlaybookStartAtTask(t *testing.T) {
+	captureOutput(t)
+	ambariRegistry := newTestAmbari(t, emptyItemsHandler)
+	dir := t.TempDir()
+	playbook := loadTestPlaybook(t, `
+name: resume
+tasks:
+  - name: "first"
+    type: LocalCommand
+    shell: true
+    command: "touch {{.dir}}/first"
+  - name: "second"
+    type: LocalCommand
+    shell: true
+    command: "touch {{.dir}}/second"
+  - name: "third"
+    type: LocalCommand
+    shell: true
+    command: "touch {{.dir}}/third"
+verify:
+  - name: "check"
+    type: LocalCommand
+    shell: true
+    command: "touch {{.dir}}/check"
+`, "dir="+dir)
+
+	if result, err := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{StartAtTask: "missing"}); err == nil || len(result.Tasks) > 0 {
+		t.Errorf("expected an error for a missing start task, got: %+v, err: %v", result.Tasks, err)
+	}
+	result, err := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{StartAtTask: "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"first": TaskSkipped, "second": TaskSuccess, "third": TaskSuccess}
+	if len(result.Tasks) != 3 {
+		t.Fatalf("unexpected task results: %+v", result.Tasks)
+	}
+	for _, taskResult := range result.Tasks {
+		if taskResult.Status != expected[taskResult.Name] {
+			t.Errorf("unexpected status of '%s': %s", taskResult.Name, taskResult.Status)
+		}
+	}
+	for name, status := range expected {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != (status == TaskSuccess) {
+			t.Errorf("unexpected execution of '%s', err: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "check")); err != nil {
+		t.Errorf("expected the verify task to run: %v", err)
+	}
+}
+
+func TestExecutePlaybookInStepMode(t *testing.T) {
+	captureOutput(t)
+	ambariRegistry := newTestAmbari(t, emptyItemsHandler)
+	previousReader := stdinReader
+	t.Cleanup(func() { stdinReader = previousReader })
+	playbook := loadTestPlaybook(t, `
+name: step
+tasks:
+  - name: "no"
+    type: LocalCommand
+    command: "true"
+  - name: "yes"
+    type: LocalCommand
+    command: "true"
+  - name: "continue"
+    type: LocalCommand
+    command: "true"
+  - name: "not asked"
+    type: LocalCommand
+    command: "true"
+`, "")
+	// the second run asks again, even though the first one has been continued without asking
+	stdinReader = bufio.NewReader(strings.NewReader("n\n\nc\nn\nn\n\nn\n"))
+	for _, expected := range [][]string{{TaskSkipped, TaskSuccess, TaskSuccess, TaskSuccess}, {TaskSkipped, TaskSkipped, TaskSuccess, TaskSkipped}} {
+		result, err := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{Step: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		statuses := make([]string, 0)
+		for _, taskResult := range result.Tasks {
+			statuses = append(statuses, taskResult.Status)
+		}
+		if !reflect.DeepEqual(statuses, expected) {
+			t.Errorf("expected task statuses %v, got: %v", expected, statuses)
+		}
+	}
+}
+
+func TestSaveAndLoadPlaybookFile(t *testing.T) {
+	playbook := loadTestPlaybook(t, `
+name: roundtrip
+description: Restart the datanodes
+inputs:
+  - name: user
+    default: hdfs
+    required: true
+  - name: password
+    default: secret
+    sensitive: true
+tasks:
+  - name: restart
+    type: AmbariCommand
+    command: RESTART
+    filter:
+      services: [HDFS]
+      components: [DATANODE]
+      exclude_hosts: [host3]
+    parameters:
+      service: HDFS
+    retries: 2
+    retry_delay: 30s
+    ignore_errors: true
+  - name: check
+    type: RemoteCommand
+    command: ls /tmp/$item
+    hosts: host1,host2
+    loop: [a, b]
+    continue_on_error: true
+`, "")
+	location := filepath.Join(t.TempDir(), "saved.yml")
+	if err := SavePlaybookFile(playbook, location); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ioutil.ReadFile(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded := loadTestPlaybook(t, string(saved), "")
+	if !reflect.DeepEqual(playbook, reloaded) {
+		t.Errorf("the reloaded playbook is different:\n%+v\n%+v", playbook, reloaded)
+	}
+	if err := SavePlaybookFile(reloaded, location); err != nil {
+		t.Fatal(err)
+	}
+	savedAgain, err := ioutil.ReadFile(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != string(savedAgain) {
+		t.Errorf("the saved playbook is not stable:\n%s\n%s", saved, savedAgain)
+	}
+	for _, expected := range []string{"retry_delay: 30s", "continue_on_error: true", "exclude_hosts:", "sensitive: true", "loop:"} {
+		if !strings.Contains(string(saved), expected) {
+			t.Errorf("expected '%s' in the saved playbook:\n%s", expected, saved)
+		}
+	}
+	for _, omitted := range []string{"ignore_errors", "when:", "timeout:", "verify:", "async:", "ambari_server:", "missing_components:", "env:"} {
+		if strings.Contains(string(saved), omitted) {
+			t.Errorf("expected '%s' to be omitted from the saved playbook:\n%s", omitted, saved)
+		}
+	}
+}
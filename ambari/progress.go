@@ -0,0 +1,70 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"fmt"
+	"golang.org/x/crypto/ssh/terminal"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const hostProgressLogInterval = 10 * time.Second
+
+// hostProgress counts the finished hosts of a parallel remote operation, on a terminal the counter is updated in place,
+// otherwise it is printed periodically
+type hostProgress struct {
+	mutex     sync.Mutex
+	total     int
+	completed int
+	terminal  bool
+	lastLog   time.Time
+}
+
+func newHostProgress(total int) *hostProgress {
+	return &hostProgress{total: total, terminal: isTerminal(executionContext.Err), lastLog: time.Now()}
+}
+
+// HostCompleted is the per-host completion hook of the progress counter
+func (p *hostProgress) HostCompleted(host string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.completed++
+	if p.total < 2 {
+		return
+	}
+	message := fmt.Sprintf("%d/%d hosts complete", p.completed, p.total)
+	if p.terminal {
+		fmt.Fprint(executionContext.Err, "\r\033[K"+message)
+		if p.completed == p.total {
+			fmt.Fprintln(executionContext.Err)
+		}
+		return
+	}
+	if p.completed == p.total || time.Since(p.lastLog) >= hostProgressLogInterval {
+		p.lastLog = time.Now()
+		errPrintln(message)
+	}
+}
+
+func isTerminal(writer io.Writer) bool {
+	if sw, ok := writer.(*syncWriter); ok {
+		writer = sw.writer
+	}
+	file, ok := writer.(*os.File)
+	return ok && terminal.IsTerminal(int(file.Fd()))
+}
@@ -16,7 +16,6 @@ package ambari
 
 import (
 	"encoding/json"
-	"fmt"
 	"os"
 	"strings"
 )
@@ -106,7 +105,7 @@ func (a AmbariRegistry) GetMinimalBlueprint(blueprint map[string]interface{}, st
 	}
 	bodyBytes, err := json.Marshal(blueprint)
 	if err != nil {
-		fmt.Println(err)
+		errPrintln(err)
 		os.Exit(1)
 	}
 	return bodyBytes
@@ -0,0 +1,170 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// RegisterTaskOutput stores the outputs of a task (by hosts) with a variable name, so later tasks can use them.
+// In templates the variable is a map with 'stdout', 'stderr', 'done', 'exit_code' (aggregated for all hosts, outputs are joined in host order)
+// and 'hosts' (the same fields by hostname) keys, e.g.: {{.version.stdout}} or {{(index .version.hosts "c7401.ambari.apache.org").stdout}}.
+// The aggregated fields can be used in conditions as well, e.g.: version.exit_code == 0
+func RegisterTaskOutput(name string, responses map[string]RemoteResponse, vars map[string]string, registered map[string]interface{}) {
+	hostNames := make([]string, 0)
+	for host := range responses {
+		hostNames = append(hostNames, host)
+	}
+	sort.Strings(hostNames)
+	stdouts := make([]string, 0)
+	stderrs := make([]string, 0)
+	done := true
+	exitCode := 0
+	hosts := make(map[string]interface{})
+	for _, host := range hostNames {
+		response := responses[host]
+		hostExitCode := GetExitCode(response)
+		stdout := strings.TrimSpace(response.StdOut)
+		stderr := strings.TrimSpace(response.StdErr)
+		if len(stdout) > 0 {
+			stdouts = append(stdouts, stdout)
+		}
+		if len(stderr) > 0 {
+			stderrs = append(stderrs, stderr)
+		}
+		if !response.Done {
+			done = false
+		}
+		if exitCode == 0 {
+			exitCode = hostExitCode
+		}
+		hosts[host] = map[string]interface{}{
+			"stdout":    stdout,
+			"stderr":    stderr,
+			"done":      strconv.FormatBool(response.Done),
+			"exit_code": strconv.Itoa(hostExitCode),
+		}
+	}
+	output := map[string]interface{}{
+		"stdout":    strings.Join(stdouts, "\n"),
+		"stderr":    strings.Join(stderrs, "\n"),
+		"done":      strconv.FormatBool(done),
+		"exit_code": strconv.Itoa(exitCode),
+		"hosts":     hosts,
+	}
+	for _, field := range []string{"stdout", "stderr", "done", "exit_code"} {
+		vars[name+"."+field] = output[field].(string)
+	}
+	registered[name] = output
+}
+
+// mergeRegisteredOutputs copy the registered outputs (and the variables that are derived from them) of a task that used its own variables (e.g. an async task)
+func mergeRegisteredOutputs(taskVars map[string]string, taskRegistered map[string]interface{}, vars map[string]string, registered map[string]interface{}) {
+	for name, output := range taskRegistered {
+		for _, field := range []string{"stdout", "stderr", "done", "exit_code"} {
+			vars[name+"."+field] = taskVars[name+"."+field]
+		}
+		registered[name] = output
+	}
+}
+
+// escapeRuntimeReferences keeps the template actions that refer to registered variables (or loop items) unrendered,
+// as those can be rendered only when the tasks are executed
+func escapeRuntimeReferences(data []byte, tasks []Task) []byte {
+	names := make([]string, 0)
+	for _, task := range tasks {
+		if len(task.Register) > 0 {
+			names = append(names, task.Register)
+		}
+		if len(task.Loop) > 0 && !containsString(names, loopItemVariable) {
+			names = append(names, loopItemVariable)
+		}
+	}
+	for _, name := range names {
+		reference := regexp.MustCompile(`\{\{[^{}]*\.` + regexp.QuoteMeta(name) + `\b[^{}]*\}\}`)
+		data = reference.ReplaceAllFunc(data, func(action []byte) []byte {
+			return []byte("{{`" + string(action) + "`}}")
+		})
+	}
+	return data
+}
+
+// templateContext get the values that can be used in the templates of the tasks: the variables and the registered outputs
+func templateContext(vars map[string]string, registered map[string]interface{}) map[string]interface{} {
+	context := make(map[string]interface{})
+	for name, value := range vars {
+		context[name] = value
+	}
+	for name, value := range registered {
+		context[name] = value
+	}
+	return context
+}
+
+// renderTaskTemplates renders the template actions of a task (that are left after loading the playbook) with the variables, the registered outputs and the loop item
+func renderTaskTemplates(task Task, vars map[string]string, registered map[string]interface{}) (Task, error) {
+	if len(registered) == 0 && !task.inLoop {
+		return task, nil
+	}
+	context := templateContext(vars, registered)
+	var err error
+	render := func(value string) string {
+		if err != nil || !strings.Contains(value, "{{") {
+			return value
+		}
+		textTemplate, parseErr := template.New(task.Name).Funcs(playbookTemplateFuncs).Parse(value)
+		if parseErr != nil {
+			err = fmt.Errorf("Cannot render task '%s': %v", task.Name, parseErr)
+			return value
+		}
+		var tpl bytes.Buffer
+		if executeErr := textTemplate.Execute(&tpl, context); executeErr != nil {
+			err = fmt.Errorf("Cannot render task '%s': %v", task.Name, executeErr)
+			return value
+		}
+		return tpl.String()
+	}
+	task.Command = render(task.Command)
+	task.When = render(task.When)
+	task.HostFilter = render(task.HostFilter)
+	task.ServiceFilter = render(task.ServiceFilter)
+	task.ComponentFilter = render(task.ComponentFilter)
+	task.Workdir = render(task.Workdir)
+	task.Cluster = render(task.Cluster)
+	assertions := make([]string, 0)
+	for _, assertion := range task.Assertions {
+		assertions = append(assertions, render(assertion))
+	}
+	task.Assertions = assertions
+	parameters := make(map[string]string)
+	for key, value := range task.Parameters {
+		parameters[key] = render(value)
+	}
+	task.Parameters = parameters
+	if len(task.Env) > 0 {
+		env := make(map[string]string)
+		for name, value := range task.Env {
+			env[name] = render(value)
+		}
+		task.Env = env
+	}
+	return task, err
+}
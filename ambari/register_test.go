@@ -0,0 +1,72 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRegisterTaskOutput(t *testing.T) {
+	vars := make(map[string]string)
+	registered := make(map[string]interface{})
+	responses := map[string]RemoteResponse{
+		"host2": {StdOut: "2.7.3\n", Done: true},
+		"host1": {StdOut: " 2.7.1 ", StdErr: "warning", Done: true, ExitStatus: 1, Err: &ExitCodeError{Code: 1}},
+	}
+
+	RegisterTaskOutput("version", responses, vars, registered)
+
+	expected := map[string]string{"version.stdout": "2.7.1\n2.7.3", "version.stderr": "warning", "version.done": "true", "version.exit_code": "1"}
+	for name, value := range expected {
+		if vars[name] != value {
+			t.Errorf("expected %s=%q, got %q", name, value, vars[name])
+		}
+	}
+	hosts := registered["version"].(map[string]interface{})["hosts"].(map[string]interface{})
+	if host2 := hosts["host2"].(map[string]interface{}); host2["stdout"] != "2.7.3" || host2["exit_code"] != "0" {
+		t.Errorf("unexpected output of host2: %v", host2)
+	}
+}
+
+func TestExecutePlaybookUsesRegisteredOutputs(t *testing.T) {
+	ambariRegistry := newTestAmbari(t, emptyItemsHandler)
+	playbook := loadTestPlaybook(t, `
+name: register
+tasks:
+  - name: "version"
+    type: LocalCommand
+    command: "echo 2.7"
+    register: version
+  - name: "use version"
+    type: LocalCommand
+    command: "echo version={{.version.stdout}}"
+    when: version.exit_code == 0 and version.stdout == '2.7'
+    register: copy
+  - name: "skipped"
+    type: LocalCommand
+    command: "true"
+    when: copy.stdout != 'version=2.7'
+`, "")
+
+	result, err := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Tasks) != 3 || result.Tasks[1].Status != TaskSuccess || result.Tasks[2].Status != TaskSkipped {
+		t.Errorf("unexpected task results: %+v", result.Tasks)
+	}
+}
@@ -17,18 +17,40 @@ package ambari
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"os/user"
 	"path"
+	"strconv"
+	"strings"
 )
 
 const (
 	ambariServerJsonFileName       = "ambari_servers.json"
 	connectionProfilesJsonFileName = "connection_profiles.json"
+	passwordMask                   = "********"
 )
 
+var (
+	// ErrNoActiveAmbari is returned when none of the ambari registries is active
+	ErrNoActiveAmbari = errors.New("no active ambari registry configured")
+	// ErrMultipleActiveAmbari is returned when more than one ambari registry is active
+	ErrMultipleActiveAmbari = errors.New("multiple active ambari registries configured")
+)
+
+var selectedCluster string
+
+// dbFolder is the folder of the ambarictl database (~/.ambarictl if it is empty)
+var dbFolder string
+
+// SetSelectedCluster set the cluster that is used for ambari server entries that do not pin a cluster
+func SetSelectedCluster(cluster string) {
+	selectedCluster = cluster
+}
+
 // CreateAmbariRegistryDb initialize ambarictl database
 func CreateAmbariRegistryDb() {
 	ambariServerJsonFile := getJsonDbFile(ambariServerJsonFileName)
@@ -45,6 +67,20 @@ func CreateAmbariRegistryDb() {
 		err := ioutil.WriteFile(connectionProfileJsonFile, connectionProfilesJson, 0644)
 		checkErr(err)
 	}
+	environmentsJsonFile := getJsonDbFile(environmentsJsonFileName)
+	if !exists(environmentsJsonFile) {
+		environments := make([]Environment, 0)
+		environmentsJson, _ := json.Marshal(environments)
+		err := ioutil.WriteFile(environmentsJsonFile, environmentsJson, 0644)
+		checkErr(err)
+	}
+	playbookRunsJsonFile := getJsonDbFile(playbookRunsJsonFileName)
+	if !exists(playbookRunsJsonFile) {
+		playbookRuns := make([]PlaybookRun, 0)
+		playbookRunsJson, _ := json.Marshal(playbookRuns)
+		err := ioutil.WriteFile(playbookRunsJsonFile, playbookRunsJson, 0644)
+		checkErr(err)
+	}
 }
 
 // DropAmbariRegistryRecords drop all ambari server entries from ambarictl database
@@ -59,7 +95,7 @@ func DropConnectionProfileRecords() {
 	WriteConnectionProfileEntries(connectionProfiles)
 }
 
-// ListAmbariRegistryEntries get all ambari registries from ambarictl database
+// ListAmbariRegistryEntries get all ambari registries from ambarictl database (encrypted passwords are decrypted only when they are used)
 func ListAmbariRegistryEntries() []AmbariRegistry {
 	ambariServerJsonFile := getJsonDbFile(ambariServerJsonFileName)
 	file, err := ioutil.ReadFile(ambariServerJsonFile)
@@ -69,7 +105,19 @@ func ListAmbariRegistryEntries() []AmbariRegistry {
 	return ambariRegistries
 }
 
-// ListConnectionProfileEntries get all ambari registries from ambarictl database
+// MaskPasswords replace the (non-empty) passwords of ambari registries with a mask, so the entries can be printed
+func MaskPasswords(ambariRegistries []AmbariRegistry) []AmbariRegistry {
+	result := make([]AmbariRegistry, 0)
+	for _, ambariRegistry := range ambariRegistries {
+		if len(ambariRegistry.Password) > 0 {
+			ambariRegistry.Password = passwordMask
+		}
+		result = append(result, ambariRegistry)
+	}
+	return result
+}
+
+// ListConnectionProfileEntries get all connection profiles from ambarictl database (encrypted passwords are decrypted only when they are used)
 func ListConnectionProfileEntries() []ConnectionProfile {
 	connectionProfileJsonFile := getJsonDbFile(connectionProfilesJsonFileName)
 	file, err := ioutil.ReadFile(connectionProfileJsonFile)
@@ -107,32 +155,194 @@ func GetConnectionProfileEntryId(id string) string {
 	return connectionProfileId
 }
 
-// RegisterNewAmbariEntry create new ambari registry entry in ambarictl database
-func RegisterNewAmbariEntry(id string, hostname string, port int, protocol string, username string, password string, cluster string) {
+// RegisterNewAmbariEntry create new ambari registry entry in ambarictl database (protocol, port and hostname are validated and normalized first),
+// the server certificate is verified for https unless insecureTLS is set (caCertPath is an optional pem file of the CA that signed the certificate),
+// requestTimeout overrides the timeout of the REST calls (in seconds, 0 means the default timeout),
+// the new entry becomes the only active one (the other entries are left intact if the registration fails)
+func RegisterNewAmbariEntry(id string, hostname string, port int, protocol string, username string, password string, passwordCommand string, cluster string, serverHosts []string,
+	insecureTLS bool, caCertPath string, requestTimeout int) error {
 	checkId := GetAmbariEntryId(id)
 	if len(checkId) > 0 {
-		alreadyExistMsg := fmt.Sprintf("Registry with id '%s' is already defined as a registry entry", checkId)
-		fmt.Println(alreadyExistMsg)
-		os.Exit(1)
+		return fmt.Errorf("Registry with id '%s' is already defined as a registry entry", checkId)
+	}
+	hostname, port, protocol, err := NormalizeAmbariAddress(hostname, port, protocol)
+	if err != nil {
+		return err
+	}
+	if len(caCertPath) > 0 {
+		if _, err := CreateTLSConfig(insecureTLS, caCertPath); err != nil {
+			return err
+		}
 	}
 	ambaiServerEntries := ListAmbariRegistryEntries()
-	newAmbariServerEntry := AmbariRegistry{Name: id, Hostname: hostname, Port: port, Protocol: protocol, Username: username, Password: password, Cluster: cluster, Active: true}
+	for index := range ambaiServerEntries {
+		ambaiServerEntries[index].Active = false
+	}
+	newAmbariServerEntry := AmbariRegistry{Name: id, Hostname: hostname, Port: port, Protocol: protocol, Username: username, Password: password, PasswordCommand: passwordCommand, Cluster: cluster, Active: true, ServerHosts: serverHosts,
+		InsecureTLS: insecureTLS, CACertPath: caCertPath, RequestTimeout: requestTimeout}
 	ambaiServerEntries = append(ambaiServerEntries, newAmbariServerEntry)
 	WriteAmbariServerEntries(ambaiServerEntries)
+	return nil
+}
+
+// RegisterOrUpdateAmbariEntry create a new ambari registry entry like RegisterNewAmbariEntry, but if the entry already exists,
+// its fields are overwritten (so registration can be re-run), the entry becomes the only active one, returns true if a new entry was created
+func RegisterOrUpdateAmbariEntry(id string, hostname string, port int, protocol string, username string, password string, passwordCommand string, cluster string, serverHosts []string,
+	insecureTLS bool, caCertPath string, requestTimeout int) (bool, error) {
+	if len(GetAmbariEntryId(id)) == 0 {
+		if err := RegisterNewAmbariEntry(id, hostname, port, protocol, username, password, passwordCommand, cluster, serverHosts, insecureTLS, caCertPath, requestTimeout); err != nil {
+			return false, err
+		}
+		return true, SetActiveAmbari(id)
+	}
+	update := AmbariRegistryUpdate{Hostname: &hostname, Port: &port, Protocol: &protocol, Username: &username, Cluster: &cluster, ServerHosts: serverHosts,
+		InsecureTLS: &insecureTLS, CACertPath: &caCertPath, RequestTimeout: &requestTimeout}
+	if len(passwordCommand) > 0 {
+		update.PasswordCommand = &passwordCommand
+	} else {
+		update.Password = &password
+	}
+	if update.ServerHosts == nil {
+		update.ServerHosts = make([]string, 0)
+	}
+	if err := UpdateAmbariRegistryEntry(id, update); err != nil {
+		return false, err
+	}
+	return false, SetActiveAmbari(id)
+}
+
+// UpdateAmbariRegistryEntry change the provided fields of an existing ambari registry entry, the other fields (e.g. the active flag) are kept,
+// setting the password clears the password command (and vice versa), returns error if the entry does not exist
+func UpdateAmbariRegistryEntry(id string, update AmbariRegistryUpdate) error {
+	if len(GetAmbariEntryId(id)) == 0 {
+		return fmt.Errorf("Not found Ambari server registry with id '%s'", id)
+	}
+	ambariServers := ListAmbariRegistryEntries()
+	for index := range ambariServers {
+		if ambariServers[index].Name != id {
+			continue
+		}
+		entry := ambariServers[index]
+		if update.Hostname != nil {
+			entry.Hostname = *update.Hostname
+		}
+		if update.Port != nil {
+			entry.Port = *update.Port
+		}
+		if update.Protocol != nil {
+			entry.Protocol = *update.Protocol
+		}
+		hostname, port, protocol, err := NormalizeAmbariAddress(entry.Hostname, entry.Port, entry.Protocol)
+		if err != nil {
+			return err
+		}
+		entry.Hostname, entry.Port, entry.Protocol = hostname, port, protocol
+		if update.Username != nil {
+			entry.Username = *update.Username
+		}
+		if update.Password != nil {
+			entry.Password = *update.Password
+			entry.PasswordEncrypted = false
+			entry.PasswordCommand = ""
+		}
+		if update.PasswordCommand != nil {
+			entry.PasswordCommand = *update.PasswordCommand
+			if len(entry.PasswordCommand) > 0 {
+				entry.Password = ""
+				entry.PasswordEncrypted = false
+			}
+		}
+		if update.Cluster != nil {
+			entry.Cluster = *update.Cluster
+		}
+		if update.ServerHosts != nil {
+			entry.ServerHosts = update.ServerHosts
+		}
+		if update.InsecureTLS != nil {
+			entry.InsecureTLS = *update.InsecureTLS
+		}
+		if update.CACertPath != nil {
+			entry.CACertPath = *update.CACertPath
+		}
+		if len(entry.CACertPath) > 0 {
+			if _, err := CreateTLSConfig(entry.InsecureTLS, entry.CACertPath); err != nil {
+				return err
+			}
+		}
+		if update.RequestTimeout != nil {
+			entry.RequestTimeout = *update.RequestTimeout
+		}
+		ambariServers[index] = entry
+	}
+	WriteAmbariServerEntries(ambariServers)
+	return nil
+}
+
+// NormalizeAmbariAddress validate protocol (http/https) and port, the port defaults to 8080 (http) or 8443 (https) if it is 0,
+// and a hostname can be provided as an url as well (e.g.: https://ambari.example.com:8443/)
+func NormalizeAmbariAddress(hostname string, port int, protocol string) (string, int, string, error) {
+	hostname = strings.TrimSpace(hostname)
+	protocol = strings.ToLower(strings.TrimSpace(protocol))
+	if strings.Contains(hostname, "://") {
+		ambariUrl, err := url.Parse(hostname)
+		if err != nil {
+			return "", 0, "", fmt.Errorf("Invalid Ambari host '%s': %v", hostname, err)
+		}
+		if len(protocol) == 0 {
+			protocol = strings.ToLower(ambariUrl.Scheme)
+		}
+		if port == 0 && len(ambariUrl.Port()) > 0 {
+			port, err = strconv.Atoi(ambariUrl.Port())
+			if err != nil {
+				return "", 0, "", fmt.Errorf("Invalid port in Ambari host '%s': %v", hostname, err)
+			}
+		}
+		hostname = ambariUrl.Hostname()
+	}
+	hostname = strings.TrimSuffix(hostname, "/")
+	if len(hostname) == 0 {
+		return "", 0, "", errors.New("Ambari host is required")
+	}
+	if len(protocol) == 0 {
+		protocol = "http"
+	}
+	if protocol != "http" && protocol != "https" {
+		return "", 0, "", fmt.Errorf("Invalid protocol '%s', use 'http' or 'https'", protocol)
+	}
+	if port == 0 {
+		port = 8080
+		if protocol == "https" {
+			port = 8443
+		}
+	}
+	if port < 1 || port > 65535 {
+		return "", 0, "", fmt.Errorf("Invalid port %d, it should be between 1 and 65535", port)
+	}
+	return hostname, port, protocol, nil
 }
 
-// RegisterNewConnectionProfile create new connection profile entry in ambarictl database
-func RegisterNewConnectionProfile(id string, keyPath string, port int, username string, hostJump bool, proxyAddress string) {
+// RegisterNewConnectionProfile create new connection profile entry in ambarictl database,
+// the profile needs a key path, a password or a password command for authentication,
+// with become the remote commands are run with sudo (the become password is piped to sudo, defaults to the ssh password),
+// with strict host key checking only the host keys of the known hosts file (defaults to ~/.ssh/known_hosts) are accepted
+func RegisterNewConnectionProfile(id string, keyPath string, port int, username string, password string, passwordCommand string, hostJump bool, proxyAddress string, ciphers []string, macs []string, keyExchanges []string, reconnectRetries int, become bool, becomePassword string, hostKeyChecking string, knownHostsFile string) error {
 	checkId := GetConnectionProfileEntryId(id)
 	if len(checkId) > 0 {
-		alreadyExistMsg := fmt.Sprintf("Connection profile with id '%s' is already defined as a profile entry", checkId)
-		fmt.Println(alreadyExistMsg)
-		os.Exit(1)
+		return fmt.Errorf("Connection profile with id '%s' is already defined as a profile entry", checkId)
+	}
+	if len(keyPath) == 0 && len(password) == 0 && len(passwordCommand) == 0 {
+		return fmt.Errorf("Connection profile '%s' needs a key path, a password or a password command for ssh authentication", id)
+	}
+	if err := ValidateHostKeyChecking(hostKeyChecking); err != nil {
+		return err
 	}
 	connectionProfiles := ListConnectionProfileEntries()
-	newConnectionProfile := ConnectionProfile{Name: id, KeyPath: keyPath, Port: port, Username: username, HostJump: hostJump, ProxyAddress: proxyAddress}
+	newConnectionProfile := ConnectionProfile{Name: id, KeyPath: keyPath, Port: port, Username: username, Password: password, PasswordCommand: passwordCommand, HostJump: hostJump, ProxyAddress: proxyAddress,
+		Ciphers: ciphers, MACs: macs, KeyExchanges: keyExchanges, ReconnectRetries: reconnectRetries, Become: become, BecomePassword: becomePassword,
+		HostKeyChecking: hostKeyChecking, KnownHostsFile: knownHostsFile}
 	connectionProfiles = append(connectionProfiles, newConnectionProfile)
 	WriteConnectionProfileEntries(connectionProfiles)
+	return nil
 }
 
 // DeRegisterAmbariEntry remove an ambari server enrty by id
@@ -149,6 +359,31 @@ func DeRegisterAmbariEntry(id string) {
 	WriteAmbariServerEntries(newAmbariServers)
 }
 
+// DeleteAmbariRegistryEntry remove a single ambari server entry by id, returns error if there is no such entry (other entries are untouched)
+func DeleteAmbariRegistryEntry(id string) error {
+	if len(GetAmbariEntryId(id)) == 0 {
+		return fmt.Errorf("No such Ambari registry entry: %s", id)
+	}
+	DeRegisterAmbariEntry(id)
+	return nil
+}
+
+// DeleteConnectionProfile remove a single connection profile by id and detach it from the ambari server entries, returns error if there is no such profile
+func DeleteConnectionProfile(id string) error {
+	if len(GetConnectionProfileEntryId(id)) == 0 {
+		return fmt.Errorf("No such connection profile: %s", id)
+	}
+	DeRegisterConnectionProfile(id)
+	ambariServers := ListAmbariRegistryEntries()
+	for index := range ambariServers {
+		if ambariServers[index].ConnectionProfile == id {
+			ambariServers[index].ConnectionProfile = ""
+		}
+	}
+	WriteAmbariServerEntries(ambariServers)
+	return nil
+}
+
 // DeRegisterConnectionProfile remove a connection profile by id
 func DeRegisterConnectionProfile(id string) {
 	connectionProfiles := ListConnectionProfileEntries()
@@ -163,18 +398,69 @@ func DeRegisterConnectionProfile(id string) {
 	WriteConnectionProfileEntries(newConnectionProfiles)
 }
 
-// GetActiveAmbari get the active ambari registry from ambarictl database (should be only one)
-func GetActiveAmbari() AmbariRegistry {
+// GetActiveAmbari get the active ambari registry from ambarictl database (should be only one),
+// if the registry has a password command, the password is obtained by running that command,
+// if the registry does not pin a cluster, the selected cluster (see SetSelectedCluster) is used
+func GetActiveAmbari() (AmbariRegistry, error) {
 	ambariServers := ListAmbariRegistryEntries()
 	var result AmbariRegistry
-	if len(ambariServers) > 0 {
-		for _, ambariServerEntry := range ambariServers {
-			if ambariServerEntry.Active {
-				result = ambariServerEntry
-			}
+	activeCount := 0
+	for _, ambariServerEntry := range ambariServers {
+		if ambariServerEntry.Active {
+			result = ambariServerEntry
+			activeCount++
 		}
 	}
-	return result
+	if activeCount == 0 {
+		return result, ErrNoActiveAmbari
+	}
+	if activeCount > 1 {
+		return AmbariRegistry{}, ErrMultipleActiveAmbari
+	}
+	result, err := result.SelectCluster(selectedCluster)
+	if err != nil {
+		return AmbariRegistry{}, err
+	}
+	return resolvePassword(result)
+}
+
+// resolvePassword get the password of the registry entry with the password command or by decrypting the stored password
+func resolvePassword(ambariRegistry AmbariRegistry) (AmbariRegistry, error) {
+	if len(ambariRegistry.PasswordCommand) > 0 {
+		debugPrintln(fmt.Sprintf("Resolve the password of '%s' with the password command", ambariRegistry.Name))
+		password, err := RunPasswordCommand(ambariRegistry.PasswordCommand)
+		if err != nil {
+			return AmbariRegistry{}, err
+		}
+		ambariRegistry.Password = password
+		ambariRegistry.PasswordEncrypted = false
+	} else if ambariRegistry.PasswordEncrypted {
+		password, err := DecryptPassword(ambariRegistry.Password)
+		if err != nil {
+			return AmbariRegistry{}, fmt.Errorf("Ambari server entry '%s': %v", ambariRegistry.Name, err)
+		}
+		ambariRegistry.Password = password
+		ambariRegistry.PasswordEncrypted = false
+	}
+	return ambariRegistry, nil
+}
+
+// decryptPasswords decrypt the stored (ssh and become) passwords of the connection profile
+func (c ConnectionProfile) decryptPasswords() (ConnectionProfile, error) {
+	var err error
+	if c.PasswordEncrypted {
+		if c.Password, err = DecryptPassword(c.Password); err != nil {
+			return ConnectionProfile{}, fmt.Errorf("Connection profile '%s': %v", c.Name, err)
+		}
+		c.PasswordEncrypted = false
+	}
+	if c.BecomePasswordEncrypted {
+		if c.BecomePassword, err = DecryptPassword(c.BecomePassword); err != nil {
+			return ConnectionProfile{}, fmt.Errorf("Connection profile '%s': %v", c.Name, err)
+		}
+		c.BecomePasswordEncrypted = false
+	}
+	return c, nil
 }
 
 // GetAmbariById get the ambari registry from ambarictl database by id
@@ -205,8 +491,14 @@ func GetConnectionProfileById(searchId string) ConnectionProfile {
 	return result
 }
 
-// SetProfileIdForAmbariEntry attach a connection profile to a specific ambari server entry
-func SetProfileIdForAmbariEntry(ambariEntryId string, profileId string) {
+// SetProfileIdForAmbariEntry attach a connection profile to a specific ambari server entry, returns error if the entry or the profile does not exist
+func SetProfileIdForAmbariEntry(ambariEntryId string, profileId string) error {
+	if len(GetAmbariEntryId(ambariEntryId)) == 0 {
+		return fmt.Errorf("Not found Ambari server registry with id '%s'", ambariEntryId)
+	}
+	if len(GetConnectionProfileEntryId(profileId)) == 0 {
+		return fmt.Errorf("Not found connection profile with id '%s'", profileId)
+	}
 	ambariServers := ListAmbariRegistryEntries()
 	if len(ambariServers) > 0 {
 		for index := range ambariServers {
@@ -216,27 +508,29 @@ func SetProfileIdForAmbariEntry(ambariEntryId string, profileId string) {
 		}
 	}
 	WriteAmbariServerEntries(ambariServers)
+	return nil
 }
 
-// ActiveAmbariRegistry turn on active status on selected ambari registry
-func ActiveAmbariRegistry(id string) {
-	checkId := GetAmbariEntryId(id)
-	if len(checkId) == 0 {
-		alreadyExistMsg := fmt.Sprintf("Not found Ambari server registry  with id '%s'.", checkId)
-		fmt.Println(alreadyExistMsg)
-		os.Exit(1)
+// SetActiveAmbari turn on active status on the selected ambari registry and turn it off on every other entry
+func SetActiveAmbari(id string) error {
+	if len(GetAmbariEntryId(id)) == 0 {
+		return fmt.Errorf("Not found Ambari server registry with id '%s'", id)
 	}
 	ambariServers := ListAmbariRegistryEntries()
-	if len(ambariServers) > 0 {
-		for index := range ambariServers {
-			if ambariServers[index].Name == id {
-				ambariServers[index].Active = true
-			} else {
-				ambariServers[index].Active = false
-			}
-		}
+	for index := range ambariServers {
+		ambariServers[index].Active = ambariServers[index].Name == id
 	}
 	WriteAmbariServerEntries(ambariServers)
+	return nil
+}
+
+// ActiveAmbariRegistry turn on active status on selected ambari registry
+func ActiveAmbariRegistry(id string) {
+	err := SetActiveAmbari(id)
+	if err != nil {
+		errPrintln(err.Error() + ".")
+		os.Exit(1)
+	}
 }
 
 // DeactiveAllAmbariRegistry turn off active status on all ambari registries
@@ -250,18 +544,43 @@ func DeactiveAllAmbariRegistry() {
 	WriteAmbariServerEntries(ambariServers)
 }
 
-// WriteAmbariServerEntries write ambari server entries to the ambari server registry json file
+// WriteAmbariServerEntries write ambari server entries to the ambari server registry json file (passwords are encrypted if a secret is configured)
 func WriteAmbariServerEntries(ambariServers []AmbariRegistry) {
-	ambariServerJson, _ := json.Marshal(ambariServers)
+	encryptedAmbariServers := make([]AmbariRegistry, 0)
+	for _, ambariServer := range ambariServers {
+		if !ambariServer.PasswordEncrypted {
+			password, encrypted, err := EncryptPassword(ambariServer.Password)
+			checkErr(err)
+			ambariServer.Password, ambariServer.PasswordEncrypted = password, encrypted
+		}
+		encryptedAmbariServers = append(encryptedAmbariServers, ambariServer)
+	}
+	ambariServerJson, _ := json.Marshal(encryptedAmbariServers)
 	ambariServerJsonFile := getJsonDbFile(ambariServerJsonFileName)
+	debugPrintln(fmt.Sprintf("Write %d entries to %s", len(ambariServers), ambariServerJsonFile))
 	err := ioutil.WriteFile(ambariServerJsonFile, FormatJson(ambariServerJson).Bytes(), 0600)
 	checkErr(err)
 }
 
-// WriteConnectionProfileEntries write connection profile entries to the connection profile registry json file
+// WriteConnectionProfileEntries write connection profile entries to the connection profile registry json file (passwords are encrypted if a secret is configured)
 func WriteConnectionProfileEntries(connectionProfiles []ConnectionProfile) {
-	connectionProfilesJson, _ := json.Marshal(connectionProfiles)
+	encryptedConnectionProfiles := make([]ConnectionProfile, 0)
+	for _, connectionProfile := range connectionProfiles {
+		if !connectionProfile.PasswordEncrypted {
+			password, encrypted, err := EncryptPassword(connectionProfile.Password)
+			checkErr(err)
+			connectionProfile.Password, connectionProfile.PasswordEncrypted = password, encrypted
+		}
+		if !connectionProfile.BecomePasswordEncrypted {
+			becomePassword, encrypted, err := EncryptPassword(connectionProfile.BecomePassword)
+			checkErr(err)
+			connectionProfile.BecomePassword, connectionProfile.BecomePasswordEncrypted = becomePassword, encrypted
+		}
+		encryptedConnectionProfiles = append(encryptedConnectionProfiles, connectionProfile)
+	}
+	connectionProfilesJson, _ := json.Marshal(encryptedConnectionProfiles)
 	connectionProfilesJsonFile := getJsonDbFile(connectionProfilesJsonFileName)
+	debugPrintln(fmt.Sprintf("Write %d entries to %s", len(connectionProfiles), connectionProfilesJsonFile))
 	err := ioutil.WriteFile(connectionProfilesJsonFile, FormatJson(connectionProfilesJson).Bytes(), 0600)
 	checkErr(err)
 }
@@ -271,19 +590,21 @@ func FormatJson(b []byte) *bytes.Buffer {
 	var out bytes.Buffer
 	err := json.Indent(&out, b, "", "    ")
 	if err != nil {
-		fmt.Println(err)
+		errPrintln(err)
 		os.Exit(1)
 	}
 	return &out
 }
 
 func getJsonDbFile(file string) string {
-	usr, err := user.Current()
-	if err != nil {
-		panic(err)
+	ambariManagerFolder := dbFolder
+	if len(ambariManagerFolder) == 0 {
+		usr, err := user.Current()
+		if err != nil {
+			panic(err)
+		}
+		ambariManagerFolder = path.Join(usr.HomeDir, ".ambarictl")
 	}
-	home := usr.HomeDir
-	ambariManagerFolder := path.Join(home, ".ambarictl")
 	if _, err := os.Stat(ambariManagerFolder); os.IsNotExist(err) {
 		os.Mkdir(ambariManagerFolder, os.ModePerm)
 	}
@@ -302,7 +623,7 @@ func exists(name string) bool {
 
 func checkErr(err error) {
 	if err != nil {
-		fmt.Println(err)
+		errPrintln(err)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,212 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// RegistryExport holds every ambarictl registry entry, so they can be moved to another machine (or backed up)
+type RegistryExport struct {
+	AmbariServers      []AmbariRegistry    `json:"ambari_servers" yaml:"ambari_servers"`
+	ConnectionProfiles []ConnectionProfile `json:"connection_profiles" yaml:"connection_profiles"`
+	Environments       []Environment       `json:"environments" yaml:"environments"`
+	// PassphraseProtected is set if the passwords are encrypted with an export passphrase (instead of the secret of the exporting machine)
+	PassphraseProtected bool `json:"passphrase_protected,omitempty" yaml:"passphrase_protected,omitempty"`
+}
+
+// ExportRegistry write the ambari server entries, connection profiles and environments to a yaml (or json if the file has .json extension) file,
+// passwords are excluded unless includePasswords is set, then they are encrypted with the passphrase (if it is not empty),
+// or they are exported as they are stored (encrypted if a secret is configured, so the same secret is needed for the import)
+func ExportRegistry(path string, includePasswords bool, passphrase string) error {
+	export := RegistryExport{AmbariServers: make([]AmbariRegistry, 0), ConnectionProfiles: make([]ConnectionProfile, 0), Environments: ListEnvironmentEntries(),
+		PassphraseProtected: includePasswords && len(passphrase) > 0}
+	var err error
+	for _, ambariServer := range ListAmbariRegistryEntries() {
+		if !includePasswords {
+			ambariServer.Password, ambariServer.PasswordEncrypted = "", false
+		} else if export.PassphraseProtected {
+			if ambariServer.Password, ambariServer.PasswordEncrypted, err = reencryptPassword(ambariServer.Password, ambariServer.PasswordEncrypted, passphrase); err != nil {
+				return fmt.Errorf("Ambari server entry '%s': %v", ambariServer.Name, err)
+			}
+		}
+		export.AmbariServers = append(export.AmbariServers, ambariServer)
+	}
+	for _, connectionProfile := range ListConnectionProfileEntries() {
+		if !includePasswords {
+			connectionProfile.Password, connectionProfile.PasswordEncrypted = "", false
+			connectionProfile.BecomePassword, connectionProfile.BecomePasswordEncrypted = "", false
+		} else if export.PassphraseProtected {
+			if connectionProfile.Password, connectionProfile.PasswordEncrypted, err = reencryptPassword(connectionProfile.Password, connectionProfile.PasswordEncrypted, passphrase); err != nil {
+				return fmt.Errorf("Connection profile '%s': %v", connectionProfile.Name, err)
+			}
+			if connectionProfile.BecomePassword, connectionProfile.BecomePasswordEncrypted, err = reencryptPassword(connectionProfile.BecomePassword, connectionProfile.BecomePasswordEncrypted, passphrase); err != nil {
+				return fmt.Errorf("Connection profile '%s': %v", connectionProfile.Name, err)
+			}
+		}
+		export.ConnectionProfiles = append(export.ConnectionProfiles, connectionProfile)
+	}
+	var content []byte
+	if isJsonFile(path) {
+		content, err = json.Marshal(export)
+		if err == nil {
+			content = FormatJson(content).Bytes()
+		}
+	} else {
+		content, err = yaml.Marshal(export)
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0600)
+}
+
+// ImportRegistry read the entries of an exported registry file and add them to the ambarictl database,
+// existing entries with the same names are replaced, if an imported ambari server entry is active, it becomes the only active one.
+// The passphrase is needed if the passwords were exported with a passphrase, otherwise they need to be encrypted with the configured secret
+func ImportRegistry(path string, passphrase string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var export RegistryExport
+	if isJsonFile(path) {
+		err = json.Unmarshal(content, &export)
+	} else {
+		err = yaml.Unmarshal(content, &export)
+	}
+	if err != nil {
+		return fmt.Errorf("Cannot parse registry export '%s': %v", path, err)
+	}
+	for index, ambariServer := range export.AmbariServers {
+		if len(ambariServer.Name) == 0 {
+			return fmt.Errorf("Ambari server entry #%d of '%s' has no name", index+1, path)
+		}
+		password, err := importPassword(ambariServer.Password, ambariServer.PasswordEncrypted, export.PassphraseProtected, passphrase)
+		if err != nil {
+			return fmt.Errorf("Cannot import the password of ambari server entry '%s' from '%s': %v", ambariServer.Name, path, err)
+		}
+		export.AmbariServers[index].Password = password
+		if export.PassphraseProtected {
+			export.AmbariServers[index].PasswordEncrypted = false
+		}
+	}
+	for index, connectionProfile := range export.ConnectionProfiles {
+		if len(connectionProfile.Name) == 0 {
+			return fmt.Errorf("Connection profile #%d of '%s' has no name", index+1, path)
+		}
+		password, err := importPassword(connectionProfile.Password, connectionProfile.PasswordEncrypted, export.PassphraseProtected, passphrase)
+		if err != nil {
+			return fmt.Errorf("Cannot import the password of connection profile '%s' from '%s': %v", connectionProfile.Name, path, err)
+		}
+		becomePassword, err := importPassword(connectionProfile.BecomePassword, connectionProfile.BecomePasswordEncrypted, export.PassphraseProtected, passphrase)
+		if err != nil {
+			return fmt.Errorf("Cannot import the become password of connection profile '%s' from '%s': %v", connectionProfile.Name, path, err)
+		}
+		export.ConnectionProfiles[index].Password, export.ConnectionProfiles[index].BecomePassword = password, becomePassword
+		if export.PassphraseProtected {
+			export.ConnectionProfiles[index].PasswordEncrypted, export.ConnectionProfiles[index].BecomePasswordEncrypted = false, false
+		}
+	}
+
+	importActive := false
+	importedAmbariServers := make(map[string]bool)
+	for _, ambariServer := range export.AmbariServers {
+		importedAmbariServers[ambariServer.Name] = true
+		importActive = importActive || ambariServer.Active
+	}
+	ambariServers := make([]AmbariRegistry, 0)
+	for _, ambariServer := range ListAmbariRegistryEntries() {
+		if !importedAmbariServers[ambariServer.Name] {
+			ambariServer.Active = ambariServer.Active && !importActive
+			ambariServers = append(ambariServers, ambariServer)
+		}
+	}
+	WriteAmbariServerEntries(append(ambariServers, export.AmbariServers...))
+
+	importedConnectionProfiles := make(map[string]bool)
+	for _, connectionProfile := range export.ConnectionProfiles {
+		importedConnectionProfiles[connectionProfile.Name] = true
+	}
+	connectionProfiles := make([]ConnectionProfile, 0)
+	for _, connectionProfile := range ListConnectionProfileEntries() {
+		if !importedConnectionProfiles[connectionProfile.Name] {
+			connectionProfiles = append(connectionProfiles, connectionProfile)
+		}
+	}
+	WriteConnectionProfileEntries(append(connectionProfiles, export.ConnectionProfiles...))
+
+	importedEnvironments := make(map[string]bool)
+	for _, environment := range export.Environments {
+		importedEnvironments[environment.Name] = true
+	}
+	environments := make([]Environment, 0)
+	for _, environment := range ListEnvironmentEntries() {
+		if !importedEnvironments[environment.Name] {
+			environments = append(environments, environment)
+		}
+	}
+	WriteEnvironmentEntries(append(environments, export.Environments...))
+	outPrintln(fmt.Sprintf("Imported %d ambari server entries, %d connection profiles and %d environments from %s",
+		len(export.AmbariServers), len(export.ConnectionProfiles), len(export.Environments), path))
+	return nil
+}
+
+// reencryptPassword decrypt a stored password (if it is encrypted) and encrypt it with the export passphrase
+func reencryptPassword(password string, encrypted bool, passphrase string) (string, bool, error) {
+	if len(password) == 0 {
+		return password, false, nil
+	}
+	if encrypted {
+		var err error
+		if password, err = DecryptPassword(password); err != nil {
+			return "", false, err
+		}
+	}
+	password, err := encryptWithSecret(password, passphrase)
+	return password, err == nil, err
+}
+
+// importPassword get the password of an imported entry: the passwords of passphrase protected exports are decrypted
+// (they are encrypted with the configured secret when they are stored), other encrypted passwords are checked with the configured secret
+func importPassword(password string, encrypted bool, passphraseProtected bool, passphrase string) (string, error) {
+	if !encrypted {
+		return password, nil
+	}
+	if passphraseProtected {
+		if len(passphrase) == 0 {
+			return "", errors.New("the passwords are encrypted with an export passphrase, provide it with --passphrase")
+		}
+		decrypted, err := decryptWithSecret(password, passphrase)
+		if err != nil {
+			return "", errors.New("wrong passphrase")
+		}
+		return decrypted, nil
+	}
+	if _, err := DecryptPassword(password); err != nil {
+		return "", fmt.Errorf("%v (the export was encrypted with a different secret, export it again with --passphrase)", err)
+	}
+	return password, nil
+}
+
+func isJsonFile(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".json"
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// registerExportEntries register an ambari server entry, a connection profile and an environment for the export tests
+func registerExportEntries(t *testing.T) {
+	resetDb(t)
+	registerTestEntry(t, "server1")
+	if err := SetActiveAmbari("server1"); err != nil {
+		t.Fatal(err)
+	}
+	err := RegisterNewConnectionProfile("profile1", "/keys/id_rsa", 22, "root", "ssh-pass", "", false, "", []string{"aes128-cbc"}, nil, nil, 2, true, "sudo-pass", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetProfileIdForAmbariEntry("server1", "profile1"); err != nil {
+		t.Fatal(err)
+	}
+	RegisterNewEnvironment("env1", "server1", "profile1")
+}
+
+// decryptedEntries get the registry entries with decrypted passwords, so entries from different secrets can be compared
+func decryptedEntries(t *testing.T) ([]AmbariRegistry, []ConnectionProfile, []Environment) {
+	ambariServers := ListAmbariRegistryEntries()
+	for index := range ambariServers {
+		var err error
+		if ambariServers[index], err = resolvePassword(ambariServers[index]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	connectionProfiles := ListConnectionProfileEntries()
+	for index := range connectionProfiles {
+		var err error
+		if connectionProfiles[index], err = connectionProfiles[index].decryptPasswords(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ambariServers, connectionProfiles, ListEnvironmentEntries()
+}
+
+func assertSameEntries(t *testing.T, expectedServers []AmbariRegistry, expectedProfiles []ConnectionProfile, expectedEnvironments []Environment) {
+	ambariServers, connectionProfiles, environments := decryptedEntries(t)
+	if !reflect.DeepEqual(ambariServers, expectedServers) {
+		t.Errorf("ambari server entries differ after import:\n%+v\n%+v", ambariServers, expectedServers)
+	}
+	if !reflect.DeepEqual(connectionProfiles, expectedProfiles) {
+		t.Errorf("connection profiles differ after import:\n%+v\n%+v", connectionProfiles, expectedProfiles)
+	}
+	if !reflect.DeepEqual(environments, expectedEnvironments) {
+		t.Errorf("environments differ after import:\n%+v\n%+v", environments, expectedEnvironments)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, file := range []string{"registry.yml", "registry.json"} {
+		useSecret(t, "my-secret")
+		registerExportEntries(t)
+		servers, profiles, environments := decryptedEntries(t)
+		path := filepath.Join(t.TempDir(), file)
+		if err := ExportRegistry(path, true, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		resetDb(t)
+		if err := ImportRegistry(path, ""); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		assertSameEntries(t, servers, profiles, environments)
+	}
+}
+
+func TestExportWithoutPasswords(t *testing.T) {
+	registerExportEntries(t)
+	path := filepath.Join(t.TempDir(), "registry.yml")
+	if err := ExportRegistry(path, false, ""); err != nil {
+		t.Fatal(err)
+	}
+	resetDb(t)
+	if err := ImportRegistry(path, ""); err != nil {
+		t.Fatal(err)
+	}
+	if server := GetAmbariById("server1"); len(server.Password) > 0 || server.Hostname != "ambari.example.com" {
+		t.Errorf("unexpected imported entry: %+v", server)
+	}
+	if profile := GetConnectionProfileById("profile1"); len(profile.Password) > 0 || len(profile.BecomePassword) > 0 || profile.KeyPath != "/keys/id_rsa" {
+		t.Errorf("unexpected imported profile: %+v", profile)
+	}
+}
+
+func TestImportWithDifferentSecret(t *testing.T) {
+	useSecret(t, "exporter-secret")
+	registerExportEntries(t)
+	servers, profiles, environments := decryptedEntries(t)
+	dir := t.TempDir()
+	withSecret, withPassphrase := filepath.Join(dir, "secret.yml"), filepath.Join(dir, "passphrase.yml")
+	if err := ExportRegistry(withSecret, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExportRegistry(withPassphrase, true, "my-passphrase"); err != nil {
+		t.Fatal(err)
+	}
+
+	useSecret(t, "importer-secret")
+	resetDb(t)
+	if err := ImportRegistry(withSecret, ""); err == nil || !strings.Contains(err.Error(), "--passphrase") {
+		t.Errorf("expected an error about the different secret, got %v", err)
+	}
+	if err := ImportRegistry(withPassphrase, ""); err == nil || !strings.Contains(err.Error(), "--passphrase") {
+		t.Errorf("expected an error about the missing passphrase, got %v", err)
+	}
+	if err := ImportRegistry(withPassphrase, "wrong"); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("expected a wrong passphrase error, got %v", err)
+	}
+	if len(ListAmbariRegistryEntries()) != 0 {
+		t.Error("entries are imported from a failed import")
+	}
+	if err := ImportRegistry(withPassphrase, "my-passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	assertSameEntries(t, servers, profiles, environments)
+	if GetAmbariById("server1").Password == servers[0].Password || !GetAmbariById("server1").PasswordEncrypted {
+		t.Error("the imported password is not encrypted with the secret of the importer")
+	}
+}
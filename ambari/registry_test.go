@@ -0,0 +1,323 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func registerTestEntry(t *testing.T, id string) {
+	if err := RegisterNewAmbariEntry(id, "ambari.example.com", 8080, "http", "admin", "admin", "", "cl1", nil, false, "", 0); err != nil {
+		t.Fatalf("cannot register '%s': %v", id, err)
+	}
+}
+
+func TestRegistryEntryWithQuoteInId(t *testing.T) {
+	resetDb(t)
+	registerTestEntry(t, "a'b")
+
+	if id := GetAmbariEntryId("a'b"); id != "a'b" {
+		t.Fatalf("expected to find entry a'b, got '%s'", id)
+	}
+	entry := GetAmbariById("a'b")
+	if entry.Name != "a'b" || entry.Hostname != "ambari.example.com" {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+	if err := RegisterNewAmbariEntry("a'b", "other.example.com", 8080, "http", "admin", "admin", "", "cl1", nil, false, "", 0); err == nil {
+		t.Error("expected the second registration of a'b to be rejected")
+	}
+	if GetAmbariById("a'b").Hostname != "ambari.example.com" {
+		t.Error("the rejected registration changed the entry")
+	}
+	if err := DeleteAmbariRegistryEntry("a'b"); err != nil {
+		t.Fatalf("cannot delete a'b: %v", err)
+	}
+	if len(GetAmbariEntryId("a'b")) > 0 || len(ListAmbariRegistryEntries()) != 0 {
+		t.Error("a'b is not deleted")
+	}
+}
+
+func TestRegisterNewAmbariEntryKeepsActiveEntryOnFailure(t *testing.T) {
+	resetDb(t)
+	registerTestEntry(t, "first")
+	registerTestEntry(t, "second")
+	if active, err := GetActiveAmbari(); err != nil || active.Name != "second" {
+		t.Fatalf("expected the new entry to be the only active one, got %+v, err: %v", active, err)
+	}
+
+	if err := RegisterNewAmbariEntry("first", "other.example.com", 8080, "http", "admin", "admin", "", "cl1", nil, false, "", 0); err == nil {
+		t.Error("expected the duplicated registration to fail")
+	}
+	if err := RegisterNewAmbariEntry("third", "ambari.example.com", 8080, "ftp", "admin", "admin", "", "cl1", nil, false, "", 0); err == nil {
+		t.Error("expected the registration with an invalid protocol to fail")
+	}
+
+	if active, err := GetActiveAmbari(); err != nil || active.Name != "second" {
+		t.Errorf("expected the active entry to be kept after the failed registrations, got %+v, err: %v", active, err)
+	}
+}
+
+func TestRegisterOrUpdateAmbariEntry(t *testing.T) {
+	resetDb(t)
+	registerTestEntry(t, "other")
+	created, err := RegisterOrUpdateAmbariEntry("test", "ambari.example.com", 8080, "http", "admin", "", "echo secret", "cl1", nil, false, "", 0)
+	if err != nil || !created {
+		t.Fatalf("expected a new entry, created: %v, err: %v", created, err)
+	}
+	if err := SetActiveAmbari("other"); err != nil {
+		t.Fatal(err)
+	}
+
+	created, err = RegisterOrUpdateAmbariEntry("test", "new.example.com", 8443, "https", "operator", "pass", "", "cl2", []string{"server1"}, true, "", 30)
+	if err != nil || created {
+		t.Fatalf("expected the entry to be updated, created: %v, err: %v", created, err)
+	}
+	entries := ListAmbariRegistryEntries()
+	if len(entries) != 2 {
+		t.Fatalf("expected no new entry for the update: %+v", entries)
+	}
+	entry := GetAmbariById("test")
+	if entry.Hostname != "new.example.com" || entry.Port != 8443 || entry.Protocol != "https" || entry.Username != "operator" || entry.Cluster != "cl2" ||
+		len(entry.ServerHosts) != 1 || !entry.InsecureTLS || entry.RequestTimeout != 30 {
+		t.Errorf("the fields of the entry are not updated: %+v", entry)
+	}
+	if entry.Password != "pass" || len(entry.PasswordCommand) > 0 {
+		t.Errorf("expected the password to replace the password command: %+v", entry)
+	}
+	for _, entry := range entries {
+		if entry.Active != (entry.Name == "test") {
+			t.Errorf("expected the updated entry to be the only active one, active flag of %s: %v", entry.Name, entry.Active)
+		}
+	}
+
+	if err := RegisterNewAmbariEntry("test", "other.example.com", 8080, "http", "admin", "admin", "", "cl1", nil, false, "", 0); err == nil ||
+		err.Error() != "Registry with id 'test' is already defined as a registry entry" {
+		t.Errorf("expected an already exists error without upsert, got: %v", err)
+	}
+	if GetAmbariById("test").Hostname != "new.example.com" {
+		t.Error("the registration without upsert changed the entry")
+	}
+}
+
+func TestDeleteAmbariRegistryEntry(t *testing.T) {
+	resetDb(t)
+	registerTestEntry(t, "first")
+	registerTestEntry(t, "second")
+
+	if err := DeleteAmbariRegistryEntry("missing"); err == nil {
+		t.Error("expected an error for a missing entry")
+	}
+	if err := DeleteAmbariRegistryEntry("first"); err != nil {
+		t.Fatalf("cannot delete first: %v", err)
+	}
+	entries := ListAmbariRegistryEntries()
+	if len(entries) != 1 || entries[0].Name != "second" {
+		t.Errorf("expected only the second entry to be kept: %+v", entries)
+	}
+}
+
+func TestSetActiveAmbari(t *testing.T) {
+	resetDb(t)
+	registerTestEntry(t, "first")
+	registerTestEntry(t, "second")
+
+	if err := SetActiveAmbari("missing"); err == nil {
+		t.Error("expected an error for a missing entry")
+	}
+	if active, err := GetActiveAmbari(); err != nil || active.Name != "second" {
+		t.Errorf("the failed switch changed the active entry: %+v, err: %v", active, err)
+	}
+	if err := SetActiveAmbari("first"); err != nil {
+		t.Fatalf("cannot activate first: %v", err)
+	}
+	for _, entry := range ListAmbariRegistryEntries() {
+		if entry.Active != (entry.Name == "first") {
+			t.Errorf("unexpected active flag of %s: %v", entry.Name, entry.Active)
+		}
+	}
+}
+
+func TestGetActiveAmbariWithoutExactlyOneActiveEntry(t *testing.T) {
+	resetDb(t)
+	if _, err := GetActiveAmbari(); err != ErrNoActiveAmbari {
+		t.Errorf("expected ErrNoActiveAmbari for an empty registry, got: %v", err)
+	}
+	registerTestEntry(t, "first")
+	registerTestEntry(t, "second")
+	DeactiveAllAmbariRegistry()
+	if _, err := GetActiveAmbari(); err != ErrNoActiveAmbari {
+		t.Errorf("expected ErrNoActiveAmbari without active entries, got: %v", err)
+	}
+	entries := ListAmbariRegistryEntries()
+	for index := range entries {
+		entries[index].Active = true
+	}
+	WriteAmbariServerEntries(entries)
+	if _, err := GetActiveAmbari(); err != ErrMultipleActiveAmbari {
+		t.Errorf("expected ErrMultipleActiveAmbari, got: %v", err)
+	}
+}
+
+func TestMaskPasswordsForJsonOutput(t *testing.T) {
+	resetDb(t)
+	registerTestEntry(t, "first")
+	if err := RegisterNewAmbariEntry("no-password", "ambari.example.com", 8080, "http", "admin", "", "", "cl1", nil, false, "", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := json.Marshal(MaskPasswords(ListAmbariRegistryEntries()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []map[string]interface{}
+	if err := json.Unmarshal(content, &entries); err != nil {
+		t.Fatal(err)
+	}
+	passwords := make(map[string]interface{})
+	for _, entry := range entries {
+		passwords[entry["name"].(string)] = entry["password"]
+	}
+	if passwords["first"] != passwordMask || passwords["no-password"] != "" {
+		t.Errorf("unexpected passwords in the json output: %v", passwords)
+	}
+	if GetAmbariById("first").Password != "admin" {
+		t.Error("the stored password is changed by masking")
+	}
+}
+
+func TestGetActiveAmbariWithSelectedCluster(t *testing.T) {
+	resetDb(t)
+	if err := RegisterNewAmbariEntry("multi", "ambari.example.com", 8080, "http", "admin", "admin", "", "", nil, false, "", 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetSelectedCluster("") })
+
+	SetSelectedCluster("prod")
+	if active, err := GetActiveAmbari(); err != nil || active.Cluster != "prod" {
+		t.Errorf("expected the selected cluster to be used, got %+v, err: %v", active, err)
+	}
+	SetSelectedCluster("")
+	if active, err := GetActiveAmbari(); err != nil || active.Cluster != "" {
+		t.Errorf("expected no cluster without selection, got %+v, err: %v", active, err)
+	}
+
+	resetDb(t)
+	registerTestEntry(t, "pinned")
+	SetSelectedCluster("prod")
+	if _, err := GetActiveAmbari(); err == nil {
+		t.Error("expected an error for selecting a different cluster than the pinned one")
+	}
+}
+
+func TestUpdateAmbariRegistryEntry(t *testing.T) {
+	resetDb(t)
+	registerTestEntry(t, "first")
+	registerTestEntry(t, "second")
+	if err := SetActiveAmbari("first"); err != nil {
+		t.Fatal(err)
+	}
+
+	password := "newpassword"
+	if err := UpdateAmbariRegistryEntry("first", AmbariRegistryUpdate{Password: &password}); err != nil {
+		t.Fatalf("cannot update the password: %v", err)
+	}
+	entry := GetAmbariById("first")
+	if entry.Password != "newpassword" || entry.Port != 8080 || entry.Hostname != "ambari.example.com" || !entry.Active {
+		t.Errorf("expected only the password to be changed: %+v", entry)
+	}
+	port := 9090
+	if err := UpdateAmbariRegistryEntry("first", AmbariRegistryUpdate{Port: &port}); err != nil {
+		t.Fatalf("cannot update the port: %v", err)
+	}
+	entry = GetAmbariById("first")
+	if entry.Port != 9090 || entry.Password != "newpassword" || entry.Cluster != "cl1" || entry.Username != "admin" || !entry.Active {
+		t.Errorf("expected only the port to be changed: %+v", entry)
+	}
+	if other := GetAmbariById("second"); other.Port != 8080 || other.Password != "admin" || other.Active {
+		t.Errorf("the other entry is changed: %+v", other)
+	}
+
+	passwordCommand := "cat /etc/ambari-password"
+	if err := UpdateAmbariRegistryEntry("first", AmbariRegistryUpdate{PasswordCommand: &passwordCommand}); err != nil {
+		t.Fatal(err)
+	}
+	if entry = GetAmbariById("first"); entry.PasswordCommand != passwordCommand || len(entry.Password) > 0 {
+		t.Errorf("expected the password command to replace the password: %+v", entry)
+	}
+
+	if err := UpdateAmbariRegistryEntry("missing", AmbariRegistryUpdate{Password: &password}); err == nil {
+		t.Error("expected an error for a missing entry")
+	}
+	invalidPort := -1
+	if err := UpdateAmbariRegistryEntry("first", AmbariRegistryUpdate{Port: &invalidPort}); err == nil {
+		t.Error("expected an error for an invalid port")
+	}
+	if GetAmbariById("first").Port != 9090 {
+		t.Error("the rejected update changed the entry")
+	}
+}
+
+func TestConnectionProfileEntries(t *testing.T) {
+	resetDb(t)
+	registerTestEntry(t, "ambari")
+	if err := RegisterNewConnectionProfile("keys", "/keys/id_rsa", 2222, "cloudbreak", "", "", false, "", nil, nil, nil, 0, false, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterNewConnectionProfile("password", "", 22, "root", "ssh-pass", "", false, "", nil, nil, nil, 0, false, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterNewConnectionProfile("keys", "/keys/other", 22, "root", "", "", false, "", nil, nil, nil, 0, false, "", "", ""); err == nil {
+		t.Error("expected the second registration of 'keys' to be rejected")
+	}
+	if err := RegisterNewConnectionProfile("noauth", "", 22, "root", "", "", false, "", nil, nil, nil, 0, false, "", "", ""); err == nil {
+		t.Error("expected an error for a profile without authentication")
+	}
+	if profiles := ListConnectionProfileEntries(); len(profiles) != 2 {
+		t.Fatalf("expected 2 profiles, got: %+v", profiles)
+	}
+	if profile := GetConnectionProfileById("keys"); profile.KeyPath != "/keys/id_rsa" || profile.Port != 2222 || profile.Username != "cloudbreak" {
+		t.Errorf("unexpected profile: %+v", profile)
+	}
+	if profile := GetConnectionProfileById("password"); profile.Password != "ssh-pass" {
+		t.Errorf("unexpected password of the profile: %+v", profile)
+	}
+
+	if err := SetProfileIdForAmbariEntry("ambari", "missing"); err == nil {
+		t.Error("expected an error for attaching a missing profile")
+	}
+	if err := SetProfileIdForAmbariEntry("missing", "keys"); err == nil {
+		t.Error("expected an error for attaching a profile to a missing entry")
+	}
+	if profile := GetAmbariById("ambari").ConnectionProfile; len(profile) > 0 {
+		t.Errorf("the failed attach changed the entry: %s", profile)
+	}
+	if err := SetProfileIdForAmbariEntry("ambari", "keys"); err != nil || GetAmbariById("ambari").ConnectionProfile != "keys" {
+		t.Fatalf("cannot attach the profile: %v", err)
+	}
+
+	if err := DeleteConnectionProfile("missing"); err == nil {
+		t.Error("expected an error for deleting a missing profile")
+	}
+	if err := DeleteConnectionProfile("keys"); err != nil {
+		t.Fatal(err)
+	}
+	if len(GetConnectionProfileEntryId("keys")) > 0 || len(GetConnectionProfileEntryId("password")) == 0 {
+		t.Errorf("unexpected profiles after delete: %+v", ListConnectionProfileEntries())
+	}
+	if profile := GetAmbariById("ambari").ConnectionProfile; len(profile) > 0 {
+		t.Errorf("the deleted profile is still attached: %s", profile)
+	}
+}
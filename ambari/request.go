@@ -0,0 +1,179 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// RequestCompleted status of a successfully finished ambari request
+	RequestCompleted = "COMPLETED"
+	// RequestFailed status of a failed ambari request
+	RequestFailed = "FAILED"
+	// RequestAborted status of an aborted ambari request
+	RequestAborted = "ABORTED"
+	// RequestTimedOut status of a timed out ambari request
+	RequestTimedOut = "TIMEDOUT"
+)
+
+var quietRequestProgress bool
+
+const (
+	defaultRequestPollInterval  = 5 * time.Second
+	defaultServiceCheckTimeout  = 10 * time.Minute
+	defaultAmbariCommandTimeout = 30 * time.Minute
+)
+
+// SetQuietRequestProgress do not print the progress of ambari requests while waiting for them
+func SetQuietRequestProgress(quiet bool) {
+	quietRequestProgress = quiet
+}
+
+// GetRequestId obtain the request id from the response of an asynchronous ambari operation (0 if no request was created)
+func GetRequestId(responseBody []byte) (int, error) {
+	if len(responseBody) == 0 {
+		return 0, nil
+	}
+	var requestResponse RequestResponse
+	if err := json.Unmarshal(responseBody, &requestResponse); err != nil {
+		return 0, err
+	}
+	return int(requestResponse.Request.ID), nil
+}
+
+// GetRequest obtain the status and the progress of an ambari request
+func (a AmbariRegistry) GetRequest(requestId int) (Request, error) {
+	uriSuffix := fmt.Sprintf("requests/%d?fields=Requests/id,Requests/request_status,Requests/request_context,Requests/progress_percent,"+
+		"Requests/task_count,Requests/completed_task_count,Requests/failed_task_count", requestId)
+	bodyBytes, err := sendRequest(a.CreateGetRequest(uriSuffix, true))
+	if err != nil {
+		return Request{}, err
+	}
+	var requestResponse RequestResponse
+	if err := json.Unmarshal(bodyBytes, &requestResponse); err != nil {
+		return Request{}, err
+	}
+	return requestResponse.Request, nil
+}
+
+// GetInProgressRequestTasks obtain the tasks of an ambari request that are actually running
+func (a AmbariRegistry) GetInProgressRequestTasks(requestId int) ([]RequestTask, error) {
+	uriSuffix := fmt.Sprintf("requests/%d/tasks?fields=Tasks/command_detail,Tasks/host_name,Tasks/status&Tasks/status=IN_PROGRESS", requestId)
+	bodyBytes, err := sendRequest(a.CreateGetRequest(uriSuffix, true))
+	if err != nil {
+		return nil, err
+	}
+	var tasksResponse RequestTasksResponse
+	if err := json.Unmarshal(bodyBytes, &tasksResponse); err != nil {
+		return nil, err
+	}
+	tasks := make([]RequestTask, 0)
+	for _, item := range tasksResponse.Items {
+		tasks = append(tasks, item.Task)
+	}
+	return tasks, nil
+}
+
+// WaitForRequest poll an ambari request until it is finished or the timeout is reached, returns error if the request was not completed successfully
+// (or the context is cancelled)
+func (a AmbariRegistry) WaitForRequest(ctx context.Context, requestId int, timeout time.Duration) (Request, error) {
+	deadline := time.Now().Add(timeout)
+	lastProgress := ""
+	for {
+		request, err := a.GetRequest(requestId)
+		if err != nil {
+			return request, err
+		}
+		if !quietRequestProgress {
+			lastProgress = a.printRequestProgress(request, lastProgress)
+		}
+		switch request.Status {
+		case RequestCompleted:
+			return request, nil
+		case RequestFailed, RequestAborted, RequestTimedOut:
+			return request, fmt.Errorf("Request %d (%s) finished with status: %s", requestId, request.Context, request.Status)
+		}
+		if time.Now().After(deadline) {
+			return request, fmt.Errorf("Timed out waiting for request %d (%s), last status: %s", requestId, request.Context, request.Status)
+		}
+		if err := sleepWithContext(ctx, defaultRequestPollInterval); err != nil {
+			return request, err
+		}
+	}
+}
+
+// WaitForOperation wait for the ambari request that was created by an asynchronous operation (based on the response of the operation),
+// returns an empty request if no request was created (e.g. the service is already in the requested state)
+func (a AmbariRegistry) WaitForOperation(ctx context.Context, responseBody []byte, timeout time.Duration) (Request, error) {
+	requestId, err := GetRequestId(responseBody)
+	if err != nil || requestId == 0 {
+		return Request{}, err
+	}
+	return a.WaitForRequest(ctx, requestId, timeout)
+}
+
+// sleepWithContext wait for the duration, returns the error of the context if it is cancelled earlier
+func sleepWithContext(ctx context.Context, duration time.Duration) error {
+	select {
+	case <-time.After(duration):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// printRequestProgress print the progress of an ambari request (if it has been changed since the last poll)
+func (a AmbariRegistry) printRequestProgress(request Request, lastProgress string) string {
+	progress := fmt.Sprintf("[request %d] %s: %.0f%% (%d/%d tasks completed", int(request.ID), request.Context,
+		request.ProgressPercent, int(request.CompletedTaskCount), int(request.TaskCount))
+	if request.FailedTaskCount > 0 {
+		progress += fmt.Sprintf(", %d failed", int(request.FailedTaskCount))
+	}
+	progress += ")"
+	if request.Status != RequestCompleted {
+		if tasks, err := a.GetInProgressRequestTasks(int(request.ID)); err == nil {
+			for _, task := range tasks {
+				progress += fmt.Sprintf("\n  - %s (%s)", task.CommandDetail, task.HostName)
+			}
+		}
+	}
+	if progress != lastProgress {
+		outPrintln(progress)
+	}
+	return progress
+}
+
+// ServiceCheck runs the service check of an ambari service and waits until it finishes
+func (a AmbariRegistry) ServiceCheck(ctx context.Context, service string, timeout time.Duration) error {
+	requestId, err := GetRequestId(a.CheckService(service))
+	if err != nil {
+		return err
+	}
+	if requestId == 0 {
+		return errors.New("No request has been created for service check of " + service)
+	}
+	outPrintln(fmt.Sprintf("Service check of %s has been started (request id: %d)", service, requestId))
+	_, err = a.WaitForRequest(ctx, requestId, timeout)
+	if err != nil {
+		return err
+	}
+	outPrintln(fmt.Sprintf("Service check of %s has been passed", service))
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetRequestId(t *testing.T) {
+	if id, err := GetRequestId([]byte(`{"href": "x", "Requests": {"id": 42, "status": "Accepted"}}`)); err != nil || id != 42 {
+		t.Errorf("unexpected request id: %d, err: %v", id, err)
+	}
+	if id, err := GetRequestId(nil); err != nil || id != 0 {
+		t.Errorf("expected no request for an empty response: %d, err: %v", id, err)
+	}
+	if _, err := GetRequestId([]byte("not json")); err == nil {
+		t.Error("expected an error for an invalid response")
+	}
+}
+
+func TestAmbariCommandTaskWaitsForRequests(t *testing.T) {
+	ambariRegistry, requests := newFakeAmbari(t, map[string][]string{"host1": {"HDFS_DATANODE", "YARN_NODEMANAGER"}}, nil)
+	task := Task{Name: "start", Type: AmbariCommand, Command: "START", ServiceFilter: "HDFS,YARN", Parameters: map[string]string{"timeout": "60"}}
+
+	finished, err := ambariRegistry.ExecuteAmbariCommand(context.Background(), task, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(finished) != 2 || finished[0].Status != RequestCompleted || finished[1].ID != 2 {
+		t.Errorf("unexpected finished requests: %+v", finished)
+	}
+	requests.setStatus(RequestFailed)
+	finished, err = ambariRegistry.ExecuteAmbariCommand(context.Background(), task, nil)
+	if err == nil || !strings.Contains(err.Error(), "finished with status: FAILED") || len(finished) != 1 {
+		t.Errorf("expected the first failed request to stop the task: %+v, err: %v", finished, err)
+	}
+}
+
+func TestWaitForRequestTimesOut(t *testing.T) {
+	ambariRegistry, requests := newFakeAmbari(t, map[string][]string{}, nil)
+	requests.setStatus("IN_PROGRESS")
+
+	start := time.Now()
+	_, err := ambariRegistry.WaitForRequest(context.Background(), 1, 0)
+
+	if err == nil || !strings.Contains(err.Error(), "Timed out waiting for request 1") {
+		t.Errorf("expected a timeout, got: %v", err)
+	}
+	if time.Since(start) >= defaultRequestPollInterval {
+		t.Error("the request is polled again after the timeout")
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/scrypt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	// SecretEnvVariable environment variable that holds the secret for encrypting the stored passwords
+	SecretEnvVariable  = "AMBARI_MANAGER_SECRET"
+	secretKeyFileName  = "secret.key"
+	plainTextPasswords = "No secret is configured (%s environment variable or ~/.ambarictl/%s file), passwords are stored in plain text"
+	// the salt is generated for every encrypted value and stored in front of the nonce
+	secretSaltSize = 16
+)
+
+var plainTextPasswordWarning sync.Once
+
+// derivedKeys caches the keys that are derived from the secret by salts (key derivation is slow on purpose)
+var derivedKeys = make(map[string][]byte)
+var derivedKeysMutex sync.Mutex
+
+// getSecret get the secret for password encryption (from the secret environment variable or the secret key file), empty if there is no secret
+func getSecret() (string, error) {
+	secret := os.Getenv(SecretEnvVariable)
+	if len(secret) == 0 {
+		secretKeyFile := getJsonDbFile(secretKeyFileName)
+		if exists(secretKeyFile) {
+			content, err := ioutil.ReadFile(secretKeyFile)
+			if err != nil {
+				return "", err
+			}
+			secret = strings.TrimSpace(string(content))
+		}
+	}
+	return secret, nil
+}
+
+// deriveKey derive an AES-256 key from the secret and the salt with scrypt
+func deriveKey(secret string, salt []byte) ([]byte, error) {
+	derivedKeysMutex.Lock()
+	defer derivedKeysMutex.Unlock()
+	cacheKey := secret + "\x00" + string(salt)
+	if key, ok := derivedKeys[cacheKey]; ok {
+		return key, nil
+	}
+	key, err := scrypt.Key([]byte(secret), salt, 32768, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	derivedKeys[cacheKey] = key
+	return key, nil
+}
+
+// EncryptPassword encrypt a password (AES-GCM with a key derived from the configured secret), returns false if there is no secret,
+// the password is returned as is then (with a one-time warning)
+func EncryptPassword(password string) (string, bool, error) {
+	if len(password) == 0 {
+		return password, false, nil
+	}
+	secret, err := getSecret()
+	if err != nil {
+		return "", false, err
+	}
+	if len(secret) == 0 {
+		plainTextPasswordWarning.Do(func() {
+			errPrintln(fmt.Sprintf(plainTextPasswords, SecretEnvVariable, secretKeyFileName))
+		})
+		return password, false, nil
+	}
+	encrypted, err := encryptWithSecret(password, secret)
+	return encrypted, err == nil, err
+}
+
+// encryptWithSecret encrypt a value with a random salt, the result holds the salt, the nonce and the encrypted value (base64 encoded)
+func encryptWithSecret(value string, secret string) (string, error) {
+	salt := make([]byte, secretSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return "", err
+	}
+	gcm, err := createGcm(secret, salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	encrypted := gcm.Seal(append(salt, nonce...), nonce, []byte(value), nil)
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+// DecryptPassword decrypt a password that was encrypted with the configured secret
+func DecryptPassword(password string) (string, error) {
+	secret, err := getSecret()
+	if err != nil {
+		return "", err
+	}
+	if len(secret) == 0 {
+		return "", errors.New("Cannot decrypt stored password: no secret is configured (" + SecretEnvVariable + " environment variable or ~/.ambarictl/" + secretKeyFileName + " file)")
+	}
+	decrypted, err := decryptWithSecret(password, secret)
+	if err != nil {
+		return "", fmt.Errorf("Cannot decrypt stored password: %v", err)
+	}
+	return decrypted, nil
+}
+
+func decryptWithSecret(value string, secret string) (string, error) {
+	encrypted, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	if len(encrypted) < secretSaltSize {
+		return "", errors.New("invalid encrypted value")
+	}
+	gcm, err := createGcm(secret, encrypted[:secretSaltSize])
+	if err != nil {
+		return "", err
+	}
+	encrypted = encrypted[secretSaltSize:]
+	if len(encrypted) < gcm.NonceSize() {
+		return "", errors.New("invalid encrypted value")
+	}
+	decrypted, err := gcm.Open(nil, encrypted[:gcm.NonceSize()], encrypted[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("wrong secret")
+	}
+	return string(decrypted), nil
+}
+
+func createGcm(secret string, salt []byte) (cipher.AEAD, error) {
+	key, err := deriveKey(secret, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
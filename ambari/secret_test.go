@@ -0,0 +1,100 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// useSecret set the secret of the password encryption until the end of the test
+func useSecret(t *testing.T, secret string) {
+	os.Setenv(SecretEnvVariable, secret)
+	t.Cleanup(func() { os.Unsetenv(SecretEnvVariable) })
+}
+
+func TestEncryptPassword(t *testing.T) {
+	useSecret(t, "my-secret")
+	first, encrypted, err := EncryptPassword("admin")
+	if err != nil || !encrypted {
+		t.Fatalf("expected an encrypted password, got %v (encrypted: %v)", err, encrypted)
+	}
+	second, _, _ := EncryptPassword("admin")
+	if first == second || strings.Contains(first, "admin") {
+		t.Errorf("expected different salted values without the password: %s, %s", first, second)
+	}
+	for _, value := range []string{first, second} {
+		if password, err := DecryptPassword(value); err != nil || password != "admin" {
+			t.Errorf("unexpected decrypted password: %q, err: %v", password, err)
+		}
+	}
+
+	useSecret(t, "other-secret")
+	if _, err := DecryptPassword(first); err == nil {
+		t.Error("expected a decryption error with a wrong secret")
+	}
+	os.Unsetenv(SecretEnvVariable)
+	if _, err := DecryptPassword(first); err == nil {
+		t.Error("expected a decryption error without a secret")
+	}
+	if password, encrypted, err := EncryptPassword("admin"); err != nil || encrypted || password != "admin" {
+		t.Errorf("expected a plain text password without a secret, got %q (encrypted: %v, err: %v)", password, encrypted, err)
+	}
+}
+
+func TestStoredPasswordsAreDecryptedWhenUsed(t *testing.T) {
+	resetDb(t)
+	useSecret(t, "my-secret")
+	registerTestEntry(t, "encrypted")
+	if err := SetActiveAmbari("encrypted"); err != nil {
+		t.Fatal(err)
+	}
+	err := RegisterNewConnectionProfile("profile", "", 22, "root", "ssh-pass", "", false, "", nil, nil, nil, 0, true, "sudo-pass", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{ambariServerJsonFileName, connectionProfilesJsonFileName} {
+		content, err := ioutil.ReadFile(getJsonDbFile(file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(content), "password\": \"admin") || strings.Contains(string(content), "pass\"") || !strings.Contains(string(content), "password_encrypted\": true") {
+			t.Errorf("passwords are not encrypted in %s: %s", file, content)
+		}
+	}
+
+	useSecret(t, "wrong-secret")
+	if entries := ListAmbariRegistryEntries(); len(entries) != 1 || !entries[0].PasswordEncrypted {
+		t.Errorf("expected the encrypted entry to be listed: %+v", entries)
+	}
+	if _, err := GetActiveAmbari(); err == nil || !strings.Contains(err.Error(), "Cannot decrypt") {
+		t.Errorf("expected a decryption error for the active entry, got %v", err)
+	}
+
+	useSecret(t, "my-secret")
+	active, err := GetActiveAmbari()
+	if err != nil || active.Password != "admin" || active.PasswordEncrypted {
+		t.Errorf("unexpected active entry: %+v, err: %v", active, err)
+	}
+	profile, password := GetConnectionProfileWithPassword("profile")
+	if password != "ssh-pass" || profile.BecomePassword != "sudo-pass" {
+		t.Errorf("unexpected profile passwords: %s, %s", password, profile.BecomePassword)
+	}
+	if err := DeleteAmbariRegistryEntry("encrypted"); err != nil {
+		t.Fatal(err)
+	}
+}
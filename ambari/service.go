@@ -0,0 +1,157 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// addServiceComponentPrefix is the prefix of the AddService task parameters that assign a component to hosts (e.g.: component.DATANODE: host1,host2)
+const addServiceComponentPrefix = "component."
+
+// AddService create a service with its components, apply the configs (config type -> properties) and assign the components
+// to the hosts (component -> ambari host names), then install the service, returns the response of the install request
+func (a AmbariRegistry) AddService(service string, componentHosts map[string][]string, configs map[string]map[string]string) ([]byte, error) {
+	if len(componentHosts) == 0 {
+		return nil, fmt.Errorf("At least one component is required for adding service %s", service)
+	}
+	var serviceBody bytes.Buffer
+	serviceBody.WriteString(fmt.Sprintf(`{"ServiceInfo": {"service_name": "%s"}}`, service))
+	ProcessRequest(a.CreatePostRequest(serviceBody, "services", true))
+
+	components := make([]string, 0)
+	for component := range componentHosts {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+	for _, component := range components {
+		ProcessRequest(a.CreatePostRequest(bytes.Buffer{}, fmt.Sprintf("services/%s/components/%s", service, component), true))
+	}
+
+	configTypes := make([]string, 0)
+	for configType := range configs {
+		configTypes = append(configTypes, configType)
+	}
+	sort.Strings(configTypes)
+	for _, configType := range configTypes {
+		desiredConfig := map[string]interface{}{
+			"type":                        configType,
+			"tag":                         fmt.Sprintf("version%d", time.Now().UnixNano()/int64(time.Millisecond)),
+			"properties":                  configs[configType],
+			"service_config_version_note": fmt.Sprintf("AMBARICTL - Add service %s", service),
+		}
+		body, err := json.Marshal(map[string]interface{}{"Clusters": map[string]interface{}{"desired_config": desiredConfig}})
+		if err != nil {
+			return nil, err
+		}
+		var bodyBytes bytes.Buffer
+		bodyBytes.Write(body)
+		ProcessRequest(a.CreatePutRequest(bodyBytes, "", true))
+	}
+
+	for _, component := range components {
+		for _, host := range componentHosts[component] {
+			ProcessRequest(a.CreatePostRequest(bytes.Buffer{}, fmt.Sprintf("hosts/%s/host_components/%s", host, component), true))
+		}
+	}
+	context := fmt.Sprintf("Install %s by ambarictl", service)
+	return ProcessRequest(a.serviceOperation(service, "INSTALLED", context)), nil
+}
+
+// ExecuteAddServiceTask adds a service ('service' parameter) with the components and hosts of the 'component.<COMPONENT>' parameters
+// and the configs of the task ('<config type>/<key>' keys), waits for the installation, then starts the service if 'start' is true
+func (a AmbariRegistry) ExecuteAddServiceTask(ctx context.Context, task Task) ([]Request, error) {
+	requests := make([]Request, 0)
+	service := strings.ToUpper(task.Parameters["service"])
+	timeoutSeconds, err := strconv.Atoi(task.Parameters["timeout"])
+	if err != nil {
+		return requests, fmt.Errorf("'timeout' parameter of '%s' task should be a number: %v", AddService, err)
+	}
+	start, err := strconv.ParseBool(task.Parameters["start"])
+	if err != nil {
+		return requests, fmt.Errorf("'start' parameter of '%s' task should be true or false: %v", AddService, err)
+	}
+	componentHosts, err := getAddServiceComponentHosts(task)
+	if err != nil {
+		return requests, err
+	}
+	configs, err := getConfigsByType(task)
+	if err != nil {
+		return requests, err
+	}
+	timeout := time.Duration(timeoutSeconds) * time.Second
+	wait := func(responseBody []byte) error {
+		request, err := a.WaitForOperation(ctx, responseBody, timeout)
+		if request.ID > 0 {
+			requests = append(requests, request)
+		}
+		return err
+	}
+	outPrintln(fmt.Sprintf("Add service %s (%d components)", service, len(componentHosts)))
+	responseBody, err := a.AddService(service, componentHosts, configs)
+	if err != nil {
+		return requests, err
+	}
+	if err := wait(responseBody); err != nil {
+		return requests, err
+	}
+	if start {
+		return requests, wait(a.StartService(service))
+	}
+	return requests, nil
+}
+
+// getAddServiceComponentHosts get the component -> hosts mapping from the 'component.<COMPONENT>' parameters of an AddService task
+func getAddServiceComponentHosts(task Task) (map[string][]string, error) {
+	componentHosts := make(map[string][]string)
+	for name, value := range task.Parameters {
+		if !strings.HasPrefix(name, addServiceComponentPrefix) {
+			continue
+		}
+		component := strings.ToUpper(strings.TrimPrefix(name, addServiceComponentPrefix))
+		hosts, _ := splitFilterValues(value, false)
+		if len(component) == 0 || len(hosts) == 0 {
+			return nil, fmt.Errorf("'%s' parameter of task '%s' should be a comma separated list of hosts", name, task.Name)
+		}
+		componentHosts[component] = hosts
+	}
+	if len(componentHosts) == 0 {
+		return nil, fmt.Errorf("'%s<COMPONENT>' parameter is required for '%s' task '%s'", addServiceComponentPrefix, AddService, task.Name)
+	}
+	return componentHosts, nil
+}
+
+// getConfigsByType group the configs of a task ('<config type>/<key>' keys) by config types
+func getConfigsByType(task Task) (map[string]map[string]string, error) {
+	configs := make(map[string]map[string]string)
+	for key, value := range task.Configs {
+		parts := strings.SplitN(key, "/", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return nil, fmt.Errorf("Config '%s' of task '%s' should be in <config type>/<key> format", key, task.Name)
+		}
+		if _, ok := configs[parts[0]]; !ok {
+			configs[parts[0]] = make(map[string]string)
+		}
+		configs[parts[0]][parts[1]] = value
+	}
+	return configs, nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestExecuteAddServiceTask(t *testing.T) {
+	ambariRegistry, requests := newFakeAmbari(t, map[string][]string{"host1": {}, "host2": {}}, nil)
+	task := Task{Name: "add zookeeper", Type: AddService, Parameters: map[string]string{"service": "zookeeper", "timeout": "10", "start": "true",
+		"component.ZOOKEEPER_SERVER": "host1,host2", "component.zookeeper_client": "host1"}, Configs: map[string]string{"zoo.cfg/tickTime": "3000"}}
+
+	result, err := ambariRegistry.ExecuteAddServiceTask(context.Background(), task)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 {
+		t.Errorf("expected the install and the start requests, got: %+v", result)
+	}
+	expected := []string{
+		`POST services {"ServiceInfo": {"service_name": "ZOOKEEPER"}}`,
+		"POST services/ZOOKEEPER/components/ZOOKEEPER_CLIENT",
+		"POST services/ZOOKEEPER/components/ZOOKEEPER_SERVER",
+		`PUT  {"Clusters":{"desired_config":{"properties":{"tickTime":"3000"},"service_config_version_note":"AMBARICTL - Add service ZOOKEEPER","tag":"version`,
+		"POST hosts/host1/host_components/ZOOKEEPER_CLIENT",
+		"POST hosts/host1/host_components/ZOOKEEPER_SERVER",
+		"POST hosts/host2/host_components/ZOOKEEPER_SERVER",
+		`PUT services/ZOOKEEPER {"RequestInfo": {"context" : "Install ZOOKEEPER by ambarictl"}, "Body": {"ServiceInfo": {"state": "INSTALLED"}}}`,
+		`PUT services/ZOOKEEPER {"RequestInfo": {"context" : "Start service (ZOOKEEPER) by ambarictl"}, "Body": {"ServiceInfo": {"state": "STARTED"}}}`,
+	}
+	operations := requests.getOperations()
+	if len(operations) != len(expected) {
+		t.Fatalf("unexpected requests:\n%s", strings.Join(operations, "\n"))
+	}
+	for i, operation := range operations {
+		if !strings.HasPrefix(operation, expected[i]) {
+			t.Errorf("request %d: expected %q, got: %q", i, expected[i], operation)
+		}
+	}
+}
+
+func TestExecuteAddServiceTaskWithInvalidParameters(t *testing.T) {
+	ambariRegistry, requests := newFakeAmbari(t, map[string][]string{"host1": {}}, nil)
+	cases := []Task{
+		{Name: "no components", Parameters: map[string]string{"service": "ZOOKEEPER", "timeout": "10", "start": "false"}},
+		{Name: "no hosts", Parameters: map[string]string{"service": "ZOOKEEPER", "timeout": "10", "start": "false", "component.ZOOKEEPER_SERVER": " , "}},
+		{Name: "invalid config", Parameters: map[string]string{"service": "ZOOKEEPER", "timeout": "10", "start": "false", "component.ZOOKEEPER_SERVER": "host1"},
+			Configs: map[string]string{"tickTime": "3000"}},
+		{Name: "invalid start", Parameters: map[string]string{"service": "ZOOKEEPER", "timeout": "10", "start": "yes please", "component.ZOOKEEPER_SERVER": "host1"}},
+	}
+	for _, task := range cases {
+		if _, err := ambariRegistry.ExecuteAddServiceTask(context.Background(), task); err == nil {
+			t.Errorf("expected an error for task '%s'", task.Name)
+		}
+	}
+	if operations := requests.getOperations(); len(operations) > 0 {
+		t.Errorf("expected no requests for invalid tasks, got: %v", operations)
+	}
+}
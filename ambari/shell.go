@@ -0,0 +1,184 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const shellHelp = `Available commands:
+  use <registry>                    select the active ambari server entry
+  filter [services=S1,S2] [components=C1,C2] [hosts=H1,H2] [missing-components=C1,C2] [server]
+                                    set the host filter (without arguments: print the actual filter)
+  hosts                             print the filtered hosts
+  run <command>                     execute a remote command on the filtered hosts
+  command <START|STOP|RESTART|SERVICE_CHECK>
+                                    execute an ambari command on the filtered services or components
+  help                              print this help
+  exit                              leave the shell`
+
+// Shell holds the state of an interactive ambarictl session (selected ambari server and host filter)
+type Shell struct {
+	Ambari AmbariRegistry
+	Filter Filter
+}
+
+// StartShell reads commands from the input line by line and executes them against the active ambari server
+func StartShell(in io.Reader) {
+	ambariServer, err := GetActiveAmbari()
+	if err != nil {
+		outPrintln(err.Error() + ", select one with 'use' command.")
+	}
+	shell := Shell{Ambari: ambariServer}
+	scanner := bufio.NewScanner(in)
+	outPrintln("Type 'help' for the available commands.")
+	for {
+		outPrint(shell.prompt())
+		if !scanner.Scan() {
+			outPrintln()
+			return
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		if line == "exit" || line == "quit" {
+			return
+		}
+		shell.ExecuteLine(line)
+	}
+}
+
+// ExecuteLine executes one shell command
+func (s *Shell) ExecuteLine(line string) {
+	fields := strings.Fields(line)
+	command := fields[0]
+	args := fields[1:]
+	if command == "help" {
+		outPrintln(shellHelp)
+		return
+	}
+	if command == "use" {
+		s.use(args)
+		return
+	}
+	if len(s.Ambari.Name) == 0 {
+		outPrintln("No active ambari server selected. (see 'use' command)")
+		return
+	}
+	switch command {
+	case "filter":
+		s.setFilter(args)
+	case "hosts":
+		for host := range s.Ambari.GetFilteredHosts(s.Filter) {
+			outPrintln(host)
+		}
+	case "run":
+		remoteCommand := strings.TrimSpace(strings.TrimPrefix(line, command))
+		if len(remoteCommand) == 0 {
+			outPrintln("Provide a command to run. e.g.: run hostname")
+			return
+		}
+		hosts := s.Ambari.GetFilteredHosts(s.Filter)
+		s.Ambari.RunRemoteHostCommand(remoteCommand, hosts, s.Filter.Server)
+	case "command":
+		s.runAmbariCommand(args)
+	default:
+		outPrintln(fmt.Sprintf("Unknown command: '%s'. Type 'help' for the available commands.", command))
+	}
+}
+
+func (s *Shell) prompt() string {
+	if len(s.Ambari.Name) > 0 {
+		return fmt.Sprintf("ambarictl (%s)> ", s.Ambari.Name)
+	}
+	return "ambarictl> "
+}
+
+func (s *Shell) use(args []string) {
+	if len(args) == 0 {
+		outPrintln("Provide a server entry name argument for use command. e.g.: use vagrant")
+		return
+	}
+	if err := SetActiveAmbari(args[0]); err != nil {
+		outPrintln(err.Error())
+		return
+	}
+	s.Ambari, _ = GetActiveAmbari()
+	s.Filter = Filter{}
+	outPrintln("Ambari server entry selected with id: " + args[0])
+}
+
+func (s *Shell) setFilter(args []string) {
+	if len(args) == 0 {
+		outPrintln(fmt.Sprintf("services: %v, components: %v, hosts: %v, missing components: %v, server: %v",
+			s.Filter.Services, s.Filter.Components, s.Filter.Hosts, s.Filter.MissingComponents, s.Filter.Server))
+		return
+	}
+	serviceFilter := ""
+	componentFilter := ""
+	hostFilter := ""
+	missingComponentFilter := ""
+	server := false
+	for _, arg := range args {
+		if arg == "server" {
+			server = true
+			continue
+		}
+		keyValue := strings.SplitN(arg, "=", 2)
+		if len(keyValue) != 2 {
+			outPrintln(fmt.Sprintf("Invalid filter argument: '%s'", arg))
+			return
+		}
+		switch keyValue[0] {
+		case "services":
+			serviceFilter = strings.ToUpper(keyValue[1])
+		case "components":
+			componentFilter = strings.ToUpper(keyValue[1])
+		case "hosts":
+			hostFilter = keyValue[1]
+		case "missing-components":
+			missingComponentFilter = strings.ToUpper(keyValue[1])
+		default:
+			outPrintln(fmt.Sprintf("Invalid filter argument: '%s'", arg))
+			return
+		}
+	}
+	filter := CreateFilter(serviceFilter, componentFilter, hostFilter, server)
+	s.Filter = CreateMissingComponentsFilter(filter, missingComponentFilter)
+}
+
+func (s *Shell) runAmbariCommand(args []string) {
+	if len(args) == 0 {
+		outPrintln("Provide an ambari command. e.g.: command RESTART")
+		return
+	}
+	if len(s.Filter.Services) == 0 && len(s.Filter.Components) == 0 {
+		outPrintln("Set a services or components filter first. e.g.: filter components=INFRA_SOLR")
+		return
+	}
+	command := strings.ToUpper(args[0])
+	useComponentFilter := len(s.Filter.Components) > 0
+	useServiceFilter := !useComponentFilter
+	if err := CheckMaintenance(s.Ambari.Name); err != nil {
+		errPrintln(err)
+		return
+	}
+	s.Ambari.RunAmbariServiceCommand(command, s.Filter, useServiceFilter, useComponentFilter)
+	outPrintln(fmt.Sprintf("Command %s has been sent", command))
+}
@@ -15,30 +15,103 @@
 package ambari
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"github.com/appleboy/easyssh-proxy"
 	"os"
 	"path"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
 // RemoteResponse represents an ssh command output
 type RemoteResponse struct {
-	StdOut string
-	StdErr string
-	Done   bool
+	StdOut      string
+	StdErr      string
+	Done        bool
+	Unreachable bool
+	Err         error
+	Attempts    int
+	TimedOut    bool
+	ExitStatus  int
 }
 
-// RunRemoteHostCommand executes bash commands on ambari agent hosts
+var streamOutput bool
+
+// ErrTransferTimeout is returned when a file copy (scp) does not finish in time
+var ErrTransferTimeout = errors.New("file transfer timed out")
+
+var transferTimeout time.Duration
+
+// SetTransferTimeout set the timeout (in seconds) of the file copies to or from the remote hosts, independently of the command timeouts,
+// 0 means no timeout (default)
+func SetTransferTimeout(seconds int) {
+	transferTimeout = time.Duration(seconds) * time.Second
+}
+
+// SetStreamOutput print the output lines of remote commands as they arrive (prefixed with the host, e.g.: 'c7401.ambari.apache.org: line')
+// instead of printing the whole outputs when the commands finish
+func SetStreamOutput(stream bool) {
+	streamOutput = stream
+}
+
+// DefaultParallelism is the maximum number of hosts that are contacted at once by default
+const DefaultParallelism = 10
+
+var parallelism = DefaultParallelism
+
+// SetParallelism limit the number of hosts that are contacted at once (running commands or copying files), values less than 1 set the default
+func SetParallelism(hosts int) {
+	if hosts < 1 {
+		hosts = DefaultParallelism
+	}
+	parallelism = hosts
+}
+
+// newHostLimiter create a limiter for the hosts that are contacted at once (the parallelism of the task if it is set, otherwise the global one)
+func (a AmbariRegistry) newHostLimiter() chan struct{} {
+	if a.parallelism > 0 {
+		return make(chan struct{}, a.parallelism)
+	}
+	return make(chan struct{}, parallelism)
+}
+
+// remoteClient runs commands and copies files on a remote host
+type remoteClient interface {
+	Run(ctx context.Context, command string, timeout int) (string, string, bool, error)
+	RunStreaming(ctx context.Context, command string, timeout int, onLine func(line string, isStderr bool)) (string, string, bool, error)
+	Stream(ctx context.Context, command string, onLine func(line string, isStderr bool)) error
+	Scp(ctx context.Context, sourceFile string, targetFile string) error
+	ScpContent(ctx context.Context, content []byte, targetFile string) error
+	Download(ctx context.Context, sourceFile string, targetFile string) error
+}
+
+// newRemoteClient create the client for a remote host (an ssh client based on the connection profile, tests replace it with fake clients)
+var newRemoteClient = func(connectionProfile ConnectionProfile, password string, host string, skipJump bool) remoteClient {
+	return createSshConfig(connectionProfile, password, host, skipJump)
+}
+
+// RunRemoteHostCommand executes bash commands on ambari agent hosts (it cannot be cancelled, see RunRemoteHostCommandWithRetries)
 func (a AmbariRegistry) RunRemoteHostCommand(command string, filteredHosts map[string]bool, skipJump bool) map[string]RemoteResponse {
+	return a.RunRemoteHostCommandWithRetries(context.Background(), command, filteredHosts, skipJump, 0, 0, DefaultCommandTimeout)
+}
+
+// RunRemoteHostCommandWithRetries executes bash commands on ambari agent hosts, if the command fails on a host (or the host is unreachable),
+// it is retried on that host (at most retries times, waiting retryDelay between the attempts).
+// The command fails with ErrCommandTimeout on the hosts where it does not finish in timeout seconds.
+// If the context is cancelled, the running commands are stopped and the command is not started on the remaining hosts
+func (a AmbariRegistry) RunRemoteHostCommandWithRetries(ctx context.Context, command string, filteredHosts map[string]bool, skipJump bool, retries int, retryDelay time.Duration, timeout int) map[string]RemoteResponse {
 	connectionProfileId := a.ConnectionProfile
 	if len(connectionProfileId) == 0 {
-		fmt.Println("No connection profile is attached for the active ambari server entry!")
+		errPrintln("No connection profile is attached for the active ambari server entry!")
 		os.Exit(1)
 	}
-	connectionProfile := GetConnectionProfileById(connectionProfileId)
+	connectionProfile, password := GetConnectionProfileWithPassword(connectionProfileId)
+	if a.become {
+		connectionProfile.Become = true
+	}
 	var hosts map[string]bool
 	if len(filteredHosts) > 0 {
 		hosts = filteredHosts
@@ -46,124 +119,307 @@ func (a AmbariRegistry) RunRemoteHostCommand(command string, filteredHosts map[s
 		hosts = a.GetFilteredHosts(Filter{})
 	}
 	response := make(map[string]RemoteResponse)
+	progress := newHostProgress(len(hosts))
+	var mutex sync.Mutex
 	var wg sync.WaitGroup
+	limiter := a.newHostLimiter()
 	wg.Add(len(hosts))
 	for host := range hosts {
-		ssh := createSshConfig(connectionProfile, host, skipJump)
-		go func(ssh *easyssh.MakeConfig, command string, host string, response map[string]RemoteResponse) {
+		ssh := newRemoteClient(connectionProfile, password, host, skipJump)
+		go func(ssh remoteClient, command string, host string, response map[string]RemoteResponse) {
 			defer wg.Done()
-			stdout, stderr, done, err := ssh.Run(command, 60)
+			limiter <- struct{}{}
+			defer func() { <-limiter }()
+			defer progress.HostCompleted(host)
+			if ctx.Err() != nil {
+				mutex.Lock()
+				response[host] = RemoteResponse{Err: ctx.Err(), ExitStatus: -1}
+				mutex.Unlock()
+				return
+			}
+			attempts := 1
+			stdout, stderr, done, err := runSshCommand(ctx, ssh, command, host, timeout)
+			for ; err != nil && ctx.Err() == nil && attempts <= retries; attempts++ {
+				ctxWarnPrintln(ctx, fmt.Sprintf("%v - attempt %d failed: %v, retrying in %v", host, attempts, err, retryDelay))
+				select {
+				case <-time.After(retryDelay):
+					stdout, stderr, done, err = runSshCommand(ctx, ssh, command, host, timeout)
+				case <-ctx.Done():
+					err = ctx.Err()
+				}
+			}
 			// Handle errors
-			msgHeader := fmt.Sprintf("%v (done: %v) - output:", host, done)
-			fmt.Println(msgHeader)
-			if err != nil {
-				panic("Can't run remote command: " + err.Error())
+			if err != nil && IsConnectionError(err) {
+				ctxErrPrintln(ctx, fmt.Sprintf("%v - unreachable: %v", host, err))
+				mutex.Lock()
+				response[host] = RemoteResponse{Unreachable: true, Err: err, Attempts: attempts, ExitStatus: -1}
+				mutex.Unlock()
+				return
+			}
+			if streamOutput {
+				ctxOutPrintln(ctx, fmt.Sprintf("%v (done: %v)", host, done))
 			} else {
+				msgHeader := fmt.Sprintf("%v (done: %v) - output:", host, done)
+				ctxOutPrintln(ctx, msgHeader)
 				if len(stdout) > 0 {
-					fmt.Println(stdout)
+					ctxOutPrintln(ctx, stdout)
 				}
 				if len(stderr) > 0 {
-					fmt.Println("std error:")
-					fmt.Println(stderr)
+					ctxErrPrintln(ctx, "std error:")
+					ctxErrPrintln(ctx, stderr)
 				}
-				response[host] = RemoteResponse{StdOut: stdout, StdErr: stderr, Done: done}
 			}
+			hostResponse := withExitStatus(RemoteResponse{StdOut: stdout, StdErr: stderr, Done: done, Err: err, Attempts: attempts, TimedOut: err == ErrCommandTimeout})
+			if err != nil {
+				ctxErrPrintln(ctx, fmt.Sprintf("Remote command failed on host %v (exit status: %d): %v", host, hostResponse.ExitStatus, err))
+			}
+			mutex.Lock()
+			response[host] = hostResponse
+			mutex.Unlock()
 		}(ssh, command, host, response)
 	}
 	wg.Wait()
 	return response
 }
 
-// CopyToRemote copy local file to remote host(s)
-func (a AmbariRegistry) CopyToRemote(source string, dest string, filteredHosts map[string]bool, skipJump bool) {
+// runSshCommand run a command on a host, the output lines are printed as they arrive (prefixed with the host) in stream mode
+func runSshCommand(ctx context.Context, ssh remoteClient, command string, host string, timeout int) (string, string, bool, error) {
+	if !streamOutput {
+		return ssh.Run(ctx, command, timeout)
+	}
+	return ssh.RunStreaming(ctx, command, timeout, func(line string, isStderr bool) {
+		if isStderr {
+			ctxErrPrintln(ctx, fmt.Sprintf("%s: %s", host, line))
+		} else {
+			ctxOutPrintln(ctx, fmt.Sprintf("%s: %s", host, line))
+		}
+	})
+}
+
+// TailRemoteFile print the last lines of a (log) file from the filtered hosts, returns the outputs by hosts
+func (a AmbariRegistry) TailRemoteFile(path string, lines int, filteredHosts map[string]bool) map[string]RemoteResponse {
+	return a.RunRemoteHostCommand(fmt.Sprintf("tail -n %d %s", lines, shellQuote(path)), filteredHosts, false)
+}
+
+// FollowRemoteFile print the last lines of a (log) file from the filtered hosts, then keep printing the new lines
+// (prefixed with the hosts) until the context is cancelled, returns the errors by hosts
+func (a AmbariRegistry) FollowRemoteFile(ctx context.Context, path string, lines int, filteredHosts map[string]bool) map[string]error {
+	connectionProfileId := a.ConnectionProfile
+	if len(connectionProfileId) == 0 {
+		errPrintln("No connection profile is attached for the active ambari server entry!")
+		os.Exit(1)
+	}
+	connectionProfile, password := GetConnectionProfileWithPassword(connectionProfileId)
+	var hosts map[string]bool
+	if len(filteredHosts) > 0 {
+		hosts = filteredHosts
+	} else {
+		hosts = a.GetFilteredHosts(Filter{})
+	}
+	command := fmt.Sprintf("tail -n %d -f %s", lines, shellQuote(path))
+	response := make(map[string]error)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(len(hosts))
+	for host := range hosts {
+		ssh := newRemoteClient(connectionProfile, password, host, false)
+		go func(ssh remoteClient, host string) {
+			defer wg.Done()
+			err := ssh.Stream(ctx, command, func(line string, isStderr bool) {
+				outPrintln(fmt.Sprintf("%s: %s", host, line))
+			})
+			if err != nil {
+				errPrintln(fmt.Sprintf("Following %s failed on host %v: %v", path, host, err))
+			}
+			mutex.Lock()
+			response[host] = err
+			mutex.Unlock()
+		}(ssh, host)
+	}
+	wg.Wait()
+	return response
+}
+
+// CopyToRemote copy local file to remote host(s), returns the copy errors by hosts (nil value if the copy was successful),
+// if the context is cancelled, the running copies are stopped and the file is not copied to the remaining hosts
+func (a AmbariRegistry) CopyToRemote(ctx context.Context, source string, dest string, filteredHosts map[string]bool, skipJump bool) map[string]error {
+	sizeInfo := ""
+	if sourceInfo, err := os.Stat(source); err == nil {
+		sizeInfo = fmt.Sprintf(", %d bytes", sourceInfo.Size())
+	}
+	return a.copyToHosts(ctx, source, dest, sizeInfo, filteredHosts, skipJump, func(ssh remoteClient) error {
+		return ssh.Scp(ctx, source, dest)
+	})
+}
+
+// CopyContentToRemote write in-memory content to a file on the remote host(s), returns the copy errors by hosts (nil value if the copy was successful)
+func (a AmbariRegistry) CopyContentToRemote(ctx context.Context, content string, dest string, filteredHosts map[string]bool, skipJump bool) map[string]error {
+	sizeInfo := fmt.Sprintf(", %d bytes", len(content))
+	return a.copyToHosts(ctx, "inline content", dest, sizeInfo, filteredHosts, skipJump, func(ssh remoteClient) error {
+		return ssh.ScpContent(ctx, []byte(content), dest)
+	})
+}
+
+func (a AmbariRegistry) copyToHosts(ctx context.Context, source string, dest string, sizeInfo string, filteredHosts map[string]bool, skipJump bool, copyFunc func(ssh remoteClient) error) map[string]error {
 	connectionProfileId := a.ConnectionProfile
 	if len(connectionProfileId) == 0 {
-		fmt.Println("No connection profile is attached for the active ambari server entry!")
+		errPrintln("No connection profile is attached for the active ambari server entry!")
 		os.Exit(1)
 	}
-	connectionProfile := GetConnectionProfileById(connectionProfileId)
+	connectionProfile, password := GetConnectionProfileWithPassword(connectionProfileId)
 	var hosts map[string]bool
 	if len(filteredHosts) > 0 {
 		hosts = filteredHosts
 	} else {
 		hosts = a.GetFilteredHosts(Filter{})
 	}
+	response := make(map[string]error)
+	progress := newHostProgress(len(hosts))
+	var mutex sync.Mutex
 	var wg sync.WaitGroup
+	limiter := a.newHostLimiter()
 	wg.Add(len(hosts))
 	for host := range hosts {
-		ssh := createSshConfig(connectionProfile, host, skipJump)
-		go func(ssh *easyssh.MakeConfig, source string, dest string, host string) {
+		ssh := newRemoteClient(connectionProfile, password, host, skipJump)
+		go func(ssh remoteClient, host string) {
 			defer wg.Done()
-			err := ssh.Scp(source, dest)
+			limiter <- struct{}{}
+			defer func() { <-limiter }()
+			defer progress.HostCompleted(host)
+			err := ctx.Err()
+			if err == nil {
+				err = copyFunc(ssh)
+			}
 			// Handle errors
 			if err != nil {
-				errMsg := fmt.Sprintf("Can't run remote command on host '%v (scp %v to %v)", host, source, dest)
-				fmt.Println(errMsg)
+				errMsg := fmt.Sprintf("Can't copy file to host '%v' (scp %v to %v): %v", host, source, dest, err)
+				ctxErrPrintln(ctx, errMsg)
 			} else {
-				succMsg := fmt.Sprintf("Copying to remote host '%v' is successful. (from - %v, to %v)", host, source, dest)
-				fmt.Println(succMsg)
+				succMsg := fmt.Sprintf("Copying to remote host '%v' is successful. (from - %v, to %v%s)", host, source, dest, sizeInfo)
+				ctxOutPrintln(ctx, succMsg)
 			}
-		}(ssh, source, dest, host)
+			mutex.Lock()
+			response[host] = err
+			mutex.Unlock()
+		}(ssh, host)
 	}
 	wg.Wait()
+	return response
+}
+
+// VerifyRemoteFileSize check that a file exists with the expected size on the remote host(s), returns the verification errors by hosts
+func (a AmbariRegistry) VerifyRemoteFileSize(ctx context.Context, remoteFile string, expectedSize int64, filteredHosts map[string]bool, skipJump bool) map[string]error {
+	command := fmt.Sprintf("stat -c %%s %s 2>/dev/null || echo missing", shellQuote(remoteFile))
+	responses := a.RunRemoteHostCommandWithRetries(ctx, command, filteredHosts, skipJump, 0, 0, DefaultCommandTimeout)
+	result := make(map[string]error)
+	for host := range filteredHosts {
+		response, ok := responses[host]
+		var err error
+		if ok && response.Err != nil {
+			err = fmt.Errorf("Cannot check file '%s': %v", remoteFile, response.Err)
+		} else {
+			err = checkRemoteFileSize(response.StdOut, ok, remoteFile, expectedSize)
+		}
+		if err != nil {
+			err = fmt.Errorf("%v (host: %s)", err, host)
+			ctxErrPrintln(ctx, err)
+		}
+		result[host] = err
+	}
+	return result
 }
 
-// CopyFromRemote copy 1 file from 1 remote host to locally
-func (a AmbariRegistry) CopyFromRemote(source string, dest string, host string, skipJump bool) {
+func checkRemoteFileSize(statOutput string, haveOutput bool, remoteFile string, expectedSize int64) error {
+	if !haveOutput {
+		return fmt.Errorf("Cannot check file '%s'", remoteFile)
+	}
+	sizeStr := strings.TrimSpace(statOutput)
+	if sizeStr == "missing" {
+		return fmt.Errorf("File '%s' is missing", remoteFile)
+	}
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil {
+		return fmt.Errorf("Cannot check size of file '%s': %v", remoteFile, err)
+	}
+	if size != expectedSize {
+		return fmt.Errorf("File '%s' has wrong size (expected: %d, actual: %d)", remoteFile, expectedSize, size)
+	}
+	return nil
+}
+
+// CopyFromRemote copy 1 file from 1 remote host to locally (the copy is stopped if the context is cancelled)
+func (a AmbariRegistry) CopyFromRemote(ctx context.Context, source string, dest string, host string, skipJump bool) {
 	connectionProfileId := a.ConnectionProfile
 	if len(connectionProfileId) == 0 {
-		fmt.Println("No connection profile is attached for the active ambari server entry!")
+		errPrintln("No connection profile is attached for the active ambari server entry!")
 		os.Exit(1)
 	}
-	connectionProfile := GetConnectionProfileById(connectionProfileId)
-	ssh := createSshConfig(connectionProfile, host, skipJump)
-	err := DownloadViaScp(ssh, source, dest, skipJump)
+	connectionProfile, password := GetConnectionProfileWithPassword(connectionProfileId)
+	ssh := newRemoteClient(connectionProfile, password, host, skipJump)
+	err := downloadViaScp(ctx, ssh, host, source, dest)
 	if err != nil {
-		fmt.Println(err)
+		errPrintln(err)
 		os.Exit(1)
 	}
 }
 
-// CopyFromRemoteHosts copy remote file to remote host(s)
-func (a AmbariRegistry) CopyFromRemoteHosts(source string, dest string, filteredHosts map[string]bool, skipJump bool) {
+// CopyFromRemoteHosts download a remote file from the filtered hosts to a local folder, the downloaded files are prefixed with the hosts
+// (e.g.: host1-ambari-agent.ini), returns the download errors by hosts (nil value if the download was successful).
+// If the context is cancelled, the running downloads are stopped and the file is not downloaded from the remaining hosts
+func (a AmbariRegistry) CopyFromRemoteHosts(ctx context.Context, source string, dest string, filteredHosts map[string]bool, skipJump bool) map[string]error {
 	connectionProfileId := a.ConnectionProfile
 	if len(connectionProfileId) == 0 {
-		fmt.Println("No connection profile is attached for the active ambari server entry!")
+		errPrintln("No connection profile is attached for the active ambari server entry!")
 		os.Exit(1)
 	}
-	connectionProfile := GetConnectionProfileById(connectionProfileId)
+	connectionProfile, password := GetConnectionProfileWithPassword(connectionProfileId)
 	var hosts map[string]bool
 	if len(filteredHosts) > 0 {
 		hosts = filteredHosts
 	} else {
 		hosts = a.GetFilteredHosts(Filter{})
 	}
+	response := make(map[string]error)
+	if err := os.MkdirAll(dest, os.ModePerm); err != nil {
+		for host := range hosts {
+			response[host] = err
+		}
+		return response
+	}
+	var mutex sync.Mutex
 	var wg sync.WaitGroup
+	limiter := a.newHostLimiter()
 	wg.Add(len(hosts))
 	for host := range hosts {
-		ssh := createSshConfig(connectionProfile, host, skipJump)
-		go func(ssh *easyssh.MakeConfig, source string, dest string, host string) {
+		ssh := newRemoteClient(connectionProfile, password, host, skipJump)
+		go func(ssh remoteClient, source string, dest string, host string) {
 			defer wg.Done()
-			hostFolder := path.Join(dest, host)
-			os.MkdirAll(hostFolder, os.ModePerm)
-			err := DownloadViaScp(ssh, source, hostFolder, skipJump)
+			limiter <- struct{}{}
+			defer func() { <-limiter }()
+			err := ctx.Err()
+			if err == nil {
+				err = downloadViaScp(ctx, ssh, host, source, path.Join(dest, host+"-"+path.Base(source)))
+			}
 			if err != nil {
-				fmt.Println(fmt.Sprintf("Failed to copy from host '%v', reason:", host))
-				fmt.Println(err)
+				errPrintln(fmt.Sprintf("Failed to copy from host '%v', reason: %v", host, err))
 			}
+			mutex.Lock()
+			response[host] = err
+			mutex.Unlock()
 		}(ssh, source, dest, host)
 	}
 	wg.Wait()
+	return response
 }
 
 // CopyFolderFromRemote copy folder (zipping it first) to local filesystem from remote location
 func (a AmbariRegistry) CopyFolderFromRemote(component string, source string, dest string, filteredHosts map[string]bool, skipJump bool) {
 	connectionProfileId := a.ConnectionProfile
 	if len(connectionProfileId) == 0 {
-		fmt.Println("No connection profile is attached for the active ambari server entry!")
+		errPrintln("No connection profile is attached for the active ambari server entry!")
 		os.Exit(1)
 	}
-	connectionProfile := GetConnectionProfileById(connectionProfileId)
+	connectionProfile, password := GetConnectionProfileWithPassword(connectionProfileId)
 	var hosts map[string]bool
 	if len(filteredHosts) > 0 {
 		hosts = filteredHosts
@@ -172,59 +428,87 @@ func (a AmbariRegistry) CopyFolderFromRemote(component string, source string, de
 	}
 
 	var wg sync.WaitGroup
+	limiter := a.newHostLimiter()
 	wg.Add(len(hosts))
 	for host := range hosts {
-		ssh := createSshConfig(connectionProfile, host, skipJump)
-		go func(ssh *easyssh.MakeConfig, component string, source string, dest string, host string) {
+		ssh := newRemoteClient(connectionProfile, password, host, skipJump)
+		go func(ssh remoteClient, component string, source string, dest string, host string) {
 			defer wg.Done()
+			limiter <- struct{}{}
+			defer func() { <-limiter }()
 			tmpSource := fmt.Sprintf("/tmp/%v.tar.gz", component)
 			command := fmt.Sprintf("cd %v && tar -cvf %v *", source, tmpSource)
-			stdout, stderr, _, err := ssh.Run(command, 60)
+			stdout, stderr, _, err := ssh.Run(context.Background(), command, 60)
 			// Handle errors
 			if err != nil {
-				panic("Can't run remote command: " + err.Error())
+				errPrintln(fmt.Sprintf("Zipping '%v' log files has been failed on host %v: %v", component, host, err))
+				return
 			} else {
 				if len(stdout) > 0 {
-					fmt.Println(fmt.Sprintf("Zipping '%v' log files has been finished on host %v", component, host))
+					outPrintln(fmt.Sprintf("Zipping '%v' log files has been finished on host %v", component, host))
 				}
 				if len(stderr) > 0 {
-					fmt.Println("std error:")
-					fmt.Println(stderr)
+					errPrintln("std error:")
+					errPrintln(stderr)
 				}
 			}
 			hostFolder := path.Join(dest, host)
 			os.MkdirAll(hostFolder, os.ModePerm)
-			err = DownloadViaScp(ssh, tmpSource, hostFolder, skipJump)
+			err = downloadViaScp(context.Background(), ssh, host, tmpSource, hostFolder)
 			if err != nil {
-				fmt.Println(err)
+				errPrintln(err)
 			}
 		}(ssh, component, source, dest, host)
 	}
 	wg.Wait()
 }
 
-func createSshConfig(connectionProfile ConnectionProfile, host string, skipJump bool) *easyssh.MakeConfig {
-	if len(connectionProfile.ProxyAddress) > 0 && !skipJump {
-		return &easyssh.MakeConfig{
-			User:    connectionProfile.Username,
-			Server:  host,
-			KeyPath: connectionProfile.KeyPath,
-			Port:    strconv.Itoa(connectionProfile.Port),
-			Timeout: 60 * time.Second,
-			Proxy: easyssh.DefaultConfig{
-				User:    connectionProfile.Username,
-				Server:  connectionProfile.ProxyAddress,
-				Port:    strconv.Itoa(connectionProfile.Port),
-				KeyPath: connectionProfile.KeyPath,
-				Timeout: 60 * time.Second,
-			},
+// GetConnectionProfileWithPassword get the connection profile by id with its ssh password, if the profile has a password command,
+// the ssh password is obtained by running that command
+func GetConnectionProfileWithPassword(connectionProfileId string) (ConnectionProfile, string) {
+	connectionProfile, err := GetConnectionProfileById(connectionProfileId).decryptPasswords()
+	if err != nil {
+		errPrintln(err)
+		os.Exit(1)
+	}
+	password := connectionProfile.Password
+	if len(connectionProfile.PasswordCommand) > 0 {
+		password, err = RunPasswordCommand(connectionProfile.PasswordCommand)
+		if err != nil {
+			errPrintln(err)
+			os.Exit(1)
 		}
 	}
-	return &easyssh.MakeConfig{
-		User:    connectionProfile.Username,
-		Server:  host,
-		KeyPath: connectionProfile.KeyPath,
-		Port:    strconv.Itoa(connectionProfile.Port),
-		Timeout: 60 * time.Second,
+	return connectionProfile, password
+}
+
+func createSshConfig(connectionProfile ConnectionProfile, password string, host string, skipJump bool) *SshConfig {
+	sshConfig := &SshConfig{
+		User:             connectionProfile.Username,
+		Server:           host,
+		KeyPath:          connectionProfile.KeyPath,
+		Password:         password,
+		Port:             strconv.Itoa(connectionProfile.Port),
+		Timeout:          60 * time.Second,
+		Ciphers:          connectionProfile.Ciphers,
+		MACs:             connectionProfile.MACs,
+		KeyExchanges:     connectionProfile.KeyExchanges,
+		ReconnectRetries: connectionProfile.ReconnectRetries,
+		KnownHostsFile:   getKnownHostsFile(connectionProfile.KnownHostsFile),
+		TransferTimeout:  transferTimeout,
+	}
+	sshConfig.StrictHostKeyChecking = connectionProfile.HostKeyChecking == HostKeyCheckingStrict
+	if len(connectionProfile.ProxyAddress) > 0 && !skipJump {
+		proxyConfig := *sshConfig
+		proxyConfig.Server = connectionProfile.ProxyAddress
+		sshConfig.Proxy = &proxyConfig
+	}
+	if connectionProfile.Become {
+		sshConfig.Become = true
+		sshConfig.BecomePassword = connectionProfile.BecomePassword
+		if len(sshConfig.BecomePassword) == 0 {
+			sshConfig.BecomePassword = password
+		}
 	}
+	return sshConfig
 }
@@ -0,0 +1,497 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSshCiphers the default ciphers of the ssh client, extra ciphers of a connection profile are appended to these
+var defaultSshCiphers = []string{"aes128-gcm@openssh.com", "chacha20-poly1305@openssh.com", "aes128-ctr", "aes192-ctr", "aes256-ctr"}
+
+// defaultSshMACs the default MAC algorithms of the ssh client, extra MACs of a connection profile are appended to these
+var defaultSshMACs = []string{"hmac-sha2-256-etm@openssh.com", "hmac-sha2-256", "hmac-sha1", "hmac-sha1-96"}
+
+// defaultSshKeyExchanges the default key exchange algorithms of the ssh client, extra ones of a connection profile are appended to these
+var defaultSshKeyExchanges = []string{"curve25519-sha256@libssh.org", "ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521", "diffie-hellman-group14-sha1"}
+
+// SshConfig holds the details that are needed to connect to a remote host (optionally through a jump host)
+type SshConfig struct {
+	User         string
+	Server       string
+	KeyPath      string
+	Port         string
+	Password     string
+	Timeout      time.Duration
+	Ciphers      []string
+	MACs         []string
+	KeyExchanges []string
+	// ReconnectRetries number of times a command is run again on a fresh connection if the connection drops during the command
+	ReconnectRetries int
+	// Become run the commands with sudo, BecomePassword is written to the standard input of sudo (if it is empty, sudo cannot prompt for a password)
+	Become         bool
+	BecomePassword string
+	// TransferTimeout limits the duration of the file copies (0: no limit), commands use their own timeouts
+	TransferTimeout time.Duration
+	// StrictHostKeyChecking accept only the host keys that are listed in KnownHostsFile
+	StrictHostKeyChecking bool
+	KnownHostsFile        string
+	Proxy                 *SshConfig
+}
+
+type sshConnection struct {
+	client      *ssh.Client
+	proxyClient *ssh.Client
+	// agentConn the connection to the ssh agent (if it is running), it is used by the jump host and the target host as well
+	agentConn net.Conn
+}
+
+func (c *sshConnection) Close() {
+	if c.client != nil {
+		c.client.Close()
+	}
+	if c.proxyClient != nil {
+		c.proxyClient.Close()
+	}
+	if c.agentConn != nil {
+		c.agentConn.Close()
+	}
+}
+
+// Run executes a command on the remote host, done is false if the command did not finish within the timeout (in seconds)
+// or the context has been cancelled (the remote command gets a TERM signal then).
+// If the connection drops during the command, the command is run again on a new connection (at most ReconnectRetries times)
+func (s *SshConfig) Run(ctx context.Context, command string, timeout int) (string, string, bool, error) {
+	stdout, stderr, done, connected, err := s.run(ctx, command, timeout)
+	for retry := 1; retry <= s.ReconnectRetries && connected && IsConnectionDropError(err) && ctx.Err() == nil; retry++ {
+		warnPrintln(fmt.Sprintf("Connection to %s has been dropped during the command (%v), reconnecting (%d/%d)", s.Server, err, retry, s.ReconnectRetries))
+		stdout, stderr, done, connected, err = s.run(ctx, command, timeout)
+	}
+	return stdout, stderr, done, err
+}
+
+// IsConnectionDropError reports whether an error of a running ssh command is caused by a dropped connection
+func IsConnectionDropError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if _, ok := err.(*ssh.ExitMissingError); ok || err == io.EOF {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	errMsg := err.Error()
+	return strings.Contains(errMsg, "connection reset") || strings.Contains(errMsg, "broken pipe")
+}
+
+func (s *SshConfig) run(ctx context.Context, command string, timeout int) (string, string, bool, bool, error) {
+	ctxDebugPrintln(ctx, fmt.Sprintf("Remote command on %s: %s", s.Server, command))
+	connection, err := s.connect()
+	if err != nil {
+		return "", "", false, false, err
+	}
+	defer connection.Close()
+	session, err := connection.client.NewSession()
+	if err != nil {
+		return "", "", false, false, err
+	}
+	defer session.Close()
+	// the session keeps writing the outputs after a timeout, so the buffers need to be synchronized
+	var stdout, stderr lockedBuffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	session.Stdin = s.becomeInput()
+	result := make(chan error, 1)
+	go func() {
+		result <- session.Run(s.becomeCommand(command))
+	}()
+	select {
+	case err = <-result:
+		return stdout.String(), stderr.String(), true, true, err
+	case <-time.After(time.Duration(timeout) * time.Second):
+		return stdout.String(), stderr.String(), false, true, ErrCommandTimeout
+	case <-ctx.Done():
+		session.Signal(ssh.SIGTERM)
+		return stdout.String(), stderr.String(), false, true, ctx.Err()
+	}
+}
+
+type lockedBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+// RunStreaming executes a command on the remote host like Run, but calls onLine for every output line as it arrives,
+// the full outputs are returned as well when the command finishes (or times out, or the context is cancelled)
+func (s *SshConfig) RunStreaming(parent context.Context, command string, timeout int, onLine func(line string, isStderr bool)) (string, string, bool, error) {
+	var stdout, stderr bytes.Buffer
+	var mutex sync.Mutex
+	ctx, cancel := context.WithTimeout(parent, time.Duration(timeout)*time.Second)
+	defer cancel()
+	err := s.Stream(ctx, command, func(line string, isStderr bool) {
+		mutex.Lock()
+		if isStderr {
+			stderr.WriteString(line + "\n")
+		} else {
+			stdout.WriteString(line + "\n")
+		}
+		mutex.Unlock()
+		onLine(line, isStderr)
+	})
+	mutex.Lock()
+	defer mutex.Unlock()
+	if parent.Err() != nil {
+		return stdout.String(), stderr.String(), false, parent.Err()
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return stdout.String(), stderr.String(), false, ErrCommandTimeout
+	}
+	return stdout.String(), stderr.String(), err == nil || !IsConnectionError(err), err
+}
+
+// Stream executes a command on the remote host and calls onLine for every output line (of stdout and stderr)
+// until the command finishes or the context is cancelled
+func (s *SshConfig) Stream(ctx context.Context, command string, onLine func(line string, isStderr bool)) error {
+	connection, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer connection.Close()
+	session, err := connection.client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := session.StderrPipe()
+	if err != nil {
+		return err
+	}
+	session.Stdin = s.becomeInput()
+	if err := session.Start(s.becomeCommand(command)); err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	for index, reader := range []io.Reader{stdout, stderr} {
+		go func(reader io.Reader, isStderr bool) {
+			defer wg.Done()
+			scanner := bufio.NewScanner(reader)
+			for scanner.Scan() {
+				onLine(scanner.Text(), isStderr)
+			}
+		}(reader, index == 1)
+	}
+	result := make(chan error, 1)
+	go func() {
+		wg.Wait()
+		result <- session.Wait()
+	}()
+	select {
+	case err = <-result:
+		return err
+	case <-ctx.Done():
+		session.Signal(ssh.SIGTERM)
+		return nil
+	}
+}
+
+// becomeCommand wraps a command with sudo if become is enabled, the password prompt is turned off,
+// so the password (piped to the standard input) does not show up in the outputs
+func (s *SshConfig) becomeCommand(command string) string {
+	if !s.Become {
+		return command
+	}
+	quotedCommand := shellQuote(command)
+	if len(s.BecomePassword) == 0 {
+		return "sudo -n sh -c " + quotedCommand
+	}
+	return "sudo -S -p '' sh -c " + quotedCommand
+}
+
+func (s *SshConfig) becomeInput() io.Reader {
+	if !s.Become || len(s.BecomePassword) == 0 {
+		return nil
+	}
+	return strings.NewReader(s.BecomePassword + "\n")
+}
+
+// Scp uploads a local file to the remote host (until the transfer timeout is reached or the context is cancelled)
+func (s *SshConfig) Scp(ctx context.Context, sourceFile string, targetFile string) error {
+	src, err := os.Open(sourceFile)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	srcStat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	return s.scpFrom(ctx, src, srcStat.Size(), targetFile)
+}
+
+// ScpContent write in-memory content to a remote file through scp
+func (s *SshConfig) ScpContent(ctx context.Context, content []byte, targetFile string) error {
+	return s.scpFrom(ctx, bytes.NewReader(content), int64(len(content)), targetFile)
+}
+
+func (s *SshConfig) scpFrom(ctx context.Context, src io.Reader, size int64, targetFile string) error {
+	connection, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer connection.Close()
+	session, err := connection.client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	w, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer w.Close()
+		fmt.Fprintln(w, "C0644", size, filepath.Base(targetFile))
+		io.Copy(w, src)
+		fmt.Fprint(w, "\x00")
+	}()
+	result := make(chan error, 1)
+	go func() {
+		result <- session.Run(fmt.Sprintf("scp -tr %s", shellQuote(targetFile)))
+	}()
+	var timeout <-chan time.Time
+	if s.TransferTimeout > 0 {
+		timer := time.NewTimer(s.TransferTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case err = <-result:
+		return err
+	case <-timeout:
+		return ErrTransferTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Download copy a remote file to a local file through scp (the remote host runs the source side of the scp protocol)
+func (s *SshConfig) Download(ctx context.Context, sourceFile string, targetFile string) error {
+	dest, err := os.Create(targetFile)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+	connection, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer connection.Close()
+	session, err := connection.client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	w, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := session.Start(fmt.Sprintf("scp -f %s", shellQuote(sourceFile))); err != nil {
+		return err
+	}
+	result := make(chan error, 1)
+	go func() {
+		err := receiveScpFile(w, r, dest)
+		w.Close()
+		if waitErr := session.Wait(); err == nil {
+			err = waitErr
+		}
+		result <- err
+	}()
+	var timeout <-chan time.Time
+	if s.TransferTimeout > 0 {
+		timer := time.NewTimer(s.TransferTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case err = <-result:
+		return err
+	case <-timeout:
+		return ErrTransferTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// receiveScpFile read 1 file from the source side of the scp protocol (every message is acknowledged with a 0 byte)
+func receiveScpFile(w io.Writer, r io.Reader, dest io.Writer) error {
+	reader := bufio.NewReader(r)
+	if _, err := w.Write([]byte{0}); err != nil {
+		return err
+	}
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("Cannot read scp header: %v", err)
+	}
+	if header[0] == 1 || header[0] == 2 {
+		return fmt.Errorf("%s", strings.TrimSpace(header[1:]))
+	}
+	fields := strings.SplitN(strings.TrimSuffix(header, "\n"), " ", 3)
+	if header[0] != 'C' || len(fields) != 3 {
+		return fmt.Errorf("Unexpected scp header: %q", header)
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("Unexpected scp header: %q", header)
+	}
+	if _, err := w.Write([]byte{0}); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(dest, reader, size); err != nil {
+		return err
+	}
+	if status, err := reader.ReadByte(); err != nil || status != 0 {
+		return fmt.Errorf("scp transfer of %d bytes is not finished properly (status: %d, error: %v)", size, status, err)
+	}
+	_, err = w.Write([]byte{0})
+	return err
+}
+
+func (s *SshConfig) connect() (*sshConnection, error) {
+	connection := &sshConnection{}
+	if socket := os.Getenv("SSH_AUTH_SOCK"); len(socket) > 0 {
+		if agentConn, err := net.Dial("unix", socket); err == nil {
+			connection.agentConn = agentConn
+		}
+	}
+	if err := s.dial(connection); err != nil {
+		connection.Close()
+		return nil, err
+	}
+	return connection, nil
+}
+
+// dial open the connection to the host (through the jump host if it is set)
+func (s *SshConfig) dial(connection *sshConnection) error {
+	address := net.JoinHostPort(s.Server, s.Port)
+	config, err := s.clientConfig(connection.agentConn)
+	if err != nil {
+		return err
+	}
+	if s.Proxy == nil {
+		connection.client, err = ssh.Dial("tcp", address, config)
+		if err != nil {
+			return &ConnectionError{Host: s.Server, Err: err}
+		}
+		return nil
+	}
+	proxyConfig, err := s.Proxy.clientConfig(connection.agentConn)
+	if err != nil {
+		return err
+	}
+	connection.proxyClient, err = ssh.Dial("tcp", net.JoinHostPort(s.Proxy.Server, s.Proxy.Port), proxyConfig)
+	if err != nil {
+		return &ConnectionError{Host: s.Proxy.Server, Err: err}
+	}
+	conn, err := connection.proxyClient.Dial("tcp", address)
+	if err != nil {
+		return &ConnectionError{Host: s.Server, Err: err}
+	}
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		return &ConnectionError{Host: s.Server, Err: err}
+	}
+	connection.client = ssh.NewClient(clientConn, chans, reqs)
+	return nil
+}
+
+// clientConfig create the ssh client configuration, the keys of the agent are used if the agent connection is not nil,
+// returns an error if the key file cannot be read or parsed
+func (s *SshConfig) clientConfig(agentConn net.Conn) (*ssh.ClientConfig, error) {
+	auths := []ssh.AuthMethod{}
+	if len(s.Password) > 0 {
+		auths = append(auths, ssh.Password(s.Password))
+	}
+	if agentConn != nil {
+		auths = append(auths, ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers))
+	}
+	if len(s.KeyPath) > 0 {
+		key, err := ioutil.ReadFile(s.KeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read ssh key '%s': %v", s.KeyPath, err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot parse ssh key '%s': %v", s.KeyPath, err)
+		}
+		auths = append(auths, ssh.PublicKeys(signer))
+	}
+	config := &ssh.ClientConfig{
+		User:            s.User,
+		Auth:            auths,
+		Timeout:         s.Timeout,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	if s.StrictHostKeyChecking {
+		config.HostKeyCallback = knownHostsCallback(s.KnownHostsFile)
+	}
+	// extra (legacy) algorithms are only enabled if they are set in the connection profile, otherwise the secure defaults are used
+	if len(s.Ciphers) > 0 {
+		config.Ciphers = append(append([]string{}, defaultSshCiphers...), s.Ciphers...)
+	}
+	if len(s.MACs) > 0 {
+		config.MACs = append(append([]string{}, defaultSshMACs...), s.MACs...)
+	}
+	if len(s.KeyExchanges) > 0 {
+		config.KeyExchanges = append(append([]string{}, defaultSshKeyExchanges...), s.KeyExchanges...)
+	}
+	return config, nil
+}
@@ -0,0 +1,386 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSshServer is a local ssh server (user: root, password: secret) that runs the commands with the local shell
+type testSshServer struct {
+	port     int
+	hostKey  ssh.PublicKey
+	mutex    sync.Mutex
+	commands []string
+}
+
+func newTestSshServer(t *testing.T) *testSshServer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "root" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	config.AddHostKey(hostKey)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	server := &testSshServer{port: listener.Addr().(*net.TCPAddr).Port, hostKey: hostKey.PublicKey()}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, config)
+		}
+	}()
+	return server
+}
+
+// sshConfig get the client configuration for the server
+func (s *testSshServer) sshConfig() *SshConfig {
+	return &SshConfig{User: "root", Password: "secret", Server: "127.0.0.1", Port: strconv.Itoa(s.port), Timeout: 5 * time.Second}
+}
+
+func (s *testSshServer) getCommands() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.commands...)
+}
+
+func (s *testSshServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() == "direct-tcpip" {
+			go forward(newChannel)
+			continue
+		}
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions and forwards are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.serveSession(channel, requests)
+	}
+}
+
+// forward connect the channel to the requested address (the server can be used as a jump host)
+func forward(newChannel ssh.NewChannel) {
+	var payload struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	go func() {
+		io.Copy(conn, channel)
+		conn.Close()
+	}()
+	io.Copy(channel, conn)
+	channel.Close()
+}
+
+func (s *testSshServer) serveSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for request := range requests {
+		if request.Type != "exec" {
+			request.Reply(false, nil)
+			continue
+		}
+		var payload struct{ Command string }
+		if err := ssh.Unmarshal(request.Payload, &payload); err != nil {
+			request.Reply(false, nil)
+			continue
+		}
+		request.Reply(true, nil)
+		s.mutex.Lock()
+		s.commands = append(s.commands, payload.Command)
+		s.mutex.Unlock()
+		cmd := exec.Command("sh", "-c", payload.Command)
+		cmd.Stdout = channel
+		cmd.Stderr = channel.Stderr()
+		stdin, _ := cmd.StdinPipe()
+		go func() {
+			io.Copy(stdin, channel)
+			stdin.Close()
+		}()
+		exitCode := 0
+		if err := cmd.Run(); err != nil {
+			exitCode = 255
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				exitCode = exitErr.ExitCode()
+			}
+		}
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(exitCode)}))
+		return
+	}
+}
+
+func TestSshConfigRunAndScp(t *testing.T) {
+	server := newTestSshServer(t)
+	config := server.sshConfig()
+
+	stdout, _, done, err := config.Run(context.Background(), "echo hello", 5)
+	if err != nil || !done || stdout != "hello\n" {
+		t.Fatalf("unexpected result: %q, done: %v, err: %v", stdout, done, err)
+	}
+	_, _, done, err = config.Run(context.Background(), "exit 3", 5)
+	if exitErr, ok := err.(*ssh.ExitError); !ok || exitErr.ExitStatus() != 3 || !done || IsConnectionError(err) {
+		t.Errorf("expected exit status 3, got done: %v, err: %v", done, err)
+	}
+
+	target := filepath.Join(t.TempDir(), "my dir", "it's; touch pwned")
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.ScpContent(context.Background(), []byte("uploaded"), target); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := ioutil.ReadFile(target); err != nil || string(content) != "uploaded" {
+		t.Errorf("unexpected uploaded content: %q, err: %v", content, err)
+	}
+	if _, err := os.Stat("pwned"); err == nil {
+		os.Remove("pwned")
+		t.Error("the target path is not quoted")
+	}
+}
+
+func TestSshConfigRunStreaming(t *testing.T) {
+	server := newTestSshServer(t)
+	var mutex sync.Mutex
+	lines := make([]string, 0)
+
+	stdout, stderr, done, err := server.sshConfig().RunStreaming(context.Background(), "echo first; echo warning >&2; echo second", 5, func(line string, isStderr bool) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if isStderr {
+			line = "stderr: " + line
+		}
+		lines = append(lines, line)
+	})
+
+	if err != nil || !done || stdout != "first\nsecond\n" || stderr != "warning\n" {
+		t.Fatalf("unexpected result: %q, %q, done: %v, err: %v", stdout, stderr, done, err)
+	}
+	sort.Strings(lines)
+	if strings.Join(lines, ",") != "first,second,stderr: warning" {
+		t.Errorf("unexpected streamed lines: %v", lines)
+	}
+	start := time.Now()
+	_, _, done, err = server.sshConfig().RunStreaming(context.Background(), "echo started; sleep 10", 1, func(line string, isStderr bool) {})
+	if err != ErrCommandTimeout || done || time.Since(start) > 5*time.Second {
+		t.Errorf("expected a timeout after 1 second, got done: %v, err: %v (%v)", done, err, time.Since(start))
+	}
+}
+
+func TestSshConfigKeyErrors(t *testing.T) {
+	server := newTestSshServer(t)
+	config := server.sshConfig()
+	config.KeyPath = filepath.Join(t.TempDir(), "missing_rsa")
+	if _, _, _, err := config.Run(context.Background(), "hostname", 5); err == nil || IsConnectionError(err) {
+		t.Errorf("expected a key read error, got %v", err)
+	}
+	if err := ioutil.WriteFile(config.KeyPath, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := config.Run(context.Background(), "hostname", 5); err == nil || IsConnectionError(err) {
+		t.Errorf("expected a key parse error, got %v", err)
+	}
+	if len(server.getCommands()) != 0 {
+		t.Errorf("commands are run with a broken key: %v", server.getCommands())
+	}
+}
+
+// TestSshAgentIsDialedOnceAndClosed connects through a jump host, the agent connection is shared and closed with the client
+func TestSshAgentIsDialedOnceAndClosed(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	closed := make(chan bool, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				// the agent is not asked (the password is accepted first), the client only has to close the connection
+				ioutil.ReadAll(conn)
+				closed <- true
+			}()
+		}
+	}()
+	previous, set := os.LookupEnv("SSH_AUTH_SOCK")
+	os.Setenv("SSH_AUTH_SOCK", socket)
+	defer func() {
+		if set {
+			os.Setenv("SSH_AUTH_SOCK", previous)
+		} else {
+			os.Unsetenv("SSH_AUTH_SOCK")
+		}
+	}()
+	jump := newTestSshServer(t)
+	config := newTestSshServer(t).sshConfig()
+	config.Proxy = jump.sshConfig()
+
+	if _, _, _, err := config.Run(context.Background(), "hostname", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the agent connection is not closed")
+	}
+	select {
+	case <-closed:
+		t.Error("the agent is dialed more than once")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestSshConfigDownload(t *testing.T) {
+	server := newTestSshServer(t)
+	config := server.sshConfig()
+	dir := t.TempDir()
+	source := filepath.Join(dir, "it's a log")
+	content := strings.Repeat("log line\n", 10000)
+	if err := ioutil.WriteFile(source, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "downloaded")
+
+	if err := config.Download(context.Background(), source, target); err != nil {
+		t.Fatal(err)
+	}
+	if downloaded, err := ioutil.ReadFile(target); err != nil || string(downloaded) != content {
+		t.Errorf("unexpected downloaded content (%d bytes), err: %v", len(downloaded), err)
+	}
+	if err := config.Download(context.Background(), source+"-missing", target); err == nil || !strings.Contains(err.Error(), "No such file") {
+		t.Errorf("expected a missing file error, got %v", err)
+	}
+}
+
+// useSlowScp make the scp command of the test ssh server wait before the transfer until the end of the test
+func useSlowScp(t *testing.T, delay string) {
+	scpPath, err := exec.LookPath("scp")
+	if err != nil {
+		t.Skip("scp is not installed")
+	}
+	dir := t.TempDir()
+	script := fmt.Sprintf("#!/bin/sh\nsleep %s\nexec %s \"$@\"\n", delay, scpPath)
+	if err := ioutil.WriteFile(filepath.Join(dir, "scp"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestSshConfigTransferTimeout(t *testing.T) {
+	server := newTestSshServer(t)
+	useSlowScp(t, "1.5")
+	config := server.sshConfig()
+	dir := t.TempDir()
+
+	if _, _, _, err := config.Run(context.Background(), "sleep 1.5", 1); err != ErrCommandTimeout {
+		t.Errorf("expected the command to time out, got: %v", err)
+	}
+	config.TransferTimeout = 10 * time.Second
+	if err := config.ScpContent(context.Background(), []byte("slow"), filepath.Join(dir, "uploaded")); err != nil {
+		t.Fatalf("expected the slow transfer to finish within the transfer timeout: %v", err)
+	}
+	if err := config.Download(context.Background(), filepath.Join(dir, "uploaded"), filepath.Join(dir, "downloaded")); err != nil {
+		t.Fatalf("expected the slow download to finish within the transfer timeout: %v", err)
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(dir, "downloaded")); err != nil || string(content) != "slow" {
+		t.Errorf("unexpected downloaded content: %q, err: %v", content, err)
+	}
+
+	config.TransferTimeout = 500 * time.Millisecond
+	start := time.Now()
+	err := config.ScpContent(context.Background(), []byte("too slow"), filepath.Join(dir, "timed-out"))
+	if err != ErrTransferTimeout || IsConnectionError(err) {
+		t.Errorf("expected a transfer timeout, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the transfer timeout returned after %v", elapsed)
+	}
+	if err := config.Download(context.Background(), filepath.Join(dir, "uploaded"), filepath.Join(dir, "timed-out")); err != ErrTransferTimeout {
+		t.Errorf("expected a download timeout, got: %v", err)
+	}
+}
+
+func TestTransferTimeoutOfSshConfigs(t *testing.T) {
+	t.Cleanup(func() { SetTransferTimeout(0) })
+	SetTransferTimeout(30)
+	if config := createSshConfig(ConnectionProfile{Name: "profile", Username: "root", Port: 22}, "secret", "host1", false); config.TransferTimeout != 30*time.Second {
+		t.Errorf("expected the transfer timeout in the ssh config: %v", config.TransferTimeout)
+	}
+}
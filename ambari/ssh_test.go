@@ -0,0 +1,543 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRunRemoteHostCommandOnManyHosts collects the responses of the hosts concurrently (run with -race)
+func TestRunRemoteHostCommandOnManyHosts(t *testing.T) {
+	remote := &fakeRemote{run: func(host string, command string) (string, string, error) {
+		return host + ": " + command, "", nil
+	}}
+	ambariRegistry := useFakeRemote(t, remote, newTestAmbari(t, emptyItemsHandler), false)
+	hosts := fakeHosts(20)
+
+	responses := ambariRegistry.RunRemoteHostCommand("hostname", hosts, false)
+
+	if len(responses) != len(hosts) {
+		t.Fatalf("expected %d responses, got %d", len(hosts), len(responses))
+	}
+	for host := range hosts {
+		response, ok := responses[host]
+		if !ok {
+			t.Errorf("missing response of %s", host)
+			continue
+		}
+		if response.StdOut != host+": hostname" || !response.Done || response.Err != nil || response.ExitStatus != 0 {
+			t.Errorf("unexpected response of %s: %+v", host, response)
+		}
+	}
+}
+
+func TestRunRemoteHostCommandWithRetries(t *testing.T) {
+	var mutex sync.Mutex
+	calls := make(map[string]int)
+	remote := &fakeRemote{run: func(host string, command string) (string, string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		calls[host]++
+		if calls[host] <= 2 {
+			return "", "flaky", &ExitCodeError{Code: 1}
+		}
+		return "ok", "", nil
+	}}
+	ambariRegistry := useFakeRemote(t, remote, newTestAmbari(t, emptyItemsHandler), false)
+
+	responses := ambariRegistry.RunRemoteHostCommandWithRetries(context.Background(), "hostname", fakeHosts(1), false, 1, time.Millisecond, DefaultCommandTimeout)
+	if response := responses["host1"]; response.Err == nil || response.Attempts != 2 {
+		t.Errorf("expected a failure after 2 attempts: %+v", response)
+	}
+	calls = make(map[string]int)
+	responses = ambariRegistry.RunRemoteHostCommandWithRetries(context.Background(), "hostname", fakeHosts(1), false, 3, time.Millisecond, DefaultCommandTimeout)
+	if response := responses["host1"]; response.Err != nil || response.StdOut != "ok" || response.Attempts != 3 {
+		t.Errorf("expected a success at the third attempt: %+v", response)
+	}
+}
+
+func TestRunRemoteHostCommandStreamsOutputLines(t *testing.T) {
+	remote := &fakeRemote{lines: []string{"first", "second"}}
+	ambariRegistry := useFakeRemote(t, remote, newTestAmbari(t, emptyItemsHandler), false)
+	output := captureOutput(t)
+	SetStreamOutput(true)
+	defer SetStreamOutput(false)
+
+	responses := ambariRegistry.RunRemoteHostCommand("cat log", fakeHosts(2), false)
+
+	for host, response := range responses {
+		if response.StdOut != "first\nsecond\n" || response.Err != nil {
+			t.Errorf("unexpected response of %s: %+v", host, response)
+		}
+		for _, line := range []string{host + ": first\n", host + ": second\n", host + " (done: true)\n"} {
+			if !strings.Contains(output.String(), line) {
+				t.Errorf("missing line '%s' in output: %s", line, output.String())
+			}
+		}
+	}
+}
+
+func TestRunRemoteHostCommandRespectsParallelism(t *testing.T) {
+	remote := &fakeRemote{delay: 20 * time.Millisecond}
+	ambariRegistry := useFakeRemote(t, remote, newTestAmbari(t, emptyItemsHandler), false)
+	SetParallelism(3)
+	defer SetParallelism(0)
+
+	responses := ambariRegistry.RunRemoteHostCommand("hostname", fakeHosts(10), false)
+
+	if len(responses) != 10 {
+		t.Errorf("expected 10 responses, got %d", len(responses))
+	}
+	if remote.maxRunning != 3 {
+		t.Errorf("expected 3 hosts to be contacted at once, got %d", remote.maxRunning)
+	}
+	ambariRegistry.parallelism = 1
+	remote.maxRunning = 0
+	ambariRegistry.RunRemoteHostCommand("hostname", fakeHosts(4), false)
+	if remote.maxRunning != 1 {
+		t.Errorf("expected the parallelism of the task to override the global one, got %d", remote.maxRunning)
+	}
+	if SetParallelism(0); parallelism != DefaultParallelism {
+		t.Errorf("expected the default parallelism, got %d", parallelism)
+	}
+}
+
+// runLocally answers the commands of the fake remote by running them with the local shell
+func runLocally(host string, command string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+func TestVerifyRemoteFileSizeWithSpecialCharactersInPath(t *testing.T) {
+	remote := &fakeRemote{run: runLocally}
+	ambariRegistry := useFakeRemote(t, remote, newTestAmbari(t, emptyItemsHandler), false)
+	remoteFile := filepath.Join(t.TempDir(), "my dir; echo 1", "it's $HOME")
+	if err := os.MkdirAll(filepath.Dir(remoteFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(remoteFile, []byte("12345"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hosts := fakeHosts(1)
+
+	if errs := ambariRegistry.VerifyRemoteFileSize(context.Background(), remoteFile, 5, hosts, false); errs["host1"] != nil {
+		t.Errorf("unexpected verification error: %v", errs["host1"])
+	}
+	if errs := ambariRegistry.VerifyRemoteFileSize(context.Background(), remoteFile, 6, hosts, false); errs["host1"] == nil {
+		t.Error("expected a size mismatch")
+	}
+	if errs := ambariRegistry.VerifyRemoteFileSize(context.Background(), remoteFile+"x", 5, hosts, false); errs["host1"] == nil {
+		t.Error("expected a missing file")
+	}
+}
+
+func TestTailRemoteFileWithSpecialCharactersInPath(t *testing.T) {
+	remote := &fakeRemote{run: runLocally}
+	ambariRegistry := useFakeRemote(t, remote, newTestAmbari(t, emptyItemsHandler), false)
+	path := filepath.Join(t.TempDir(), "ambari server's log; rm -rf x")
+	if err := ioutil.WriteFile(path, []byte("line1\nline2\nline3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	responses := ambariRegistry.TailRemoteFile(path, 2, fakeHosts(2))
+
+	for host, response := range responses {
+		if response.StdOut != "line2\nline3\n" || GetExitCode(response) != 0 {
+			t.Errorf("unexpected response of %s: %+v", host, response)
+		}
+	}
+	if len(responses) != 2 {
+		t.Errorf("expected 2 responses, got %d", len(responses))
+	}
+}
+
+func TestFollowRemoteFilePrintsLinesWithHosts(t *testing.T) {
+	remote := &fakeRemote{lines: []string{"first", "second"}}
+	ambariRegistry := useFakeRemote(t, remote, newTestAmbari(t, emptyItemsHandler), false)
+	output := captureOutput(t)
+
+	errs := ambariRegistry.FollowRemoteFile(context.Background(), "/var/log/it's.log", 5, fakeHosts(2))
+
+	for host, err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error on %s: %v", host, err)
+		}
+		if commands := remote.getCommands(host); len(commands) != 1 || commands[0] != `tail -n 5 -f '/var/log/it'\''s.log'` {
+			t.Errorf("unexpected commands on %s: %v", host, commands)
+		}
+		for _, line := range []string{host + ": first", host + ": second"} {
+			if !strings.Contains(output.String(), line+"\n") {
+				t.Errorf("missing line '%s' in output: %s", line, output.String())
+			}
+		}
+	}
+}
+
+func TestCopyFromRemoteHosts(t *testing.T) {
+	remote := &fakeRemote{run: func(host string, command string) (string, string, error) {
+		if host == "host2" {
+			return "", "", errors.New("scp: /etc/app.conf: No such file or directory")
+		}
+		return host + " content", "", nil
+	}}
+	ambariRegistry := useFakeRemote(t, remote, newTestAmbari(t, emptyItemsHandler), false)
+	defer CleanupRunTempDir(false)
+	dest := filepath.Join(t.TempDir(), "downloads")
+
+	errs := ambariRegistry.CopyFromRemoteHosts(context.Background(), "/etc/app.conf", dest, fakeHosts(3), false)
+
+	if errs["host1"] != nil || errs["host3"] != nil || errs["host2"] == nil {
+		t.Errorf("unexpected download errors: %v", errs)
+	}
+	for _, host := range []string{"host1", "host3"} {
+		file := filepath.Join(dest, host+"-app.conf")
+		if content, err := ioutil.ReadFile(file); err != nil || string(content) != host+" content" {
+			t.Errorf("unexpected content of %s: %q, err: %v", file, content, err)
+		}
+		if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0644 {
+			t.Errorf("expected file mode 0644 for %s: %v", file, info.Mode())
+		}
+		if commands := remote.getCommands(host); len(commands) != 1 || commands[0] != "scp -f /etc/app.conf" {
+			t.Errorf("unexpected commands on %s: %v", host, commands)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dest, "host2-app.conf")); !os.IsNotExist(err) {
+		t.Error("a partial file is left behind for the failed download")
+	}
+}
+
+func TestCopyFromRemoteToLocalFile(t *testing.T) {
+	remote := &fakeRemote{run: func(host string, command string) (string, string, error) {
+		return "agent config", "", nil
+	}}
+	ambariRegistry := useFakeRemote(t, remote, newTestAmbari(t, emptyItemsHandler), false)
+	defer CleanupRunTempDir(false)
+	dest := filepath.Join(t.TempDir(), "ambari-agent.ini")
+
+	ambariRegistry.CopyFromRemote(context.Background(), "/etc/ambari-agent/conf/ambari-agent.ini", dest, "host1", false)
+
+	if content, err := ioutil.ReadFile(dest); err != nil || string(content) != "agent config" {
+		t.Errorf("unexpected content of %s: %q, err: %v", dest, content, err)
+	}
+}
+
+func TestCopyFromRemoteHostsIsNotStartedAfterCancel(t *testing.T) {
+	remote := &fakeRemote{}
+	ambariRegistry := useFakeRemote(t, remote, newTestAmbari(t, emptyItemsHandler), false)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	errs := ambariRegistry.CopyFromRemoteHosts(ctx, "/etc/app.conf", t.TempDir(), fakeHosts(2), false)
+
+	for host, err := range errs {
+		if err != context.Canceled {
+			t.Errorf("expected a cancelled download on %s, got: %v", host, err)
+		}
+		if commands := remote.getCommands(host); len(commands) != 0 {
+			t.Errorf("the download is started on %s: %v", host, commands)
+		}
+	}
+}
+
+func TestBecomeCommand(t *testing.T) {
+	config := &SshConfig{}
+	if command := config.becomeCommand("id -u"); command != "id -u" {
+		t.Errorf("unexpected command without become: %s", command)
+	}
+	config.Become = true
+	if command := config.becomeCommand("echo 'a b'"); command != `sudo -n sh -c 'echo '\''a b'\'''` {
+		t.Errorf("unexpected command without become password: %s", command)
+	}
+	if config.becomeInput() != nil {
+		t.Error("expected no input without become password")
+	}
+	config.BecomePassword = "secret"
+	if command := config.becomeCommand("id -u"); command != `sudo -S -p '' sh -c 'id -u'` {
+		t.Errorf("unexpected command with become password: %s", command)
+	}
+	if input, _ := ioutil.ReadAll(config.becomeInput()); string(input) != "secret\n" {
+		t.Errorf("unexpected input of sudo: %q", input)
+	}
+}
+
+func TestRemoteCommandTaskWithBecome(t *testing.T) {
+	remote := &fakeRemote{}
+	ambariRegistry := useFakeRemote(t, remote, newFakeCluster(t, map[string][]string{"host1": nil, "host2": nil}, nil), false)
+	playbook := loadTestPlaybook(t, `
+name: become
+tasks:
+  - name: "as user"
+    type: RemoteCommand
+    hosts: host1
+    command: "id -u"
+  - name: "as root"
+    type: RemoteCommand
+    hosts: host2
+    become: true
+    command: "id -u"
+`, "")
+
+	if _, err := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if config := remote.configs["host1"]; config.Become {
+		t.Error("become is enabled without the become field of the task")
+	}
+	if config := remote.configs["host2"]; !config.Become || config.BecomePassword != "secret" {
+		t.Errorf("expected become with the ssh password: %+v", config)
+	}
+}
+
+func TestCopyToRemoteReturnsErrorsByHosts(t *testing.T) {
+	remote := &fakeRemote{run: func(host string, command string) (string, string, error) {
+		if host == "host2" {
+			return "", "", errors.New("scp: /opt/app.jar: Permission denied")
+		}
+		return "", "", nil
+	}}
+	ambariRegistry := useFakeRemote(t, remote, newTestAmbari(t, emptyItemsHandler), false)
+	output := captureOutput(t)
+	source := filepath.Join(t.TempDir(), "app.jar")
+	if err := ioutil.WriteFile(source, []byte("12345"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := ambariRegistry.CopyToRemote(context.Background(), source, "/opt/app.jar", fakeHosts(3), false)
+
+	if len(errs) != 3 || errs["host1"] != nil || errs["host3"] != nil || errs["host2"] == nil {
+		t.Errorf("unexpected copy errors: %v", errs)
+	}
+	if content, ok := remote.getUpload("host1", "/opt/app.jar"); !ok || string(content) != "12345" {
+		t.Errorf("unexpected uploaded content: %q", content)
+	}
+	if !strings.Contains(output.String(), "Copying to remote host 'host1' is successful. (from - "+source+", to /opt/app.jar, 5 bytes)") {
+		t.Errorf("missing success line with the size in output: %s", output.String())
+	}
+	if !strings.Contains(output.String(), "Can't copy file to host 'host2'") {
+		t.Errorf("missing failure line in output: %s", output.String())
+	}
+}
+
+func TestRemoteResponseExitStatus(t *testing.T) {
+	captureOutput(t)
+	remote := &fakeRemote{run: func(host string, command string) (string, string, error) {
+		if host == "host2" {
+			return "", "", &ExitCodeError{Code: 1}
+		}
+		return "", "", nil
+	}}
+	ambariRegistry := useFakeRemote(t, remote, newFakeCluster(t, map[string][]string{"host1": nil, "host2": nil}, nil), false)
+
+	responses := ambariRegistry.RunRemoteHostCommand("test -f /etc/hadoop/conf/core-site.xml", fakeHosts(2), false)
+
+	if response := responses["host1"]; response.ExitStatus != 0 || response.Err != nil || !response.Done {
+		t.Errorf("unexpected response of host1: %+v", response)
+	}
+	if response := responses["host2"]; response.ExitStatus != 1 || GetExitCode(response) != 1 {
+		t.Errorf("expected exit status 1 on host2: %+v", response)
+	}
+	if failedHosts := GetFailedHosts(responses); strings.Join(failedHosts, ",") != "host2" {
+		t.Errorf("expected the silent failure of host2 to be a failure: %v", failedHosts)
+	}
+
+	playbook := loadTestPlaybook(t, `
+name: exit-status
+tasks:
+  - name: "check"
+    type: RemoteCommand
+    hosts: host1,host2
+    command: "test -f /etc/hadoop/conf/core-site.xml"
+`, "")
+	result, err := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{})
+	if err == nil || len(result.Tasks) != 1 || result.Tasks[0].Status != TaskFailed {
+		t.Fatalf("expected the task to fail on the nonzero exit status: %+v, err: %v", result.Tasks, err)
+	}
+	if len(result.Tasks[0].Hosts) != 2 {
+		t.Errorf("expected the results of both hosts: %+v", result.Tasks[0].Hosts)
+	}
+	for _, hostResult := range result.Tasks[0].Hosts {
+		if expected := map[string]int{"host1": 0, "host2": 1}[hostResult.Host]; hostResult.ExitCode != expected {
+			t.Errorf("expected exit code %d of %s: %+v", expected, hostResult.Host, hostResult)
+		}
+	}
+}
+
+func TestRemoteCommandErrorsAreReportedByHosts(t *testing.T) {
+	output := captureOutput(t)
+	remote := &fakeRemote{run: func(host string, command string) (string, string, error) {
+		switch host {
+		case "host2":
+			return "", "", &ConnectionError{Host: host, Err: errors.New("connection refused")}
+		case "host3":
+			return "", "", errors.New("session closed")
+		}
+		return "5", "", nil
+	}}
+	ambariRegistry := useFakeRemote(t, remote, newTestAmbari(t, emptyItemsHandler), false)
+	hosts := fakeHosts(4)
+
+	responses := ambariRegistry.RunRemoteHostCommand("stat -c %s /tmp/file", hosts, false)
+
+	if len(responses) != 4 {
+		t.Fatalf("expected the responses of every host: %+v", responses)
+	}
+	if unreachable := GetUnreachableHosts(responses); strings.Join(unreachable, ",") != "host2" {
+		t.Errorf("unexpected unreachable hosts: %v", unreachable)
+	}
+	if failed := GetFailedHosts(responses); strings.Join(failed, ",") != "host3" {
+		t.Errorf("unexpected failed hosts: %v", failed)
+	}
+	for _, host := range []string{"host1", "host4"} {
+		if response := responses[host]; response.Err != nil || response.StdOut != "5" {
+			t.Errorf("unexpected response of %s: %+v", host, response)
+		}
+	}
+	if !strings.Contains(output.String(), "host2 - unreachable: ") || !strings.Contains(output.String(), "Remote command failed on host host3") {
+		t.Errorf("expected the errors of the hosts in the output:\n%s", output.String())
+	}
+
+	errs := ambariRegistry.VerifyRemoteFileSize(context.Background(), "/tmp/file", 5, hosts, false)
+	if errs["host1"] != nil || errs["host4"] != nil {
+		t.Errorf("unexpected verification errors: %v", errs)
+	}
+	if err := errs["host3"]; err == nil || !strings.Contains(err.Error(), "session closed (host: host3)") {
+		t.Errorf("expected the command error of host3: %v", err)
+	}
+	if errs["host2"] == nil {
+		t.Error("expected an error for the unreachable host")
+	}
+}
+
+func TestUploadTaskWithInlineContent(t *testing.T) {
+	captureOutput(t)
+	remote := &fakeRemote{}
+	remote.run = func(host string, command string) (string, string, error) {
+		if strings.HasPrefix(command, "stat -c") {
+			content, ok := remote.getUpload(host, "/etc/myapp/app.properties")
+			if !ok {
+				return "missing", "", nil
+			}
+			return fmt.Sprintf("%d", len(content)), "", nil
+		}
+		return "", "", nil
+	}
+	ambariRegistry := useFakeRemote(t, remote, newFakeCluster(t, map[string][]string{"host1": nil, "host2": nil}, nil), false)
+	playbook := loadTestPlaybook(t, `
+name: inline-upload
+tasks:
+  - name: "upload"
+    type: Upload
+    hosts: host1,host2
+    parameters:
+      target: /etc/myapp/app.properties
+      verify_size: "true"
+      content: |
+        cluster={{.cluster}}
+        port=8080
+`, "cluster=prod")
+
+	if _, err := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"host1", "host2"} {
+		content, ok := remote.getUpload(host, "/etc/myapp/app.properties")
+		if !ok || string(content) != "cluster=prod\nport=8080\n" {
+			t.Errorf("unexpected upload on %s: %q", host, content)
+		}
+	}
+	errs := ambariRegistry.CopyContentToRemote(context.Background(), "", "/etc/myapp/empty", fakeHosts(1), false)
+	if content, ok := remote.getUpload("host1", "/etc/myapp/empty"); errs["host1"] != nil || !ok || len(content) != 0 {
+		t.Errorf("expected an empty file to be uploaded: %q, err: %v", content, errs["host1"])
+	}
+}
+
+func TestExecutePlaybookWithHostLimit(t *testing.T) {
+	captureOutput(t)
+	remote := &fakeRemote{}
+	ambariRegistry := useFakeRemote(t, remote, newFakeCluster(t, map[string][]string{"host1": {"HDFS_DATANODE"}, "host2": {"HDFS_DATANODE"}, "host3": {"YARN_NODEMANAGER"}}, nil), false)
+	source := filepath.Join(t.TempDir(), "source")
+	if err := ioutil.WriteFile(source, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	playbook := loadTestPlaybook(t, `
+name: limit
+tasks:
+  - name: "every host"
+    type: RemoteCommand
+    command: "hostname"
+  - name: "datanodes"
+    type: RemoteCommand
+    components: HDFS_DATANODE
+    command: "hdfs version"
+  - name: "upload"
+    type: Upload
+    hosts: host1,host2
+    parameters:
+      source: "{{.source}}"
+      target: /tmp/target
+  - name: "nodemanagers"
+    type: RemoteCommand
+    components: YARN_NODEMANAGER
+    command: "yarn version"
+`, "source="+source)
+	result, err := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{Limit: []string{"host2"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commands := strings.Join(remote.getCommands("host2"), ","); commands != "hostname,hdfs version,scp -t /tmp/target" {
+		t.Errorf("unexpected commands on the limited host: %s", commands)
+	}
+	for _, host := range []string{"host1", "host3"} {
+		if commands := remote.getCommands(host); len(commands) > 0 {
+			t.Errorf("expected no commands outside of the limit on %s: %v", host, commands)
+		}
+	}
+	if len(result.Tasks) != 4 || len(result.Tasks[3].Hosts) > 0 {
+		t.Errorf("expected the task without hosts in the limit to be skipped: %+v", result.Tasks)
+	}
+}
+
+func TestLimitHostsByNamesAndIps(t *testing.T) {
+	ambariRegistry := newTestAmbari(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"items":[{"Hosts":{"host_name":"c7401.internal","public_host_name":"c7401.example.com","ip":"10.0.0.1"}},` +
+			`{"Hosts":{"host_name":"c7402.internal","public_host_name":"c7402.example.com","ip":"10.0.0.2"}}]}`))
+	})
+	filteredHosts := map[string]bool{"10.0.0.1": true, "10.0.0.2": true}
+	for _, limit := range []string{"c7401.internal", "c7401.example.com", "10.0.0.1"} {
+		if hosts := ambariRegistry.LimitHosts(filteredHosts, []string{limit}); len(hosts) != 1 || !hosts["10.0.0.1"] {
+			t.Errorf("limit %s: unexpected hosts: %v", limit, hosts)
+		}
+	}
+	if hosts := ambariRegistry.LimitHosts(filteredHosts, nil); len(hosts) != 2 {
+		t.Errorf("expected no limit without hosts: %v", hosts)
+	}
+}
@@ -15,24 +15,154 @@
 package ambari
 
 import (
+	"context"
+	"encoding/csv"
 	"fmt"
-	"github.com/appleboy/easyssh-proxy"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
 )
 
-// DownloadViaScp downloads file from remote to local
-func DownloadViaScp(sshConfig *easyssh.MakeConfig, source string, dest string, skipJump bool) error {
-	userAndRemote := fmt.Sprintf("%v@%v", sshConfig.User, sshConfig.Server)
-	var args []string
-	if len(sshConfig.Proxy.Server) > 0 && !skipJump {
-		args = []string{"-o", fmt.Sprintf("ProxyJump=%v", sshConfig.Proxy.Server), "-o", "StrictHostKeyChecking=no", "-q", "-P", sshConfig.Port, "-i", sshConfig.KeyPath, userAndRemote + ":" + source, dest}
-	} else {
-		args = []string{"-o", "StrictHostKeyChecking=no", "-q", "-P", sshConfig.Port, "-i", sshConfig.KeyPath, userAndRemote + ":" + source, dest}
-	}
-	cmd := exec.Command("scp", args...)
-	if err := cmd.Run(); err != nil {
+// ConnectionError is returned when the ssh connection to a host (or to its jump host) cannot be opened (network or handshake problems)
+type ConnectionError struct {
+	Host string
+	Err  error
+}
+
+func (e *ConnectionError) Error() string {
+	return e.Err.Error()
+}
+
+// IsConnectionError reports whether an ssh error is caused by a connection problem (not by the remote command itself),
+// other errors (e.g. a missing local file or a failed command) are not connection errors
+func IsConnectionError(err error) bool {
+	switch err.(type) {
+	case *ConnectionError, net.Error:
+		return true
+	}
+	return false
+}
+
+// GetFailedHosts get the (sorted) hosts from remote responses where the connection was successful, but the command has been failed
+func GetFailedHosts(responses map[string]RemoteResponse) []string {
+	failedHosts := make([]string, 0)
+	for host, response := range responses {
+		if (response.Err != nil || response.ExitStatus != 0) && !response.Unreachable {
+			failedHosts = append(failedHosts, host)
+		}
+	}
+	sort.Strings(failedHosts)
+	return failedHosts
+}
+
+// GetTimedOutHosts get the (sorted) hosts from remote responses where the command did not finish in time
+func GetTimedOutHosts(responses map[string]RemoteResponse) []string {
+	timedOutHosts := make([]string, 0)
+	for host, response := range responses {
+		if response.TimedOut {
+			timedOutHosts = append(timedOutHosts, host)
+		}
+	}
+	sort.Strings(timedOutHosts)
+	return timedOutHosts
+}
+
+// GetUnreachableHosts get the (sorted) hosts from remote responses that could not be connected
+func GetUnreachableHosts(responses map[string]RemoteResponse) []string {
+	unreachableHosts := make([]string, 0)
+	for host, response := range responses {
+		if response.Unreachable {
+			unreachableHosts = append(unreachableHosts, host)
+		}
+	}
+	sort.Strings(unreachableHosts)
+	return unreachableHosts
+}
+
+// GetExitCode get the exit code of a remote (or local) command (-1 if it is unknown, e.g. the host was unreachable),
+// the ExitStatus of the response is used if it is set, otherwise the exit code is derived from the error of the command
+func GetExitCode(response RemoteResponse) int {
+	if response.ExitStatus != 0 {
+		return response.ExitStatus
+	}
+	if response.Err == nil {
+		if response.Unreachable {
+			return -1
+		}
+		return 0
+	}
+	if exitErr, ok := response.Err.(*ssh.ExitError); ok {
+		return exitErr.ExitStatus()
+	}
+	if exitErr, ok := response.Err.(*ExitCodeError); ok {
+		return exitErr.Code
+	}
+	if exitErr, ok := response.Err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus()
+		}
+	}
+	return -1
+}
+
+// withExitStatus set the ExitStatus of a command response based on its error (0: success, -1: unknown)
+func withExitStatus(response RemoteResponse) RemoteResponse {
+	response.ExitStatus = GetExitCode(response)
+	return response
+}
+
+// WriteRemoteResponsesCsv write remote responses as csv (host, exit_code, stdout, stderr, done columns, sorted by hosts)
+func WriteRemoteResponsesCsv(responses map[string]RemoteResponse, writer io.Writer) error {
+	csvWriter := csv.NewWriter(writer)
+	csvWriter.Write([]string{"host", "exit_code", "stdout", "stderr", "done"})
+	hosts := make([]string, 0)
+	for host := range responses {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		response := responses[host]
+		csvWriter.Write([]string{host, strconv.Itoa(GetExitCode(response)), response.StdOut, response.StdErr, strconv.FormatBool(response.Done)})
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// shellQuote quote a value (e.g. a path) for a remote shell command with single quotes
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+// downloadViaScp downloads file from a remote host to local (dest can be a folder as well), the copy is stopped if the context is cancelled.
+// The file is downloaded into the temporary directory of the run first, so a failed download does not leave a partial file behind
+func downloadViaScp(ctx context.Context, ssh remoteClient, host string, source string, dest string) error {
+	tmpFile, err := CreateTempFile("download-")
+	if err != nil {
+		return err
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+	if err := ssh.Download(ctx, source, tmpFile.Name()); err != nil {
+		return err
+	}
+	if destInfo, err := os.Stat(dest); err == nil && destInfo.IsDir() {
+		dest = filepath.Join(dest, path.Base(source))
+	}
+	// temporary files are created with 0600
+	if err := os.Chmod(tmpFile.Name(), 0644); err != nil {
+		return err
+	}
+	if err := moveFile(tmpFile.Name(), dest); err != nil {
 		return err
 	}
-	fmt.Println(fmt.Sprintf("Copy %v (host: %v) to location: %v", source, sshConfig.Server, dest))
+	outPrintln(fmt.Sprintf("Copy %v (host: %v) to location: %v", source, host, dest))
 	return nil
 }
@@ -0,0 +1,110 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// closedPort get a local port where nothing listens
+func closedPort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	return port
+}
+
+// brokenSshPort get a local port where the connections are closed right after they are accepted (the ssh handshake fails)
+func brokenSshPort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestIsConnectionError(t *testing.T) {
+	_, missingFileErr := os.Open(filepath.Join(t.TempDir(), "missing"))
+	_, dialErr := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(closedPort(t)))
+	cases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"nil", nil, false},
+		{"missing local file", missingFileErr, false},
+		{"exit code", &ExitCodeError{Code: 1}, false},
+		{"command timeout", ErrCommandTimeout, false},
+		{"transfer timeout", ErrTransferTimeout, false},
+		{"cancelled", context.Canceled, false},
+		{"other", errors.New("scp: /etc/x: Permission denied"), false},
+		{"dial", dialErr, true},
+		{"connection", &ConnectionError{Host: "host1", Err: errors.New("ssh: handshake failed: EOF")}, true},
+	}
+	for _, c := range cases {
+		if actual := IsConnectionError(c.err); actual != c.expected {
+			t.Errorf("%s (%v): expected %v, got %v", c.name, c.err, c.expected, actual)
+		}
+	}
+}
+
+func TestSshConnectErrorsAreConnectionErrors(t *testing.T) {
+	for name, port := range map[string]int{"refused": closedPort(t), "handshake": brokenSshPort(t)} {
+		config := &SshConfig{User: "root", Password: "secret", Server: "127.0.0.1", Port: strconv.Itoa(port), Timeout: 5 * time.Second}
+		_, _, done, err := config.Run(context.Background(), "hostname", 5)
+		if err == nil || done || !IsConnectionError(err) {
+			t.Errorf("%s: expected a connection error, got done: %v, err: %v", name, done, err)
+		}
+	}
+}
+
+func TestUploadOfMissingSourceIsNotUnreachable(t *testing.T) {
+	remote := &fakeRemote{}
+	ambariRegistry := useFakeRemote(t, remote, newTestAmbari(t, emptyItemsHandler), false)
+	source := filepath.Join(t.TempDir(), "missing")
+
+	copyErrors := ambariRegistry.CopyToRemote(context.Background(), source, "/tmp/missing", fakeHosts(2), false)
+
+	if err := checkCopyErrors(copyErrors, true); err == nil {
+		t.Errorf("expected the upload of a missing file to fail even if unreachable hosts are ignored: %v", copyErrors)
+	}
+	unreachable := map[string]error{"host1": nil, "host2": &ConnectionError{Host: "host2", Err: errors.New("connection refused")}}
+	if err := checkCopyErrors(unreachable, true); err != nil {
+		t.Errorf("expected unreachable hosts to be skipped: %v", err)
+	}
+	if err := checkCopyErrors(unreachable, false); err == nil {
+		t.Error("expected unreachable hosts to fail the upload by default")
+	}
+}
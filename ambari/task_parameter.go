@@ -0,0 +1,120 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import "fmt"
+
+// TaskParameter describes a parameter of a task type: whether it is required, or what its default value is
+type TaskParameter struct {
+	Name     string
+	Required bool
+	Default  string
+}
+
+// taskParameterSpecs holds the parameters of the task types (in the order they are validated)
+var taskParameterSpecs = map[string][]TaskParameter{
+	Config: {
+		{Name: "config_type", Required: true},
+		{Name: "config_key"},
+		{Name: "config_value"},
+		{Name: "operation", Default: ConfigSet},
+		{Name: "note"},
+		{Name: "tag"},
+		{Name: "version"},
+	},
+	Upload: {
+		{Name: "source"},
+		{Name: "content"},
+		{Name: "target", Required: true},
+		{Name: "verify_size", Default: "false"},
+		{Name: "template", Default: "false"},
+	},
+	Download: {
+		{Name: "url", Required: true},
+		{Name: "file", Required: true},
+		{Name: "sha256"},
+		{Name: "md5"},
+		{Name: "timeout"},
+		{Name: "username"},
+		{Name: "password"},
+	},
+	AmbariCommand: {
+		{Name: "timeout", Default: fmt.Sprintf("%d", int(defaultAmbariCommandTimeout.Seconds()))},
+	},
+	AddService: {
+		{Name: "service", Required: true},
+		{Name: "start", Default: "false"},
+		{Name: "timeout", Default: fmt.Sprintf("%d", int(defaultAmbariCommandTimeout.Seconds()))},
+	},
+	ConfigGroupTask: {
+		{Name: "group", Required: true},
+		{Name: "service"},
+		{Name: "description"},
+		{Name: "operation", Default: ConfigGroupCreate},
+	},
+	ServiceCheck: {
+		{Name: "timeout", Default: fmt.Sprintf("%d", int(defaultServiceCheckTimeout.Seconds()))},
+	},
+	AlertCheck: {
+		{Name: "min_severity", Default: AlertCritical},
+		{Name: "wait", Default: "false"},
+		{Name: "timeout", Default: fmt.Sprintf("%d", int(defaultServiceCheckTimeout.Seconds()))},
+		{Name: "poll_interval", Default: fmt.Sprintf("%d", int(defaultRequestPollInterval.Seconds()))},
+	},
+	HostMaintenance: {
+		{Name: "state", Required: true},
+	},
+	WaitForState: {
+		{Name: "desired_state", Required: true},
+		{Name: "timeout", Default: fmt.Sprintf("%d", int(defaultServiceCheckTimeout.Seconds()))},
+		{Name: "poll_interval", Default: fmt.Sprintf("%d", int(defaultRequestPollInterval.Seconds()))},
+	},
+	Mapping: {
+		{Name: "file", Required: true},
+		{Name: "by", Default: MappingByComponent},
+		{Name: "format", Default: "json"},
+	},
+	Maintenance: {
+		{Name: "reason"},
+	},
+	Assert: {
+		{Name: "message"},
+	},
+}
+
+// ApplyTaskParameterSpec check that the required parameters of a task are set and fill the missing ones with their default values
+func ApplyTaskParameterSpec(task Task) (Task, error) {
+	specs, ok := taskParameterSpecs[task.Type]
+	if !ok {
+		return task, nil
+	}
+	parameters := make(map[string]string)
+	for name, value := range task.Parameters {
+		parameters[name] = value
+	}
+	for _, spec := range specs {
+		if _, ok := parameters[spec.Name]; ok {
+			continue
+		}
+		if spec.Required {
+			return task, fmt.Errorf("'%s' parameter is required for '%s' task", spec.Name, task.Type)
+		}
+		if len(spec.Default) > 0 {
+			parameters[spec.Name] = spec.Default
+		}
+	}
+	task.Parameters = parameters
+	return task, nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+var (
+	runTempDir           string
+	keepTempDirOnFailure bool
+	runTempDirMutex      sync.Mutex
+)
+
+// SetKeepTempDirOnFailure preserve the temporary directory of a failed run for debugging
+func SetKeepTempDirOnFailure(keep bool) {
+	keepTempDirOnFailure = keep
+}
+
+// GetRunTempDir get the temporary directory of the actual run (it is created on first use)
+func GetRunTempDir() (string, error) {
+	runTempDirMutex.Lock()
+	defer runTempDirMutex.Unlock()
+	if len(runTempDir) == 0 {
+		dir, err := ioutil.TempDir("", "ambarictl-")
+		if err != nil {
+			return "", err
+		}
+		runTempDir = dir
+	}
+	return runTempDir, nil
+}
+
+// CreateTempFile create a new temporary file inside the temporary directory of the actual run
+func CreateTempFile(pattern string) (*os.File, error) {
+	dir, err := GetRunTempDir()
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.TempFile(dir, pattern)
+}
+
+// CleanupRunTempDir remove the temporary directory of the actual run (it is kept if the run failed and keeping it was requested)
+func CleanupRunTempDir(failed bool) {
+	runTempDirMutex.Lock()
+	defer runTempDirMutex.Unlock()
+	if len(runTempDir) == 0 {
+		return
+	}
+	if failed && keepTempDirOnFailure {
+		outPrintln(fmt.Sprintf("Temporary files are kept at: %s", runTempDir))
+	} else if err := os.RemoveAll(runTempDir); err != nil {
+		errPrintln(err)
+	}
+	runTempDir = ""
+}
+
+// moveFile move a file to a new location, it falls back to copy if the locations are on different devices (the file mode is kept)
+func moveFile(source string, dest string) error {
+	if err := os.Rename(source, dest); err == nil {
+		return nil
+	}
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	sourceInfo, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, sourceInfo.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return err
+	}
+	if err = out.Close(); err != nil {
+		os.Remove(dest)
+		return err
+	}
+	return os.Remove(source)
+}
@@ -0,0 +1,103 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCleanupRunTempDir(t *testing.T) {
+	file, err := CreateTempFile("test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	dir := filepath.Dir(file.Name())
+	CleanupRunTempDir(false)
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("temporary directory %s is not removed", dir)
+	}
+
+	SetKeepTempDirOnFailure(true)
+	defer SetKeepTempDirOnFailure(false)
+	keptDir, err := GetRunTempDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(keptDir)
+	CleanupRunTempDir(true)
+	if _, err := os.Stat(keptDir); err != nil {
+		t.Errorf("temporary directory of the failed run is not kept: %v", err)
+	}
+	if newDir, _ := GetRunTempDir(); newDir == keptDir {
+		t.Error("the next run uses the kept temporary directory")
+	}
+	CleanupRunTempDir(false)
+}
+
+func TestDownloadFileIsReadableByOthers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+	defer CleanupRunTempDir(false)
+	dest := filepath.Join(t.TempDir(), "downloaded")
+	if err := DownloadFile(context.Background(), dest, server.URL, DownloadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("expected file mode 0644, got %v", info.Mode().Perm())
+	}
+}
+
+func TestUploadTemplateIsRenderedToTempDir(t *testing.T) {
+	remote := &fakeRemote{}
+	ambariRegistry := useFakeRemote(t, remote, newFakeCluster(t, map[string][]string{"host1": nil, "host2": nil}, nil), false)
+	defer CleanupRunTempDir(false)
+	source := filepath.Join(t.TempDir(), "app.properties")
+	if err := ioutil.WriteFile(source, []byte("port={{.port}}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	task := Task{Name: "upload", Type: Upload, HostFilter: "host1",
+		Parameters: map[string]string{"source": source, "target": "/etc/app.properties", "template": "true"}}
+
+	_, _, err := ambariRegistry.executeTask(context.Background(), task, map[string]string{"port": "8886"}, map[string]interface{}{}, PlaybookOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, ok := remote.getUpload("host1", "/etc/app.properties")
+	if !ok || string(content) != "port=8886\n" {
+		t.Errorf("unexpected uploaded content: %q", content)
+	}
+	if _, ok := remote.getUpload("host2", "/etc/app.properties"); ok {
+		t.Error("the file is uploaded to a host that is not selected")
+	}
+	dir, _ := GetRunTempDir()
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 || !strings.HasPrefix(files[0].Name(), "upload-") {
+		t.Errorf("the rendered file is not in the temporary directory: %v", files)
+	}
+}
@@ -14,27 +14,77 @@
 
 package ambari
 
+import "context"
+
 // AmbariRegistry represents registered ambari server entry details
 type AmbariRegistry struct {
-	Name              string `json:"name"`
-	Hostname          string `json:"hostname"`
-	Port              int    `json:"port"`
-	Username          string `json:"username"`
-	Password          string `json:"password"`
-	Protocol          string `json:"protocol"`
-	Cluster           string `json:"cluster"`
-	Active            bool   `json:"active"`
-	ConnectionProfile string `json:"profile"`
+	Name              string   `json:"name" yaml:"name"`
+	Hostname          string   `json:"hostname" yaml:"hostname"`
+	Port              int      `json:"port" yaml:"port"`
+	Username          string   `json:"username" yaml:"username"`
+	Password          string   `json:"password" yaml:"password"`
+	PasswordEncrypted bool     `json:"password_encrypted,omitempty" yaml:"password_encrypted,omitempty"`
+	PasswordCommand   string   `json:"password_command,omitempty" yaml:"password_command,omitempty"`
+	Protocol          string   `json:"protocol" yaml:"protocol"`
+	Cluster           string   `json:"cluster" yaml:"cluster"`
+	Active            bool     `json:"active" yaml:"active"`
+	ConnectionProfile string   `json:"profile" yaml:"profile"`
+	ServerHosts       []string `json:"server_hosts,omitempty" yaml:"server_hosts,omitempty"`
+	InsecureTLS       bool     `json:"insecure_tls,omitempty" yaml:"insecure_tls,omitempty"`
+	CACertPath        string   `json:"ca_cert,omitempty" yaml:"ca_cert,omitempty"`
+	RequestTimeout    int      `json:"request_timeout,omitempty" yaml:"request_timeout,omitempty"`
+	// become run the remote commands with sudo (set by playbook tasks, not stored)
+	become bool
+	// parallelism overrides the number of hosts that are contacted at once (set by playbook tasks, not stored)
+	parallelism int
+	// ctx cancels the REST calls of a running playbook task (set by playbook tasks, not stored)
+	ctx context.Context
+	// hostLimited the filtered hosts of a running playbook task are restricted by the host limit of the playbook execution (not stored)
+	hostLimited bool
+}
+
+// AmbariRegistryUpdate holds the fields of an ambari server entry that needs to be changed (nil fields are left intact)
+type AmbariRegistryUpdate struct {
+	Hostname        *string
+	Port            *int
+	Protocol        *string
+	Username        *string
+	Password        *string
+	PasswordCommand *string
+	Cluster         *string
+	ServerHosts     []string
+	InsecureTLS     *bool
+	CACertPath      *string
+	RequestTimeout  *int
 }
 
 // ConnectionProfile represents ssh/connection descriptions which is used to communicate with Ambari server and agents
 type ConnectionProfile struct {
-	Name         string `json:"name"`
-	KeyPath      string `json:"key_path"`
-	Port         int    `json:"port"`
-	Username     string `json:"username"`
-	HostJump     bool   `json:"host_jump"`
-	ProxyAddress string `json:"proxy_address"`
+	Name                    string   `json:"name" yaml:"name"`
+	KeyPath                 string   `json:"key_path" yaml:"key_path"`
+	Port                    int      `json:"port" yaml:"port"`
+	Username                string   `json:"username" yaml:"username"`
+	Password                string   `json:"password,omitempty" yaml:"password,omitempty"`
+	PasswordEncrypted       bool     `json:"password_encrypted,omitempty" yaml:"password_encrypted,omitempty"`
+	PasswordCommand         string   `json:"password_command,omitempty" yaml:"password_command,omitempty"`
+	HostJump                bool     `json:"host_jump" yaml:"host_jump"`
+	ProxyAddress            string   `json:"proxy_address" yaml:"proxy_address"`
+	Ciphers                 []string `json:"ciphers,omitempty" yaml:"ciphers,omitempty"`
+	MACs                    []string `json:"macs,omitempty" yaml:"macs,omitempty"`
+	KeyExchanges            []string `json:"key_exchanges,omitempty" yaml:"key_exchanges,omitempty"`
+	ReconnectRetries        int      `json:"reconnect_retries,omitempty" yaml:"reconnect_retries,omitempty"`
+	Become                  bool     `json:"become,omitempty" yaml:"become,omitempty"`
+	BecomePassword          string   `json:"become_password,omitempty" yaml:"become_password,omitempty"`
+	BecomePasswordEncrypted bool     `json:"become_password_encrypted,omitempty" yaml:"become_password_encrypted,omitempty"`
+	HostKeyChecking         string   `json:"host_key_checking,omitempty" yaml:"host_key_checking,omitempty"`
+	KnownHostsFile          string   `json:"known_hosts_file,omitempty" yaml:"known_hosts_file,omitempty"`
+}
+
+// Environment bundles an ambari server entry with a connection profile, so they can be selected together
+type Environment struct {
+	Name              string `json:"name" yaml:"name"`
+	AmbariEntry       string `json:"ambari_entry" yaml:"ambari_entry"`
+	ConnectionProfile string `json:"profile" yaml:"profile"`
 }
 
 // AmbariItems global items from Ambari rest API response
@@ -73,9 +123,12 @@ type Component struct {
 
 // HostComponent ambari managed host component details
 type HostComponent struct {
-	HostComponentName  string `json:"host_component_name,omitempty"`
-	HostComponentState string `json:"state,omitempty"`
-	HostComponntHost   string `json:"host_name,omitempty"`
+	HostComponentName    string `json:"host_component_name,omitempty"`
+	HostComponentState   string `json:"state,omitempty"`
+	HostComponntHost     string `json:"host_name,omitempty"`
+	HostComponentVersion string `json:"version,omitempty"`
+	HostComponentService string `json:"service_name,omitempty"`
+	StaleConfigs         bool   `json:"stale_configs,omitempty"`
 }
 
 // ServiceConfig represents service specific configurations
@@ -108,6 +161,97 @@ type Cluster struct {
 	ClusterSecurityType string  `json:"security_type,omitempty"`
 }
 
+// Request represents an (asynchronous) ambari request with its progress
+type Request struct {
+	ID                 float64 `json:"id,omitempty"`
+	Status             string  `json:"request_status,omitempty"`
+	Context            string  `json:"request_context,omitempty"`
+	ProgressPercent    float64 `json:"progress_percent,omitempty"`
+	TaskCount          float64 `json:"task_count,omitempty"`
+	CompletedTaskCount float64 `json:"completed_task_count,omitempty"`
+	FailedTaskCount    float64 `json:"failed_task_count,omitempty"`
+}
+
+// RequestTask represents a task (command on a host) of an ambari request
+type RequestTask struct {
+	CommandDetail string `json:"command_detail,omitempty"`
+	HostName      string `json:"host_name,omitempty"`
+	Status        string `json:"status,omitempty"`
+}
+
+// RequestTasksResponse wraps the task items of an ambari request
+type RequestTasksResponse struct {
+	Items []struct {
+		Task RequestTask `json:"Tasks,omitempty"`
+	} `json:"items,omitempty"`
+}
+
+// ClustersResponse wraps the cluster items of an ambari response
+type ClustersResponse struct {
+	Items []struct {
+		Cluster Cluster `json:"Clusters,omitempty"`
+	} `json:"items,omitempty"`
+}
+
+// Alert represents the current state of an ambari alert (on a host, or cluster-wide if there is no host)
+type Alert struct {
+	DefinitionName   string `json:"definition_name,omitempty"`
+	Label            string `json:"label,omitempty"`
+	ServiceName      string `json:"service_name,omitempty"`
+	ComponentName    string `json:"component_name,omitempty"`
+	HostName         string `json:"host_name,omitempty"`
+	State            string `json:"state,omitempty"`
+	Text             string `json:"text,omitempty"`
+	MaintenanceState string `json:"maintenance_state,omitempty"`
+}
+
+// AlertsResponse wraps the alert items of an ambari response
+type AlertsResponse struct {
+	Items []struct {
+		Alert Alert `json:"Alert,omitempty"`
+	} `json:"items,omitempty"`
+}
+
+// ConfigGroup represents an ambari config group: config overrides for a subset of the hosts of a service
+type ConfigGroup struct {
+	ID          float64 `json:"id,omitempty"`
+	GroupName   string  `json:"group_name,omitempty"`
+	ServiceName string  `json:"tag,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Hosts       []struct {
+		HostName string `json:"host_name,omitempty"`
+	} `json:"hosts,omitempty"`
+}
+
+// ConfigGroupsResponse wraps the config group items of an ambari response
+type ConfigGroupsResponse struct {
+	Items []struct {
+		ConfigGroup ConfigGroup `json:"ConfigGroup,omitempty"`
+	} `json:"items,omitempty"`
+}
+
+// ServiceConfigVersion represents a service config version (a snapshot of the config types of a service)
+type ServiceConfigVersion struct {
+	ServiceName    string          `json:"service_name,omitempty"`
+	Version        int             `json:"service_config_version,omitempty"`
+	IsCurrent      bool            `json:"is_current,omitempty"`
+	Note           string          `json:"service_config_version_note,omitempty"`
+	User           string          `json:"user,omitempty"`
+	CreateTime     int64           `json:"createtime,omitempty"`
+	Configurations []ServiceConfig `json:"configurations,omitempty"`
+}
+
+// ServiceConfigVersionsResponse wraps the service config version items of an ambari response
+type ServiceConfigVersionsResponse struct {
+	Items []ServiceConfigVersion `json:"items,omitempty"`
+}
+
+// RequestResponse wraps the request details of an ambari response
+type RequestResponse struct {
+	Href    string  `json:"href,omitempty"`
+	Request Request `json:"Requests,omitempty"`
+}
+
 // Properties represents configuration properties (key/value pairs)
 type Properties map[string]interface{}
 
@@ -0,0 +1,91 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var taskTypes = []string{RemoteCommand, LocalCommand, Download, Upload, Config, AmbariCommand, ServiceCheck, VersionCheck, Assert, Mapping, Maintenance, WaitForState, HostMaintenance, AddService, AlertCheck, ConfigGroupTask}
+
+// ValidatePlaybook checks the types and the required parameters of all the tasks (and verify tasks) of a playbook,
+// and the types and patterns of the inputs, returns every problem that is found (empty if the playbook is valid)
+func ValidatePlaybook(playbook Playbook) []error {
+	validationErrors := make([]error, 0)
+	for _, input := range playbook.Inputs {
+		if !containsString([]string{"", "string", "int", "bool"}, strings.ToLower(input.Type)) {
+			validationErrors = append(validationErrors, fmt.Errorf("Unknown type '%s' of input '%s' (supported types: string, int, bool)", input.Type, input.Name))
+		}
+		if _, err := regexp.Compile(input.Pattern); err != nil {
+			validationErrors = append(validationErrors, fmt.Errorf("Invalid pattern of input '%s': %v", input.Name, err))
+		}
+	}
+	for _, task := range append(playbook.Tasks, playbook.Verify...) {
+		if err := validateTask(task); err != nil {
+			validationErrors = append(validationErrors, err)
+		}
+	}
+	return validationErrors
+}
+
+// validateTask checks the type, the required parameters and the fields of a task that are supported only by specific types
+func validateTask(task Task) error {
+	if len(task.Type) == 0 {
+		if len(task.Name) > 0 {
+			return fmt.Errorf("Type field for task '%s' is required!", task.Name)
+		}
+		return errors.New("Type field for task is required!")
+	}
+	if !containsString(taskTypes, task.Type) {
+		return fmt.Errorf("Unknown type '%s' of task '%s' (supported types: %s)", task.Type, task.Name, strings.Join(taskTypes, ", "))
+	}
+	if _, err := ApplyTaskParameterSpec(task); err != nil {
+		return fmt.Errorf("Task '%s': %v", task.Name, err)
+	}
+	if task.Type == Upload {
+		_, hasSource := task.Parameters["source"]
+		_, hasContent := task.Parameters["content"]
+		if hasSource == hasContent {
+			return fmt.Errorf("Task '%s': exactly one of 'source' and 'content' parameters is required for '%s' task", task.Name, Upload)
+		}
+		if EvaluateBoolValueFromString(task.Parameters["template"]) && !hasSource {
+			return fmt.Errorf("Task '%s': 'template' parameter of '%s' task needs a 'source' file", task.Name, Upload)
+		}
+	}
+	if len(task.Register) > 0 && task.Type != RemoteCommand && task.Type != LocalCommand && task.Type != Config {
+		return fmt.Errorf("'register' field of task '%s' is supported only for '%s', '%s' and '%s' tasks", task.Name, RemoteCommand, LocalCommand, Config)
+	}
+	if task.Become && task.Type != RemoteCommand {
+		return fmt.Errorf("'become' field of task '%s' is supported only for '%s' tasks", task.Name, RemoteCommand)
+	}
+	if task.Shell && task.Type != LocalCommand {
+		return fmt.Errorf("'shell' field of task '%s' is supported only for '%s' tasks", task.Name, LocalCommand)
+	}
+	if len(task.HostComponentFilter) > 0 {
+		if task.Type != AmbariCommand {
+			return fmt.Errorf("'host_component_filter' field of task '%s' is supported only for '%s' tasks", task.Name, AmbariCommand)
+		}
+		if _, err := ParseHostComponentFilter(task.HostComponentFilter); err != nil {
+			return fmt.Errorf("Task '%s': %v", task.Name, err)
+		}
+	}
+	if (len(task.Workdir) > 0 || len(task.Env) > 0) && task.Type != LocalCommand {
+		return fmt.Errorf("'workdir' and 'env' fields of task '%s' are supported only for '%s' tasks", task.Name, LocalCommand)
+	}
+	return nil
+}
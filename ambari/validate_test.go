@@ -0,0 +1,70 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateTask(t *testing.T) {
+	invalidTasks := []Task{
+		{Name: "no type"},
+		{Name: "unknown type", Type: "RemoteComand"},
+		{Name: "register", Type: Upload, Register: "out", Parameters: map[string]string{"source": "a", "target": "b"}},
+		{Name: "upload without source", Type: Upload, Parameters: map[string]string{"target": "b"}},
+		{Name: "become", Type: LocalCommand, Become: true, Command: "true"},
+		{Name: "shell", Type: RemoteCommand, Shell: true, Command: "true"},
+		{Name: "env", Type: RemoteCommand, Env: map[string]string{"A": "b"}, Command: "true"},
+	}
+	for _, task := range invalidTasks {
+		if err := validateTask(task); err == nil {
+			t.Errorf("expected task '%s' to be invalid", task.Name)
+		}
+	}
+	if err := validateTask(Task{Name: "valid", Type: LocalCommand, Shell: true, Command: "true", Register: "out"}); err != nil {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+}
+
+func TestExecutePlaybookValidatesEveryTaskFirst(t *testing.T) {
+	ambariRegistry := newTestAmbari(t, emptyItemsHandler)
+	dir := t.TempDir()
+	playbook := loadTestPlaybook(t, `
+name: invalid
+tasks:
+  - name: "valid"
+    type: LocalCommand
+    shell: true
+    command: "touch {{.dir}}/valid"
+  - name: "invalid"
+    type: Unknown
+verify:
+  - name: "no type"
+`, "dir="+dir)
+	playbook.Inputs = []Input{{Name: "size", Type: "number"}}
+
+	if errs := ValidatePlaybook(playbook); len(errs) != 3 {
+		t.Errorf("expected 3 validation errors, got: %v", errs)
+	}
+	if _, err := ambariRegistry.ExecutePlaybook(context.Background(), playbook, PlaybookOptions{}); err == nil {
+		t.Error("expected the invalid playbook to fail")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "valid")); !os.IsNotExist(err) {
+		t.Error("a task of the invalid playbook has been executed")
+	}
+}
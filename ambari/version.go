@@ -0,0 +1,85 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// unknownVersion is used for host components that do not report any version
+const unknownVersion = "UNKNOWN"
+
+// VersionSkew holds the majority version of a component and the hosts that have a different version installed
+type VersionSkew struct {
+	Component       string
+	MajorityVersion string
+	HostVersions    map[string]string
+	SkewedHosts     []string
+}
+
+// GetVersionSkew collect the installed versions of a component across hosts and compare them to the majority version
+func (a AmbariRegistry) GetVersionSkew(component string) VersionSkew {
+	return CalculateVersionSkew(component, a.ListHostComponentVersions(component))
+}
+
+// CalculateVersionSkew find the hosts where the component version differs from the majority
+func CalculateVersionSkew(component string, hostComponents []HostComponent) VersionSkew {
+	versionSkew := VersionSkew{Component: component, HostVersions: make(map[string]string), SkewedHosts: make([]string, 0)}
+	versionCounts := make(map[string]int)
+	for _, hostComponent := range hostComponents {
+		version := hostComponent.HostComponentVersion
+		if len(version) == 0 {
+			version = unknownVersion
+		}
+		versionSkew.HostVersions[hostComponent.HostComponntHost] = version
+		versionCounts[version]++
+	}
+	for version, count := range versionCounts {
+		majorityCount := versionCounts[versionSkew.MajorityVersion]
+		if count > majorityCount || (count == majorityCount && version > versionSkew.MajorityVersion) {
+			versionSkew.MajorityVersion = version
+		}
+	}
+	for host, version := range versionSkew.HostVersions {
+		if version != versionSkew.MajorityVersion {
+			versionSkew.SkewedHosts = append(versionSkew.SkewedHosts, host)
+		}
+	}
+	sort.Strings(versionSkew.SkewedHosts)
+	return versionSkew
+}
+
+// ExecuteVersionCheckTask fails if any of the filtered components has a different version on some hosts than the majority
+func (a AmbariRegistry) ExecuteVersionCheckTask(task Task) error {
+	if len(task.ComponentFilter) == 0 {
+		return fmt.Errorf("'components' field is required for '%s' task", VersionCheck)
+	}
+	filter := CreateFilter("", task.ComponentFilter, "", false)
+	for _, component := range filter.Components {
+		versionSkew := a.GetVersionSkew(component)
+		if len(versionSkew.SkewedHosts) > 0 {
+			skewedHosts := make([]string, 0)
+			for _, host := range versionSkew.SkewedHosts {
+				skewedHosts = append(skewedHosts, fmt.Sprintf("%s (%s)", host, versionSkew.HostVersions[host]))
+			}
+			return fmt.Errorf("Version of %s differs from the majority version (%s) on hosts: %s",
+				component, versionSkew.MajorityVersion, strings.Join(skewedHosts, ", "))
+		}
+		outPrintln(fmt.Sprintf("%s has the same version on all hosts: %s", component, versionSkew.MajorityVersion))
+	}
+	return nil
+}
@@ -16,6 +16,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/oleewere/ambarictl/ambari"
@@ -23,9 +24,13 @@ import (
 	"github.com/urfave/cli"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"os/user"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
 // Version that will be generated during the build as a constant
@@ -49,6 +54,30 @@ func main() {
 		app.Version = app.Version + fmt.Sprintf(" (git short hash: %v)", GitRevString)
 	}
 
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "log-level", Value: "info", Usage: "Minimum level of the printed outputs: debug, info, warn or error"},
+		cli.BoolFlag{Name: "verbose", Usage: "Print debug outputs as well (e.g. REST requests and executed commands), same as --log-level debug"},
+		cli.BoolFlag{Name: "quiet", Usage: "Print only errors, same as --log-level error"},
+		cli.StringFlag{Name: "cluster", Usage: "Target cluster if the active Ambari server entry does not pin one"},
+		cli.IntFlag{Name: "transfer-timeout", Usage: "Timeout (in seconds) of the file copies to or from the hosts, independent of the command timeouts (default: no timeout)"},
+	}
+	app.Before = func(c *cli.Context) error {
+		level, err := ambari.ParseLogLevel(c.String("log-level"))
+		if err != nil {
+			return err
+		}
+		if c.Bool("verbose") {
+			level = ambari.LevelDebug
+		}
+		if c.Bool("quiet") {
+			level = ambari.LevelError
+		}
+		ambari.SetLogLevel(level)
+		ambari.SetSelectedCluster(c.String("cluster"))
+		ambari.SetTransferTimeout(c.Int("transfer-timeout"))
+		return nil
+	}
+
 	app.Commands = []cli.Command{}
 	initCommand := cli.Command{
 		Name:  "init",
@@ -65,7 +94,16 @@ func main() {
 		Aliases: []string{"ls"},
 		Usage:   "Print all registered Ambari servers",
 		Action: func(c *cli.Context) error {
-			ambariServerEntries := ambari.ListAmbariRegistryEntries()
+			ambariServerEntries := ambari.MaskPasswords(ambari.ListAmbariRegistryEntries())
+			if c.Bool("json") {
+				ambariServerJson, err := json.Marshal(ambariServerEntries)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				printJson(ambariServerJson)
+				return nil
+			}
 			var tableData [][]string
 			for _, ambariServer := range ambariServerEntries {
 				activeValue := "false"
@@ -78,6 +116,9 @@ func main() {
 			printTable("AMBARI REGISTRIES:", []string{"Name", "HOSTNAME", "PORT", "PROTOCOL", "USER", "PASSWORD", "CLUSTER", "PROFILE", "ACTIVE"}, tableData, c)
 			return nil
 		},
+		Flags: []cli.Flag{
+			cli.BoolFlag{Name: "json", Usage: "Print the entries in json format (with masked passwords)"},
+		},
 	}
 
 	profileCommand := cli.Command{
@@ -117,6 +158,11 @@ func main() {
 						os.Exit(1)
 					}
 					userName := ambari.GetStringFlag(c.String("username"), "root", "Enter ssh username")
+					passwordCommand := c.String("password_command")
+					password := c.String("password")
+					if len(keyPath) == 0 && len(passwordCommand) == 0 {
+						password = ambari.GetPassword(password, "Enter ssh password")
+					}
 					hostJumpStr := ambari.GetStringFlag(c.String("host_jump"), "n", "Use host jump?")
 					hostJump := ambari.EvaluateBoolValueFromString(hostJumpStr)
 					proxyAddress := ""
@@ -126,7 +172,13 @@ func main() {
 							proxyAddress = ""
 						}
 					}
-					ambari.RegisterNewConnectionProfile(name, keyPath, port, userName, hostJump, proxyAddress)
+					err = ambari.RegisterNewConnectionProfile(name, keyPath, port, userName, password, passwordCommand, hostJump, proxyAddress,
+						splitFlagValues(c.String("ciphers")), splitFlagValues(c.String("macs")), splitFlagValues(c.String("kex")), c.Int("reconnect-retries"),
+						c.Bool("become"), c.String("become-password"), c.String("host-key-checking"), strings.Replace(c.String("known-hosts-file"), "~", home, -1))
+					if err != nil {
+						fmt.Println(err)
+						os.Exit(1)
+					}
 					fmt.Println("New connection profile entry has been created: " + name)
 					return nil
 				},
@@ -137,6 +189,16 @@ func main() {
 					cli.StringFlag{Name: "username", Usage: "Protocol for Ambar REST API: http/https"},
 					cli.StringFlag{Name: "host_jump", Usage: "User name for Ambari server"},
 					cli.StringFlag{Name: "proxy_address", Usage: "Password for Ambari user"},
+					cli.StringFlag{Name: "password", Usage: "Ssh password (used if there is no key path or password command)"},
+					cli.StringFlag{Name: "password_command", Usage: "Command that prints the ssh password to the standard output (e.g. a secret manager client)"},
+					cli.StringFlag{Name: "ciphers", Usage: "Extra (legacy) ssh ciphers, comma separated (e.g. aes128-cbc,3des-cbc), weakens security, use only for old hosts"},
+					cli.StringFlag{Name: "macs", Usage: "Extra (legacy) ssh MAC algorithms, comma separated, weakens security, use only for old hosts"},
+					cli.StringFlag{Name: "kex", Usage: "Extra (legacy) ssh key exchange algorithms, comma separated (e.g. diffie-hellman-group1-sha1), weakens security, use only for old hosts"},
+					cli.IntFlag{Name: "reconnect-retries", Usage: "Run a remote command again on a new connection (at most this many times) if the connection drops during the command"},
+					cli.BoolFlag{Name: "become", Usage: "Run the remote commands with sudo"},
+					cli.StringFlag{Name: "become-password", Usage: "Sudo password (piped to sudo, defaults to the ssh password)"},
+					cli.StringFlag{Name: "host-key-checking", Usage: "Host key checking mode: strict (verify against the known hosts file) or insecure (accept any host key, default)"},
+					cli.StringFlag{Name: "known-hosts-file", Usage: "Known hosts file for strict host key checking (default: ~/.ssh/known_hosts)"},
 				},
 			},
 			{
@@ -167,13 +229,11 @@ func main() {
 						os.Exit(1)
 					}
 					name := c.Args().First()
-					profileEntryId := ambari.GetConnectionProfileEntryId(name)
-					if len(profileEntryId) == 0 {
-						fmt.Println("Connection profile entry does not exist with id " + name)
+					if err := ambari.DeleteConnectionProfile(name); err != nil {
+						fmt.Println(err)
 						os.Exit(1)
 					}
-					ambari.DeRegisterConnectionProfile(profileEntryId)
-					msg := fmt.Sprintf("Connection profile '%s' has been deleted successfully", profileEntryId)
+					msg := fmt.Sprintf("Connection profile '%s' has been deleted successfully", name)
 					fmt.Println(msg)
 					return nil
 				},
@@ -191,6 +251,81 @@ func main() {
 		},
 	}
 
+	environmentCommand := cli.Command{
+		Name:  "envs",
+		Usage: "Environment (Ambari server entry + connection profile) related commands",
+		Subcommands: []cli.Command{
+			{
+				Name:    "create",
+				Aliases: []string{"c"},
+				Usage:   "Create new environment",
+				Action: func(c *cli.Context) error {
+					name := ambari.GetStringFlag(c.String("name"), "", "Enter environment name")
+					ambariEntry := ambari.GetStringFlag(c.String("ambari"), "", "Enter Ambari server entry name")
+					profile := ambari.GetStringFlag(c.String("profile"), "none", "Enter connection profile name")
+					if profile == "none" {
+						profile = ""
+					}
+					ambari.RegisterNewEnvironment(name, ambariEntry, profile)
+					fmt.Println("New environment entry has been created: " + name)
+					return nil
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "name", Usage: "Name of the environment"},
+					cli.StringFlag{Name: "ambari", Usage: "Name of the Ambari server entry"},
+					cli.StringFlag{Name: "profile", Usage: "Name of the connection profile"},
+				},
+			},
+			{
+				Name:    "list",
+				Aliases: []string{"ls"},
+				Usage:   "Print all environment entries",
+				Action: func(c *cli.Context) error {
+					environments := ambari.ListEnvironmentEntries()
+					var tableData [][]string
+					for _, environment := range environments {
+						tableData = append(tableData, []string{environment.Name, environment.AmbariEntry, environment.ConnectionProfile})
+					}
+					printTable("ENVIRONMENTS:", []string{"NAME", "AMBARI", "PROFILE"}, tableData, c)
+					return nil
+				},
+			},
+			{
+				Name:  "use",
+				Usage: "Select the Ambari server entry and connection profile of an environment",
+				Action: func(c *cli.Context) error {
+					if len(c.Args()) == 0 {
+						fmt.Println("Provide an environment name argument for use command. e.g.: use prod")
+						os.Exit(1)
+					}
+					name := c.Args().First()
+					ambari.UseEnvironment(name)
+					fmt.Println("Environment selected with id: " + name)
+					return nil
+				},
+			},
+			{
+				Name:    "delete",
+				Aliases: []string{"d"},
+				Usage:   "Delete an environment entry by id",
+				Action: func(c *cli.Context) error {
+					if len(c.Args()) == 0 {
+						fmt.Println("Provide an environment name argument for delete command. e.g.: delete prod")
+						os.Exit(1)
+					}
+					name := c.Args().First()
+					if len(ambari.GetEnvironmentById(name).Name) == 0 {
+						fmt.Println("Environment entry does not exist with id " + name)
+						os.Exit(1)
+					}
+					ambari.DeRegisterEnvironment(name)
+					fmt.Println(fmt.Sprintf("Environment '%s' has been deleted successfully", name))
+					return nil
+				},
+			},
+		},
+	}
+
 	attachCommand := cli.Command{
 		Name:  "attach",
 		Usage: "Attach a profile to an ambari server entry",
@@ -203,14 +338,10 @@ func main() {
 			profileId := args.Get(0)
 			var ambariRegistry ambari.AmbariRegistry
 			if len(args) == 1 {
-				ambariRegistry = ambari.GetActiveAmbari()
-				if len(ambariRegistry.Name) == 0 {
-					fmt.Println("No active ambari selected")
-					os.Exit(1)
-				}
+				ambariRegistry = getActiveAmbari()
 			} else {
 				ambariRegistryId := args.Get(1)
-				ambari.GetAmbariById(ambariRegistryId)
+				ambariRegistry = ambari.GetAmbariById(ambariRegistryId)
 				if len(ambariRegistry.Name) == 0 {
 					fmt.Println("Cannot find specific ambari server entry")
 					os.Exit(1)
@@ -222,7 +353,10 @@ func main() {
 				os.Exit(1)
 			}
 
-			ambari.SetProfileIdForAmbariEntry(ambariRegistry.Name, profile.Name)
+			if err := ambari.SetProfileIdForAmbariEntry(ambariRegistry.Name, profile.Name); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
 			msg := fmt.Sprintf("Attach profile '%s' to '%s'", profile.Name, ambariRegistry.Name)
 			fmt.Println(msg)
 			return nil
@@ -233,8 +367,7 @@ func main() {
 		Name:  "hosts",
 		Usage: "Print all registered Ambari agent hosts",
 		Action: func(c *cli.Context) error {
-			ambariRegistry := ambari.GetActiveAmbari()
-			validateActiveAmbari(ambariRegistry)
+			ambariRegistry := getActiveAmbari()
 			hosts := ambariRegistry.ListAgents()
 			var tableData [][]string
 			for _, host := range hosts {
@@ -249,8 +382,7 @@ func main() {
 		Name:  "services",
 		Usage: "Print all installed Ambari services",
 		Action: func(c *cli.Context) error {
-			ambariRegistry := ambari.GetActiveAmbari()
-			validateActiveAmbari(ambariRegistry)
+			ambariRegistry := getActiveAmbari()
 			services := ambariRegistry.ListServices()
 			var tableData [][]string
 			for _, service := range services {
@@ -265,8 +397,7 @@ func main() {
 		Name:  "components",
 		Usage: "Print all installed Ambari components",
 		Action: func(c *cli.Context) error {
-			ambariRegistry := ambari.GetActiveAmbari()
-			validateActiveAmbari(ambariRegistry)
+			ambariRegistry := getActiveAmbari()
 			components := ambariRegistry.ListComponents()
 			var tableData [][]string
 			for _, component := range components {
@@ -281,8 +412,7 @@ func main() {
 		Name:  "hcomponents",
 		Usage: "Print all installed Ambari host components by component name",
 		Action: func(c *cli.Context) error {
-			ambariRegistry := ambari.GetActiveAmbari()
-			validateActiveAmbari(ambariRegistry)
+			ambariRegistry := getActiveAmbari()
 			var param string
 			useHost := false
 			if len(c.String("component")) > 0 {
@@ -308,14 +438,75 @@ func main() {
 		},
 	}
 
+	versionsCommand := cli.Command{
+		Name:  "versions",
+		Usage: "Compare installed component versions across hosts",
+		Action: func(c *cli.Context) error {
+			ambariRegistry := getActiveAmbari()
+			if len(c.String("component")) == 0 {
+				fmt.Println("Flag '--component' with a value is required for 'versions' action!")
+				os.Exit(1)
+			}
+			versionSkew := ambariRegistry.GetVersionSkew(c.String("component"))
+			hosts := make([]string, 0)
+			for host := range versionSkew.HostVersions {
+				hosts = append(hosts, host)
+			}
+			sort.Strings(hosts)
+			var tableData [][]string
+			for _, host := range hosts {
+				version := versionSkew.HostVersions[host]
+				skewed := "false"
+				if version != versionSkew.MajorityVersion {
+					skewed = "true"
+				}
+				tableData = append(tableData, []string{host, version, skewed})
+			}
+			printTable("COMPONENT VERSIONS: "+c.String("component"), []string{"HOST", "VERSION", "DIFFERS FROM MAJORITY"}, tableData, c)
+			if len(versionSkew.SkewedHosts) > 0 {
+				fmt.Println(fmt.Sprintf("Version differs from the majority version (%s) on hosts: %s",
+					versionSkew.MajorityVersion, strings.Join(versionSkew.SkewedHosts, ", ")))
+				os.Exit(1)
+			}
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "component", Usage: "Component name"},
+		},
+	}
+
+	mappingCommand := cli.Command{
+		Name:  "mapping",
+		Usage: "Print which components run on which hosts (or the inverse) as json or csv",
+		Action: func(c *cli.Context) error {
+			ambariRegistry := getActiveAmbari()
+			mapping, err := ambariRegistry.GetMapping(c.String("by"))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			content, err := ambari.FormatMapping(mapping, c.String("format"))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			fmt.Print(string(content))
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "by", Usage: "Create the mapping by 'component' (default) or by 'host'"},
+			cli.StringFlag{Name: "format", Usage: "Output format: json (default) or csv"},
+		},
+	}
+
 	createCommand := cli.Command{
 		Name:  "create",
 		Usage: "Register new Ambari server entry",
 		Action: func(c *cli.Context) error {
 			name := ambari.GetStringFlag(c.String("name"), "", "Enter ambari registry name")
 			ambariEntryId := ambari.GetAmbariEntryId(name)
-			if len(ambariEntryId) > 0 {
-				fmt.Println("Ambari registry entry already exists with id " + name)
+			if len(ambariEntryId) > 0 && !c.Bool("upsert") {
+				fmt.Println("Ambari registry entry already exists with id " + name + " (use --upsert to update it)")
 				os.Exit(1)
 			}
 			host := ambari.GetStringFlag(c.String("host"), "", "Enter ambari host name")
@@ -325,18 +516,49 @@ func main() {
 				fmt.Println(err)
 				os.Exit(1)
 			}
-			protocol := strings.ToLower(ambari.GetStringFlag(c.String("protocol"), "http", "Enter ambari protocol"))
-			if protocol != "http" && protocol != "https" {
-				fmt.Println("Use 'http' or 'https' value for protocol option")
-				os.Exit(1)
-			}
+			protocol := ambari.GetStringFlag(c.String("protocol"), "http", "Enter ambari protocol")
 			username := strings.ToLower(ambari.GetStringFlag(c.String("username"), "admin", "Enter ambari user"))
-			password := ambari.GetPassword(c.String("password"), "Enter ambari user password")
-			cluster := ambari.GetStringFlag(c.String("cluster"), "", "Enter ambari cluster")
+			passwordCommand := c.String("password-command")
+			password := ""
+			if len(passwordCommand) == 0 {
+				password = ambari.GetPassword(c.String("password"), "Enter ambari user password")
+			}
+			cluster := ""
+			if !c.Bool("no-cluster") {
+				cluster = ambari.GetStringFlag(c.String("cluster"), "", "Enter ambari cluster")
+			}
+			serverHosts := make([]string, 0)
+			if len(c.String("server-hosts")) > 0 {
+				serverHosts = strings.Split(c.String("server-hosts"), ",")
+			}
 
-			ambari.DeactiveAllAmbariRegistry()
-			ambari.RegisterNewAmbariEntry(name, host, port, protocol,
-				username, password, cluster)
+			hostname, port, protocol, err := ambari.NormalizeAmbariAddress(host, port, protocol)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			if c.Bool("upsert") {
+				created, err := ambari.RegisterOrUpdateAmbariEntry(name, hostname, port, protocol,
+					username, password, passwordCommand, cluster, serverHosts, c.Bool("insecure-tls"), c.String("ca-cert"),
+					c.Int("request-timeout"))
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				if !created {
+					fmt.Println("Ambari server entry has been updated: " + name)
+					return nil
+				}
+				fmt.Println("New Ambari server entry has been created: " + name)
+				return nil
+			}
+			err = ambari.RegisterNewAmbariEntry(name, hostname, port, protocol,
+				username, password, passwordCommand, cluster, serverHosts, c.Bool("insecure-tls"), c.String("ca-cert"),
+				c.Int("request-timeout"))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
 			fmt.Println("New Ambari server entry has been created: " + name)
 			return nil
 		},
@@ -347,7 +569,68 @@ func main() {
 			cli.StringFlag{Name: "protocol", Usage: "Protocol for Ambar REST API: http/https"},
 			cli.StringFlag{Name: "username", Usage: "User name for Ambari server"},
 			cli.StringFlag{Name: "password", Usage: "Password for Ambari user"},
+			cli.StringFlag{Name: "password-command", Usage: "Command that prints the Ambari user password to the standard output (e.g. a secret manager client)"},
 			cli.StringFlag{Name: "cluster", Usage: "Cluster name"},
+			cli.BoolFlag{Name: "no-cluster", Usage: "Do not pin a cluster for the entry (for Ambari servers with multiple clusters, select one with the global --cluster flag)"},
+			cli.StringFlag{Name: "server-hosts", Usage: "Comma separated list of all Ambari server hosts (for HA setups), defaults to the Ambari host"},
+			cli.BoolFlag{Name: "insecure-tls", Usage: "Do not verify the certificate of the Ambari server (e.g. self-signed certificates)"},
+			cli.StringFlag{Name: "ca-cert", Usage: "CA certificate (pem file) that is used to verify the certificate of the Ambari server"},
+			cli.IntFlag{Name: "request-timeout", Usage: fmt.Sprintf("Timeout of the Ambari REST calls in seconds (default: %d)", ambari.DefaultRequestTimeout)},
+			cli.BoolFlag{Name: "upsert", Usage: "Update the entry if it already exists instead of failing (e.g. for re-running setup scripts)"},
+		},
+	}
+
+	updateCommand := cli.Command{
+		Name:  "update",
+		Usage: "Change the provided fields of an existing Ambari server entry",
+		Action: func(c *cli.Context) error {
+			if len(c.Args()) == 0 {
+				fmt.Println("Provide a registry name argument for update command. e.g.: update vagrant --port 8081")
+				os.Exit(1)
+			}
+			name := c.Args().First()
+			update := ambari.AmbariRegistryUpdate{Hostname: optionalStringFlag(c, "host"), Protocol: optionalStringFlag(c, "protocol"),
+				Username: optionalStringFlag(c, "username"), PasswordCommand: optionalStringFlag(c, "password-command"),
+				Cluster: optionalStringFlag(c, "cluster"), CACertPath: optionalStringFlag(c, "ca-cert")}
+			if c.IsSet("port") {
+				port := c.Int("port")
+				update.Port = &port
+			}
+			if c.IsSet("request-timeout") {
+				requestTimeout := c.Int("request-timeout")
+				update.RequestTimeout = &requestTimeout
+			}
+			if c.IsSet("insecure-tls") {
+				insecureTLS := c.Bool("insecure-tls")
+				update.InsecureTLS = &insecureTLS
+			}
+			if c.IsSet("server-hosts") {
+				update.ServerHosts = strings.Split(c.String("server-hosts"), ",")
+			}
+			if c.IsSet("password") || c.Bool("ask-password") {
+				password := ambari.GetPassword(c.String("password"), "Enter ambari user password")
+				update.Password = &password
+			}
+			if err := ambari.UpdateAmbariRegistryEntry(name, update); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			fmt.Println("Ambari registry updated with id: " + name)
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "host", Usage: "Hostname of the Ambari server"},
+			cli.IntFlag{Name: "port", Usage: "Port for AmbarisServer"},
+			cli.StringFlag{Name: "protocol", Usage: "Protocol for Ambar REST API: http/https"},
+			cli.StringFlag{Name: "username", Usage: "User name for Ambari server"},
+			cli.StringFlag{Name: "password", Usage: "Password for Ambari user"},
+			cli.BoolFlag{Name: "ask-password", Usage: "Ask the new password of the Ambari user"},
+			cli.StringFlag{Name: "password-command", Usage: "Command that prints the Ambari user password to the standard output (e.g. a secret manager client)"},
+			cli.StringFlag{Name: "cluster", Usage: "Cluster name (empty value un-pins the cluster)"},
+			cli.StringFlag{Name: "server-hosts", Usage: "Comma separated list of all Ambari server hosts (for HA setups)"},
+			cli.BoolFlag{Name: "insecure-tls", Usage: "Do not verify the certificate of the Ambari server (use --insecure-tls=false to turn verification back on)"},
+			cli.StringFlag{Name: "ca-cert", Usage: "CA certificate (pem file) that is used to verify the certificate of the Ambari server"},
+			cli.IntFlag{Name: "request-timeout", Usage: "Timeout of the Ambari REST calls in seconds (0: default timeout)"},
 		},
 	}
 
@@ -360,12 +643,10 @@ func main() {
 				os.Exit(1)
 			}
 			name := c.Args().First()
-			ambariEntryId := ambari.GetAmbariEntryId(name)
-			if len(ambariEntryId) == 0 {
-				fmt.Println("Ambari registry entry does not exist with id " + name)
+			if err := ambari.DeleteAmbariRegistryEntry(name); err != nil {
+				fmt.Println(err)
 				os.Exit(1)
 			}
-			ambari.DeRegisterAmbariEntry(name)
 			fmt.Println("Ambari registry de-registered with id: " + name)
 			return nil
 		},
@@ -383,13 +664,11 @@ func main() {
 				os.Exit(1)
 			}
 			name := c.Args().First()
-			ambariEntryId := ambari.GetAmbariEntryId(name)
-			if len(ambariEntryId) == 0 {
-				fmt.Println("Ambari server entry does not exist with id " + name)
+			err := ambari.SetActiveAmbari(name)
+			if err != nil {
+				fmt.Println(err)
 				os.Exit(1)
 			}
-			ambari.DeactiveAllAmbariRegistry()
-			ambari.ActiveAmbariRegistry(name)
 			fmt.Println("Ambari server entry selected with id: " + name)
 			return nil
 		},
@@ -408,11 +687,67 @@ func main() {
 		},
 	}
 
+	registryCommand := cli.Command{
+		Name:  "registry",
+		Usage: "Export or import the Ambari server entries, connection profiles and environments",
+		Subcommands: []cli.Command{
+			{
+				Name:  "export",
+				Usage: "Export the registry entries to a yaml (or json) file",
+				Action: func(c *cli.Context) error {
+					if len(c.String("file")) == 0 {
+						fmt.Println("Flag 'file' is required for export command. e.g.: registry export -f ambarictl-registry.yml")
+						os.Exit(1)
+					}
+					if len(c.String("passphrase")) > 0 && !c.Bool("include-passwords") {
+						fmt.Println("Flag 'passphrase' can be used only with 'include-passwords'")
+						os.Exit(1)
+					}
+					if err := ambari.ExportRegistry(c.String("file"), c.Bool("include-passwords"), c.String("passphrase")); err != nil {
+						fmt.Println(err)
+						os.Exit(1)
+					}
+					fmt.Println("Registry entries have been exported to " + c.String("file"))
+					return nil
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "file, f", Usage: "Export file (json format if it has .json extension, yaml otherwise)"},
+					cli.BoolFlag{Name: "include-passwords", Usage: "Export the passwords as well (encrypted if a secret is configured)"},
+					cli.StringFlag{Name: "passphrase", Usage: "Encrypt the exported passwords with this passphrase (instead of the secret of this machine)"},
+				},
+			},
+			{
+				Name:  "import",
+				Usage: "Import the registry entries of an exported file (existing entries with the same names are replaced)",
+				Action: func(c *cli.Context) error {
+					if len(c.String("file")) == 0 {
+						fmt.Println("Flag 'file' is required for import command. e.g.: registry import -f ambarictl-registry.yml")
+						os.Exit(1)
+					}
+					ambari.CreateAmbariRegistryDb()
+					if err := ambari.ImportRegistry(c.String("file"), c.String("passphrase")); err != nil {
+						fmt.Println(err)
+						os.Exit(1)
+					}
+					return nil
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "file, f", Usage: "Exported registry file"},
+					cli.StringFlag{Name: "passphrase", Usage: "Passphrase of the exported passwords (if they were exported with a passphrase)"},
+				},
+			},
+		},
+	}
+
 	showCommand := cli.Command{
 		Name:  "show",
 		Usage: "Show active Ambari server details",
 		Action: func(c *cli.Context) error {
-			ambariRegistry := ambari.GetActiveAmbari()
+			ambariRegistry, err := ambari.GetActiveAmbari()
+			if err == ambari.ErrMultipleActiveAmbari {
+				fmt.Println(err.Error() + ", select one of them with 'use' command")
+				os.Exit(1)
+			}
 			var tableData [][]string
 			if len(ambariRegistry.Name) > 0 {
 				tableData = append(tableData, []string{ambariRegistry.Name, ambariRegistry.Hostname, strconv.Itoa(ambariRegistry.Port), ambariRegistry.Protocol,
@@ -431,8 +766,7 @@ func main() {
 				Name:  "versions",
 				Usage: "Print all service config types with versions",
 				Action: func(c *cli.Context) error {
-					ambariRegistry := ambari.GetActiveAmbari()
-					validateActiveAmbari(ambariRegistry)
+					ambariRegistry := getActiveAmbari()
 					configs := ambariRegistry.ListServiceConfigVersions()
 					var tableData [][]string
 					for _, config := range configs {
@@ -446,35 +780,105 @@ func main() {
 				Name:  "update",
 				Usage: "Update config value for a specific config key of a config type",
 				Action: func(c *cli.Context) error {
-					ambariRegistry := ambari.GetActiveAmbari()
-					validateActiveAmbari(ambariRegistry)
-					if len(c.String("config-type")) == 0 {
-						fmt.Println("Parameter '--config-type' is required")
+					ambariRegistry := getActiveAmbari()
+					if len(c.String("type")) == 0 {
+						fmt.Println("Parameter '--type' is required")
+						os.Exit(1)
+					}
+					if len(c.String("key")) == 0 {
+						fmt.Println("Parameter '--key' is required")
 						os.Exit(1)
 					}
-					if len(c.String("config-key")) == 0 {
-						fmt.Println("Parameter '--config-key' is required")
+					if len(c.String("value")) == 0 {
+						fmt.Println("Parameter '--value' is required")
 						os.Exit(1)
 					}
-					if len(c.String("config-value")) == 0 {
-						fmt.Println("Parameter '--config-value' is required")
+					ambari.SetForceMaintenance(c.Bool("force"))
+					if err := ambari.CheckMaintenance(ambariRegistry.Name); err != nil {
+						fmt.Println(err)
 						os.Exit(1)
 					}
-					ambariRegistry.SetConfig(c.String("type"), c.String("key"), c.String("value"))
+					if len(c.String("tag")) > 0 {
+						configs := map[string]string{c.String("key"): c.String("value")}
+						if err := ambariRegistry.SetConfigs(c.String("type"), configs, c.String("note"), c.String("tag")); err != nil {
+							fmt.Println(err)
+							os.Exit(1)
+						}
+						return nil
+					}
+					ambariRegistry.SetConfig(c.String("type"), c.String("key"), c.String("value"), c.String("note"))
 					return nil
 				},
 				Flags: []cli.Flag{
 					cli.StringFlag{Name: "type, t", Usage: "Configuration type"},
 					cli.StringFlag{Name: "key, k", Usage: "Configuration key"},
 					cli.StringFlag{Name: "value, v", Usage: "Configuration value"},
+					cli.StringFlag{Name: "note", Usage: "Note of the new config version"},
+					cli.StringFlag{Name: "tag", Usage: "Tag of the new config version (must be unique for the config type)"},
+					cli.BoolFlag{Name: "force", Usage: "Update the config even if a maintenance is in progress"},
+				},
+			},
+			{
+				Name:  "history",
+				Usage: "Print the service config versions of a config type",
+				Action: func(c *cli.Context) error {
+					ambariRegistry := getActiveAmbari()
+					if len(c.String("type")) == 0 {
+						fmt.Println("Parameter '--type' is required")
+						os.Exit(1)
+					}
+					versions, err := ambariRegistry.ListConfigVersions(c.String("type"))
+					if err != nil {
+						fmt.Println(err)
+						os.Exit(1)
+					}
+					var tableData [][]string
+					for _, version := range versions {
+						created := time.Unix(0, version.CreateTime*int64(time.Millisecond)).Format("2006-01-02 15:04:05")
+						tableData = append(tableData, []string{version.ServiceName, strconv.Itoa(version.Version), strconv.FormatBool(version.IsCurrent), created, version.User, version.Note})
+					}
+					printTable("CONFIG VERSIONS:", []string{"SERVICE", "VERSION", "CURRENT", "CREATED", "USER", "NOTE"}, tableData, c)
+					return nil
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "type, t", Usage: "Configuration type"},
+				},
+			},
+			{
+				Name:  "rollback",
+				Usage: "Make a previous service config version current again (every config type of the service is reverted)",
+				Action: func(c *cli.Context) error {
+					ambariRegistry := getActiveAmbari()
+					if len(c.String("type")) == 0 {
+						fmt.Println("Parameter '--type' is required")
+						os.Exit(1)
+					}
+					if c.Int("version") <= 0 {
+						fmt.Println("Parameter '--version' is required")
+						os.Exit(1)
+					}
+					ambari.SetForceMaintenance(c.Bool("force"))
+					if err := ambari.CheckMaintenance(ambariRegistry.Name); err != nil {
+						fmt.Println(err)
+						os.Exit(1)
+					}
+					if err := ambariRegistry.RollbackConfig(c.String("type"), c.Int("version")); err != nil {
+						fmt.Println(err)
+						os.Exit(1)
+					}
+					return nil
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "type, t", Usage: "Configuration type"},
+					cli.IntFlag{Name: "version", Usage: "Service config version to rollback to (see 'configs history')"},
+					cli.BoolFlag{Name: "force", Usage: "Rollback the config even if a maintenance is in progress"},
 				},
 			},
 			{
 				Name:  "export",
 				Usage: "Export cluster configuration to a blueprint json",
 				Action: func(c *cli.Context) error {
-					ambariRegistry := ambari.GetActiveAmbari()
-					validateActiveAmbari(ambariRegistry)
+					ambariRegistry := getActiveAmbari()
 					var blueprint []byte
 					if c.Bool("minimal") {
 						clusterInfo := ambariRegistry.GetClusterInfo()
@@ -523,8 +927,7 @@ func main() {
 		Name:  "cluster",
 		Usage: "Print Ambari managed cluster details",
 		Action: func(c *cli.Context) error {
-			ambariRegistry := ambari.GetActiveAmbari()
-			validateActiveAmbari(ambariRegistry)
+			ambariRegistry := getActiveAmbari()
 			clusterInfo := ambariRegistry.GetClusterInfo()
 			var tableData [][]string
 			if len(ambariRegistry.Name) > 0 {
@@ -535,12 +938,34 @@ func main() {
 		},
 	}
 
+	clustersCommand := cli.Command{
+		Name:  "clusters",
+		Usage: "List the clusters that are managed by the Ambari server",
+		Action: func(c *cli.Context) error {
+			ambariRegistry := getActiveAmbari()
+			clusters, err := ambariRegistry.GetClusters()
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			var tableData [][]string
+			for _, cluster := range clusters {
+				selected := "false"
+				if cluster == ambariRegistry.Cluster {
+					selected = "true"
+				}
+				tableData = append(tableData, []string{cluster, selected})
+			}
+			printTable("CLUSTERS:", []string{"NAME", "SELECTED"}, tableData, c)
+			return nil
+		},
+	}
+
 	runCommand := cli.Command{
 		Name:  "run",
 		Usage: "Execute commands on all (or specific) hosts",
 		Action: func(c *cli.Context) error {
-			ambariServer := ambari.GetActiveAmbari()
-			validateActiveAmbari(ambariServer)
+			ambariServer := getActiveAmbari()
 			args := c.Args()
 			command := ""
 			for _, arg := range args {
@@ -548,8 +973,38 @@ func main() {
 			}
 			filter := ambari.CreateFilter(strings.ToUpper(c.String("services")),
 				strings.ToUpper(c.String("components")), c.String("hosts"), c.Bool("server"))
+			filter = ambari.CreateMissingComponentsFilter(filter, strings.ToUpper(c.String("missing-components")))
 			hosts := ambariServer.GetFilteredHosts(filter)
-			ambariServer.RunRemoteHostCommand(command, hosts, filter.Server)
+			ambari.SetStreamOutput(c.Bool("stream"))
+			ambari.SetParallelism(c.Int("parallelism"))
+			responses := ambariServer.RunRemoteHostCommand(command, hosts, filter.Server)
+			if len(c.String("csv")) > 0 {
+				csvFile, err := os.Create(c.String("csv"))
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				err = ambari.WriteRemoteResponsesCsv(responses, csvFile)
+				csvFile.Close()
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+			}
+			failed := false
+			failedHosts := ambari.GetFailedHosts(responses)
+			if len(failedHosts) > 0 {
+				fmt.Println("Failed hosts: " + strings.Join(failedHosts, ", "))
+				failed = true
+			}
+			unreachableHosts := ambari.GetUnreachableHosts(responses)
+			if len(unreachableHosts) > 0 {
+				fmt.Println("Unreachable hosts: " + strings.Join(unreachableHosts, ", "))
+				failed = failed || !c.Bool("ignore-unreachable")
+			}
+			if failed {
+				os.Exit(1)
+			}
 			return nil
 		},
 		Flags: []cli.Flag{
@@ -557,6 +1012,11 @@ func main() {
 			cli.StringFlag{Name: "services, s", Usage: "Filter on services (comma separated)"},
 			cli.StringFlag{Name: "components, c", Usage: "Filter on components (comma separated)"},
 			cli.StringFlag{Name: "hosts", Usage: "Filter on hosts (comma separated)"},
+			cli.StringFlag{Name: "missing-components", Usage: "Filter on hosts where none of the components are installed (comma separated)"},
+			cli.BoolFlag{Name: "ignore-unreachable", Usage: "Skip hosts that cannot be connected instead of failing"},
+			cli.StringFlag{Name: "csv", Usage: "Write the outputs by hosts (host, exit_code, stdout, stderr, done) to a csv file"},
+			cli.BoolFlag{Name: "stream", Usage: "Print the output lines as they arrive (prefixed with the hosts) instead of waiting for the commands to finish"},
+			cli.IntFlag{Name: "parallelism", Value: ambari.DefaultParallelism, Usage: "Maximum number of hosts where the command runs at once"},
 		},
 	}
 
@@ -564,8 +1024,7 @@ func main() {
 		Name:  "command",
 		Usage: "Execute ambari commands on Ambari server (START/STOP/RESTART/SERVICE_CHECK)",
 		Action: func(c *cli.Context) error {
-			ambariServer := ambari.GetActiveAmbari()
-			validateActiveAmbari(ambariServer)
+			ambariServer := getActiveAmbari()
 			args := c.Args()
 			command := ""
 			for _, arg := range args {
@@ -579,8 +1038,14 @@ func main() {
 				fmt.Println("Service check can be performed only on services, not components")
 				os.Exit(1)
 			}
+			ambari.SetForceMaintenance(c.Bool("force"))
+			if err := ambari.CheckMaintenance(ambariServer.Name); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
 			filter := ambari.CreateFilter(strings.ToUpper(c.String("services")),
 				strings.ToUpper(c.String("components")), "", false)
+			filter = ambariServer.ResolveExclusions(filter)
 			ambariServer.RunAmbariServiceCommand(command, filter, len(filter.Services) > 0, len(filter.Components) > 0)
 			if len(c.String("components")) > 0 {
 				fmt.Println(fmt.Sprintf("Command %s has been sent to %s (components)", command, c.String("components")))
@@ -593,6 +1058,7 @@ func main() {
 		Flags: []cli.Flag{
 			cli.StringFlag{Name: "services, s", Usage: "Filter on services (comma separated)"},
 			cli.StringFlag{Name: "components, c", Usage: "Filter on components (comma separated)"},
+			cli.BoolFlag{Name: "force", Usage: "Run the command even if a maintenance is in progress"},
 		},
 	}
 
@@ -600,19 +1066,148 @@ func main() {
 		Name:  "playbook",
 		Usage: "Execute a list of commands defined in playbook file(s)",
 		Action: func(c *cli.Context) error {
-			ambariServer := ambari.GetActiveAmbari()
-			validateActiveAmbari(ambariServer)
+			ambariServer := getActiveAmbari()
 			if len(c.String("file")) == 0 {
 				fmt.Println("Provide -f or --file parameter")
 				os.Exit(1)
 			}
+			ambari.SetKeepTempDirOnFailure(c.Bool("keep-temp"))
+			ambari.SetForceMaintenance(c.Bool("force"))
+			ambari.SetQuietRequestProgress(c.Bool("quiet"))
+			ambari.SetIgnoreUnreachable(c.Bool("ignore-unreachable"))
+			ambari.SetStreamOutput(c.Bool("stream"))
+			ambari.SetParallelism(c.Int("parallelism"))
+			ambari.SetNonInteractive(c.Bool("non-interactive"))
 			playbook := ambari.LoadPlaybookFile(c.String("file"), c.String("vars"))
-			ambariServer.ExecutePlaybook(playbook)
+			ctx, cancel := interruptContext()
+			defer cancel()
+			options := ambari.PlaybookOptions{
+				DryRun:      c.Bool("dry-run"),
+				Tags:        splitCommaSeparated(c.String("tags")),
+				SkipTags:    splitCommaSeparated(c.String("skip-tags")),
+				StartAtTask: c.String("start-at-task"),
+				Step:        c.Bool("step"),
+				Limit:       splitCommaSeparated(c.String("limit")),
+			}
+			result, err := ambariServer.ExecutePlaybook(ctx, playbook, options)
+			if !c.Bool("dry-run") {
+				printPlaybookResult(result, c)
+			}
+			if len(c.String("report")) > 0 {
+				reportJson, jsonErr := json.Marshal(result)
+				if jsonErr == nil {
+					jsonErr = ioutil.WriteFile(c.String("report"), formatJson(reportJson).Bytes(), 0644)
+				}
+				if jsonErr != nil {
+					fmt.Println(jsonErr)
+					os.Exit(1)
+				}
+			}
+			if err != nil {
+				fmt.Println(ambari.RedactSecrets(err.Error()))
+				os.Exit(1)
+			}
 			return nil
 		},
 		Flags: []cli.Flag{
 			cli.StringFlag{Name: "file, f", Usage: "Playbook file"},
 			cli.StringFlag{Name: "vars, v", Usage: "Provided extra variables (e.g.: --vars='myvar1=myvalue1 myvar2=myvalue2')"},
+			cli.BoolFlag{Name: "keep-temp", Usage: "Keep the temporary directory of the playbook run if it fails (for debugging)"},
+			cli.BoolFlag{Name: "force", Usage: "Run Config and AmbariCommand tasks even if a maintenance is in progress"},
+			cli.BoolFlag{Name: "quiet, q", Usage: "Do not print the progress of Ambari requests (e.g. service checks) while waiting for them"},
+			cli.BoolFlag{Name: "ignore-unreachable", Usage: "Skip hosts that cannot be connected in every task instead of failing"},
+			cli.BoolFlag{Name: "dry-run", Usage: "Print the tasks with their target hosts without executing them"},
+			cli.BoolFlag{Name: "non-interactive", Usage: "Fail if inputs are missing instead of asking them (e.g. for CI pipelines)"},
+			cli.StringFlag{Name: "tags", Usage: "Run only the tasks that have any of these (comma separated) tags"},
+			cli.StringFlag{Name: "skip-tags", Usage: "Skip the tasks that have any of these (comma separated) tags"},
+			cli.StringFlag{Name: "start-at-task", Usage: "Skip the tasks before the task with this name (e.g. for resuming a failed run)"},
+			cli.BoolFlag{Name: "step", Usage: "Ask before running each task"},
+			cli.StringFlag{Name: "limit", Usage: "Run the host tasks only on these (comma separated) hosts, on top of the filters of the tasks (e.g. for a canary run)"},
+			cli.StringFlag{Name: "report", Usage: "Write the results of the tasks (by hosts) to a json file"},
+			cli.BoolFlag{Name: "stream", Usage: "Print the output lines of remote commands as they arrive (prefixed with the hosts)"},
+			cli.IntFlag{Name: "parallelism", Value: ambari.DefaultParallelism, Usage: "Maximum number of hosts that are contacted at once (can be overridden by the 'parallelism' field of tasks)"},
+		},
+	}
+
+	maintenanceCommand := cli.Command{
+		Name:  "maintenance",
+		Usage: "Freeze (or unfreeze) config changes and ambari commands of the active Ambari server for other ambarictl invocations",
+		Subcommands: []cli.Command{
+			{
+				Name:  "start",
+				Usage: "Start a maintenance window",
+				Action: func(c *cli.Context) error {
+					ambariRegistry := getActiveAmbari()
+					ambari.SetForceMaintenance(c.Bool("force"))
+					if err := ambari.StartMaintenance(ambariRegistry.Name, c.String("reason")); err != nil {
+						fmt.Println(err)
+						os.Exit(1)
+					}
+					fmt.Println("Maintenance has been started for " + ambariRegistry.Name)
+					return nil
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "reason", Usage: "Reason of the maintenance"},
+					cli.BoolFlag{Name: "force", Usage: "Take over the maintenance window from someone else"},
+				},
+			},
+			{
+				Name:  "stop",
+				Usage: "Stop the maintenance window",
+				Action: func(c *cli.Context) error {
+					ambariRegistry := getActiveAmbari()
+					ambari.StopMaintenance(ambariRegistry.Name)
+					fmt.Println("Maintenance has been stopped for " + ambariRegistry.Name)
+					return nil
+				},
+			},
+			{
+				Name:  "show",
+				Usage: "Print the maintenance window of the active Ambari server (if there is any)",
+				Action: func(c *cli.Context) error {
+					ambariRegistry := getActiveAmbari()
+					var tableData [][]string
+					if marker, ok := ambari.GetMaintenanceMarker(ambariRegistry.Name); ok {
+						tableData = append(tableData, []string{marker.AmbariEntry, marker.Owner, marker.StartTime.Format(time.RFC3339), marker.Reason})
+					}
+					printTable("MAINTENANCE:", []string{"AMBARI", "OWNER", "SINCE", "REASON"}, tableData, c)
+					return nil
+				},
+			},
+		},
+	}
+
+	shellCommand := cli.Command{
+		Name:  "shell",
+		Usage: "Start an interactive shell for running ad-hoc commands against the active Ambari server",
+		Action: func(c *cli.Context) error {
+			ambari.StartShell(os.Stdin)
+			return nil
+		},
+	}
+
+	historyCommand := cli.Command{
+		Name:  "history",
+		Usage: "Print recently executed playbooks",
+		Action: func(c *cli.Context) error {
+			if c.Bool("clear") {
+				ambari.DropPlaybookRunRecords()
+				fmt.Println("Playbook run records has been dropped")
+				return nil
+			}
+			playbookRuns := ambari.ListPlaybookRuns(c.Int("limit"))
+			var tableData [][]string
+			for _, playbookRun := range playbookRuns {
+				duration := playbookRun.EndTime.Sub(playbookRun.StartTime).String()
+				tableData = append(tableData, []string{playbookRun.Name, playbookRun.Cluster, playbookRun.StartTime.Format("2006-01-02 15:04:05"),
+					playbookRun.EndTime.Format("2006-01-02 15:04:05"), duration, playbookRun.Status})
+			}
+			printTable("PLAYBOOK RUNS:", []string{"NAME", "CLUSTER", "START", "END", "DURATION", "STATUS"}, tableData, c)
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.IntFlag{Name: "limit, l", Value: 10, Usage: "Number of the latest playbook runs to print (0 means all)"},
+			cli.BoolFlag{Name: "clear", Usage: "Drop all playbook run records"},
 		},
 	}
 
@@ -620,7 +1215,7 @@ func main() {
 		Name:  "logs",
 		Usage: "Download logs from Ambari agents",
 		Action: func(c *cli.Context) error {
-			ambariServer := ambari.GetActiveAmbari()
+			ambariServer := getActiveAmbari()
 			if len(c.String("destination")) == 0 {
 				fmt.Println("Provide --destination parameter")
 				os.Exit(1)
@@ -628,6 +1223,7 @@ func main() {
 			filter := ambari.CreateFilter(strings.ToUpper(c.String("services")),
 				strings.ToUpper(c.String("components")), c.String("hosts"), c.Bool("server"))
 			ambariServer.DownloadLogs(c.String("destination"), filter)
+			ambari.CleanupRunTempDir(false)
 			return nil
 		},
 		Flags: []cli.Flag{
@@ -639,8 +1235,80 @@ func main() {
 		},
 	}
 
+	fetchCommand := cli.Command{
+		Name:  "fetch",
+		Usage: "Download a file from all (or specific) hosts, the downloaded files are prefixed with the hosts",
+		Action: func(c *cli.Context) error {
+			ambariServer := getActiveAmbari()
+			if len(c.Args()) == 0 {
+				fmt.Println("Provide a remote file argument for fetch command. e.g.: fetch /etc/ambari-agent/conf/ambari-agent.ini -d /tmp/configs")
+				os.Exit(1)
+			}
+			if len(c.String("destination")) == 0 {
+				fmt.Println("Provide --destination parameter")
+				os.Exit(1)
+			}
+			filter := ambari.CreateFilter(strings.ToUpper(c.String("services")),
+				strings.ToUpper(c.String("components")), c.String("hosts"), c.Bool("server"))
+			hosts := ambariServer.GetFilteredHosts(filter)
+			ctx, cancel := interruptContext()
+			defer cancel()
+			failedHosts := make([]string, 0)
+			for host, err := range ambariServer.CopyFromRemoteHosts(ctx, c.Args().First(), c.String("destination"), hosts, filter.Server) {
+				if err != nil {
+					failedHosts = append(failedHosts, host)
+				}
+			}
+			ambari.CleanupRunTempDir(len(failedHosts) > 0)
+			if len(failedHosts) > 0 {
+				sort.Strings(failedHosts)
+				fmt.Println("Failed hosts: " + strings.Join(failedHosts, ", "))
+				os.Exit(1)
+			}
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "destination, d", Usage: "Download destination folder"},
+			cli.BoolFlag{Name: "server", Usage: "Filter on ambari-server"},
+			cli.StringFlag{Name: "services, s", Usage: "Filter on services (comma separated)"},
+			cli.StringFlag{Name: "components, c", Usage: "Filter on components (comma separated)"},
+			cli.StringFlag{Name: "hosts", Usage: "Filter on hosts (comma separated)"},
+		},
+	}
+
+	tailCommand := cli.Command{
+		Name:  "tail",
+		Usage: "Print the last lines of a (log) file from Ambari agents",
+		Action: func(c *cli.Context) error {
+			ambariServer := getActiveAmbari()
+			if len(c.Args()) == 0 {
+				fmt.Println("Provide a file argument for tail command. e.g.: tail /var/log/ambari-agent/ambari-agent.log")
+				os.Exit(1)
+			}
+			filter := ambari.CreateFilter(strings.ToUpper(c.String("services")),
+				strings.ToUpper(c.String("components")), c.String("hosts"), false)
+			filteredHosts := ambariServer.GetFilteredHosts(filter)
+			if !c.Bool("follow") {
+				ambariServer.TailRemoteFile(c.Args().First(), c.Int("lines"), filteredHosts)
+				return nil
+			}
+			ctx, cancel := interruptContext()
+			defer cancel()
+			ambariServer.FollowRemoteFile(ctx, c.Args().First(), c.Int("lines"), filteredHosts)
+			return nil
+		},
+		Flags: []cli.Flag{
+			cli.IntFlag{Name: "lines, n", Value: 10, Usage: "Number of lines to print"},
+			cli.BoolFlag{Name: "follow, f", Usage: "Keep printing new lines until interrupted"},
+			cli.StringFlag{Name: "services, s", Usage: "Filter on services (comma separated)"},
+			cli.StringFlag{Name: "components, c", Usage: "Filter on components (comma separated)"},
+			cli.StringFlag{Name: "hosts", Usage: "Filter on hosts (comma separated)"},
+		},
+	}
+
 	app.Commands = append(app.Commands, initCommand)
 	app.Commands = append(app.Commands, createCommand)
+	app.Commands = append(app.Commands, updateCommand)
 	app.Commands = append(app.Commands, deleteCommand)
 	app.Commands = append(app.Commands, useCommand)
 	app.Commands = append(app.Commands, showCommand)
@@ -649,15 +1317,25 @@ func main() {
 	app.Commands = append(app.Commands, playbookCommand)
 	app.Commands = append(app.Commands, profileCommand)
 	app.Commands = append(app.Commands, attachCommand)
+	app.Commands = append(app.Commands, environmentCommand)
 	app.Commands = append(app.Commands, listCommand)
 	app.Commands = append(app.Commands, listAgentsCommand)
 	app.Commands = append(app.Commands, listServicesCommand)
 	app.Commands = append(app.Commands, listComponentsCommand)
 	app.Commands = append(app.Commands, listHostComponentsCommand)
+	app.Commands = append(app.Commands, versionsCommand)
+	app.Commands = append(app.Commands, mappingCommand)
 	app.Commands = append(app.Commands, configsCommand)
 	app.Commands = append(app.Commands, clusterCommand)
+	app.Commands = append(app.Commands, clustersCommand)
 	app.Commands = append(app.Commands, logsCommand)
+	app.Commands = append(app.Commands, tailCommand)
+	app.Commands = append(app.Commands, fetchCommand)
+	app.Commands = append(app.Commands, historyCommand)
+	app.Commands = append(app.Commands, maintenanceCommand)
+	app.Commands = append(app.Commands, shellCommand)
 	app.Commands = append(app.Commands, clearCommand)
+	app.Commands = append(app.Commands, registryCommand)
 
 	err := app.Run(os.Args)
 	if err != nil {
@@ -666,6 +1344,42 @@ func main() {
 	}
 }
 
+// interruptContext create a context that is cancelled on the first interrupt (Ctrl-C) or TERM signal,
+// later signals are not caught anymore (so a second Ctrl-C kills the process)
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			fmt.Println("Interrupted, stopping the running operations (press Ctrl-C again to exit immediately)")
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+	return ctx, cancel
+}
+
+func splitCommaSeparated(value string) []string {
+	values := make([]string, 0)
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func optionalStringFlag(c *cli.Context, name string) *string {
+	if !c.IsSet(name) {
+		return nil
+	}
+	value := c.String(name)
+	return &value
+}
+
 func printTable(title string, headers []string, data [][]string, c *cli.Context) {
 	fmt.Println(title)
 	if len(data) > 0 {
@@ -684,6 +1398,28 @@ func printTable(title string, headers []string, data [][]string, c *cli.Context)
 	}
 }
 
+func printPlaybookResult(result ambari.PlaybookResult, c *cli.Context) {
+	var tableData [][]string
+	for _, taskResult := range append(result.Tasks, result.Verify...) {
+		failedHosts := make([]string, 0)
+		for _, hostResult := range taskResult.Hosts {
+			if len(hostResult.Error) > 0 || hostResult.Unreachable {
+				failedHosts = append(failedHosts, hostResult.Host)
+			}
+		}
+		duration := taskResult.EndTime.Sub(taskResult.StartTime).Round(time.Millisecond)
+		tableData = append(tableData, []string{taskResult.Name, taskResult.Type, taskResult.Status, duration.String(), strings.Join(failedHosts, ",")})
+	}
+	printTable("PLAYBOOK RESULT:", []string{"TASK", "TYPE", "STATUS", "DURATION", "FAILED HOSTS"}, tableData, c)
+}
+
+func splitFlagValues(value string) []string {
+	if len(value) == 0 {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
 func printJson(b []byte) {
 	fmt.Println(formatJson(b).String())
 }
@@ -698,9 +1434,11 @@ func formatJson(b []byte) *bytes.Buffer {
 	return &out
 }
 
-func validateActiveAmbari(ambariServer ambari.AmbariRegistry) {
-	if len(ambariServer.Name) == 0 {
-		fmt.Println("No active ambari server selected. (see 'use' command)")
+func getActiveAmbari() ambari.AmbariRegistry {
+	ambariServer, err := ambari.GetActiveAmbari()
+	if err != nil {
+		fmt.Println(err.Error() + ", select one with 'use' command")
 		os.Exit(1)
 	}
+	return ambariServer
 }